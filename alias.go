@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+)
+
+// aliasProvider 是把模型别名替换为实际模型名称的提供者
+type aliasProvider struct {
+	Provider
+	aliases map[string]string
+}
+
+// NewAliasProvider 返回一个支持模型别名的提供者，aliases 把别名映射到实际的模型名称，
+// 不在 aliases 中的模型名称保持不变
+func NewAliasProvider(provider Provider, aliases map[string]string) Provider {
+	copied := make(map[string]string, len(aliases))
+	for alias, model := range aliases {
+		copied[alias] = model
+	}
+	return &aliasProvider{Provider: provider, aliases: copied}
+}
+
+// resolve 返回别名对应的模型名称
+func (p *aliasProvider) resolve(modelID string) string {
+	if model, ok := p.aliases[modelID]; ok {
+		return model
+	}
+	return modelID
+}
+
+// GetModel 返回指定模型的信息
+func (p *aliasProvider) GetModel(ctx context.Context, modelID string) (ModelInfo, error) {
+	return p.Provider.GetModel(ctx, p.resolve(modelID))
+}
+
+// Complete 生成文本补全
+func (p *aliasProvider) Complete(ctx context.Context, modelID string, request CompletionRequest) (CompletionResponse, error) {
+	return p.Provider.Complete(ctx, p.resolve(modelID), request)
+}
+
+// Chat 执行聊天补全
+func (p *aliasProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	return p.Provider.Chat(ctx, p.resolve(modelID), request)
+}
+
+// ChatStream 流式执行聊天补全
+func (p *aliasProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	return wrappedChatStream(ctx, p.Provider, p.resolve(modelID), request, fn)
+}
+
+// Embed 生成文本的嵌入向量
+func (p *aliasProvider) Embed(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+	return p.Provider.Embed(ctx, p.resolve(modelID), request)
+}
+
+// EmbeddingModelInfo 转发给被包装的提供者
+func (p *aliasProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return wrappedEmbeddingModelInfo(ctx, p.Provider, p.resolve(modelID))
+}
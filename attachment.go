@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 定义附件处理错误
+var (
+	ErrUnsupportedAttachment = errors.New("unsupported attachment type")
+	ErrAttachmentTooLarge    = errors.New("attachment too large")
+)
+
+// defaultMaxAttachmentSize 默认的附件大小上限（20MB）
+const defaultMaxAttachmentSize = 20 << 20
+
+// AttachmentProcessor 将原始附件转换为模型可用的形式
+type AttachmentProcessor interface {
+	Process(ctx context.Context, attachment Attachment) (ProcessedAttachment, error)
+}
+
+// AttachmentProcessorFunc 是函数形式的 AttachmentProcessor
+type AttachmentProcessorFunc func(ctx context.Context, attachment Attachment) (ProcessedAttachment, error)
+
+// Process 实现 AttachmentProcessor 接口
+func (f AttachmentProcessorFunc) Process(ctx context.Context, attachment Attachment) (ProcessedAttachment, error) {
+	return f(ctx, attachment)
+}
+
+// AttachmentRegistry 按MIME类型分发附件处理器
+type AttachmentRegistry struct {
+	processors map[string]AttachmentProcessor
+	maxSize    int
+	mu         sync.RWMutex
+}
+
+// NewAttachmentRegistry 创建一个附件处理器注册表，并注册图像、文本和PDF的默认处理器
+func NewAttachmentRegistry() *AttachmentRegistry {
+	r := &AttachmentRegistry{
+		processors: make(map[string]AttachmentProcessor),
+		maxSize:    defaultMaxAttachmentSize,
+	}
+
+	images := NewImageProcessor(1024)
+	for _, mimeType := range []string{"image/png", "image/jpeg", "image/gif"} {
+		r.processors[mimeType] = images
+	}
+
+	text := TextProcessor{}
+	for _, mimeType := range []string{"text/plain", "text/markdown", "text/x-markdown", "text/csv"} {
+		r.processors[mimeType] = text
+	}
+
+	r.processors["application/pdf"] = PDFProcessor{}
+	return r
+}
+
+// Register 注册指定MIME类型的处理器，支持 "image/*" 形式的通配
+func (r *AttachmentRegistry) Register(mimeType string, processor AttachmentProcessor) error {
+	if processor == nil {
+		return fmt.Errorf("processor cannot be nil")
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return fmt.Errorf("invalid mime type %q: %w", mimeType, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processors[mediaType] = processor
+	return nil
+}
+
+// SetMaxSize 设置附件原始数据的大小上限（字节）
+func (r *AttachmentRegistry) SetMaxSize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size > 0 {
+		r.maxSize = size
+	} else {
+		r.maxSize = defaultMaxAttachmentSize // 保持默认值
+	}
+}
+
+// Process 处理单个附件
+func (r *AttachmentRegistry) Process(ctx context.Context, attachment Attachment) (ProcessedAttachment, error) {
+	r.mu.RLock()
+	maxSize := r.maxSize
+	r.mu.RUnlock()
+
+	if len(attachment.Data) > maxSize {
+		return ProcessedAttachment{}, fmt.Errorf("%w: %s is %d bytes, limit is %d",
+			ErrAttachmentTooLarge, attachment.FileName, len(attachment.Data), maxSize)
+	}
+
+	mediaType := detectMimeType(attachment)
+	processor, err := r.lookup(mediaType)
+	if err != nil {
+		return ProcessedAttachment{}, err
+	}
+
+	attachment.MimeType = mediaType
+	processed, err := processor.Process(ctx, attachment)
+	if err != nil {
+		return ProcessedAttachment{}, fmt.Errorf("failed to process attachment %s: %w", attachment.FileName, err)
+	}
+	if processed.SourceName == "" {
+		processed.SourceName = attachment.FileName
+	}
+	return processed, nil
+}
+
+// ProcessAll 按顺序处理多个附件，遇到错误立即返回
+func (r *AttachmentRegistry) ProcessAll(ctx context.Context, attachments []Attachment) ([]ProcessedAttachment, error) {
+	results := make([]ProcessedAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		processed, err := r.Process(ctx, attachment)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, processed)
+	}
+	return results, nil
+}
+
+// lookup 查找处理器，先精确匹配，再匹配 "type/*"
+func (r *AttachmentRegistry) lookup(mediaType string) (AttachmentProcessor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if processor, exists := r.processors[mediaType]; exists {
+		return processor, nil
+	}
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if processor, exists := r.processors[mediaType[:i]+"/*"]; exists {
+			return processor, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAttachment, mediaType)
+}
+
+// detectMimeType 确定附件的MIME类型：优先使用声明的类型，其次是文件扩展名，最后根据内容探测
+func detectMimeType(attachment Attachment) string {
+	if attachment.MimeType != "" {
+		if mediaType, _, err := mime.ParseMediaType(attachment.MimeType); err == nil {
+			return mediaType
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(attachment.FileName)) {
+	case ".md", ".markdown":
+		return "text/markdown"
+	case ".csv":
+		return "text/csv"
+	case ".txt":
+		return "text/plain"
+	case "":
+	default:
+		if mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(attachment.FileName))); err == nil {
+			return mediaType
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(attachment.Data))
+	return mediaType
+}
@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	"image/png"
+	"unicode/utf8"
+)
+
+// TextProcessor 将文本类附件（纯文本、Markdown、CSV）内联为文本
+type TextProcessor struct{}
+
+// Process 实现 AttachmentProcessor 接口
+func (TextProcessor) Process(ctx context.Context, attachment Attachment) (ProcessedAttachment, error) {
+	data := bytes.TrimPrefix(attachment.Data, []byte("\xef\xbb\xbf")) // 去掉UTF-8 BOM
+	if !utf8.Valid(data) {
+		return ProcessedAttachment{}, fmt.Errorf("text attachment is not valid UTF-8")
+	}
+
+	return ProcessedAttachment{
+		Type:       AttachmentTypeText,
+		Data:       string(data),
+		SourceName: attachment.FileName,
+	}, nil
+}
+
+// defaultMaxImagePixels 是默认允许解码的最大像素数，解码后约占 160MB 内存
+const defaultMaxImagePixels = 40_000_000
+
+// ImageProcessor 将图像缩放到最大边长以内并重新编码为base64，供视觉模型使用
+type ImageProcessor struct {
+	maxDimension int
+	maxPixels    int
+	jpegQuality  int
+}
+
+// NewImageProcessor 创建一个图像处理器，maxDimension<=0 表示不缩放
+func NewImageProcessor(maxDimension int) *ImageProcessor {
+	return &ImageProcessor{
+		maxDimension: maxDimension,
+		maxPixels:    defaultMaxImagePixels,
+		jpegQuality:  85,
+	}
+}
+
+// SetMaxPixels 设置允许解码的最大像素数（宽×高），防止很小的文件声明巨大的尺寸耗尽内存
+func (p *ImageProcessor) SetMaxPixels(pixels int) {
+	if pixels > 0 {
+		p.maxPixels = pixels
+	}
+}
+
+// Process 实现 AttachmentProcessor 接口
+// 不透明图像编码为JPEG，带透明通道的图像编码为PNG
+func (p *ImageProcessor) Process(ctx context.Context, attachment Attachment) (ProcessedAttachment, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(attachment.Data))
+	if err != nil {
+		return ProcessedAttachment{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > int64(p.maxPixels) {
+		return ProcessedAttachment{}, fmt.Errorf("%w: image %s is %dx%d, exceeds %d pixels",
+			ErrAttachmentTooLarge, attachment.FileName, config.Width, config.Height, p.maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(attachment.Data))
+	if err != nil {
+		return ProcessedAttachment{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	img = resizeImage(img, p.maxDimension)
+
+	var buf bytes.Buffer
+	if isOpaque(img) {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return ProcessedAttachment{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	return ProcessedAttachment{
+		Type:       AttachmentTypeImage,
+		Data:       base64.StdEncoding.EncodeToString(buf.Bytes()),
+		SourceName: attachment.FileName,
+	}, nil
+}
+
+// resizeImage 按比例缩小图像，使最长边不超过 maxDimension
+// 使用区域平均采样，缩小时比最近邻插值更平滑
+func resizeImage(src image.Image, maxDimension int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return src
+	}
+
+	dstWidth, dstHeight := maxDimension, maxDimension
+	if width > height {
+		dstHeight = max(1, height*maxDimension/width)
+	} else {
+		dstWidth = max(1, width*maxDimension/height)
+	}
+
+	// 先转换为NRGBA以便快速访问像素
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := y * height / dstHeight
+		y1 := max(y0+1, (y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := x * width / dstWidth
+			x1 := max(x0+1, (x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := nrgba.Pix[sy*nrgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += uint32(pixel[0])
+					g += uint32(pixel[1])
+					b += uint32(pixel[2])
+					a += uint32(pixel[3])
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// isOpaque 判断图像是否完全不透明
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// PDFProcessor 提取PDF中的文本
+type PDFProcessor struct{}
+
+// Process 实现 AttachmentProcessor 接口
+func (PDFProcessor) Process(ctx context.Context, attachment Attachment) (ProcessedAttachment, error) {
+	text, err := ExtractPDFText(attachment.Data)
+	if err != nil {
+		return ProcessedAttachment{}, err
+	}
+
+	return ProcessedAttachment{
+		Type:       AttachmentTypeText,
+		Data:       text,
+		SourceName: attachment.FileName,
+	}, nil
+}
@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// buildPDF 构造一个只包含单个内容流的最小PDF
+func buildPDF(content string, compress bool) []byte {
+	stream := []byte(content)
+	dict := fmt.Sprintf("/Length %d", len(stream))
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(stream)
+		w.Close()
+		stream = buf.Bytes()
+		dict = fmt.Sprintf("/Length %d /Filter /FlateDecode", len(stream))
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&pdf, "2 0 obj\n<< %s >>\nstream\n", dict)
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj T* [(Wor) -20 (ld) -500 (again)] TJ ET\n" +
+		"BT 72 600 Td <48657821> Tj (next) ' ET"
+
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			got, err := ExtractPDFText(buildPDF(content, compress))
+			if err != nil {
+				t.Fatalf("ExtractPDFText() error = %v", err)
+			}
+			want := "Hello (PDF)\nWorld again\nHex!\nnext"
+			if got != want {
+				t.Errorf("ExtractPDFText() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := ExtractPDFText([]byte("not a pdf")); err == nil {
+		t.Error("ExtractPDFText() on non-PDF expected error, got nil")
+	}
+	if _, err := ExtractPDFText(buildPDF("q 1 0 0 1 0 0 cm Q", false)); err == nil {
+		t.Error("ExtractPDFText() without text expected error, got nil")
+	}
+	// WinAnsi 编码的 "été" 不是有效的 UTF-8
+	if _, err := ExtractPDFText(buildPDF("BT (\\351t\\351) Tj ET", false)); err == nil {
+		t.Error("ExtractPDFText() with WinAnsi bytes expected error, got nil")
+	}
+	// 只有 64KB 的压缩流解压后超过上限
+	bomb := "BT (" + strings.Repeat("a", maxInflatedPDFSize) + ") Tj ET"
+	if _, err := ExtractPDFText(buildPDF(bomb, true)); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("ExtractPDFText() on oversized stream error = %v, want ErrAttachmentTooLarge", err)
+	}
+}
+
+func TestAttachmentRegistry(t *testing.T) {
+	registry := NewAttachmentRegistry()
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		attachment Attachment
+		wantType   string
+		wantData   string
+		wantErr    error
+	}{
+		{
+			name:       "markdown by extension",
+			attachment: Attachment{Data: []byte("# Title"), FileName: "README.md"},
+			wantType:   AttachmentTypeText,
+			wantData:   "# Title",
+		},
+		{
+			name:       "csv with charset parameter",
+			attachment: Attachment{Data: []byte("\xef\xbb\xbfa,b\n1,2"), MimeType: "text/csv; charset=utf-8", FileName: "data.csv"},
+			wantType:   AttachmentTypeText,
+			wantData:   "a,b\n1,2",
+		},
+		{
+			name:       "pdf",
+			attachment: Attachment{Data: buildPDF("BT (report) Tj ET", true), FileName: "report.pdf"},
+			wantType:   AttachmentTypeText,
+			wantData:   "report",
+		},
+		{
+			name:       "unsupported",
+			attachment: Attachment{Data: []byte{0, 1}, MimeType: "audio/wav", FileName: "a.wav"},
+			wantErr:    ErrUnsupportedAttachment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.Process(ctx, tt.attachment)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Process() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if got.Type != tt.wantType || got.Data != tt.wantData || got.SourceName != tt.attachment.FileName {
+				t.Errorf("Process() = %+v, want type %q data %q", got, tt.wantType, tt.wantData)
+			}
+		})
+	}
+
+	registry.SetMaxSize(4)
+	if _, err := registry.Process(ctx, Attachment{Data: []byte("too long"), FileName: "a.txt"}); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("Process() over size limit error = %v, want ErrAttachmentTooLarge", err)
+	}
+	registry.SetMaxSize(0)
+
+	if err := registry.Register("audio/*", AttachmentProcessorFunc(func(ctx context.Context, a Attachment) (ProcessedAttachment, error) {
+		return ProcessedAttachment{Type: "audio", Data: a.MimeType}, nil
+	})); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	got, err := registry.Process(ctx, Attachment{Data: []byte{0, 1}, MimeType: "audio/wav", FileName: "a.wav"})
+	if err != nil || got.Type != "audio" || got.Data != "audio/wav" {
+		t.Errorf("Process() with wildcard processor = %+v, %v", got, err)
+	}
+}
+
+func TestImageProcessor(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	processed, err := NewAttachmentRegistry().Process(context.Background(), Attachment{Data: buf.Bytes(), FileName: "photo.png"})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if processed.Type != AttachmentTypeImage {
+		t.Fatalf("Process() type = %q, want %q", processed.Type, AttachmentTypeImage)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(processed.Data.(string))
+	if err != nil {
+		t.Fatalf("image data is not base64: %v", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	// 不透明图像不超过默认上限，保持原尺寸并重新编码为JPEG
+	if config.Width != 200 || config.Height != 100 || format != "jpeg" {
+		t.Errorf("processed image = %dx%d %s, want 200x100 jpeg", config.Width, config.Height, format)
+	}
+
+	// 只读取文件头的尺寸，超过像素上限时不解码
+	processor := NewImageProcessor(0)
+	processor.SetMaxPixels(100 * 100)
+	if _, err := processor.Process(context.Background(), Attachment{Data: buf.Bytes(), FileName: "photo.png"}); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("Process() over pixel limit error = %v, want ErrAttachmentTooLarge", err)
+	}
+
+	resized := resizeImage(src, 50)
+	if b := resized.Bounds(); b.Dx() != 50 || b.Dy() != 25 {
+		t.Errorf("resizeImage() = %dx%d, want 50x25", b.Dx(), b.Dy())
+	}
+	// 每个目标像素是4x4源像素的平均值
+	if got, want := resized.At(1, 0), (color.NRGBA{R: 5, G: 1, B: 0, A: 255}); got != want {
+		t.Errorf("resizeImage() pixel = %v, want %v", got, want)
+	}
+}
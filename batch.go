@@ -0,0 +1,885 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 定义批处理错误
+var (
+	ErrBatchNotFound = errors.New("batch job not found")
+	ErrBatchFinished = errors.New("batch job already finished")
+	ErrBatchCanceled = errors.New("batch job canceled")
+)
+
+// errBatchShutdown 是批处理管理器关闭时中断任务的原因，任务保持运行状态以便之后恢复
+var errBatchShutdown = errors.New("batch manager shut down")
+
+// BatchStatus 表示批处理任务的状态
+type BatchStatus string
+
+const (
+	BatchPending   BatchStatus = "pending"
+	BatchRunning   BatchStatus = "running"
+	BatchCompleted BatchStatus = "completed"
+	BatchFailed    BatchStatus = "failed"
+	BatchCanceled  BatchStatus = "canceled"
+)
+
+// Done 判断任务是否已结束
+func (s BatchStatus) Done() bool {
+	return s == BatchCompleted || s == BatchFailed || s == BatchCanceled
+}
+
+// BatchItem 是批处理中的一个请求，Chat、Completion 和 Embedding 必须且只能设置一个
+type BatchItem struct {
+	ID         string             `json:"id,omitempty"` // 调用方自定义的ID，原样写入结果
+	Chat       *ChatRequest       `json:"chat,omitempty"`
+	Completion *CompletionRequest `json:"completion,omitempty"`
+	Embedding  *EmbeddingRequest  `json:"embedding,omitempty"`
+}
+
+// BatchRequest 是提交批处理任务的请求
+type BatchRequest struct {
+	Provider    string      `json:"provider"` // 为空时 Model 是 Service 的路由名
+	Model       string      `json:"model"`
+	Items       []BatchItem `json:"items"`
+	Concurrency int         `json:"concurrency,omitempty"` // 为0时使用管理器的默认并发数
+}
+
+// BatchJob 是批处理任务的状态和进度
+type BatchJob struct {
+	ID          string      `json:"id"`
+	Provider    string      `json:"provider"`
+	Model       string      `json:"model"`
+	Concurrency int         `json:"concurrency"`
+	Status      BatchStatus `json:"status"`
+	Total       int         `json:"total"`
+	Succeeded   int         `json:"succeeded"`
+	Failed      int         `json:"failed"`
+	Error       string      `json:"error,omitempty"` // 任务整体失败的原因，单个请求的错误记录在结果中
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// Processed 返回已处理的请求数
+func (j BatchJob) Processed() int {
+	return j.Succeeded + j.Failed
+}
+
+// Progress 返回任务进度，取值范围 0-1
+func (j BatchJob) Progress() float64 {
+	if j.Total == 0 {
+		return 1
+	}
+	return float64(j.Processed()) / float64(j.Total)
+}
+
+// BatchResult 是批处理中一个请求的结果
+type BatchResult struct {
+	Index      int                 `json:"index"`
+	ID         string              `json:"id,omitempty"`
+	Chat       *ChatResponse       `json:"chat,omitempty"`
+	Completion *CompletionResponse `json:"completion,omitempty"`
+	Embedding  *EmbeddingResponse  `json:"embedding,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	Retryable  bool                `json:"retryable,omitempty"` // 失败原因是限流、服务不可用等临时错误，Resume 时重新执行
+}
+
+// latestResults 返回每个请求最后一次的结果，按请求顺序排列
+func latestResults(results []BatchResult) []BatchResult {
+	latest := make(map[int]int, len(results))
+	var deduped []BatchResult
+	for _, result := range results {
+		if i, ok := latest[result.Index]; ok {
+			deduped[i] = result
+			continue
+		}
+		latest[result.Index] = len(deduped)
+		deduped = append(deduped, result)
+	}
+	sort.SliceStable(deduped, func(i, j int) bool { return deduped[i].Index < deduped[j].Index })
+	return deduped
+}
+
+// BatchStore 表示批处理任务的存储
+type BatchStore interface {
+	// 保存新任务及其请求
+	Create(ctx context.Context, job BatchJob, items []BatchItem) error
+
+	// 更新任务状态
+	Update(ctx context.Context, job BatchJob) error
+
+	// 加载任务，不存在时返回 ErrBatchNotFound
+	Job(ctx context.Context, id string) (BatchJob, error)
+
+	// 列出所有任务
+	Jobs(ctx context.Context) ([]BatchJob, error)
+
+	// 加载任务的请求
+	Items(ctx context.Context, id string) ([]BatchItem, error)
+
+	// 追加一条结果
+	AppendResult(ctx context.Context, id string, result BatchResult) error
+
+	// 加载任务已有的结果
+	Results(ctx context.Context, id string) ([]BatchResult, error)
+}
+
+// BatchConfig 是批处理管理器的配置
+type BatchConfig struct {
+	Concurrency    int           // 任务默认的并发请求数，默认4
+	UpdateInterval time.Duration // 运行中的任务进度写入存储的最短间隔，默认1秒
+}
+
+// batchRun 是一个正在执行的任务
+type batchRun struct {
+	job       BatchJob
+	cancel    context.CancelCauseFunc
+	done      chan struct{}
+	saved     time.Time
+	persistMu sync.Mutex
+}
+
+// BatchManager 管理异步批处理任务：提交后在后台通过 Service 执行，结果逐条写入存储，
+// 进程崩溃或关闭后可以通过 Resume 从存储中恢复未完成的任务，已完成的请求不会重复执行
+type BatchManager struct {
+	service Service
+	store   BatchStore
+	config  BatchConfig
+	runs    map[string]*batchRun
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewBatchManager 创建一个新的批处理管理器，store 为空时使用内存存储
+func NewBatchManager(service Service, store BatchStore, config BatchConfig) *BatchManager {
+	if store == nil {
+		store = NewMemoryBatchStore()
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	if config.UpdateInterval <= 0 {
+		config.UpdateInterval = time.Second
+	}
+	return &BatchManager{
+		service: service,
+		store:   store,
+		config:  config,
+		runs:    make(map[string]*batchRun),
+	}
+}
+
+// newBatchID 生成一个随机的任务ID
+func newBatchID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "batch_" + hex.EncodeToString(b)
+}
+
+// Submit 提交一个批处理任务并立即返回，任务在后台执行
+func (m *BatchManager) Submit(ctx context.Context, request BatchRequest) (BatchJob, error) {
+	if request.Model == "" {
+		return BatchJob{}, fmt.Errorf("%w: batch model is required", ErrInvalidRequest)
+	}
+	if request.Provider == "" {
+		// 提供者为空时模型是路由名
+		if _, _, err := m.service.ResolveRoute(request.Model, RouteRequest{}); err != nil {
+			return BatchJob{}, err
+		}
+	} else if _, err := m.service.GetProvider(request.Provider); err != nil {
+		return BatchJob{}, err
+	}
+	if len(request.Items) == 0 {
+		return BatchJob{}, fmt.Errorf("%w: batch has no items", ErrInvalidRequest)
+	}
+	for i, item := range request.Items {
+		set := 0
+		for _, ok := range []bool{item.Chat != nil, item.Completion != nil, item.Embedding != nil} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return BatchJob{}, fmt.Errorf("%w: batch item %d must set exactly one of chat, completion or embedding", ErrInvalidRequest, i)
+		}
+	}
+
+	concurrency := request.Concurrency
+	if concurrency <= 0 {
+		concurrency = m.config.Concurrency
+	}
+	now := time.Now()
+	job := BatchJob{
+		ID:          newBatchID(),
+		Provider:    request.Provider,
+		Model:       request.Model,
+		Concurrency: concurrency,
+		Status:      BatchPending,
+		Total:       len(request.Items),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := m.store.Create(ctx, job, request.Items); err != nil {
+		return BatchJob{}, fmt.Errorf("failed to save batch job: %w", err)
+	}
+
+	m.start(job, request.Items, nil)
+	return job, nil
+}
+
+// Resume 恢复存储中所有未结束且未在执行的任务，返回恢复的任务ID
+func (m *BatchManager) Resume(ctx context.Context) ([]string, error) {
+	jobs, err := m.store.Jobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batch jobs: %w", err)
+	}
+
+	var resumed []string
+	for _, job := range jobs {
+		if job.Status.Done() {
+			continue
+		}
+		items, err := m.store.Items(ctx, job.ID)
+		if err != nil {
+			return resumed, fmt.Errorf("failed to load batch %s: %w", job.ID, err)
+		}
+		results, err := m.store.Results(ctx, job.ID)
+		if err != nil {
+			return resumed, fmt.Errorf("failed to load batch %s results: %w", job.ID, err)
+		}
+
+		finished := make(map[int]bool, len(results))
+		job.Succeeded, job.Failed = 0, 0
+		for _, result := range latestResults(results) {
+			if result.Retryable {
+				continue // 临时错误导致的失败重新执行
+			}
+			finished[result.Index] = true
+			if result.Error != "" {
+				job.Failed++
+			} else {
+				job.Succeeded++
+			}
+		}
+		if !m.start(job, items, finished) {
+			continue // 已在执行，例如被并发的 Resume 启动
+		}
+		resumed = append(resumed, job.ID)
+	}
+	return resumed, nil
+}
+
+// start 在后台执行任务中尚未完成的请求，任务已在执行时返回 false
+// 检查和登记在同一个临界区内完成，同一个任务不会被启动两次
+func (m *BatchManager) start(job BatchJob, items []BatchItem, finished map[int]bool) bool {
+	m.mu.Lock()
+	if _, ok := m.runs[job.ID]; ok {
+		m.mu.Unlock()
+		return false
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	run := &batchRun{job: job, cancel: cancel, done: make(chan struct{})}
+	m.runs[job.ID] = run
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(run.done)
+		defer cancel(nil)
+		m.run(ctx, run, items, finished)
+	}()
+	return true
+}
+
+// run 用固定数量的工作goroutine执行任务，每个结果写入存储后才计入进度
+func (m *BatchManager) run(ctx context.Context, run *batchRun, items []BatchItem, finished map[int]bool) {
+	m.mu.Lock()
+	run.job.Status = BatchRunning
+	job := run.job
+	m.mu.Unlock()
+	if err := m.persist(run, true); err != nil {
+		run.cancel(err)
+	}
+
+	pending := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < job.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range pending {
+				result := m.execute(ctx, job, index, items[index])
+				if ctx.Err() != nil {
+					// 被取消或中断的请求不记录结果，恢复时重新执行
+					continue
+				}
+				if err := m.store.AppendResult(ctx, job.ID, result); err != nil {
+					run.cancel(fmt.Errorf("failed to save batch result: %w", err))
+					continue
+				}
+
+				m.mu.Lock()
+				if result.Error != "" {
+					run.job.Failed++
+				} else {
+					run.job.Succeeded++
+				}
+				m.mu.Unlock()
+				if err := m.persist(run, false); err != nil {
+					run.cancel(err)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for index := range items {
+		if finished[index] {
+			continue
+		}
+		select {
+		case pending <- index:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	cause := context.Cause(ctx)
+	m.mu.Lock()
+	switch {
+	case cause == nil:
+		run.job.Status = BatchCompleted
+	case errors.Is(cause, ErrBatchCanceled):
+		run.job.Status = BatchCanceled
+	case errors.Is(cause, errBatchShutdown):
+		// 保持运行状态，之后通过 Resume 继续
+	default:
+		run.job.Status = BatchFailed
+		run.job.Error = cause.Error()
+	}
+	m.mu.Unlock()
+	_ = m.persist(run, true)
+
+	m.mu.Lock()
+	delete(m.runs, job.ID)
+	m.mu.Unlock()
+}
+
+// execute 执行一个请求，请求失败时把错误记录在结果中
+func (m *BatchManager) execute(ctx context.Context, job BatchJob, index int, item BatchItem) BatchResult {
+	result := BatchResult{Index: index, ID: item.ID}
+	var err error
+	switch {
+	case item.Chat != nil:
+		var response ChatResponse
+		if response, err = m.service.Chat(ctx, job.Provider, job.Model, *item.Chat); err == nil {
+			result.Chat = &response
+		}
+	case item.Completion != nil:
+		var response CompletionResponse
+		if response, err = m.service.Complete(ctx, job.Provider, job.Model, *item.Completion); err == nil {
+			result.Completion = &response
+		}
+	case item.Embedding != nil:
+		var response EmbeddingResponse
+		if response, err = m.service.Embed(ctx, job.Provider, job.Model, *item.Embedding); err == nil {
+			result.Embedding = &response
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Retryable = IsOverloadError(err)
+	}
+	return result
+}
+
+// persist 把任务状态写入存储，force 为 false 时距离上次写入不足 UpdateInterval 则跳过
+func (m *BatchManager) persist(run *batchRun, force bool) error {
+	run.persistMu.Lock()
+	defer run.persistMu.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(run.saved) < m.config.UpdateInterval {
+		return nil
+	}
+	m.mu.Lock()
+	run.job.UpdatedAt = now
+	job := run.job
+	m.mu.Unlock()
+
+	if err := m.store.Update(context.Background(), job); err != nil {
+		return fmt.Errorf("failed to save batch job: %w", err)
+	}
+	run.saved = now
+	return nil
+}
+
+// Status 返回任务的状态和进度
+func (m *BatchManager) Status(ctx context.Context, id string) (BatchJob, error) {
+	m.mu.Lock()
+	if run, ok := m.runs[id]; ok {
+		job := run.job
+		m.mu.Unlock()
+		return job, nil
+	}
+	m.mu.Unlock()
+	return m.store.Job(ctx, id)
+}
+
+// Jobs 列出所有任务
+func (m *BatchManager) Jobs(ctx context.Context) ([]BatchJob, error) {
+	jobs, err := m.store.Jobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	for i, job := range jobs {
+		if run, ok := m.runs[job.ID]; ok {
+			jobs[i] = run.job
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// Cancel 取消任务，已完成的请求结果会保留
+func (m *BatchManager) Cancel(ctx context.Context, id string) error {
+	m.mu.Lock()
+	run, ok := m.runs[id]
+	m.mu.Unlock()
+	if ok {
+		run.cancel(ErrBatchCanceled)
+		<-run.done
+		return nil
+	}
+
+	job, err := m.store.Job(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.Status.Done() {
+		return fmt.Errorf("%w: %s is %s", ErrBatchFinished, id, job.Status)
+	}
+	// 中断后尚未恢复的任务
+	job.Status = BatchCanceled
+	job.UpdatedAt = time.Now()
+	return m.store.Update(ctx, job)
+}
+
+// Wait 等待任务结束或被中断，返回任务的最终状态
+func (m *BatchManager) Wait(ctx context.Context, id string) (BatchJob, error) {
+	m.mu.Lock()
+	run, ok := m.runs[id]
+	m.mu.Unlock()
+	if ok {
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return BatchJob{}, ctx.Err()
+		}
+	}
+	return m.store.Job(ctx, id)
+}
+
+// Results 返回任务已有的结果，按请求顺序排列，恢复后重新执行过的请求只返回最后一次的结果
+func (m *BatchManager) Results(ctx context.Context, id string) ([]BatchResult, error) {
+	if _, err := m.Status(ctx, id); err != nil {
+		return nil, err
+	}
+	results, err := m.store.Results(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return latestResults(results), nil
+}
+
+// WriteResults 将任务已有的结果以 JSONL 格式写入 w，每行一个 BatchResult
+func (m *BatchManager) WriteResults(ctx context.Context, id string, w io.Writer) error {
+	results, err := m.Results(ctx, id)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to write batch result: %w", err)
+		}
+	}
+	return nil
+}
+
+// Shutdown 中断所有正在执行的任务并等待它们退出，任务保持运行状态，可以通过 Resume 继续
+func (m *BatchManager) Shutdown() {
+	m.mu.Lock()
+	for _, run := range m.runs {
+		run.cancel(errBatchShutdown)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// MemoryBatchStore 是基于内存的批处理任务存储
+type MemoryBatchStore struct {
+	jobs    map[string]BatchJob
+	items   map[string][]BatchItem
+	results map[string][]BatchResult
+	mu      sync.Mutex
+}
+
+// NewMemoryBatchStore 创建一个新的内存批处理任务存储
+func NewMemoryBatchStore() *MemoryBatchStore {
+	return &MemoryBatchStore{
+		jobs:    make(map[string]BatchJob),
+		items:   make(map[string][]BatchItem),
+		results: make(map[string][]BatchResult),
+	}
+}
+
+// Create 保存新任务及其请求
+func (s *MemoryBatchStore) Create(ctx context.Context, job BatchJob, items []BatchItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	s.items[job.ID] = append([]BatchItem(nil), items...)
+	return nil
+}
+
+// Update 更新任务状态
+func (s *MemoryBatchStore) Update(ctx context.Context, job BatchJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		return fmt.Errorf("%w: %s", ErrBatchNotFound, job.ID)
+	}
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// Job 加载任务
+func (s *MemoryBatchStore) Job(ctx context.Context, id string) (BatchJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return BatchJob{}, fmt.Errorf("%w: %s", ErrBatchNotFound, id)
+	}
+	return job, nil
+}
+
+// Jobs 列出所有任务
+func (s *MemoryBatchStore) Jobs(ctx context.Context) ([]BatchJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]BatchJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Items 加载任务的请求
+func (s *MemoryBatchStore) Items(ctx context.Context, id string) ([]BatchItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items, ok := s.items[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBatchNotFound, id)
+	}
+	return append([]BatchItem(nil), items...), nil
+}
+
+// AppendResult 追加一条结果
+func (s *MemoryBatchStore) AppendResult(ctx context.Context, id string, result BatchResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[id] = append(s.results[id], result)
+	return nil
+}
+
+// Results 加载任务已有的结果
+func (s *MemoryBatchStore) Results(ctx context.Context, id string) ([]BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]BatchResult(nil), s.results[id]...), nil
+}
+
+// FileBatchStore 是基于本地目录的批处理任务存储
+// 每个任务一个子目录，包含 job.json（状态）、items.json（请求）和 results.jsonl（逐条追加的结果）
+type FileBatchStore struct {
+	dir      string
+	repaired map[string]bool // 已检查过结果文件末尾的任务
+	mu       sync.Mutex
+}
+
+// NewFileBatchStore 创建一个新的文件批处理任务存储
+func NewFileBatchStore(dir string) (*FileBatchStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create batch directory: %w", err)
+	}
+	return &FileBatchStore{dir: dir, repaired: make(map[string]bool)}, nil
+}
+
+// path 返回任务目录下文件的路径
+// id 会被校验，不能指向任务目录之外的位置
+func (s *FileBatchStore) path(id, name string) (string, error) {
+	if !validFileID(id) {
+		return "", fmt.Errorf("invalid batch id %q", id)
+	}
+	return filepath.Join(s.dir, id, name), nil
+}
+
+// writeJSON 先写入临时文件并同步到磁盘再重命名，保证崩溃后文件是完整的旧版本或新版本
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Create 保存新任务及其请求
+func (s *FileBatchStore) Create(ctx context.Context, job BatchJob, items []BatchItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	itemsPath, err := s.path(job.ID, "items.json")
+	if err != nil {
+		return err
+	}
+	jobPath, _ := s.path(job.ID, "job.json")
+	if err := os.MkdirAll(filepath.Dir(jobPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create batch directory: %w", err)
+	}
+	if err := writeJSON(itemsPath, items); err != nil {
+		return fmt.Errorf("failed to write batch items: %w", err)
+	}
+	if err := writeJSON(jobPath, job); err != nil {
+		return fmt.Errorf("failed to write batch job: %w", err)
+	}
+	return nil
+}
+
+// Update 更新任务状态
+func (s *FileBatchStore) Update(ctx context.Context, job BatchJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(job.ID, "job.json")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%w: %s", ErrBatchNotFound, job.ID)
+	}
+	if err := writeJSON(path, job); err != nil {
+		return fmt.Errorf("failed to write batch job: %w", err)
+	}
+	return nil
+}
+
+// Job 加载任务
+func (s *FileBatchStore) Job(ctx context.Context, id string) (BatchJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readJob(id)
+}
+
+// readJob 读取任务文件，调用方需持有锁
+func (s *FileBatchStore) readJob(id string) (BatchJob, error) {
+	path, err := s.path(id, "job.json")
+	if err != nil {
+		return BatchJob{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return BatchJob{}, fmt.Errorf("%w: %s", ErrBatchNotFound, id)
+	}
+	if err != nil {
+		return BatchJob{}, fmt.Errorf("failed to read batch job: %w", err)
+	}
+	var job BatchJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return BatchJob{}, fmt.Errorf("failed to decode batch job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// Jobs 列出所有任务
+func (s *FileBatchStore) Jobs(ctx context.Context) ([]BatchJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch directory: %w", err)
+	}
+	var jobs []BatchJob
+	for _, entry := range entries {
+		if !entry.IsDir() || !validFileID(entry.Name()) {
+			continue
+		}
+		job, err := s.readJob(entry.Name())
+		if errors.Is(err, ErrBatchNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Items 加载任务的请求
+func (s *FileBatchStore) Items(ctx context.Context, id string) ([]BatchItem, error) {
+	path, err := s.path(id, "items.json")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBatchNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch items: %w", err)
+	}
+	var items []BatchItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode batch items: %w", err)
+	}
+	return items, nil
+}
+
+// AppendResult 追加一条结果，返回前同步到磁盘
+func (s *FileBatchStore) AppendResult(ctx context.Context, id string, result BatchResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch result: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id, "results.jsonl")
+	if err != nil {
+		return err
+	}
+	if !s.repaired[id] {
+		if err := truncatePartialLine(path); err != nil {
+			return fmt.Errorf("failed to repair batch results: %w", err)
+		}
+		s.repaired[id] = true
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open batch results: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write batch result: %w", err)
+	}
+	// 结果写入磁盘后才计入进度，否则崩溃后 Resume 会跳过丢失的结果
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write batch result: %w", err)
+	}
+	return f.Close()
+}
+
+// truncatePartialLine 截掉文件末尾崩溃时写了一半的行，避免之后追加的结果与它拼在一起
+func truncatePartialLine(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	buf := make([]byte, 64*1024)
+	for offset := end; offset > 0; {
+		n := min(int64(len(buf)), offset)
+		offset -= n
+		if _, err := f.ReadAt(buf[:n], offset); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if size := offset + int64(i) + 1; size < end {
+				return f.Truncate(size)
+			}
+			return nil
+		}
+	}
+	return f.Truncate(0)
+}
+
+// Results 加载任务已有的结果，崩溃时写了一半的最后一行会被忽略
+func (s *FileBatchStore) Results(ctx context.Context, id string) ([]BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id, "results.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch results: %w", err)
+	}
+	defer f.Close()
+
+	var results []BatchResult
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var result BatchResult
+			if decodeErr := json.Unmarshal(data, &result); decodeErr != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("failed to decode batch result on line %d: %w", line, decodeErr)
+			}
+			results = append(results, result)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch results: %w", err)
+		}
+	}
+	return results, nil
+}
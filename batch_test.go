@@ -0,0 +1,431 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBatchService 返回一个注册了 test-provider 的服务，embed 模拟嵌入后端
+func newBatchService(embed func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error)) Service {
+	svc := NewService()
+	_ = svc.RegisterProvider(&mockProvider{
+		name:      "test-provider",
+		embedFunc: embed,
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			return ChatResponse{Message: Message{Role: "assistant", Content: "re: " + request.Messages[0].Content}}, nil
+		},
+	})
+	return svc
+}
+
+// embeddingItems 返回 n 个嵌入请求
+func embeddingItems(inputs ...string) []BatchItem {
+	items := make([]BatchItem, len(inputs))
+	for i, input := range inputs {
+		items[i] = BatchItem{ID: input, Embedding: &EmbeddingRequest{Input: input}}
+	}
+	return items
+}
+
+func TestBatchManagerRun(t *testing.T) {
+	svc := newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		if request.Input == "bad" {
+			return EmbeddingResponse{}, ErrInvalidRequest
+		}
+		return EmbeddingResponse{Embedding: []float64{float64(len(request.Input))}}, nil
+	})
+	manager := NewBatchManager(svc, nil, BatchConfig{Concurrency: 3})
+	ctx := context.Background()
+
+	items := append(embeddingItems("a", "bb", "bad", "dddd"),
+		BatchItem{ID: "chat", Chat: &ChatRequest{Messages: []Message{{Role: "user", Content: "hello"}}}},
+		BatchItem{ID: "complete", Completion: &CompletionRequest{Prompt: "hi"}},
+	)
+	job, err := manager.Submit(ctx, BatchRequest{Provider: "test-provider", Model: "m", Items: items})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job.ID == "" || job.Total != len(items) {
+		t.Fatalf("Submit() = %+v, want an ID and %d items", job, len(items))
+	}
+
+	job, err = manager.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if job.Status != BatchCompleted || job.Succeeded != 5 || job.Failed != 1 || job.Progress() != 1 {
+		t.Errorf("Wait() = %+v, want completed with 5 succeeded and 1 failed", job)
+	}
+
+	var buf bytes.Buffer
+	if err := manager.WriteResults(ctx, job.ID, &buf); err != nil {
+		t.Fatalf("WriteResults() error = %v", err)
+	}
+	var results []BatchResult
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var result BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("WriteResults() wrote %d lines, want %d", len(results), len(items))
+	}
+	for i, result := range results {
+		if result.Index != i || result.ID != items[i].ID {
+			t.Errorf("result %d = index %d id %q, want results in submission order", i, result.Index, result.ID)
+		}
+	}
+	if results[1].Embedding == nil || results[1].Embedding.Embedding[0] != 2 {
+		t.Errorf("results[1] = %+v, want the embedding of \"bb\"", results[1])
+	}
+	if results[2].Error == "" || results[2].Embedding != nil {
+		t.Errorf("results[2] = %+v, want an error", results[2])
+	}
+	if results[4].Chat == nil || results[4].Chat.Message.Content != "re: hello" {
+		t.Errorf("results[4] = %+v, want the chat reply", results[4])
+	}
+	if results[5].Completion == nil {
+		t.Errorf("results[5] = %+v, want a completion", results[5])
+	}
+}
+
+func TestBatchManagerSubmitValidation(t *testing.T) {
+	manager := NewBatchManager(newBatchService(nil), nil, BatchConfig{})
+
+	tests := []struct {
+		name    string
+		request BatchRequest
+	}{
+		{"unknown provider", BatchRequest{Provider: "missing", Model: "m", Items: embeddingItems("a")}},
+		{"no model", BatchRequest{Provider: "test-provider", Items: embeddingItems("a")}},
+		{"no items", BatchRequest{Provider: "test-provider", Model: "m"}},
+		{"empty item", BatchRequest{Provider: "test-provider", Model: "m", Items: []BatchItem{{ID: "x"}}}},
+		{"two requests in one item", BatchRequest{Provider: "test-provider", Model: "m", Items: []BatchItem{{
+			Chat:      &ChatRequest{},
+			Embedding: &EmbeddingRequest{},
+		}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := manager.Submit(context.Background(), tt.request); err == nil {
+				t.Error("Submit() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestBatchManagerCancel(t *testing.T) {
+	var calls atomic.Int32
+	svc := newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		if calls.Add(1) > 2 {
+			<-ctx.Done()
+			return EmbeddingResponse{}, ctx.Err()
+		}
+		return EmbeddingResponse{Embedding: []float64{1}}, nil
+	})
+	manager := NewBatchManager(svc, nil, BatchConfig{Concurrency: 2})
+	ctx := context.Background()
+
+	job, err := manager.Submit(ctx, BatchRequest{
+		Provider: "test-provider",
+		Model:    "m",
+		Items:    embeddingItems("a", "b", "c", "d", "e", "f"),
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	for calls.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := manager.Cancel(ctx, job.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	job, err = manager.Status(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if job.Status != BatchCanceled || job.Succeeded != 2 || job.Failed != 0 {
+		t.Errorf("Status() = %+v, want canceled with the 2 finished items", job)
+	}
+	if results, _ := manager.Results(ctx, job.ID); len(results) != 2 {
+		t.Errorf("Results() returned %d results, want 2", len(results))
+	}
+	if err := manager.Cancel(ctx, job.ID); !errors.Is(err, ErrBatchFinished) {
+		t.Errorf("second Cancel() error = %v, want ErrBatchFinished", err)
+	}
+	if _, err := manager.Status(ctx, "batch_missing"); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("Status() of an unknown job error = %v, want ErrBatchNotFound", err)
+	}
+}
+
+func TestBatchManagerResume(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileBatchStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileBatchStore() error = %v", err)
+	}
+	ctx := context.Background()
+
+	// 第一个管理器只完成前三个请求后被关闭，模拟进程退出
+	var firstCalls atomic.Int32
+	first := NewBatchManager(newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		if firstCalls.Add(1) > 3 {
+			<-ctx.Done()
+			return EmbeddingResponse{}, ctx.Err()
+		}
+		return EmbeddingResponse{Embedding: []float64{1}}, nil
+	}), store, BatchConfig{Concurrency: 1})
+
+	job, err := first.Submit(ctx, BatchRequest{
+		Provider: "test-provider",
+		Model:    "m",
+		Items:    embeddingItems("a", "b", "c", "d", "e", "f", "g"),
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	for firstCalls.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	first.Shutdown()
+
+	interrupted, err := store.Job(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Job() error = %v", err)
+	}
+	if interrupted.Status != BatchRunning || interrupted.Succeeded != 3 {
+		t.Fatalf("interrupted job = %+v, want running with 3 succeeded", interrupted)
+	}
+
+	// 模拟崩溃时写了一半的结果行
+	f, err := os.OpenFile(filepath.Join(dir, job.ID, "results.jsonl"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"index":3,"emb`)
+	f.Close()
+
+	// 新的管理器从同一存储恢复，只执行剩余的请求
+	var secondCalls atomic.Int32
+	reopened, err := NewFileBatchStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileBatchStore() error = %v", err)
+	}
+	second := NewBatchManager(newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		secondCalls.Add(1)
+		return EmbeddingResponse{Embedding: []float64{2}}, nil
+	}), reopened, BatchConfig{})
+
+	resumed, err := second.Resume(ctx)
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if len(resumed) != 1 || resumed[0] != job.ID {
+		t.Fatalf("Resume() = %v, want [%s]", resumed, job.ID)
+	}
+
+	job, err = second.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if job.Status != BatchCompleted || job.Succeeded != 7 {
+		t.Errorf("resumed job = %+v, want completed with 7 succeeded", job)
+	}
+	if got := secondCalls.Load(); got != 4 {
+		t.Errorf("resumed job made %d calls, want 4", got)
+	}
+	results, err := second.Results(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Results() error = %v", err)
+	}
+	if len(results) != 7 {
+		t.Fatalf("Results() returned %d results, want 7", len(results))
+	}
+	for i, result := range results {
+		want := 1.0
+		if i >= 3 {
+			want = 2
+		}
+		if result.Index != i || result.Embedding == nil || result.Embedding.Embedding[0] != want {
+			t.Errorf("result %d = %+v, want embedding [%v]", i, result, want)
+		}
+	}
+
+	jobs, err := second.Jobs(ctx)
+	if err != nil || len(jobs) != 1 || jobs[0].Status != BatchCompleted {
+		t.Errorf("Jobs() = %+v, %v, want the completed job", jobs, err)
+	}
+}
+
+func TestBatchManagerConcurrentResume(t *testing.T) {
+	store := NewMemoryBatchStore()
+	ctx := context.Background()
+	job := BatchJob{ID: "batch_test", Provider: "test-provider", Model: "m", Concurrency: 1, Status: BatchRunning, Total: 2}
+	if err := store.Create(ctx, job, embeddingItems("a", "b")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	manager := NewBatchManager(newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		calls.Add(1)
+		<-release
+		return EmbeddingResponse{Embedding: []float64{1}}, nil
+	}), store, BatchConfig{})
+
+	// 并发的 Resume 只会启动任务一次
+	var resumed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids, err := manager.Resume(ctx)
+			if err != nil {
+				t.Errorf("Resume() error = %v", err)
+			}
+			resumed.Add(int32(len(ids)))
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	if got := resumed.Load(); got != 1 {
+		t.Errorf("job resumed %d times, want 1", got)
+	}
+	done, err := manager.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if done.Status != BatchCompleted || calls.Load() != 2 {
+		t.Errorf("job = %+v after %d calls, want completed after 2", done, calls.Load())
+	}
+}
+
+func TestBatchManagerResumeRetriesOverload(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryBatchStore()
+	job := BatchJob{ID: "batch_test", Provider: "test-provider", Model: "m", Concurrency: 1, Status: BatchRunning, Total: 4}
+	if err := store.Create(ctx, job, embeddingItems("a", "b", "c", "d")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// 中断前：a 成功，b 因限流失败，c 因请求无效失败，d 未执行
+	svc := newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		switch request.Input {
+		case "b":
+			return EmbeddingResponse{}, ErrRateLimited
+		case "c":
+			return EmbeddingResponse{}, ErrInvalidRequest
+		}
+		return EmbeddingResponse{Embedding: []float64{1}}, nil
+	})
+	first := NewBatchManager(svc, store, BatchConfig{})
+	for i, item := range embeddingItems("a", "b", "c") {
+		if err := store.AppendResult(ctx, job.ID, first.execute(ctx, job, i, item)); err != nil {
+			t.Fatalf("AppendResult() error = %v", err)
+		}
+	}
+
+	var calls []string
+	var mu sync.Mutex
+	second := NewBatchManager(newBatchService(func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		mu.Lock()
+		calls = append(calls, request.Input)
+		mu.Unlock()
+		return EmbeddingResponse{Embedding: []float64{2}}, nil
+	}), store, BatchConfig{})
+	if _, err := second.Resume(ctx); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	job, err := second.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	// 限流失败的 b 和未执行的 d 重新执行，请求无效的 c 不重试
+	if !reflect.DeepEqual(calls, []string{"b", "d"}) {
+		t.Errorf("resumed calls = %v, want [b d]", calls)
+	}
+	if job.Succeeded != 3 || job.Failed != 1 {
+		t.Errorf("resumed job = %+v, want 3 succeeded and 1 failed", job)
+	}
+	results, err := second.Results(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Results() error = %v", err)
+	}
+	if len(results) != 4 || results[1].Error != "" || results[1].Embedding == nil {
+		t.Errorf("Results() = %+v, want 4 results with b retried", results)
+	}
+}
+
+func TestFileBatchStoreIgnoresPartialLine(t *testing.T) {
+	store, err := NewFileBatchStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBatchStore() error = %v", err)
+	}
+	ctx := context.Background()
+	job := BatchJob{ID: "batch_test", Status: BatchRunning, Total: 2}
+	if err := store.Create(ctx, job, embeddingItems("a", "b")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := store.AppendResult(ctx, job.ID, BatchResult{Index: 0, ID: "a"}); err != nil {
+		t.Fatalf("AppendResult() error = %v", err)
+	}
+	path, _ := store.path(job.ID, "results.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"index":1,"i`)
+	f.Close()
+
+	results, err := store.Results(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Results() error = %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Results() = %+v, want only the complete line", results)
+	}
+}
+
+func TestFileBatchStoreRejectsInvalidIDs(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "batches")
+	store, err := NewFileBatchStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileBatchStore() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for _, id := range []string{"", "../x", "a/b", ".hidden"} {
+		if err := store.Create(ctx, BatchJob{ID: id}, embeddingItems("a")); err == nil {
+			t.Errorf("Create(%q) succeeded, want an error", id)
+		}
+		if _, err := store.Job(ctx, id); err == nil {
+			t.Errorf("Job(%q) succeeded, want an error", id)
+		}
+		if err := store.AppendResult(ctx, id, BatchResult{}); err == nil {
+			t.Errorf("AppendResult(%q) succeeded, want an error", id)
+		}
+	}
+	// 任务目录之外不能出现文件
+	if _, err := os.Stat(filepath.Join(root, "x")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("store wrote outside its directory: %v", err)
+	}
+}
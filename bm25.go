@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25Index 是基于 BM25 算法的关键词索引，适合匹配标识符、错误码等嵌入检索容易遗漏的精确词
+type BM25Index struct {
+	docs        map[string]*bm25Document
+	postings    map[string]map[string]int // 词 -> 文档ID -> 词频
+	totalLength int
+	k1          float64
+	b           float64
+	tokenizer   func(string) []string
+	mu          sync.RWMutex
+}
+
+// bm25Document 是索引中的一篇文档
+type bm25Document struct {
+	doc    Document
+	terms  map[string]int
+	length int
+}
+
+// NewBM25Index 创建一个新的BM25索引，默认参数 k1=1.2，b=0.75
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		docs:      make(map[string]*bm25Document),
+		postings:  make(map[string]map[string]int),
+		k1:        1.2,
+		b:         0.75,
+		tokenizer: BM25Tokenize,
+	}
+}
+
+// SetParameters 设置 BM25 的 k1 和 b 参数，非法值保持不变
+func (idx *BM25Index) SetParameters(k1, b float64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if k1 >= 0 {
+		idx.k1 = k1
+	}
+	if b >= 0 && b <= 1 {
+		idx.b = b
+	}
+}
+
+// SetTokenizer 设置分词函数，需在添加文档之前调用，为空时使用 BM25Tokenize
+func (idx *BM25Index) SetTokenizer(tokenizer func(string) []string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if tokenizer == nil {
+		tokenizer = BM25Tokenize
+	}
+	idx.tokenizer = tokenizer
+}
+
+// BM25Tokenize 是默认的分词函数：转为小写，按字母、数字和下划线切分，中日韩文字每个字单独成词
+// 含有连接符（-、.、/、:）的词如 ERR-1042 会同时保留整体和各部分
+func BM25Tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	joined := false
+
+	flush := func() {
+		w := strings.TrimRight(string(word), "-./:")
+		if w != "" {
+			tokens = append(tokens, w)
+			if joined {
+				for _, part := range strings.FieldsFunc(w, isBM25Joiner) {
+					if part != w {
+						tokens = append(tokens, part)
+					}
+				}
+			}
+		}
+		word = word[:0]
+		joined = false
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word = append(word, r)
+		case isBM25Joiner(r) && len(word) > 0:
+			word = append(word, r)
+			joined = true
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// isBM25Joiner 判断字符是否是词内部的连接符
+func isBM25Joiner(r rune) bool {
+	return r == '-' || r == '.' || r == '/' || r == ':'
+}
+
+// Upsert 添加或更新文档
+func (idx *BM25Index) Upsert(ctx context.Context, docs ...Document) error {
+	for _, doc := range docs {
+		if doc.ID == "" {
+			return fmt.Errorf("%w: document id cannot be empty", ErrInvalidRequest)
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, doc := range docs {
+		idx.remove(doc.ID)
+
+		entry := &bm25Document{doc: cloneDocument(doc), terms: make(map[string]int)}
+		for _, token := range idx.tokenizer(doc.Content) {
+			entry.terms[token]++
+			entry.length++
+		}
+		for term, tf := range entry.terms {
+			if idx.postings[term] == nil {
+				idx.postings[term] = make(map[string]int)
+			}
+			idx.postings[term][doc.ID] = tf
+		}
+		idx.docs[doc.ID] = entry
+		idx.totalLength += entry.length
+	}
+	return nil
+}
+
+// Delete 删除文档
+func (idx *BM25Index) Delete(ctx context.Context, ids ...string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, id := range ids {
+		idx.remove(id)
+	}
+	return nil
+}
+
+// remove 从索引中移除文档，调用方需持有写锁
+func (idx *BM25Index) remove(id string) {
+	entry, exists := idx.docs[id]
+	if !exists {
+		return
+	}
+	for term := range entry.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= entry.length
+	delete(idx.docs, id)
+}
+
+// Len 返回文档数量
+func (idx *BM25Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search 返回与查询最相关的 k 篇文档，得分为 BM25 分数，不含任何查询词的文档不会返回
+func (idx *BM25Index) Search(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: k must be positive", ErrInvalidRequest)
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.docs) == 0 {
+		return nil, nil
+	}
+
+	n := float64(len(idx.docs))
+	avgLength := float64(idx.totalLength) / n
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range idx.tokenizer(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		df := float64(len(postings))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			length := float64(idx.docs[id].length)
+			f := float64(tf)
+			scores[id] += idf * f * (idx.k1 + 1) / (f + idx.k1*(1-idx.b+idx.b*length/avgLength))
+		}
+	}
+
+	top := &topK{k: k}
+	for id, score := range scores {
+		doc := idx.docs[id].doc
+		if len(filter) > 0 && !filter.Match(doc.Metadata) {
+			continue
+		}
+		top.push(SearchResult{Document: doc, Score: score})
+	}
+	return cloneResults(top.sorted()), nil
+}
+
+// Retrieve 实现 Retriever 接口
+func (idx *BM25Index) Retrieve(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	return idx.Search(ctx, query, k, filter)
+}
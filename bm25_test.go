@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBM25Tokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"words", "Hello, World!", []string{"hello", "world"}},
+		{"identifiers", "call parse_config() now", []string{"call", "parse_config", "now"}},
+		{"joined", "got ERR-1042.", []string{"got", "err-1042", "err", "1042"}},
+		{"cjk", "向量abc", []string{"向", "量", "abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BM25Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BM25Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBM25IndexSearch(t *testing.T) {
+	idx := NewBM25Index()
+	ctx := context.Background()
+
+	err := idx.Upsert(ctx,
+		Document{ID: "1", Content: "the cat sat on the mat", Metadata: map[string]interface{}{"kind": "animal"}},
+		Document{ID: "2", Content: "the dog chased the cat around the cat tree", Metadata: map[string]interface{}{"kind": "animal"}},
+		Document{ID: "3", Content: "connection failed with ERR-1042", Metadata: map[string]interface{}{"kind": "log"}},
+		Document{ID: "4", Content: "the car needs fuel", Metadata: map[string]interface{}{"kind": "vehicle"}},
+	)
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		k      int
+		filter MetadataFilter
+		want   []string
+	}{
+		{"term frequency", "cat", 4, nil, []string{"2", "1"}},
+		{"exact identifier", "ERR-1042", 4, nil, []string{"3"}},
+		{"rare term wins", "cat fuel", 1, nil, []string{"4"}},
+		{"filter", "the", 4, MetadataFilter{"kind": "vehicle"}, []string{"4"}},
+		{"no match", "airplane", 4, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := idx.Search(ctx, tt.query, tt.k, tt.filter)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+
+	if err := idx.Upsert(ctx, Document{ID: "3", Content: "all good"}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := idx.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if results, _ := idx.Search(ctx, "ERR-1042 mat", 4, nil); len(results) != 0 {
+		t.Errorf("Search() after update and delete = %v, want no results", results)
+	}
+	if idx.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", idx.Len())
+	}
+}
@@ -0,0 +1,157 @@
+// llm-gateway 是 OpenAI 兼容的 HTTP 网关，把 Ollama 等提供者暴露为 /v1 接口
+//
+// 用法：
+//
+//	llm-gateway -addr :8080 -ollama http://localhost:11434 -keys keys.json
+//	llm-gateway -addr :8080 -config providers.yaml -keys keys.json
+//	llm-gateway -ollama http://localhost:11434
+//
+// -config 指定 llm.LoadConfig 格式的提供者配置文件，设置后忽略 -ollama。
+//
+// keys.json 是 API 密钥数组，例如 [{"key":"sk-xxx","name":"team-a","requests_per_minute":60,"tokens_per_day":1000000}]，
+// 也可以通过环境变量 LLM_GATEWAY_KEYS 提供以逗号分隔的不限额密钥。未配置任何密钥时不做认证，
+// 此时默认只监听 127.0.0.1；要在其他地址上无认证地提供服务需要显式指定 -insecure。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hewenyu/llm"
+	"github.com/hewenyu/llm/gateway"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address")
+	ollama := flag.String("ollama", envconfig.Host().String(), "Ollama endpoint, read from $OLLAMA_HOST when set")
+	configFile := flag.String("config", "", "YAML or JSON provider config file (overrides -ollama)")
+	keysFile := flag.String("keys", "", "JSON file with API keys and quotas")
+	defaultProvider := flag.String("default-provider", "ollama", "provider for model names without a provider/ prefix")
+	insecure := flag.Bool("insecure", false, "allow serving without API keys on a non-loopback address")
+	flag.Parse()
+
+	if err := run(*addr, *ollama, *configFile, *keysFile, *defaultProvider, *insecure); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 启动网关直到收到中断信号
+func run(addr, ollama, configFile, keysFile, defaultProvider string, insecure bool) error {
+	keys, err := loadKeys(keysFile)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 && !insecure && !isLoopback(addr) {
+		return fmt.Errorf("refusing to serve %s without API keys: configure -keys or LLM_GATEWAY_KEYS, listen on a loopback address, or pass -insecure", addr)
+	}
+
+	service, err := newService(ollama, configFile)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr: addr,
+		Handler: gateway.NewServer(service, gateway.Config{
+			APIKeys:         keys,
+			DefaultProvider: defaultProvider,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("llm-gateway listening on %s (providers: %s, %d API keys)", addr, strings.Join(service.ListProviders(), ", "), len(keys))
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newService 根据配置文件创建服务，未指定配置文件时只注册 ollama 提供者
+func newService(ollama, configFile string) (llm.Service, error) {
+	if configFile != "" {
+		config, err := llm.LoadConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+		return llm.NewServiceFromConfig(config)
+	}
+
+	service := llm.NewService()
+	provider, err := llm.NewOllamaProvider(ollama)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.RegisterProvider(provider); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// loadKeys 从文件和 LLM_GATEWAY_KEYS 环境变量加载 API 密钥
+func loadKeys(path string) ([]gateway.APIKey, error) {
+	var keys []gateway.APIKey
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys file: %w", err)
+		}
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("failed to decode keys file %s: %w", path, err)
+		}
+	}
+	for i, key := range strings.Split(os.Getenv("LLM_GATEWAY_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, gateway.APIKey{Key: key, Name: fmt.Sprintf("env-%d", i)})
+		}
+	}
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("API key %d has an empty key", i)
+		}
+	}
+	return keys, nil
+}
+
+// isLoopback 判断监听地址是否只接受本机连接，主机为空表示监听所有地址
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
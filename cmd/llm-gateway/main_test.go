@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:8080", true},
+		{"localhost:8080", true},
+		{"[::1]:8080", true},
+		{":8080", false},
+		{"0.0.0.0:8080", false},
+		{"192.168.1.10:8080", false},
+		{"8080", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestRunRefusesUnauthenticatedExposure(t *testing.T) {
+	t.Setenv("LLM_GATEWAY_KEYS", "")
+	err := run(":0", "http://localhost:11434", "", "", "ollama", false)
+	if err == nil || !strings.Contains(err.Error(), "without API keys") {
+		t.Errorf("run without keys on all interfaces = %v, want a refusal", err)
+	}
+}
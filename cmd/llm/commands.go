@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hewenyu/llm"
+)
+
+// chat 运行交互式对话，给出参数时只发送一次
+func (a *app) chat(ctx context.Context, args []string) error {
+	f := a.newFlags("chat")
+	system := f.set.String("system", "", "system prompt")
+	session := f.set.String("session", "", "save the conversation under this name and resume it on the next run")
+	sessionsDir := f.set.String("sessions-dir", "", "directory for saved sessions (default ~/.config/llm/sessions)")
+	temperature := f.set.Float64("temperature", 0, "sampling temperature")
+	cfg, err := a.parse(f, args)
+	if err != nil {
+		return err
+	}
+	if err := requireModel(cfg); err != nil {
+		return err
+	}
+	service, err := a.newService(cfg)
+	if err != nil {
+		return err
+	}
+
+	conv := llm.NewConversation(service, cfg.Provider, cfg.Model, *session)
+	if *session != "" {
+		dir := *sessionsDir
+		if dir == "" {
+			configDir, err := os.UserConfigDir()
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(configDir, "llm", "sessions")
+		}
+		store, err := llm.NewFileConversationStore(dir)
+		if err != nil {
+			return err
+		}
+		loaded, err := llm.LoadConversation(ctx, service, store, *session)
+		switch {
+		case err == nil:
+			conv = loaded
+			fmt.Fprintf(a.stderr, "resumed session %s (%d messages)\n", *session, len(conv.Messages()))
+		case errors.Is(err, llm.ErrConversationNotFound):
+			conv.SetStore(store)
+		default:
+			return err
+		}
+	}
+	if *system != "" {
+		conv.SetSystemPrompt(*system)
+	}
+	conv.SetRequestTemplate(llm.ChatRequest{Temperature: *temperature})
+
+	if f.set.NArg() > 0 {
+		response, err := conv.Send(ctx, strings.Join(f.set.Args(), " "))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(a.stdout, response.Message.Content)
+		return nil
+	}
+
+	fmt.Fprintf(a.stderr, "chatting with %s/%s, /exit to quit\n", cfg.Provider, cfg.Model)
+	scanner := bufio.NewScanner(a.stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for {
+		fmt.Fprint(a.stderr, ">>> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(a.stderr)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			command, arg, _ := strings.Cut(line, " ")
+			switch command {
+			case "/exit", "/quit":
+				return nil
+			case "/reset":
+				_ = conv.Rewind(len(conv.State().Messages))
+				fmt.Fprintln(a.stderr, "conversation cleared")
+			case "/undo":
+				if err := conv.Rewind(2); err != nil {
+					fmt.Fprintln(a.stderr, "nothing to undo")
+				}
+			case "/history":
+				for _, m := range conv.Messages() {
+					fmt.Fprintf(a.stdout, "[%s] %s\n", m.Role, m.Content)
+				}
+			case "/system":
+				conv.SetSystemPrompt(strings.TrimSpace(arg))
+				fmt.Fprintln(a.stderr, "system prompt updated")
+			default:
+				fmt.Fprintf(a.stderr, "unknown command %s (try /reset, /undo, /history, /system, /exit)\n", command)
+			}
+			continue
+		}
+
+		response, err := conv.Send(ctx, line)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintln(a.stderr, "error:", err)
+			continue
+		}
+		fmt.Fprintln(a.stdout, response.Message.Content)
+	}
+}
+
+// complete 对参数或标准输入中的提示词进行补全
+func (a *app) complete(ctx context.Context, args []string) error {
+	f := a.newFlags("complete")
+	maxTokens := f.set.Int("max-tokens", 0, "maximum number of tokens to generate")
+	temperature := f.set.Float64("temperature", 0, "sampling temperature")
+	cfg, err := a.parse(f, args)
+	if err != nil {
+		return err
+	}
+	if err := requireModel(cfg); err != nil {
+		return err
+	}
+
+	prompt := strings.Join(f.set.Args(), " ")
+	if prompt == "" {
+		data, err := io.ReadAll(a.stdin)
+		if err != nil {
+			return err
+		}
+		prompt = string(data)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return errors.New("empty prompt")
+	}
+
+	service, err := a.newService(cfg)
+	if err != nil {
+		return err
+	}
+	response, err := service.Complete(ctx, cfg.Provider, cfg.Model, llm.CompletionRequest{
+		Prompt:      prompt,
+		MaxTokens:   *maxTokens,
+		Temperature: *temperature,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, response.Text)
+	return nil
+}
+
+// embedLine 是 embed 命令输出的一行
+type embedLine struct {
+	Index     int       `json:"index"`
+	Text      string    `json:"text"`
+	Embedding []float64 `json:"embedding,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// embed 嵌入标准输入中的每一个非空行，按输入顺序输出 JSONL
+func (a *app) embed(ctx context.Context, args []string) error {
+	f := a.newFlags("embed")
+	concurrency := f.set.Int("c", 4, "concurrent requests")
+	dimensions := f.set.Int("dimensions", 0, "truncate embeddings to this many dimensions (Matryoshka models)")
+	cfg, err := a.parse(f, args)
+	if err != nil {
+		return err
+	}
+	service, err := a.newService(cfg)
+	if err != nil {
+		return err
+	}
+	model := cfg.EmbedModel
+	if model == "" {
+		provider, err := service.GetProvider(cfg.Provider)
+		if err != nil {
+			return err
+		}
+		model = provider.GetEmbedModel()
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(a.stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	embedder := llm.NewLLMEmbedder(service, cfg.Provider, model, 0)
+	embedder.SetMaxPoolSize(*concurrency)
+	if *dimensions > 0 {
+		if err := embedder.SetOutputDimensions(*dimensions); err != nil {
+			return err
+		}
+	}
+
+	contents := make([]interface{}, len(lines))
+	for i, line := range lines {
+		contents[i] = line
+	}
+	results := embedder.BatchEmbedDetailed(ctx, contents)
+
+	encoder := json.NewEncoder(a.stdout)
+	for i, result := range results {
+		out := embedLine{Index: i, Text: lines[i], Embedding: result.Embedding}
+		if result.Err != nil {
+			out.Error = result.Err.Error()
+		}
+		if err := encoder.Encode(out); err != nil {
+			return err
+		}
+	}
+	if failed := llm.FailedIndexes(results); len(failed) > 0 {
+		return fmt.Errorf("%d of %d inputs failed", len(failed), len(lines))
+	}
+	return nil
+}
+
+// modelRow 是 models 命令输出的一个模型
+type modelRow struct {
+	Provider        string `json:"provider"`
+	Name            string `json:"name"`
+	ContextWindow   int    `json:"context_window"`
+	MaxOutputTokens int    `json:"max_output_tokens"`
+	ImageInput      bool   `json:"image_input"`
+}
+
+// models 列出所有提供者的模型
+func (a *app) models(ctx context.Context, args []string) error {
+	f := a.newFlags("models")
+	asJSON := f.set.Bool("json", false, "print JSON instead of a table")
+	cfg, err := a.parse(f, args)
+	if err != nil {
+		return err
+	}
+	service, err := a.newService(cfg)
+	if err != nil {
+		return err
+	}
+	all, err := service.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := []modelRow{}
+	for provider, models := range all {
+		for _, m := range models {
+			rows = append(rows, modelRow{
+				Provider:        provider,
+				Name:            m.Name,
+				ContextWindow:   m.ContextWindowSize,
+				MaxOutputTokens: m.MaxOutputTokens,
+				ImageInput:      m.SupportsImageInput,
+			})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Provider != rows[j].Provider {
+			return rows[i].Provider < rows[j].Provider
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	if *asJSON {
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tMODEL\tCONTEXT\tMAX OUTPUT\tIMAGES")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%t\n", row.Provider, row.Name, row.ContextWindow, row.MaxOutputTokens, row.ImageInput)
+	}
+	return w.Flush()
+}
+
+// benchStats 是压测结果
+type benchStats struct {
+	Requests   int             // 请求总数
+	Failed     int             // 失败的请求数
+	Duration   time.Duration   // 总耗时
+	Tokens     int             // 成功请求消耗的 token 总数
+	Latencies  []time.Duration // 成功请求的延迟
+	FirstError string          // 第一个错误
+}
+
+// percentile 返回已排序延迟的分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// bench 以固定并发发送 n 个请求，输出吞吐量和延迟分位数
+func (a *app) bench(ctx context.Context, args []string) error {
+	f := a.newFlags("bench")
+	mode := f.set.String("mode", "chat", "request type: chat, complete or embed")
+	n := f.set.Int("n", 20, "number of requests")
+	concurrency := f.set.Int("c", 4, "concurrent requests")
+	prompt := f.set.String("prompt", "Write one sentence about the sea.", "prompt or text to embed")
+	maxTokens := f.set.Int("max-tokens", 64, "maximum number of tokens to generate")
+	cfg, err := a.parse(f, args)
+	if err != nil {
+		return err
+	}
+	if *n <= 0 || *concurrency <= 0 {
+		return errors.New("-n and -c must be positive")
+	}
+	service, err := a.newService(cfg)
+	if err != nil {
+		return err
+	}
+
+	var call func(ctx context.Context) (llm.Usage, error)
+	switch *mode {
+	case "chat", "complete":
+		if err := requireModel(cfg); err != nil {
+			return err
+		}
+		call = func(ctx context.Context) (llm.Usage, error) {
+			if *mode == "complete" {
+				response, err := service.Complete(ctx, cfg.Provider, cfg.Model, llm.CompletionRequest{Prompt: *prompt, MaxTokens: *maxTokens})
+				return response.Usage, err
+			}
+			response, err := service.Chat(ctx, cfg.Provider, cfg.Model, llm.ChatRequest{
+				Messages:  []llm.Message{{Role: "user", Content: *prompt}},
+				MaxTokens: *maxTokens,
+			})
+			return response.Usage, err
+		}
+	case "embed":
+		model := cfg.EmbedModel
+		if model == "" {
+			provider, err := service.GetProvider(cfg.Provider)
+			if err != nil {
+				return err
+			}
+			model = provider.GetEmbedModel()
+		}
+		call = func(ctx context.Context) (llm.Usage, error) {
+			response, err := service.Embed(ctx, cfg.Provider, model, llm.EmbeddingRequest{Input: *prompt, Model: model})
+			return response.Usage, err
+		}
+	default:
+		return fmt.Errorf("unknown bench mode %q", *mode)
+	}
+
+	stats := runBench(ctx, *n, *concurrency, call)
+	latencies := slices.Clone(stats.Latencies)
+	slices.Sort(latencies)
+
+	seconds := stats.Duration.Seconds()
+	fmt.Fprintf(a.stdout, "requests:    %d (%d failed)\n", stats.Requests, stats.Failed)
+	fmt.Fprintf(a.stdout, "duration:    %s\n", stats.Duration.Round(time.Millisecond))
+	fmt.Fprintf(a.stdout, "throughput:  %.2f req/s, %.1f tokens/s\n", float64(stats.Requests-stats.Failed)/seconds, float64(stats.Tokens)/seconds)
+	fmt.Fprintf(a.stdout, "latency:     p50 %s  p95 %s  p99 %s  max %s\n",
+		percentile(latencies, 0.50).Round(time.Millisecond),
+		percentile(latencies, 0.95).Round(time.Millisecond),
+		percentile(latencies, 0.99).Round(time.Millisecond),
+		percentile(latencies, 1).Round(time.Millisecond))
+	if stats.FirstError != "" {
+		fmt.Fprintf(a.stdout, "first error: %s\n", stats.FirstError)
+	}
+	return nil
+}
+
+// runBench 用 concurrency 个goroutine执行 n 次 call 并统计结果
+func runBench(ctx context.Context, n, concurrency int, call func(ctx context.Context) (llm.Usage, error)) benchStats {
+	stats := benchStats{Requests: n}
+	jobs := make(chan struct{})
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < min(concurrency, n); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				begin := time.Now()
+				u, err := call(ctx)
+				latency := time.Since(begin)
+
+				mu.Lock()
+				if err != nil {
+					stats.Failed++
+					if stats.FirstError == "" {
+						stats.FirstError = err.Error()
+					}
+				} else {
+					stats.Tokens += u.TotalTokens
+					stats.Latencies = append(stats.Latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	stats.Duration = time.Since(start)
+	return stats
+}
@@ -0,0 +1,243 @@
+// llm 是用于试用模型的命令行工具
+//
+// 用法：
+//
+//	llm chat [-model qwen2.5] [-session NAME] [问题]    交互式对话，给出问题时只回答一次
+//	llm complete [-model qwen2.5] [提示词]              文本补全，未给出提示词时从标准输入读取
+//	llm embed [-embed-model NAME] < lines.txt           每行输入输出一个 JSONL 向量
+//	llm models [-json]                                  列出所有提供者的模型
+//	llm bench [-mode chat|complete|embed] [-n 20] [-c 4] 压测并输出吞吐量和延迟分位数
+//
+// 配置按以下优先级合并：命令行参数 > 环境变量（LLM_ENDPOINT 或 OLLAMA_HOST、LLM_PROVIDER、
+// LLM_MODEL、LLM_EMBED_MODEL）> 配置文件（-config、LLM_CONFIG 或 ~/.config/llm/config.json）> 默认值。
+// 配置文件是 YAML 文件或包含 providers 的 JSON 文件时按 llm.LoadConfig 的声明式格式加载，
+// 服务由 llm.NewServiceFromConfig 创建，此时忽略 endpoint，只声明了一个提供者时默认使用该提供者
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/hewenyu/llm"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// config 是命令行工具的配置
+type config struct {
+	Endpoint   string `json:"endpoint"`
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	EmbedModel string `json:"embed_model"`
+
+	declared *llm.Config // 声明式配置文件，非空时由它创建服务
+}
+
+// app 是命令行工具，输入输出和服务的创建方式可以在测试中替换
+type app struct {
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	getenv     func(string) string
+	newService func(cfg config) (llm.Service, error)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	a := &app{
+		stdin:      os.Stdin,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		getenv:     os.Getenv,
+		newService: newService,
+	}
+	if err := a.run(ctx, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "llm:", err)
+		os.Exit(1)
+	}
+}
+
+// usage 是命令行帮助
+const usage = `Usage: llm <command> [flags] [args]
+
+Commands:
+  chat      interactive chat (REPL); /reset, /undo, /history, /system TEXT, /exit
+  complete  text completion of a prompt from the arguments or stdin
+  embed     embed stdin lines and print one JSON object per line
+  models    list models of all providers
+  bench     run concurrent requests and report throughput and latency
+
+Run "llm <command> -h" for the flags of a command.
+`
+
+// run 解析子命令并执行
+func (a *app) run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(a.stderr, usage)
+		return nil
+	}
+
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"chat":     a.chat,
+		"complete": a.complete,
+		"embed":    a.embed,
+		"models":   a.models,
+		"bench":    a.bench,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(a.stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	err := command(ctx, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+// commonFlags 是所有子命令共用的参数
+type commonFlags struct {
+	set        *flag.FlagSet
+	configPath string
+	cfg        config
+}
+
+// newFlags 创建子命令的参数集并注册共用参数
+func (a *app) newFlags(name string) *commonFlags {
+	f := &commonFlags{set: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.set.SetOutput(a.stderr)
+	f.set.StringVar(&f.configPath, "config", "", "config file, JSON or a YAML/JSON provider config for llm.LoadConfig (default $LLM_CONFIG or ~/.config/llm/config.json)")
+	f.set.StringVar(&f.cfg.Endpoint, "endpoint", "", "provider endpoint (default $LLM_ENDPOINT, $OLLAMA_HOST or http://localhost:11434)")
+	f.set.StringVar(&f.cfg.Provider, "provider", "", "provider name (default $LLM_PROVIDER or ollama)")
+	f.set.StringVar(&f.cfg.Model, "model", "", "model for chat and completion (default $LLM_MODEL)")
+	f.set.StringVar(&f.cfg.EmbedModel, "embed-model", "", "embedding model (default $LLM_EMBED_MODEL or the provider's embedding model)")
+	return f
+}
+
+// parse 解析参数并按 参数 > 环境变量 > 配置文件 > 默认值 合并配置
+func (a *app) parse(f *commonFlags, args []string) (config, error) {
+	if err := f.set.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	cfg := config{Endpoint: "http://localhost:11434", Provider: "ollama"}
+
+	path := f.configPath
+	if path == "" {
+		path = a.getenv("LLM_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "llm", "config.json")
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil && isDeclarative(path, data):
+			declared, err := llm.LoadConfig(path)
+			if err != nil {
+				return config{}, err
+			}
+			cfg.declared = declared
+			if len(declared.Providers) == 1 {
+				for name := range declared.Providers {
+					cfg.Provider = name
+				}
+			}
+		case err == nil:
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return config{}, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	for _, env := range []struct {
+		names []string
+		value *string
+	}{
+		{[]string{"LLM_ENDPOINT", "OLLAMA_HOST"}, &cfg.Endpoint},
+		{[]string{"LLM_PROVIDER"}, &cfg.Provider},
+		{[]string{"LLM_MODEL"}, &cfg.Model},
+		{[]string{"LLM_EMBED_MODEL"}, &cfg.EmbedModel},
+	} {
+		for _, name := range env.names {
+			if v := a.getenv(name); v != "" {
+				if name == "OLLAMA_HOST" {
+					// 与 Ollama 和 llm-gateway 一样由 envconfig.Host 从进程环境变量解析，补全协议和端口
+					v = envconfig.Host().String()
+				}
+				*env.value = v
+				break
+			}
+		}
+	}
+
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "endpoint":
+			cfg.Endpoint = f.cfg.Endpoint
+		case "provider":
+			cfg.Provider = f.cfg.Provider
+		case "model":
+			cfg.Model = f.cfg.Model
+		case "embed-model":
+			cfg.EmbedModel = f.cfg.EmbedModel
+		}
+	})
+	return cfg, nil
+}
+
+// isDeclarative 判断配置文件是否为 llm.LoadConfig 格式：YAML 文件或顶层包含 providers 的 JSON 文件
+func isDeclarative(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	var keys map[string]json.RawMessage
+	if json.Unmarshal(data, &keys) != nil {
+		return false
+	}
+	_, ok := keys["providers"]
+	return ok
+}
+
+// newService 创建注册了配置中提供者的服务
+func newService(cfg config) (llm.Service, error) {
+	if cfg.declared != nil {
+		return llm.NewServiceFromConfig(cfg.declared)
+	}
+	if cfg.Provider != "ollama" {
+		return nil, fmt.Errorf("unsupported provider %q", cfg.Provider)
+	}
+	provider, err := llm.NewOllamaProvider(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	service := llm.NewService()
+	if err := service.RegisterProvider(provider); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// requireModel 检查是否配置了模型
+func requireModel(cfg config) error {
+	if cfg.Model == "" {
+		return errors.New("no model specified; use -model, LLM_MODEL or the config file")
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hewenyu/llm"
+)
+
+// fakeProvider 是用于测试的提供者，注册名为 ollama
+type fakeProvider struct{}
+
+func (p *fakeProvider) Name() string { return "ollama" }
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	return []llm.ModelInfo{
+		{Name: "qwen2.5", ContextWindowSize: 4096, MaxOutputTokens: 2048},
+		{Name: "llava", ContextWindowSize: 4096, MaxOutputTokens: 2048, SupportsImageInput: true},
+	}, nil
+}
+
+func (p *fakeProvider) GetModel(ctx context.Context, modelID string) (llm.ModelInfo, error) {
+	return llm.ModelInfo{Name: modelID}, nil
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, modelID string, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	return llm.CompletionResponse{Text: modelID + " completes " + strings.TrimSpace(request.Prompt)}, nil
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, modelID string, request llm.ChatRequest) (llm.ChatResponse, error) {
+	return llm.ChatResponse{
+		Message: llm.Message{Role: "assistant", Content: "reply " + request.Messages[len(request.Messages)-1].Content},
+		Usage:   llm.Usage{TotalTokens: 3},
+	}, nil
+}
+
+func (p *fakeProvider) Embed(ctx context.Context, modelID string, request llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	return llm.EmbeddingResponse{Embedding: []float64{float64(len(request.Input)), 1}}, nil
+}
+
+func (p *fakeProvider) GetEmbedModel() string { return "fake-embed" }
+
+// newTestApp 返回使用 fakeProvider 的命令行工具，configured 记录最终生效的配置
+func newTestApp(stdin string, env map[string]string, configured *config) (*app, *bytes.Buffer) {
+	stdout := &bytes.Buffer{}
+	return &app{
+		stdin:  strings.NewReader(stdin),
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+		getenv: func(name string) string { return env[name] },
+		newService: func(cfg config) (llm.Service, error) {
+			if configured != nil {
+				*configured = cfg
+			}
+			service := llm.NewService()
+			return service, service.RegisterProvider(&fakeProvider{})
+		},
+	}, stdout
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"endpoint":"http://file:1","model":"file-model","embed_model":"file-embed"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want config
+	}{
+		{
+			name: "config file",
+			env:  map[string]string{"LLM_CONFIG": path},
+			want: config{Endpoint: "http://file:1", Provider: "ollama", Model: "file-model", EmbedModel: "file-embed"},
+		},
+		{
+			name: "env overrides file",
+			env:  map[string]string{"LLM_CONFIG": path, "OLLAMA_HOST": "http://env:2", "LLM_MODEL": "env-model"},
+			want: config{Endpoint: "http://env:2", Provider: "ollama", Model: "env-model", EmbedModel: "file-embed"},
+		},
+		{
+			name: "bare OLLAMA_HOST",
+			env:  map[string]string{"LLM_CONFIG": path, "OLLAMA_HOST": "0.0.0.0"},
+			want: config{Endpoint: "http://0.0.0.0:11434", Provider: "ollama", Model: "file-model", EmbedModel: "file-embed"},
+		},
+		{
+			name: "OLLAMA_HOST without scheme",
+			env:  map[string]string{"LLM_CONFIG": path, "OLLAMA_HOST": "gpu-box:1234"},
+			want: config{Endpoint: "http://gpu-box:1234", Provider: "ollama", Model: "file-model", EmbedModel: "file-embed"},
+		},
+		{
+			name: "OLLAMA_HOST with scheme",
+			env:  map[string]string{"LLM_CONFIG": path, "OLLAMA_HOST": "https://gpu-box/ollama"},
+			want: config{Endpoint: "https://gpu-box:443/ollama", Provider: "ollama", Model: "file-model", EmbedModel: "file-embed"},
+		},
+		{
+			name: "LLM_ENDPOINT overrides OLLAMA_HOST",
+			env:  map[string]string{"LLM_CONFIG": path, "LLM_ENDPOINT": "http://env:4", "OLLAMA_HOST": "0.0.0.0"},
+			want: config{Endpoint: "http://env:4", Provider: "ollama", Model: "file-model", EmbedModel: "file-embed"},
+		},
+		{
+			name: "flags override env",
+			env:  map[string]string{"LLM_MODEL": "env-model"},
+			args: []string{"-config", path, "-model", "flag-model", "-endpoint", "http://flag:3"},
+			want: config{Endpoint: "http://flag:3", Provider: "ollama", Model: "flag-model", EmbedModel: "file-embed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// OLLAMA_HOST 由 Ollama 的 envconfig 从进程环境变量解析
+			t.Setenv("OLLAMA_HOST", tt.env["OLLAMA_HOST"])
+			var got config
+			a, _ := newTestApp("", tt.env, &got)
+			if err := a.run(context.Background(), append([]string{"complete"}, append(tt.args, "hi")...)); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("config = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	a, _ := newTestApp("", map[string]string{"LLM_CONFIG": filepath.Join(t.TempDir(), "missing.json")}, nil)
+	if err := a.run(context.Background(), []string{"models"}); err == nil {
+		t.Error("run() with a missing explicit config file error = nil, want an error")
+	}
+}
+
+func TestDeclarativeConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "llm.yaml")
+	if err := os.WriteFile(yamlPath, []byte("providers:\n  local:\n    type: ollama\n    endpoint: http://gpu:1\n    aliases:\n      chat: qwen2.5:7b\nretry:\n  max_attempts: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jsonPath := filepath.Join(dir, "providers.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"providers":{"a":{"type":"ollama"},"b":{"type":"ollama"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		env          map[string]string
+		args         []string
+		wantProvider string
+		wantServices []string
+	}{
+		{"yaml", nil, []string{"-config", yamlPath}, "local", []string{"local"}},
+		{"json with providers", map[string]string{"LLM_CONFIG": jsonPath}, []string{"-provider", "b"}, "b", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got config
+			a, _ := newTestApp("", tt.env, &got)
+			if err := a.run(context.Background(), append([]string{"models"}, tt.args...)); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if got.declared == nil || got.Provider != tt.wantProvider {
+				t.Fatalf("config = %+v, want the declarative config with provider %s", got, tt.wantProvider)
+			}
+			service, err := newService(got)
+			if err != nil {
+				t.Fatalf("newService() error = %v", err)
+			}
+			providers := service.ListProviders()
+			sort.Strings(providers)
+			if strings.Join(providers, ",") != strings.Join(tt.wantServices, ",") {
+				t.Errorf("providers = %v, want %v", providers, tt.wantServices)
+			}
+		})
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("providers:\n  local:\n    type: unknown\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := newTestApp("", nil, nil)
+	if err := a.run(context.Background(), []string{"models", "-config", invalid}); err == nil {
+		t.Error("run() with an invalid declarative config error = nil, want an error")
+	}
+}
+
+func TestChatCommand(t *testing.T) {
+	env := map[string]string{"LLM_MODEL": "qwen2.5"}
+
+	t.Run("one shot", func(t *testing.T) {
+		a, stdout := newTestApp("", env, nil)
+		if err := a.run(context.Background(), []string{"chat", "what", "is", "go"}); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if got := stdout.String(); got != "reply what is go\n" {
+			t.Errorf("stdout = %q, want the single reply", got)
+		}
+	})
+
+	t.Run("repl", func(t *testing.T) {
+		a, stdout := newTestApp("hello\nsecond\n/undo\n/history\n/exit\nignored\n", env, nil)
+		if err := a.run(context.Background(), []string{"chat", "-system", "be brief"}); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		want := "reply hello\nreply second\n[system] be brief\n[user] hello\n[assistant] reply hello\n"
+		if got := stdout.String(); got != want {
+			t.Errorf("stdout = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("session", func(t *testing.T) {
+		dir := t.TempDir()
+		args := []string{"chat", "-session", "notes", "-sessions-dir", dir}
+		a, _ := newTestApp("first\n", env, nil)
+		if err := a.run(context.Background(), args); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		a, stdout := newTestApp("/history\n", env, nil)
+		if err := a.run(context.Background(), args); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if got := stdout.String(); got != "[user] first\n[assistant] reply first\n" {
+			t.Errorf("resumed history = %q, want the saved messages", got)
+		}
+	})
+
+	a, _ := newTestApp("", nil, nil)
+	if err := a.run(context.Background(), []string{"chat", "hi"}); err == nil {
+		t.Error("chat without a model error = nil, want an error")
+	}
+}
+
+func TestEmbedCommand(t *testing.T) {
+	a, stdout := newTestApp("a\n\n  bbb  \n", nil, nil)
+	if err := a.run(context.Background(), []string{"embed"}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("embed printed %d lines, want 2: %q", len(lines), stdout.String())
+	}
+	var second embedLine
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", lines[1], err)
+	}
+	if second.Index != 1 || second.Text != "bbb" || len(second.Embedding) != 2 || second.Embedding[0] != 3 {
+		t.Errorf("second line = %+v, want the embedding of bbb", second)
+	}
+}
+
+func TestModelsCommand(t *testing.T) {
+	a, stdout := newTestApp("", nil, nil)
+	if err := a.run(context.Background(), []string{"models"}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "PROVIDER") || !strings.Contains(lines[1], "llava") {
+		t.Errorf("table = %q, want a header and models sorted by name", stdout.String())
+	}
+
+	a, stdout = newTestApp("", nil, nil)
+	if err := a.run(context.Background(), []string{"models", "-json"}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	var rows []modelRow
+	if err := json.Unmarshal(stdout.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if len(rows) != 2 || rows[0].Name != "llava" || !rows[0].ImageInput || rows[1].ContextWindow != 4096 {
+		t.Errorf("rows = %+v, want both models", rows)
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	for _, mode := range []string{"chat", "complete", "embed"} {
+		t.Run(mode, func(t *testing.T) {
+			a, stdout := newTestApp("", map[string]string{"LLM_MODEL": "qwen2.5"}, nil)
+			if err := a.run(context.Background(), []string{"bench", "-mode", mode, "-n", "7", "-c", "3"}); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if out := stdout.String(); !strings.Contains(out, "requests:    7 (0 failed)") || !strings.Contains(out, "p95") {
+				t.Errorf("bench output = %q, want 7 successful requests and latency percentiles", out)
+			}
+		})
+	}
+
+	a, _ := newTestApp("", nil, nil)
+	if err := a.run(context.Background(), []string{"bench", "-mode", "unknown"}); err == nil {
+		t.Error("bench with an unknown mode error = nil, want an error")
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	a, _ := newTestApp("", nil, nil)
+	if err := a.run(context.Background(), []string{"frobnicate"}); err == nil {
+		t.Error("run() error = nil, want an error for an unknown command")
+	}
+}
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// MetadataCoalesce 是请求 Metadata 中控制是否合并请求的键，值为 false 时该请求总是单独发送，
+// 值为 true 时即使 Temperature 大于 0 也合并
+const MetadataCoalesce = "coalesce"
+
+// flightCall 是一个正在执行的合并调用
+type flightCall[T any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	value   T
+	err     error
+}
+
+// flightGroup 将相同键的并发调用合并为一次执行
+type flightGroup[T any] struct {
+	calls map[string]*flightCall[T]
+	mu    sync.Mutex
+}
+
+// do 执行 fn 或等待相同键正在执行的调用，shared 表示结果来自其他调用方发起的执行
+// 执行使用不随调用方取消的 context，只有当所有等待者都离开后才取消
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (value T, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[T])
+	}
+	call, shared := g.calls[key]
+	if shared {
+		call.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &flightCall[T]{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		g.calls[key] = call
+		go func() {
+			call.value, call.err = fn(callCtx)
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, shared, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// 没有调用方再等待结果，取消后端调用并让后续请求重新发起
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			call.cancel()
+		}
+		g.mu.Unlock()
+		var zero T
+		return zero, shared, ctx.Err()
+	}
+}
+
+// CoalescingStats 是请求合并的统计信息
+type CoalescingStats struct {
+	Calls     uint64 // 实际发往后端的调用数
+	Coalesced uint64 // 与其他调用合并、未单独发送的请求数
+}
+
+// CoalescingProvider 将相同的并发 Complete、Chat 和 Embed 请求合并为一次后端调用，并把结果分发给所有调用方
+// 请求按模型和完整的请求内容判断是否相同；只合并同时在执行中的请求，不缓存已完成的结果。
+// Embed 总是合并；Complete 和 Chat 默认只合并 Temperature 为 0 的确定性请求，采样请求的每个调用方各自得到独立的回复
+type CoalescingProvider struct {
+	Provider
+	completions flightGroup[CompletionResponse]
+	chats       flightGroup[ChatResponse]
+	embeddings  flightGroup[EmbeddingResponse]
+	calls       atomic.Uint64
+	coalesced   atomic.Uint64
+}
+
+// NewCoalescingProvider 返回一个合并相同并发请求的提供者
+// 可以在 Metadata 中设置 "coalesce": false 跳过合并，或设置 "coalesce": true 合并 Temperature 大于 0 的请求
+func NewCoalescingProvider(provider Provider) *CoalescingProvider {
+	return &CoalescingProvider{Provider: provider}
+}
+
+// Stats 返回请求合并的统计信息
+func (p *CoalescingProvider) Stats() CoalescingStats {
+	return CoalescingStats{Calls: p.calls.Load(), Coalesced: p.coalesced.Load()}
+}
+
+// coalesceKey 返回请求的合并键，请求不可合并时返回 false
+// Metadata 中的 "coalesce" 优先，未设置时由 byDefault 决定是否合并
+func coalesceKey(method, modelID string, request interface{}, metadata map[string]interface{}, byDefault bool) (string, bool) {
+	enabled, ok := metadata[MetadataCoalesce].(bool)
+	if !ok {
+		enabled = byDefault
+	}
+	if !enabled {
+		return "", false
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(modelID))
+	h.Write([]byte{0})
+	h.Write(data)
+	return string(h.Sum(nil)), true
+}
+
+// record 更新统计信息
+func (p *CoalescingProvider) record(shared bool) {
+	if shared {
+		p.coalesced.Add(1)
+	} else {
+		p.calls.Add(1)
+	}
+}
+
+// Complete 生成文本补全
+func (p *CoalescingProvider) Complete(ctx context.Context, modelID string, request CompletionRequest) (CompletionResponse, error) {
+	key, ok := coalesceKey("complete", modelID, request, request.Metadata, request.Temperature == 0)
+	if !ok {
+		p.calls.Add(1)
+		return p.Provider.Complete(ctx, modelID, request)
+	}
+	response, shared, err := p.completions.do(ctx, key, func(ctx context.Context) (CompletionResponse, error) {
+		return p.Provider.Complete(ctx, modelID, request)
+	})
+	p.record(shared)
+	response.Metadata = maps.Clone(response.Metadata)
+	return response, err
+}
+
+// Chat 执行聊天补全
+func (p *CoalescingProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	key, ok := coalesceKey("chat", modelID, request, request.Metadata, request.Temperature == 0)
+	if !ok {
+		p.calls.Add(1)
+		return p.Provider.Chat(ctx, modelID, request)
+	}
+	response, shared, err := p.chats.do(ctx, key, func(ctx context.Context) (ChatResponse, error) {
+		return p.Provider.Chat(ctx, modelID, request)
+	})
+	p.record(shared)
+	response.Message.Context = maps.Clone(response.Message.Context)
+	response.Metadata = maps.Clone(response.Metadata)
+	return response, err
+}
+
+// ChatStream 流式执行聊天补全，增量只能交给一个调用方，因此流式请求不合并
+func (p *CoalescingProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	p.calls.Add(1)
+	return wrappedChatStream(ctx, p.Provider, modelID, request, fn)
+}
+
+// Embed 生成文本的嵌入向量
+func (p *CoalescingProvider) Embed(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+	key, ok := coalesceKey("embed", modelID, request, request.Metadata, true)
+	if !ok {
+		p.calls.Add(1)
+		return p.Provider.Embed(ctx, modelID, request)
+	}
+	response, shared, err := p.embeddings.do(ctx, key, func(ctx context.Context) (EmbeddingResponse, error) {
+		return p.Provider.Embed(ctx, modelID, request)
+	})
+	p.record(shared)
+	// 每个调用方得到独立的副本，避免一方修改向量影响其他调用方
+	response.Embedding = slices.Clone(response.Embedding)
+	response.Metadata = maps.Clone(response.Metadata)
+	return response, err
+}
+
+// EmbeddingModelInfo 转发给被包装的提供者
+func (p *CoalescingProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return wrappedEmbeddingModelInfo(ctx, p.Provider, modelID)
+}
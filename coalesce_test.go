@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitWaiters 等待合并组中所有调用的等待者总数达到 n
+func waitWaiters[T any](t *testing.T, g *flightGroup[T], n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		g.mu.Lock()
+		total := 0
+		for _, call := range g.calls {
+			total += call.waiters
+		}
+		g.mu.Unlock()
+		if total >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d waiters, have %d", n, total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingEmbedProvider 返回一个在 unblock 关闭前阻塞的嵌入提供者，calls 记录后端调用次数
+func blockingEmbedProvider(calls *atomic.Int32, unblock <-chan struct{}) *mockProvider {
+	return &mockProvider{
+		name: "test-provider",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			calls.Add(1)
+			select {
+			case <-unblock:
+				return EmbeddingResponse{Embedding: []float64{float64(len(request.Input)), 1}}, nil
+			case <-ctx.Done():
+				return EmbeddingResponse{}, ctx.Err()
+			}
+		},
+	}
+}
+
+func TestCoalescingProviderEmbed(t *testing.T) {
+	var calls atomic.Int32
+	unblock := make(chan struct{})
+	provider := NewCoalescingProvider(blockingEmbedProvider(&calls, unblock))
+
+	inputs := []string{"same", "same", "same", "same", "other", "other"}
+	results := make([]EmbeddingResponse, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := provider.Embed(context.Background(), "m", EmbeddingRequest{Input: input})
+			if err != nil {
+				t.Errorf("Embed(%q) error = %v", input, err)
+			}
+			results[i] = response
+		}()
+	}
+	waitWaiters(t, &provider.embeddings, len(inputs))
+	close(unblock)
+	wg.Wait()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("backend calls = %d, want 2", got)
+	}
+	if stats := provider.Stats(); stats.Calls != 2 || stats.Coalesced != 4 {
+		t.Errorf("Stats() = %+v, want 2 calls and 4 coalesced", stats)
+	}
+	if results[0].Embedding[0] != 4 || results[4].Embedding[0] != 5 {
+		t.Errorf("results = %v, want each caller to get the result for its own input", results)
+	}
+
+	// 调用方之间的结果互不影响
+	results[0].Embedding[1] = 42
+	if results[1].Embedding[1] != 1 {
+		t.Error("modifying one caller's embedding changed another caller's result")
+	}
+}
+
+func TestCoalescingProviderCancellation(t *testing.T) {
+	var calls atomic.Int32
+	unblock := make(chan struct{})
+	provider := NewCoalescingProvider(blockingEmbedProvider(&calls, unblock))
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := provider.Embed(leaderCtx, "m", EmbeddingRequest{Input: "text"})
+		leaderErr <- err
+	}()
+	waitWaiters(t, &provider.embeddings, 1)
+
+	followerErr := make(chan error, 1)
+	go func() {
+		_, err := provider.Embed(context.Background(), "m", EmbeddingRequest{Input: "text"})
+		followerErr <- err
+	}()
+	waitWaiters(t, &provider.embeddings, 2)
+
+	// 发起调用的一方取消后，仍在等待的调用方应得到结果
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want context.Canceled", err)
+	}
+	close(unblock)
+	if err := <-followerErr; err != nil {
+		t.Errorf("follower error = %v, want the shared result", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("backend calls = %d, want 1", got)
+	}
+}
+
+func TestCoalescingProviderAllCanceled(t *testing.T) {
+	backendErr := make(chan error, 1)
+	provider := NewCoalescingProvider(&mockProvider{
+		name: "test-provider",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			<-ctx.Done()
+			backendErr <- ctx.Err()
+			return EmbeddingResponse{}, ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = provider.Embed(ctx, "m", EmbeddingRequest{Input: "text"})
+	}()
+	waitWaiters(t, &provider.embeddings, 1)
+	cancel()
+	<-done
+
+	select {
+	case err := <-backendErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("backend context error = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend call was not canceled after every caller left")
+	}
+}
+
+func TestCoalescingProviderChatSampling(t *testing.T) {
+	tests := []struct {
+		name          string
+		temperature   float64
+		metadata      map[string]interface{}
+		wantCalls     uint64
+		wantCoalesced uint64
+	}{
+		{"deterministic", 0, nil, 1, 2},
+		{"sampled", 0.9, nil, 3, 0},
+		{"opt out", 0, map[string]interface{}{MetadataCoalesce: false}, 3, 0},
+		{"sampled opt in", 0.9, map[string]interface{}{MetadataCoalesce: true}, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			unblock := make(chan struct{})
+			provider := NewCoalescingProvider(&mockProvider{
+				name: "test-provider",
+				chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+					calls.Add(1)
+					<-unblock
+					return ChatResponse{Message: Message{Role: "assistant", Content: "hi"}}, nil
+				},
+			})
+
+			request := ChatRequest{
+				Messages:    []Message{{Role: "user", Content: "tell me a story"}},
+				Temperature: tt.temperature,
+				Metadata:    tt.metadata,
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = provider.Chat(context.Background(), "m", request)
+				}()
+			}
+			if tt.wantCoalesced > 0 {
+				waitWaiters(t, &provider.chats, 3)
+			} else {
+				for calls.Load() < 3 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			close(unblock)
+			wg.Wait()
+
+			if stats := provider.Stats(); stats.Calls != tt.wantCalls || stats.Coalesced != tt.wantCoalesced {
+				t.Errorf("Stats() = %+v, want %d calls and %d coalesced", stats, tt.wantCalls, tt.wantCoalesced)
+			}
+		})
+	}
+}
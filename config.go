@@ -0,0 +1,672 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config 是 Service 的声明式配置，可以从 YAML 或 JSON 文件加载：
+//
+//	providers:
+//	  local:
+//	    type: ollama
+//	    endpoint: http://localhost:11434
+//	    embed_model: nomic-embed-text
+//	    timeout: 2m
+//	    aliases:
+//	      chat: qwen2.5:7b
+//	  gpu:
+//	    type: ollama
+//	    endpoint: https://gpu.example.com
+//	    api_key: ${GPU_OLLAMA_TOKEN}
+//	    rate_limit:
+//	      requests_per_minute: 600
+//	      max_concurrency: 16
+//	retry:
+//	  max_attempts: 3
+//	  initial_backoff: 500ms
+//	routes:
+//	  smart:
+//	    provider: gpu
+//	    model: qwen2.5:72b
+//	    rules:
+//	      - images: true
+//	        model: llava:34b
+//
+// 字符串中的 ${NAME} 会替换为环境变量的值，${NAME:-default} 在变量未设置时使用默认值
+type Config struct {
+	Providers map[string]ProviderConfig `json:"providers"`  // 以注册名为键的提供者配置
+	Retry     *RetryPolicy              `json:"retry"`      // 所有提供者默认的重试策略
+	RateLimit *RateLimitPolicy          `json:"rate_limit"` // 所有提供者默认的限流策略
+	Routes    map[string]Route          `json:"routes"`     // 以路由名为键的路由表，见 Service.SetRoute
+}
+
+// ProviderConfig 是单个提供者的配置
+type ProviderConfig struct {
+	Type           string            `json:"type"`            // 提供者类型，为空时使用注册名，见 RegisterProviderType
+	Endpoint       string            `json:"endpoint"`        // 服务地址
+	APIKey         string            `json:"api_key"`         // 以 Authorization: Bearer 头发送的凭据，通常写作 ${ENV_NAME}
+	Headers        map[string]string `json:"headers"`         // 每个请求附加的 HTTP 头
+	EmbedModel     string            `json:"embed_model"`     // 默认嵌入模型
+	Timeout        time.Duration     `json:"timeout"`         // 单个请求（包括读取完整响应）的超时时间，0 表示不限制
+	ConnectTimeout time.Duration     `json:"connect_timeout"` // 建立连接的超时时间
+	Aliases        map[string]string `json:"aliases"`         // 模型别名，请求别名时使用对应的模型
+	Retry          *RetryPolicy      `json:"retry"`           // 覆盖默认的重试策略
+	RateLimit      *RateLimitPolicy  `json:"rate_limit"`      // 覆盖默认的限流策略
+}
+
+// RateLimitPolicy 是提供者的限流策略，值为 0 的字段表示不限制
+type RateLimitPolicy struct {
+	RequestsPerMinute int  `json:"requests_per_minute"` // 每分钟的请求数
+	Burst             int  `json:"burst"`               // 空闲后允许突发的请求数，默认 1
+	MaxConcurrency    int  `json:"max_concurrency"`     // 最大并发数
+	Adaptive          bool `json:"adaptive"`            // 为 true 时在 MaxConcurrency 以内按延迟和过载错误自适应调整并发数
+}
+
+// ConfigError 是指向具体配置项的配置错误
+type ConfigError struct {
+	Key string // 配置项的路径，如 providers.local.endpoint
+	Err error
+}
+
+// Error 返回错误信息
+func (e *ConfigError) Error() string {
+	if e.Key == "" {
+		return e.Err.Error()
+	}
+	return e.Key + ": " + e.Err.Error()
+}
+
+// Unwrap 返回底层错误
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ProviderFactory 根据配置创建名为 name 的提供者
+type ProviderFactory func(name string, config ProviderConfig) (Provider, error)
+
+// providerTypes 是已注册的提供者类型
+var providerTypes = struct {
+	factories map[string]ProviderFactory
+	mu        sync.RWMutex
+}{
+	factories: map[string]ProviderFactory{"ollama": newOllamaProviderFromConfig},
+}
+
+// RegisterProviderType 注册一种可以在配置中使用的提供者类型，重复注册会覆盖之前的工厂函数
+func RegisterProviderType(typ string, factory ProviderFactory) {
+	providerTypes.mu.Lock()
+	defer providerTypes.mu.Unlock()
+	providerTypes.factories[typ] = factory
+}
+
+// providerFactory 返回提供者类型的工厂函数
+func providerFactory(typ string) (ProviderFactory, bool) {
+	providerTypes.mu.RLock()
+	defer providerTypes.mu.RUnlock()
+	factory, ok := providerTypes.factories[typ]
+	return factory, ok
+}
+
+// LoadConfig 从文件加载配置，.json 文件按 JSON 解析，其他文件按 YAML 解析
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config *Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		config, err = parseConfig(data, true)
+	} else {
+		config, err = parseConfig(data, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig 解析 YAML 或 JSON 格式的配置并校验，以 { 开头的内容按 JSON 解析。
+// 配置错误以 *ConfigError 返回，多个错误通过 errors.Join 合并
+func ParseConfig(data []byte) (*Config, error) {
+	return parseConfig(data, bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")))
+}
+
+// parseConfig 解析并校验配置
+func parseConfig(data []byte, isJSON bool) (*Config, error) {
+	var tree any
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		var err error
+		if tree, err = parseYAML(data); err != nil {
+			return nil, err
+		}
+	}
+
+	config := &Config{}
+	d := &configDecoder{}
+	d.decode("", tree, reflect.ValueOf(config).Elem())
+	// 解码失败的配置项保持零值，继续校验以便一次报告所有错误
+	if errs := append(d.errs, config.validate()...); len(errs) > 0 {
+		return nil, joinConfigErrors(errs)
+	}
+	return config, nil
+}
+
+// Validate 校验配置，返回所有配置错误
+func (c *Config) Validate() error {
+	if errs := c.validate(); len(errs) > 0 {
+		return joinConfigErrors(errs)
+	}
+	return nil
+}
+
+// validate 校验配置
+func (c *Config) validate() []*ConfigError {
+	var errs []*ConfigError
+	add := func(key string, format string, args ...any) {
+		errs = append(errs, &ConfigError{Key: key, Err: fmt.Errorf(format, args...)})
+	}
+
+	if len(c.Providers) == 0 {
+		add("providers", "at least one provider is required")
+	}
+	for name, provider := range c.Providers {
+		key := "providers." + name
+		if name == "" {
+			add(key, "provider name cannot be empty")
+		}
+		typ := provider.providerType(name)
+		if typ == "" {
+			add(key+".type", "provider type is required")
+		} else if _, ok := providerFactory(typ); !ok {
+			add(key+".type", "unknown provider type %q", typ)
+		}
+		if provider.Endpoint != "" {
+			if u, err := url.Parse(provider.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(key+".endpoint", "invalid endpoint %q: expected an http or https URL", provider.Endpoint)
+			}
+		}
+		if provider.Timeout < 0 {
+			add(key+".timeout", "must not be negative")
+		}
+		if provider.ConnectTimeout < 0 {
+			add(key+".connect_timeout", "must not be negative")
+		}
+		for alias, model := range provider.Aliases {
+			if alias == "" {
+				add(key+".aliases", "alias name cannot be empty")
+			}
+			if model == "" {
+				add(key+".aliases."+alias, "target model cannot be empty")
+			}
+		}
+		validateRetryPolicy(key+".retry", provider.Retry, add)
+		validateRateLimitPolicy(key+".rate_limit", provider.RateLimit, add)
+	}
+	validateRetryPolicy("retry", c.Retry, add)
+	validateRateLimitPolicy("rate_limit", c.RateLimit, add)
+
+	for name, route := range c.Routes {
+		key := "routes." + name
+		if name == "" || strings.Contains(name, "/") {
+			add(key, "invalid route name %q", name)
+		}
+		if route.Model == "" {
+			add(key+".model", "model is required")
+		}
+		c.validateRouteProvider(key+".provider", route.Provider, true, add)
+		for i, rule := range route.Rules {
+			ruleKey := fmt.Sprintf("%s.rules[%d]", key, i)
+			if rule.Provider == "" && rule.Model == "" {
+				add(ruleKey, "provider or model is required")
+			}
+			c.validateRouteProvider(ruleKey+".provider", rule.Provider, false, add)
+			if rule.MinPromptTokens < 0 {
+				add(ruleKey+".min_prompt_tokens", "must not be negative")
+			}
+			if rule.MaxPromptTokens < 0 {
+				add(ruleKey+".max_prompt_tokens", "must not be negative")
+			} else if rule.MaxPromptTokens > 0 && rule.MaxPromptTokens < rule.MinPromptTokens {
+				add(ruleKey+".max_prompt_tokens", "must not be less than min_prompt_tokens")
+			}
+		}
+	}
+	return errs
+}
+
+// validateRouteProvider 校验路由引用的提供者已在配置中定义
+func (c *Config) validateRouteProvider(key, provider string, required bool, add func(key string, format string, args ...any)) {
+	if provider == "" {
+		if required {
+			add(key, "provider is required")
+		}
+		return
+	}
+	if _, ok := c.Providers[provider]; !ok {
+		add(key, "unknown provider %q", provider)
+	}
+}
+
+// validateRetryPolicy 校验重试策略
+func validateRetryPolicy(key string, policy *RetryPolicy, add func(key string, format string, args ...any)) {
+	if policy == nil {
+		return
+	}
+	if policy.MaxAttempts < 0 {
+		add(key+".max_attempts", "must not be negative")
+	}
+	if policy.InitialBackoff < 0 {
+		add(key+".initial_backoff", "must not be negative")
+	}
+	if policy.MaxBackoff < 0 {
+		add(key+".max_backoff", "must not be negative")
+	} else if policy.MaxBackoff > 0 && policy.MaxBackoff < policy.InitialBackoff {
+		add(key+".max_backoff", "must not be less than initial_backoff")
+	}
+	if policy.Multiplier != 0 && policy.Multiplier < 1 {
+		add(key+".multiplier", "must be at least 1")
+	}
+}
+
+// validateRateLimitPolicy 校验限流策略
+func validateRateLimitPolicy(key string, policy *RateLimitPolicy, add func(key string, format string, args ...any)) {
+	if policy == nil {
+		return
+	}
+	if policy.RequestsPerMinute < 0 {
+		add(key+".requests_per_minute", "must not be negative")
+	}
+	if policy.Burst < 0 {
+		add(key+".burst", "must not be negative")
+	}
+	if policy.MaxConcurrency < 0 {
+		add(key+".max_concurrency", "must not be negative")
+	}
+	if policy.Adaptive && policy.MaxConcurrency == 0 {
+		add(key+".adaptive", "requires max_concurrency")
+	}
+}
+
+// joinConfigErrors 按配置项排序后合并错误
+func joinConfigErrors(errs []*ConfigError) error {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+	joined := make([]error, len(errs))
+	for i, err := range errs {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+// providerType 返回提供者的类型，未设置时使用注册名
+func (p ProviderConfig) providerType(name string) string {
+	if p.Type != "" {
+		return p.Type
+	}
+	if _, ok := providerFactory(name); ok {
+		return name
+	}
+	return ""
+}
+
+// NewServiceFromConfig 校验配置并创建注册了所有提供者和路由的服务。
+// 每个提供者按配置依次包装并发限制、速率限制、重试和模型别名，重试的每次尝试都会重新申请限流许可
+func NewServiceFromConfig(config *Config) (Service, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config.Providers))
+	for name := range config.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	service := NewService()
+	for _, name := range names {
+		provider, err := config.newProvider(name)
+		if err != nil {
+			return nil, &ConfigError{Key: "providers." + name, Err: err}
+		}
+		if err := service.RegisterProvider(provider); err != nil {
+			return nil, &ConfigError{Key: "providers." + name, Err: err}
+		}
+	}
+	for name, route := range config.Routes {
+		if err := service.SetRoute(name, route); err != nil {
+			return nil, &ConfigError{Key: "routes." + name, Err: err}
+		}
+	}
+	return service, nil
+}
+
+// newProvider 创建并包装一个提供者
+func (c *Config) newProvider(name string) (Provider, error) {
+	pc := c.Providers[name]
+	factory, _ := providerFactory(pc.providerType(name))
+	provider, err := factory(name, pc)
+	if err != nil {
+		return nil, err
+	}
+	if provider.Name() != name {
+		return nil, fmt.Errorf("provider type %s created a provider named %q, want %q", pc.providerType(name), provider.Name(), name)
+	}
+
+	rateLimit := pc.RateLimit
+	if rateLimit == nil {
+		rateLimit = c.RateLimit
+	}
+	if rateLimit != nil {
+		if rateLimit.MaxConcurrency > 0 {
+			limits := AdaptiveLimiterConfig{
+				InitialLimit: rateLimit.MaxConcurrency,
+				MinLimit:     rateLimit.MaxConcurrency,
+				MaxLimit:     rateLimit.MaxConcurrency,
+			}
+			if rateLimit.Adaptive {
+				limits = DefaultAdaptiveLimiterConfig()
+				limits.MaxLimit = rateLimit.MaxConcurrency
+			}
+			provider = NewLimitedProvider(provider, NewAdaptiveLimiter(limits))
+		}
+		if rateLimit.RequestsPerMinute > 0 {
+			provider = NewRateLimitedProvider(provider, NewRateLimiter(rateLimit.RequestsPerMinute, rateLimit.Burst))
+		}
+	}
+
+	retryPolicy := pc.Retry
+	if retryPolicy == nil {
+		retryPolicy = c.Retry
+	}
+	if retryPolicy != nil && retryPolicy.MaxAttempts != 1 {
+		provider = NewRetryProvider(provider, *retryPolicy)
+	}
+
+	if len(pc.Aliases) > 0 {
+		provider = NewAliasProvider(provider, pc.Aliases)
+	}
+	return provider, nil
+}
+
+// newOllamaProviderFromConfig 是 ollama 类型的工厂函数
+func newOllamaProviderFromConfig(name string, config ProviderConfig) (Provider, error) {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:11434"
+	}
+	return NewOllamaProviderWithConfig(OllamaConfig{
+		Name:       name,
+		Endpoint:   endpoint,
+		EmbedModel: config.EmbedModel,
+		HTTPClient: config.HTTPClient(),
+	})
+}
+
+// HTTPClient 返回按超时、凭据和请求头配置的 HTTP 客户端，供提供者类型的工厂函数使用
+func (p ProviderConfig) HTTPClient() *http.Client {
+	if p.Timeout == 0 && p.ConnectTimeout == 0 && p.APIKey == "" && len(p.Headers) == 0 {
+		return http.DefaultClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.ConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: p.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	headers := make(http.Header, len(p.Headers)+1)
+	for name, value := range p.Headers {
+		headers.Set(name, value)
+	}
+	if p.APIKey != "" {
+		headers.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	return &http.Client{
+		Timeout:   p.Timeout,
+		Transport: &headerTransport{base: transport, headers: headers},
+	}
+}
+
+// headerTransport 为每个请求附加固定的 HTTP 头
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+// RoundTrip 发送附加了请求头的请求
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.base.RoundTrip(req)
+}
+
+// configDecoder 把解析后的 YAML 或 JSON 解码到配置结构体，记录每个错误对应的配置项
+type configDecoder struct {
+	errs []*ConfigError
+}
+
+// fail 记录一个配置错误
+func (d *configDecoder) fail(key string, format string, args ...any) {
+	d.errs = append(d.errs, &ConfigError{Key: key, Err: fmt.Errorf(format, args...)})
+}
+
+// durationType 是 time.Duration 的反射类型
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decode 把 value 解码到 dst，key 是当前配置项的路径
+func (d *configDecoder) decode(key string, value any, dst reflect.Value) {
+	if value == nil {
+		return
+	}
+
+	switch {
+	case dst.Type() == durationType:
+		s, ok := value.(string)
+		if !ok {
+			d.fail(key, "expected a duration such as \"30s\", got %s", describeConfigValue(value))
+			return
+		}
+		duration, err := time.ParseDuration(d.expand(key, s))
+		if err != nil {
+			d.fail(key, "invalid duration %q", s)
+			return
+		}
+		dst.SetInt(int64(duration))
+		return
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(dst.Type().Elem())
+		d.decode(key, value, elem.Elem())
+		dst.Set(elem)
+
+	case reflect.Struct:
+		m, ok := value.(map[string]any)
+		if !ok {
+			d.fail(key, "expected a mapping, got %s", describeConfigValue(value))
+			return
+		}
+		fields := make(map[string]reflect.Value)
+		for i := 0; i < dst.NumField(); i++ {
+			name, _, _ := strings.Cut(dst.Type().Field(i).Tag.Get("json"), ",")
+			fields[name] = dst.Field(i)
+		}
+		for _, name := range sortedKeys(m) {
+			field, ok := fields[name]
+			if !ok {
+				d.fail(joinConfigKey(key, name), "unknown key")
+				continue
+			}
+			d.decode(joinConfigKey(key, name), m[name], field)
+		}
+
+	case reflect.Map:
+		m, ok := value.(map[string]any)
+		if !ok {
+			d.fail(key, "expected a mapping, got %s", describeConfigValue(value))
+			return
+		}
+		result := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for _, name := range sortedKeys(m) {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			d.decode(joinConfigKey(key, name), m[name], elem)
+			result.SetMapIndex(reflect.ValueOf(name), elem)
+		}
+		dst.Set(result)
+
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			d.fail(key, "expected a list, got %s", describeConfigValue(value))
+			return
+		}
+		result := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			d.decode(fmt.Sprintf("%s[%d]", key, i), item, result.Index(i))
+		}
+		dst.Set(result)
+
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			dst.SetString(d.expand(key, v))
+		case json.Number:
+			dst.SetString(v.String())
+		default:
+			d.fail(key, "expected a string, got %s", describeConfigValue(value))
+		}
+
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			d.fail(key, "expected true or false, got %s", describeConfigValue(value))
+			return
+		}
+		dst.SetBool(b)
+
+	case reflect.Int, reflect.Int64:
+		n, ok := value.(json.Number)
+		if !ok {
+			d.fail(key, "expected an integer, got %s", describeConfigValue(value))
+			return
+		}
+		i, err := n.Int64()
+		if err != nil {
+			d.fail(key, "expected an integer, got %s", n)
+			return
+		}
+		dst.SetInt(i)
+
+	case reflect.Float64:
+		n, ok := value.(json.Number)
+		if !ok {
+			d.fail(key, "expected a number, got %s", describeConfigValue(value))
+			return
+		}
+		f, err := n.Float64()
+		if err != nil {
+			d.fail(key, "expected a number, got %s", n)
+			return
+		}
+		dst.SetFloat(f)
+
+	default:
+		d.fail(key, "unsupported config type %s", dst.Type())
+	}
+}
+
+// expand 替换字符串中的 ${NAME} 和 ${NAME:-default} 环境变量引用，$$ 表示字面的 $
+func (d *configDecoder) expand(key, s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			s = s[i+2:]
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				d.fail(key, "unterminated environment variable reference in %q", s)
+				return b.String()
+			}
+			name, fallback, hasFallback := strings.Cut(s[i+2:i+end], ":-")
+			if value, ok := os.LookupEnv(name); ok && (value != "" || !hasFallback) {
+				b.WriteString(value)
+			} else if hasFallback {
+				b.WriteString(fallback)
+			} else {
+				d.fail(key, "environment variable %s is not set", name)
+			}
+			s = s[i+end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[i+1:]
+		}
+	}
+}
+
+// joinConfigKey 拼接配置项路径
+func joinConfigKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// sortedKeys 返回排序后的映射键，使错误顺序稳定
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// describeConfigValue 描述配置值的类型，用于错误信息
+func describeConfigValue(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "a mapping"
+	case []any:
+		return "a list"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case json.Number:
+		return "number " + v.String()
+	case bool:
+		return fmt.Sprintf("%t", v)
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
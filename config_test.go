@@ -0,0 +1,384 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigYAML = `
+providers:
+  local:
+    type: ollama
+    endpoint: ${TEST_LLM_ENDPOINT:-http://localhost:11434}
+    embed_model: nomic-embed-text
+    timeout: 2m
+    aliases:
+      chat: qwen2.5:7b
+  gpu:
+    type: ollama
+    endpoint: https://gpu.example.com
+    api_key: ${TEST_LLM_TOKEN}
+    headers:
+      X-Team: search
+    rate_limit:
+      requests_per_minute: 600
+      max_concurrency: 16
+      adaptive: true
+retry:
+  max_attempts: 4
+  initial_backoff: 250ms
+`
+
+const testConfigJSON = `{
+  "providers": {
+    "local": {
+      "type": "ollama",
+      "endpoint": "${TEST_LLM_ENDPOINT:-http://localhost:11434}",
+      "embed_model": "nomic-embed-text",
+      "timeout": "2m",
+      "aliases": {"chat": "qwen2.5:7b"}
+    },
+    "gpu": {
+      "type": "ollama",
+      "endpoint": "https://gpu.example.com",
+      "api_key": "${TEST_LLM_TOKEN}",
+      "headers": {"X-Team": "search"},
+      "rate_limit": {"requests_per_minute": 600, "max_concurrency": 16, "adaptive": true}
+    }
+  },
+  "retry": {"max_attempts": 4, "initial_backoff": "250ms"}
+}`
+
+func TestParseConfig(t *testing.T) {
+	t.Setenv("TEST_LLM_TOKEN", "secret")
+
+	want := &Config{
+		Providers: map[string]ProviderConfig{
+			"local": {
+				Type:       "ollama",
+				Endpoint:   "http://localhost:11434",
+				EmbedModel: "nomic-embed-text",
+				Timeout:    2 * time.Minute,
+				Aliases:    map[string]string{"chat": "qwen2.5:7b"},
+			},
+			"gpu": {
+				Type:      "ollama",
+				Endpoint:  "https://gpu.example.com",
+				APIKey:    "secret",
+				Headers:   map[string]string{"X-Team": "search"},
+				RateLimit: &RateLimitPolicy{RequestsPerMinute: 600, MaxConcurrency: 16, Adaptive: true},
+			},
+		},
+		Retry: &RetryPolicy{MaxAttempts: 4, InitialBackoff: 250 * time.Millisecond},
+	}
+
+	for name, input := range map[string]string{"yaml": testConfigYAML, "json": testConfigJSON} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseConfig([]byte(input))
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("TEST_LLM_TOKEN", "secret")
+	t.Setenv("TEST_LLM_ENDPOINT", "http://ollama:11434")
+	dir := t.TempDir()
+
+	for name, input := range map[string]string{"config.yaml": testConfigYAML, "config.json": testConfigJSON} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("LoadConfig(%s) error = %v", name, err)
+		}
+		if got := config.Providers["local"].Endpoint; got != "http://ollama:11434" {
+			t.Errorf("LoadConfig(%s) endpoint = %q, want the value from the environment", name, got)
+		}
+	}
+
+	if _, err := LoadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("LoadConfig() of a missing file error = nil, want an error")
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "no providers",
+			input: "retry:\n  max_attempts: 2\n",
+			want:  []string{"providers: at least one provider is required"},
+		},
+		{
+			name: "invalid values",
+			input: `
+providers:
+  local:
+    type: openai
+    endpoint: localhost:11434
+    timeout: 10
+    retry:
+      max_attempts: -1
+  other:
+    endpoint: http://other
+    rate_limit:
+      adaptive: true
+`,
+			want: []string{
+				`providers.local.endpoint: invalid endpoint "localhost:11434"`,
+				"providers.local.retry.max_attempts: must not be negative",
+				`providers.local.timeout: expected a duration such as "30s", got number 10`,
+				"providers.local.type: unknown provider type \"openai\"",
+				"providers.other.rate_limit.adaptive: requires max_concurrency",
+				"providers.other.type: provider type is required",
+			},
+		},
+		{
+			name: "unknown keys and types",
+			input: `
+providers:
+  ollama:
+    endpiont: http://localhost
+    aliases: [a, b]
+    rate_limit:
+      burst: lots
+`,
+			want: []string{
+				"providers.ollama.aliases: expected a mapping, got a list",
+				"providers.ollama.endpiont: unknown key",
+				`providers.ollama.rate_limit.burst: expected an integer, got string "lots"`,
+			},
+		},
+		{
+			name: "invalid routes",
+			input: `
+providers:
+  ollama: {}
+routes:
+  fast:
+    provider: missing
+    model: qwen2.5
+  smart:
+    provider: ollama
+    rules:
+      - images: true
+      - tenants: [a]
+        provider: other
+`,
+			want: []string{
+				`routes.fast.provider: unknown provider "missing"`,
+				"routes.smart.model: model is required",
+				"routes.smart.rules[0]: provider or model is required",
+				`routes.smart.rules[1].provider: unknown provider "other"`,
+			},
+		},
+		{
+			name:  "unset environment variable",
+			input: `{"providers": {"ollama": {"api_key": "${TEST_LLM_UNSET_TOKEN}"}}}`,
+			want:  []string{"providers.ollama.api_key: environment variable TEST_LLM_UNSET_TOKEN is not set"},
+		},
+		{
+			name:  "invalid endpoint",
+			input: "providers:\n  ollama:\n    endpoint: ftp://example.com\n",
+			want:  []string{"providers.ollama.endpoint: invalid endpoint"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.input))
+			if err == nil {
+				t.Fatal("ParseConfig() error = nil, want an error")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("ParseConfig() error = %q, want %d errors", err, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("error %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Errorf("ParseConfig() error %T, want a *ConfigError", err)
+			}
+		})
+	}
+}
+
+func TestNewServiceFromConfig(t *testing.T) {
+	attempts := 0
+	var gotModels []string
+	RegisterProviderType("test-flaky", func(name string, config ProviderConfig) (Provider, error) {
+		return &mockProvider{
+			name: name,
+			chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+				attempts++
+				gotModels = append(gotModels, modelID)
+				if attempts == 1 {
+					return ChatResponse{}, ErrLLMNotAvailable
+				}
+				return ChatResponse{Message: Message{Content: config.EmbedModel}}, nil
+			},
+		}, nil
+	})
+
+	config, err := ParseConfig([]byte(`
+providers:
+  flaky:
+    type: test-flaky
+    embed_model: marker
+    aliases:
+      smart: big-model
+    rate_limit:
+      max_concurrency: 2
+retry:
+  max_attempts: 2
+  initial_backoff: 1ms
+routes:
+  best:
+    provider: flaky
+    model: smart
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	service, err := NewServiceFromConfig(config)
+	if err != nil {
+		t.Fatalf("NewServiceFromConfig() error = %v", err)
+	}
+
+	response, err := service.Chat(context.Background(), "", "best", ChatRequest{})
+	if err != nil {
+		t.Fatalf("Chat() error = %v, want the retry to succeed", err)
+	}
+	if response.Message.Content != "marker" {
+		t.Errorf("Chat() content = %q, want the provider created from the config", response.Message.Content)
+	}
+	if !reflect.DeepEqual(gotModels, []string{"big-model", "big-model"}) {
+		t.Errorf("provider models = %v, want the alias resolved on every attempt", gotModels)
+	}
+}
+
+func TestNewServiceFromConfigChatStream(t *testing.T) {
+	inner := &streamingMockProvider{deltas: []string{"Hel", "lo"}}
+	RegisterProviderType("test-streaming", func(name string, config ProviderConfig) (Provider, error) {
+		inner.name = name
+		return inner, nil
+	})
+
+	config, err := ParseConfig([]byte(`
+providers:
+  streaming:
+    type: test-streaming
+    aliases:
+      smart: big-model
+    rate_limit:
+      requests_per_minute: 600
+      max_concurrency: 2
+retry:
+  max_attempts: 2
+  initial_backoff: 1ms
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	service, err := NewServiceFromConfig(config)
+	if err != nil {
+		t.Fatalf("NewServiceFromConfig() error = %v", err)
+	}
+	provider, err := service.GetProvider("streaming")
+	if err != nil {
+		t.Fatalf("GetProvider() error = %v", err)
+	}
+
+	// 配置包装的并发限制、限流、重试和别名都不能丢失流式能力
+	streamer, ok := provider.(ChatStreamer)
+	if !ok {
+		t.Fatalf("configured provider %T does not implement ChatStreamer", provider)
+	}
+	var deltas []string
+	response, err := streamer.ChatStream(context.Background(), "smart", ChatRequest{}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if !reflect.DeepEqual(deltas, []string{"Hel", "lo"}) || response.Message.Content != "Hello" {
+		t.Errorf("ChatStream() deltas = %q, content = %q, want [Hel lo] and Hello", deltas, response.Message.Content)
+	}
+	if !reflect.DeepEqual(inner.models, []string{"big-model"}) {
+		t.Errorf("inner provider received models %v, want the alias resolved", inner.models)
+	}
+}
+
+func TestNewServiceFromConfigOllama(t *testing.T) {
+	var gotHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"models":[{"name":"qwen2.5:7b"}]}`))
+	}))
+	defer server.Close()
+	t.Setenv("TEST_LLM_ENDPOINT", server.URL)
+	t.Setenv("TEST_LLM_TOKEN", "secret")
+
+	config, err := ParseConfig([]byte(testConfigYAML))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	config.Providers["local"] = ProviderConfig{
+		Type:       "ollama",
+		Endpoint:   server.URL,
+		EmbedModel: "nomic-embed-text",
+		APIKey:     "${literal}",
+		Headers:    map[string]string{"X-Team": "search"},
+	}
+	service, err := NewServiceFromConfig(config)
+	if err != nil {
+		t.Fatalf("NewServiceFromConfig() error = %v", err)
+	}
+
+	providers := service.ListProviders()
+	if len(providers) != 2 {
+		t.Fatalf("ListProviders() = %v, want local and gpu", providers)
+	}
+	provider, err := service.GetProvider("local")
+	if err != nil {
+		t.Fatalf("GetProvider() error = %v", err)
+	}
+	if got := provider.GetEmbedModel(); got != "nomic-embed-text" {
+		t.Errorf("GetEmbedModel() = %q, want nomic-embed-text", got)
+	}
+	models, err := provider.ListModels(context.Background())
+	if err != nil || len(models) != 1 {
+		t.Fatalf("ListModels() = %v, %v, want one model", models, err)
+	}
+	if got := gotHeaders.Get("Authorization"); got != "Bearer ${literal}" {
+		t.Errorf("Authorization = %q, want the configured API key", got)
+	}
+	if got := gotHeaders.Get("X-Team"); got != "search" {
+		t.Errorf("X-Team = %q, want search", got)
+	}
+}
@@ -0,0 +1,271 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TokenCounter 计算一段文本的token数
+type TokenCounter func(text string) int
+
+// messageTokenOverhead 每条消息除内容外的额外token开销（角色、分隔符等）
+const messageTokenOverhead = 4
+
+// ApproxTokenCounter 是一个近似的token计数器
+// CJK字符按每个字符1个token计算，其余字符按每4个字符1个token计算
+func ApproxTokenCounter(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// isCJK 判断字符是否是中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// CountMessageTokens 使用指定的计数器计算消息列表的token数
+func CountMessageTokens(counter TokenCounter, messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += counter(msg.Content) + messageTokenOverhead
+	}
+	return total
+}
+
+// TrimStrategy 定义在消息超出上下文窗口时如何裁剪消息
+type TrimStrategy interface {
+	// Trim 裁剪可移除的历史消息，使其token数不超过budget
+	// 返回保留的消息和被移除的消息
+	Trim(ctx context.Context, history []Message, budget int, counter TokenCounter) (kept []Message, removed []Message, err error)
+}
+
+// DropOldestStrategy 从最早的消息开始逐条丢弃，直到满足预算
+type DropOldestStrategy struct{}
+
+// Trim 实现 TrimStrategy 接口
+func (DropOldestStrategy) Trim(ctx context.Context, history []Message, budget int, counter TokenCounter) ([]Message, []Message, error) {
+	start := 0
+	for start < len(history) && CountMessageTokens(counter, history[start:]) > budget {
+		start++
+	}
+	return history[start:], history[:start], nil
+}
+
+// SlidingWindowStrategy 只保留最近的 MaxMessages 条消息，
+// 如果仍超出预算，则继续丢弃最早的消息
+type SlidingWindowStrategy struct {
+	MaxMessages int // 最多保留的历史消息数，<=0 表示不限制
+}
+
+// Trim 实现 TrimStrategy 接口
+func (s SlidingWindowStrategy) Trim(ctx context.Context, history []Message, budget int, counter TokenCounter) ([]Message, []Message, error) {
+	start := 0
+	if s.MaxMessages > 0 && len(history) > s.MaxMessages {
+		start = len(history) - s.MaxMessages
+	}
+	kept, removed, err := DropOldestStrategy{}.Trim(ctx, history[start:], budget, counter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kept, append(append([]Message{}, history[:start]...), removed...), nil
+}
+
+// defaultSummaryPrompt 默认的摘要提示词
+const defaultSummaryPrompt = "Summarize the following conversation concisely, keeping facts, decisions and open questions that later turns may rely on."
+
+// SummarizeStrategy 将较早的对话轮次通过LLM总结为一条系统消息
+type SummarizeStrategy struct {
+	Service  Service // 用于生成摘要的服务
+	Provider string  // 提供者名称
+	Model    string  // 模型名称
+	Prompt   string  // 摘要提示词，为空时使用默认值
+}
+
+// Trim 实现 TrimStrategy 接口
+func (s SummarizeStrategy) Trim(ctx context.Context, history []Message, budget int, counter TokenCounter) ([]Message, []Message, error) {
+	if s.Service == nil {
+		return nil, nil, fmt.Errorf("summarize strategy requires a service")
+	}
+
+	// 先确定按丢弃策略需要移除哪些消息
+	kept, removed, _ := DropOldestStrategy{}.Trim(ctx, history, budget, counter)
+	if len(removed) == 0 {
+		return kept, removed, nil
+	}
+
+	// 摘要本身也占用预算，若放不下则多移除一条消息并重新生成摘要
+	for {
+		summary, err := s.summarize(ctx, removed)
+		if err != nil {
+			return nil, nil, err
+		}
+		withSummary := append([]Message{summary}, kept...)
+		if CountMessageTokens(counter, withSummary) <= budget {
+			return withSummary, removed, nil
+		}
+		if len(kept) == 0 {
+			// 摘要本身超出预算时直接丢弃
+			return kept, removed, nil
+		}
+		removed = append(removed, kept[0])
+		kept = kept[1:]
+	}
+}
+
+// summarize 调用LLM将消息总结为一条系统消息
+func (s SummarizeStrategy) summarize(ctx context.Context, messages []Message) (Message, error) {
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = defaultSummaryPrompt
+	}
+
+	var transcript strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	response, err := s.Service.Chat(ctx, s.Provider, s.Model, ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: transcript.String()},
+		},
+	})
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to summarize history: %w", err)
+	}
+
+	return Message{
+		Role:    "system",
+		Content: "Summary of earlier conversation: " + response.Message.Content,
+	}, nil
+}
+
+// TrimReport 描述一次上下文裁剪的结果
+type TrimReport struct {
+	Budget         int       // 可用于输入的token预算
+	OriginalTokens int       // 裁剪前的token数
+	FinalTokens    int       // 裁剪后的token数
+	Removed        []Message // 被移除的消息
+}
+
+// Trimmed 返回是否有消息被移除
+func (r TrimReport) Trimmed() bool {
+	return len(r.Removed) > 0
+}
+
+// ContextManager 在发送请求前使消息适配模型的上下文窗口
+type ContextManager struct {
+	counter        TokenCounter
+	strategy       TrimStrategy
+	reservedTokens int
+}
+
+// NewContextManager 创建一个新的上下文管理器
+// counter 为空时使用 ApproxTokenCounter，strategy 为空时使用 DropOldestStrategy
+func NewContextManager(counter TokenCounter, strategy TrimStrategy) *ContextManager {
+	if counter == nil {
+		counter = ApproxTokenCounter
+	}
+	if strategy == nil {
+		strategy = DropOldestStrategy{}
+	}
+	return &ContextManager{
+		counter:        counter,
+		strategy:       strategy,
+		reservedTokens: 512, // 默认为输出预留的token数
+	}
+}
+
+// SetReservedTokens 设置请求未指定MaxTokens时为输出预留的token数
+func (m *ContextManager) SetReservedTokens(n int) {
+	if n >= 0 {
+		m.reservedTokens = n
+	}
+}
+
+// Fit 裁剪请求中的消息以适配模型的上下文窗口
+// 系统消息和最后一条消息始终保留
+func (m *ContextManager) Fit(ctx context.Context, model ModelInfo, request ChatRequest) (ChatRequest, TrimReport, error) {
+	report := TrimReport{
+		OriginalTokens: CountMessageTokens(m.counter, request.Messages),
+	}
+	report.FinalTokens = report.OriginalTokens
+
+	// 未知上下文窗口大小时不做裁剪
+	if model.ContextWindowSize <= 0 {
+		return request, report, nil
+	}
+
+	reserved := m.reservedTokens
+	if request.MaxTokens > 0 {
+		reserved = request.MaxTokens
+	}
+	report.Budget = model.ContextWindowSize - reserved
+	if report.OriginalTokens <= report.Budget {
+		return request, report, nil
+	}
+
+	// 拆分固定消息和可裁剪的历史消息
+	var pinned, history []Message
+	last := len(request.Messages) - 1
+	for i, msg := range request.Messages {
+		if msg.Role == "system" || i == last {
+			pinned = append(pinned, msg)
+		} else {
+			history = append(history, msg)
+		}
+	}
+
+	remaining := report.Budget - CountMessageTokens(m.counter, pinned)
+	if remaining < 0 {
+		return request, report, fmt.Errorf("%w: pinned messages need %d tokens, budget is %d",
+			ErrContextWindowExceeded, report.Budget-remaining, report.Budget)
+	}
+
+	kept, removed, err := m.strategy.Trim(ctx, history, remaining, m.counter)
+	if err != nil {
+		return request, report, err
+	}
+
+	// 按原顺序重新组装：前置系统消息、保留的历史消息、最后一条消息
+	messages := make([]Message, 0, len(pinned)+len(kept))
+	messages = append(messages, pinned[:len(pinned)-1]...)
+	messages = append(messages, kept...)
+	messages = append(messages, pinned[len(pinned)-1])
+
+	report.Removed = removed
+	report.FinalTokens = CountMessageTokens(m.counter, messages)
+	if report.FinalTokens > report.Budget {
+		return request, report, fmt.Errorf("%w: %d tokens after trimming, budget is %d",
+			ErrContextWindowExceeded, report.FinalTokens, report.Budget)
+	}
+
+	request.Messages = messages
+	return request, report, nil
+}
+
+// Chat 获取模型信息、裁剪消息后调用服务执行聊天补全
+func (m *ContextManager) Chat(ctx context.Context, service Service, providerName, modelID string, request ChatRequest) (ChatResponse, TrimReport, error) {
+	model, err := service.GetModel(ctx, providerName, modelID)
+	if err != nil {
+		return ChatResponse{}, TrimReport{}, fmt.Errorf("failed to get model info: %w", err)
+	}
+
+	fitted, report, err := m.Fit(ctx, model, request)
+	if err != nil {
+		return ChatResponse{}, report, err
+	}
+
+	response, err := service.Chat(ctx, providerName, modelID, fitted)
+	return response, report, err
+}
@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// wordCounter 按空格分词计数，便于在测试中精确控制token数
+func wordCounter(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestApproxTokenCounter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{"empty", "", 0},
+		{"ascii", "abcdefgh", 2},
+		{"ascii rounding", "abcde", 2},
+		{"cjk", "你好世界", 4},
+		{"mixed", "你好 abcd", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ApproxTokenCounter(tt.input); got != tt.want {
+				t.Errorf("ApproxTokenCounter(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextManagerFit(t *testing.T) {
+	// 每条消息: 内容2个词 + 4个开销 = 6个token
+	messages := []Message{
+		{Role: "system", Content: "be nice"},
+		{Role: "user", Content: "turn one"},
+		{Role: "assistant", Content: "reply one"},
+		{Role: "user", Content: "turn two"},
+		{Role: "assistant", Content: "reply two"},
+		{Role: "user", Content: "turn three"},
+	}
+
+	tests := []struct {
+		name        string
+		strategy    TrimStrategy
+		window      int
+		wantContent []string
+		wantRemoved int
+		wantErr     error
+	}{
+		{
+			name:        "fits without trimming",
+			strategy:    DropOldestStrategy{},
+			window:      100,
+			wantContent: []string{"be nice", "turn one", "reply one", "turn two", "reply two", "turn three"},
+		},
+		{
+			name:        "unknown window",
+			strategy:    DropOldestStrategy{},
+			window:      0,
+			wantContent: []string{"be nice", "turn one", "reply one", "turn two", "reply two", "turn three"},
+		},
+		{
+			name:        "drop oldest",
+			strategy:    DropOldestStrategy{},
+			window:      10 + 24,
+			wantContent: []string{"be nice", "turn two", "reply two", "turn three"},
+			wantRemoved: 2,
+		},
+		{
+			name:        "sliding window",
+			strategy:    SlidingWindowStrategy{MaxMessages: 1},
+			window:      100,
+			wantContent: []string{"be nice", "turn one", "reply one", "turn two", "reply two", "turn three"},
+		},
+		{
+			name:        "sliding window over budget",
+			strategy:    SlidingWindowStrategy{MaxMessages: 1},
+			window:      10 + 30,
+			wantContent: []string{"be nice", "reply two", "turn three"},
+			wantRemoved: 3,
+		},
+		{
+			name:     "pinned messages exceed budget",
+			strategy: DropOldestStrategy{},
+			window:   10 + 11,
+			wantErr:  ErrContextWindowExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewContextManager(wordCounter, tt.strategy)
+			manager.SetReservedTokens(10)
+
+			got, report, err := manager.Fit(context.Background(), ModelInfo{ContextWindowSize: tt.window}, ChatRequest{Messages: messages})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Fit() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fit() error = %v", err)
+			}
+
+			var contents []string
+			for _, msg := range got.Messages {
+				contents = append(contents, msg.Content)
+			}
+			if strings.Join(contents, "|") != strings.Join(tt.wantContent, "|") {
+				t.Errorf("Fit() messages = %v, want %v", contents, tt.wantContent)
+			}
+			if len(report.Removed) != tt.wantRemoved {
+				t.Errorf("Fit() removed %d messages, want %d", len(report.Removed), tt.wantRemoved)
+			}
+			if report.FinalTokens != CountMessageTokens(wordCounter, got.Messages) {
+				t.Errorf("Fit() FinalTokens = %d, want %d", report.FinalTokens, CountMessageTokens(wordCounter, got.Messages))
+			}
+		})
+	}
+}
+
+func TestContextManagerSummarize(t *testing.T) {
+	svc := NewService()
+	var summarized string
+	_ = svc.RegisterProvider(&mockProvider{
+		name: "test-provider",
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			summarized = request.Messages[1].Content
+			return ChatResponse{Message: Message{Role: "assistant", Content: "short"}}, nil
+		},
+	})
+
+	manager := NewContextManager(wordCounter, SummarizeStrategy{
+		Service:  svc,
+		Provider: "test-provider",
+		Model:    "test-model",
+	})
+	manager.SetReservedTokens(0)
+
+	request := ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "be nice"},
+			{Role: "user", Content: "turn one"},
+			{Role: "assistant", Content: "reply one"},
+			{Role: "user", Content: "turn two"},
+		},
+	}
+
+	// 系统消息和最后一条消息占12个token，摘要占9个token，剩余空间只够摘要
+	got, report, err := manager.Fit(context.Background(), ModelInfo{ContextWindowSize: 12 + 9}, request)
+	if err != nil {
+		t.Fatalf("Fit() error = %v", err)
+	}
+
+	if len(report.Removed) != 2 {
+		t.Fatalf("Fit() removed %d messages, want 2", len(report.Removed))
+	}
+	if !strings.Contains(summarized, "user: turn one") || !strings.Contains(summarized, "assistant: reply one") {
+		t.Errorf("summary request = %q, want removed turns", summarized)
+	}
+	if len(got.Messages) != 3 || got.Messages[1].Role != "system" || !strings.Contains(got.Messages[1].Content, "short") {
+		t.Errorf("Fit() messages = %+v, want summary after system prompt", got.Messages)
+	}
+}
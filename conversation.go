@@ -0,0 +1,380 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrConversationNotFound 表示会话存储中不存在指定的会话
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationState 是会话的可序列化状态
+type ConversationState struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	SystemPrompt string    `json:"system_prompt,omitempty"`
+	Messages     []Message `json:"messages"`
+}
+
+// ConversationStore 表示按会话ID存储会话状态的接口
+type ConversationStore interface {
+	// 保存会话状态
+	Save(ctx context.Context, state ConversationState) error
+
+	// 加载会话状态，不存在时返回 ErrConversationNotFound
+	Load(ctx context.Context, id string) (ConversationState, error)
+
+	// 删除会话状态
+	Delete(ctx context.Context, id string) error
+}
+
+// Conversation 表示绑定到服务、提供者和模型的多轮对话
+type Conversation struct {
+	service      Service
+	provider     string
+	model        string
+	id           string
+	systemPrompt string
+	messages     []Message
+	template     ChatRequest
+	store        ConversationStore
+	manager      *ContextManager
+	mu           sync.Mutex
+}
+
+// NewConversation 创建一个新的会话
+func NewConversation(service Service, provider, model, id string) *Conversation {
+	return &Conversation{
+		service:  service,
+		provider: provider,
+		model:    model,
+		id:       id,
+	}
+}
+
+// LoadConversation 从存储中加载会话，并绑定到指定的服务
+func LoadConversation(ctx context.Context, service Service, store ConversationStore, id string) (*Conversation, error) {
+	state, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	conv := NewConversation(service, state.Provider, state.Model, state.ID)
+	conv.systemPrompt = state.SystemPrompt
+	conv.messages = state.Messages
+	conv.store = store
+	return conv, nil
+}
+
+// ID 返回会话ID
+func (c *Conversation) ID() string {
+	return c.id
+}
+
+// SetSystemPrompt 设置固定在所有消息之前的系统提示
+func (c *Conversation) SetSystemPrompt(prompt string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.systemPrompt = prompt
+}
+
+// SetRequestTemplate 设置发送请求时使用的参数（温度、最大token数等），其中的消息会被忽略
+func (c *Conversation) SetRequestTemplate(request ChatRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	request.Messages = nil
+	c.template = request
+}
+
+// SetStore 设置会话存储，设置后每轮对话结束时自动保存
+func (c *Conversation) SetStore(store ConversationStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+// SetContextManager 设置上下文管理器，发送前用其裁剪消息
+func (c *Conversation) SetContextManager(manager *ContextManager) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manager = manager
+}
+
+// Append 追加一条消息
+func (c *Conversation) Append(message Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, message)
+}
+
+// Messages 返回包含系统提示在内的完整消息列表
+func (c *Conversation) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buildMessages()
+}
+
+// buildMessages 组装消息列表，调用方需持有锁
+func (c *Conversation) buildMessages() []Message {
+	messages := make([]Message, 0, len(c.messages)+1)
+	if c.systemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: c.systemPrompt})
+	}
+	return append(messages, c.messages...)
+}
+
+// Send 追加一条用户消息，调用模型并追加助手回复
+func (c *Conversation) Send(ctx context.Context, content string) (ChatResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	request := c.template
+	request.Messages = append(c.buildMessages(), Message{Role: "user", Content: content})
+
+	var response ChatResponse
+	var err error
+	if c.manager != nil {
+		response, _, err = c.manager.Chat(ctx, c.service, c.provider, c.model, request)
+	} else {
+		response, err = c.service.Chat(ctx, c.provider, c.model, request)
+	}
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	reply := response.Message
+	if reply.Role == "" {
+		reply.Role = "assistant"
+	}
+	c.messages = append(c.messages, Message{Role: "user", Content: content}, reply)
+
+	if c.store != nil {
+		if err := c.store.Save(ctx, c.state()); err != nil {
+			return response, fmt.Errorf("failed to save conversation: %w", err)
+		}
+	}
+
+	return response, nil
+}
+
+// Rewind 移除最后 n 条消息（不含系统提示）
+func (c *Conversation) Rewind(n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n < 0 || n > len(c.messages) {
+		return fmt.Errorf("cannot rewind %d messages, conversation has %d", n, len(c.messages))
+	}
+	c.messages = c.messages[:len(c.messages)-n]
+	return nil
+}
+
+// Fork 以新的会话ID复制当前会话，两者之后互不影响
+func (c *Conversation) Fork(id string) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &Conversation{
+		service:      c.service,
+		provider:     c.provider,
+		model:        c.model,
+		id:           id,
+		systemPrompt: c.systemPrompt,
+		messages:     append([]Message(nil), c.messages...),
+		template:     c.template,
+		store:        c.store,
+		manager:      c.manager,
+	}
+}
+
+// Save 将会话保存到已设置的存储中
+func (c *Conversation) Save(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.store == nil {
+		return fmt.Errorf("conversation store not set")
+	}
+	return c.store.Save(ctx, c.state())
+}
+
+// State 返回会话的可序列化状态
+func (c *Conversation) State() ConversationState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state()
+}
+
+// state 返回会话状态的副本，调用方需持有锁
+func (c *Conversation) state() ConversationState {
+	return ConversationState{
+		ID:           c.id,
+		Provider:     c.provider,
+		Model:        c.model,
+		SystemPrompt: c.systemPrompt,
+		Messages:     append([]Message(nil), c.messages...),
+	}
+}
+
+// MarshalJSON 实现 json.Marshaler 接口
+func (c *Conversation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.State())
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口，服务需另外通过 NewConversation 或 LoadConversation 绑定
+func (c *Conversation) UnmarshalJSON(data []byte) error {
+	var state ConversationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = state.ID
+	c.provider = state.Provider
+	c.model = state.Model
+	c.systemPrompt = state.SystemPrompt
+	c.messages = state.Messages
+	return nil
+}
+
+// MemoryConversationStore 是基于内存的会话存储
+type MemoryConversationStore struct {
+	states map[string]ConversationState
+	mu     sync.RWMutex
+}
+
+// NewMemoryConversationStore 创建一个新的内存会话存储
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{
+		states: make(map[string]ConversationState),
+	}
+}
+
+// Save 保存会话状态
+func (s *MemoryConversationStore) Save(ctx context.Context, state ConversationState) error {
+	if state.ID == "" {
+		return fmt.Errorf("conversation id cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.Messages = append([]Message(nil), state.Messages...)
+	s.states[state.ID] = state
+	return nil
+}
+
+// Load 加载会话状态
+func (s *MemoryConversationStore) Load(ctx context.Context, id string) (ConversationState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, exists := s.states[id]
+	if !exists {
+		return ConversationState{}, fmt.Errorf("%w: %s", ErrConversationNotFound, id)
+	}
+	state.Messages = append([]Message(nil), state.Messages...)
+	return state, nil
+}
+
+// Delete 删除会话状态
+func (s *MemoryConversationStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, id)
+	return nil
+}
+
+// FileConversationStore 是基于文件的会话存储，每个会话保存为目录下的一个JSON文件
+type FileConversationStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileConversationStore 创建一个新的文件会话存储
+func NewFileConversationStore(dir string) (*FileConversationStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create conversation directory: %w", err)
+	}
+	return &FileConversationStore{dir: dir}, nil
+}
+
+// path 返回会话文件路径
+func (s *FileConversationStore) path(id string) (string, error) {
+	if !validFileID(id) {
+		return "", fmt.Errorf("invalid conversation id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// validFileID 判断 id 能否直接用作存储目录下的文件名：不能为空、不能包含路径分隔符、不能以 . 开头
+func validFileID(id string) bool {
+	return id != "" && id == filepath.Base(id) && !strings.HasPrefix(id, ".")
+}
+
+// Save 保存会话状态，先写入临时文件再重命名以保证原子性
+func (s *FileConversationStore) Save(ctx context.Context, state ConversationState) error {
+	path, err := s.path(state.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	return nil
+}
+
+// Load 加载会话状态
+func (s *FileConversationStore) Load(ctx context.Context, id string) (ConversationState, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return ConversationState{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ConversationState{}, fmt.Errorf("%w: %s", ErrConversationNotFound, id)
+	}
+	if err != nil {
+		return ConversationState{}, fmt.Errorf("failed to read conversation: %w", err)
+	}
+
+	var state ConversationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return ConversationState{}, fmt.Errorf("failed to decode conversation: %w", err)
+	}
+	return state, nil
+}
+
+// Delete 删除会话状态
+func (s *FileConversationStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newEchoService 返回一个回显最后一条消息的服务
+func newEchoService(requests *[]ChatRequest) Service {
+	svc := NewService()
+	_ = svc.RegisterProvider(&mockProvider{
+		name: "test-provider",
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			if requests != nil {
+				*requests = append(*requests, request)
+			}
+			last := request.Messages[len(request.Messages)-1]
+			return ChatResponse{Message: Message{Role: "assistant", Content: "echo: " + last.Content}}, nil
+		},
+	})
+	return svc
+}
+
+func TestConversationSend(t *testing.T) {
+	var requests []ChatRequest
+	conv := NewConversation(newEchoService(&requests), "test-provider", "test-model", "session-1")
+	conv.SetSystemPrompt("be nice")
+	conv.SetRequestTemplate(ChatRequest{Temperature: 0.3, Messages: []Message{{Role: "user", Content: "ignored"}}})
+
+	ctx := context.Background()
+	if _, err := conv.Send(ctx, "hello"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	response, err := conv.Send(ctx, "again")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if response.Message.Content != "echo: again" {
+		t.Errorf("Send() = %q, want %q", response.Message.Content, "echo: again")
+	}
+
+	want := []Message{
+		{Role: "system", Content: "be nice"},
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "echo: hello"},
+		{Role: "user", Content: "again"},
+	}
+	if !reflect.DeepEqual(requests[1].Messages, want) {
+		t.Errorf("second request messages = %+v, want %+v", requests[1].Messages, want)
+	}
+	if requests[1].Temperature != 0.3 {
+		t.Errorf("request temperature = %v, want 0.3", requests[1].Temperature)
+	}
+	if got := len(conv.Messages()); got != 5 {
+		t.Errorf("Messages() has %d messages, want 5", got)
+	}
+}
+
+func TestConversationForkAndRewind(t *testing.T) {
+	conv := NewConversation(newEchoService(nil), "test-provider", "test-model", "main")
+	ctx := context.Background()
+	_, _ = conv.Send(ctx, "one")
+
+	fork := conv.Fork("branch")
+	_, _ = fork.Send(ctx, "two")
+
+	if got := len(conv.Messages()); got != 2 {
+		t.Errorf("original has %d messages after fork sends, want 2", got)
+	}
+	if got := len(fork.Messages()); got != 4 {
+		t.Errorf("fork has %d messages, want 4", got)
+	}
+
+	if err := fork.Rewind(2); err != nil {
+		t.Fatalf("Rewind() error = %v", err)
+	}
+	if !reflect.DeepEqual(fork.Messages(), conv.Messages()) {
+		t.Errorf("rewound fork = %+v, want %+v", fork.Messages(), conv.Messages())
+	}
+	if err := fork.Rewind(3); err == nil {
+		t.Error("Rewind() past the start expected error, got nil")
+	}
+}
+
+func TestConversationJSON(t *testing.T) {
+	conv := NewConversation(newEchoService(nil), "test-provider", "test-model", "session-1")
+	conv.SetSystemPrompt("be nice")
+	_, _ = conv.Send(context.Background(), "hello")
+
+	data, err := json.Marshal(conv)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var restored Conversation
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(restored.State(), conv.State()) {
+		t.Errorf("restored state = %+v, want %+v", restored.State(), conv.State())
+	}
+}
+
+func TestConversationStores(t *testing.T) {
+	fileStore, err := NewFileConversationStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileConversationStore() error = %v", err)
+	}
+
+	stores := map[string]ConversationStore{
+		"memory": NewMemoryConversationStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			svc := newEchoService(nil)
+
+			conv := NewConversation(svc, "test-provider", "test-model", "session-1")
+			conv.SetStore(store)
+			conv.SetSystemPrompt("be nice")
+			if _, err := conv.Send(ctx, "hello"); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			loaded, err := LoadConversation(ctx, svc, store, "session-1")
+			if err != nil {
+				t.Fatalf("LoadConversation() error = %v", err)
+			}
+			if !reflect.DeepEqual(loaded.State(), conv.State()) {
+				t.Errorf("loaded state = %+v, want %+v", loaded.State(), conv.State())
+			}
+
+			if err := store.Delete(ctx, "session-1"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if _, err := store.Load(ctx, "session-1"); !errors.Is(err, ErrConversationNotFound) {
+				t.Errorf("Load() after delete error = %v, want ErrConversationNotFound", err)
+			}
+		})
+	}
+
+	if err := fileStore.Save(context.Background(), ConversationState{ID: "../escape"}); err == nil {
+		t.Error("Save() with path traversal id expected error, got nil")
+	}
+}
@@ -3,19 +3,37 @@ package llm
 import (
 	"context"
 	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/hewenyu/llm/vecmath"
 )
 
+// dimensionProbe 是探测嵌入维度时使用的文本
+const dimensionProbe = "dimension probe"
+
 // LLMEmbedder 是一个使用LLM服务进行嵌入的Embedder实现
 type LLMEmbedder struct {
 	service     Service
-	provider    string
+	provider    string // 为空时 model 是路由名，第一次使用时解析并固定为路由的目标
 	model       string
-	dimensions  int
+	dimensions  int // 期望的输出维度，0 表示由第一次嵌入结果自动确定
+	output      int // 请求的缩减输出维度，0 表示使用模型原生维度
 	maxPoolSize int
+	limiter     *AdaptiveLimiter
+	failFast    bool
+	mu          sync.RWMutex
 }
 
-// NewLLMEmbedder 创建一个新的LLM嵌入器
+// NewLLMEmbedder 创建一个新的LLM嵌入器，dimensions 为 0 时自动检测维度
+// provider 为空时 model 作为路由名，第一次嵌入或检测维度时解析一次并固定，之后修改路由表不影响该嵌入器，
+// 保证同一个嵌入器生成的向量来自同一个模型
 func NewLLMEmbedder(service Service, provider, model string, dimensions int) *LLMEmbedder {
+	if dimensions <= 0 {
+		if info, ok := LookupEmbeddingModel(model); ok {
+			dimensions = info.Dimensions
+		}
+	}
 	return &LLMEmbedder{
 		service:     service,
 		provider:    provider,
@@ -27,6 +45,8 @@ func NewLLMEmbedder(service Service, provider, model string, dimensions int) *LL
 
 // SetMaxPoolSize 设置最大并发池大小
 func (e *LLMEmbedder) SetMaxPoolSize(size int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	if size > 0 {
 		e.maxPoolSize = size
 	} else {
@@ -34,6 +54,88 @@ func (e *LLMEmbedder) SetMaxPoolSize(size int) {
 	}
 }
 
+// Dimensions 返回嵌入维度，尚未确定时返回 0
+func (e *LLMEmbedder) Dimensions() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.dimensions
+}
+
+// DetectDimensions 确定嵌入维度并返回
+// 依次使用构造时指定的维度、已知模型注册表、提供者的模型元数据，最后发送一次探测请求
+func (e *LLMEmbedder) DetectDimensions(ctx context.Context) (int, error) {
+	if dimensions := e.Dimensions(); dimensions > 0 {
+		return dimensions, nil
+	}
+
+	// 按实际嵌入使用的提供者和模型查询元数据
+	providerName, model, err := e.target()
+	if err != nil {
+		return 0, err
+	}
+
+	dimensions := 0
+	if info, ok := LookupEmbeddingModel(model); ok {
+		dimensions = info.Dimensions
+	} else if provider, err := e.service.GetProvider(providerName); err == nil {
+		if p, ok := provider.(EmbeddingModelInfoProvider); ok {
+			if info, err := p.EmbeddingModelInfo(ctx, model); err == nil {
+				dimensions = info.Dimensions
+			}
+		}
+	}
+	if dimensions == 0 {
+		embedding, err := e.Embed(ctx, dimensionProbe)
+		if err != nil {
+			return 0, fmt.Errorf("failed to probe embedding dimensions: %w", err)
+		}
+		dimensions = len(embedding)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dimensions == 0 {
+		e.dimensions = dimensions
+	}
+	return e.dimensions, nil
+}
+
+// SetOutputDimensions 请求缩减后的输出维度，0 表示恢复模型原生维度
+// 维度随请求发送给提供者，提供者返回的向量更长时在本地截断并重新归一化
+// 已知不支持缩减维度的模型或超过原生维度时返回错误
+func (e *LLMEmbedder) SetOutputDimensions(dimensions int) error {
+	if dimensions < 0 {
+		return fmt.Errorf("%w: output dimensions must not be negative", ErrInvalidRequest)
+	}
+
+	e.mu.RLock()
+	model := e.model
+	e.mu.RUnlock()
+	info, known := LookupEmbeddingModel(model)
+	if dimensions > 0 && known {
+		if !info.Matryoshka {
+			return fmt.Errorf("%w: model %s does not support reduced dimensions", ErrInvalidRequest, model)
+		}
+		if dimensions > info.Dimensions {
+			return fmt.Errorf("%w: model %s has %d dimensions, cannot output %d",
+				ErrInvalidRequest, model, info.Dimensions, dimensions)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.output = dimensions
+	switch {
+	case dimensions > 0:
+		e.dimensions = dimensions
+	case known:
+		e.dimensions = info.Dimensions
+	default:
+		e.dimensions = 0
+	}
+	return nil
+}
+
 // Embed 将内容转换为向量
 func (e *LLMEmbedder) Embed(ctx context.Context, content interface{}) ([]float64, error) {
 	// 将内容转换为字符串
@@ -50,68 +152,301 @@ func (e *LLMEmbedder) Embed(ctx context.Context, content interface{}) ([]float64
 	}
 
 	// 创建嵌入请求
+	e.mu.RLock()
+	output := e.output
+	e.mu.RUnlock()
+
 	request := EmbeddingRequest{
-		Input: textContent,
+		Input:      textContent,
+		Dimensions: output,
+	}
+
+	providerName, model, err := e.target()
+	if err != nil {
+		return nil, err
 	}
 
 	// 调用LLM服务获取嵌入
-	response, err := e.service.Embed(ctx, e.provider, e.model, request)
+	response, err := e.service.Embed(ctx, providerName, model, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get embedding: %w", err)
 	}
 
-	// 确保嵌入维度正确
-	if e.dimensions > 0 && len(response.Embedding) != e.dimensions {
-		return nil, fmt.Errorf("expected embedding dimension %d, got %d", e.dimensions, len(response.Embedding))
+	embedding := response.Embedding
+	if output > 0 && len(embedding) > output {
+		embedding = vecmath.Truncate(embedding, output)
+	}
+
+	// 确保嵌入维度正确，未指定维度时以第一次的结果为准；维度确定后只需读锁
+	e.mu.RLock()
+	dimensions := e.dimensions
+	e.mu.RUnlock()
+	if dimensions == 0 {
+		e.mu.Lock()
+		if e.dimensions == 0 {
+			e.dimensions = len(embedding)
+		}
+		dimensions = e.dimensions
+		e.mu.Unlock()
+	}
+	if len(embedding) != dimensions {
+		return nil, fmt.Errorf("expected embedding dimension %d, got %d", dimensions, len(embedding))
 	}
 
-	return response.Embedding, nil
+	return embedding, nil
 }
 
-// BatchEmbed 批量将内容转换为向量
-func (e *LLMEmbedder) BatchEmbed(ctx context.Context, contents []interface{}) ([][]float64, error) {
-	// 创建结果切片
-	results := make([][]float64, len(contents))
-	errs := make([]error, len(contents))
-
-	// 使用有限的goroutine池来处理批量嵌入
-	semaphore := make(chan struct{}, e.maxPoolSize)
-	done := make(chan int, len(contents))
-
-	// 启动工作goroutine
-	for i, content := range contents {
-		go func(idx int, c interface{}) {
-			// 获取信号量
-			semaphore <- struct{}{}
-			defer func() {
-				// 释放信号量
-				<-semaphore
-				// 通知完成
-				done <- idx
-			}()
-
-			// 执行嵌入
-			embedding, err := e.Embed(ctx, c)
-			if err != nil {
-				errs[idx] = err
-				return
+// target 返回嵌入使用的提供者和模型，提供者为空时把模型名作为路由名解析并固定下来
+func (e *LLMEmbedder) target() (string, string, error) {
+	e.mu.RLock()
+	providerName, model := e.provider, e.model
+	e.mu.RUnlock()
+	if providerName != "" {
+		return providerName, model, nil
+	}
+
+	providerName, model, err := e.service.ResolveRoute(model, RouteRequest{Embedding: true})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve embedding route: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.provider == "" {
+		e.provider, e.model = providerName, model
+		if e.dimensions == 0 {
+			if info, ok := LookupEmbeddingModel(model); ok {
+				e.dimensions = info.Dimensions
 			}
+		}
+	}
+	return e.provider, e.model, nil
+}
+
+// EmbeddingResult 是批量嵌入中单个输入的结果
+type EmbeddingResult struct {
+	Index     int       // 输入在批次中的下标
+	Embedding []float64 // 嵌入向量，失败时为空
+	Err       error     // 失败原因，快速失败模式下被取消的输入为包装了 context.Canceled 的错误
+}
+
+// SetLimiter 设置自适应并发限制器，设置后批量和流式嵌入的并发数由限制器动态调整，
+// 最多使用限制器的 MaxLimit 个工作goroutine；为空时恢复使用固定的 maxPoolSize
+func (e *LLMEmbedder) SetLimiter(limiter *AdaptiveLimiter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limiter = limiter
+}
 
-			results[idx] = embedding
-		}(i, content)
+// SetFailFast 设置 BatchEmbedDetailed 是否在第一个错误出现时取消其余的嵌入请求
+func (e *LLMEmbedder) SetFailFast(failFast bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failFast = failFast
+}
+
+// poolSettings 是批量和流式嵌入开始时读取的并发设置快照
+type poolSettings struct {
+	maxPoolSize int
+	limiter     *AdaptiveLimiter
+	failFast    bool
+}
+
+// settings 返回当前并发设置的快照，之后的 SetXxx 调用只影响新开始的批次
+func (e *LLMEmbedder) settings() poolSettings {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return poolSettings{maxPoolSize: e.maxPoolSize, limiter: e.limiter, failFast: e.failFast}
+}
+
+// BatchEmbed 批量将内容转换为向量，任一输入失败时取消其余请求并返回该错误
+func (e *LLMEmbedder) BatchEmbed(ctx context.Context, contents []interface{}) ([][]float64, error) {
+	results, err := e.batchEmbed(ctx, contents, true)
+	if err != nil {
+		return nil, fmt.Errorf("batch embedding failed: %w", err)
 	}
 
-	// 等待所有工作完成
-	for i := 0; i < len(contents); i++ {
-		<-done
+	embeddings := make([][]float64, len(results))
+	for i, result := range results {
+		embeddings[i] = result.Embedding
 	}
+	return embeddings, nil
+}
 
-	// 检查是否有错误
-	for _, err := range errs {
-		if err != nil {
-			return nil, fmt.Errorf("batch embedding failed: %w", err)
+// BatchEmbedDetailed 批量将内容转换为向量，返回每个输入各自的结果和错误
+// 成功的结果不会因其他输入失败而丢弃，调用方可以只重试 FailedIndexes 返回的输入
+func (e *LLMEmbedder) BatchEmbedDetailed(ctx context.Context, contents []interface{}) []EmbeddingResult {
+	results, _ := e.batchEmbed(ctx, contents, e.settings().failFast)
+	return results
+}
+
+// FailedIndexes 返回失败的输入下标
+func FailedIndexes(results []EmbeddingResult) []int {
+	var failed []int
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.Index)
 		}
 	}
+	return failed
+}
+
+// batchEmbed 并发嵌入所有输入，返回每个输入的结果和第一个出错的原因
+// failFast 为 true 时第一个错误出现后通过派生的上下文取消其余请求
+func (e *LLMEmbedder) batchEmbed(ctx context.Context, contents []interface{}, failFast bool) ([]EmbeddingResult, error) {
+	results := make([]EmbeddingResult, len(contents))
+	done := make([]bool, len(contents))
+
+	next := 0
+	err := e.pipeline(ctx, func(ctx context.Context) (interface{}, bool) {
+		if next >= len(contents) {
+			return nil, false
+		}
+		next++
+		return contents[next-1], true
+	}, func(result EmbeddingResult) {
+		results[result.Index] = result
+		done[result.Index] = true
+	}, failFast)
+
+	// 快速失败时未分发的输入也标记为已取消
+	for i := range results {
+		if !done[i] {
+			results[i] = EmbeddingResult{Index: i, Err: fmt.Errorf("embedding canceled: %w", context.Canceled)}
+		}
+	}
+	return results, err
+}
+
+// EmbedStream 从通道读取输入并流式返回嵌入结果，适合无法一次放入内存的语料
+// 结果按完成顺序返回，Index 为输入的序号；输入通道关闭且全部完成后结果通道关闭
+// 取消 ctx 会停止读取输入并关闭结果通道
+func (e *LLMEmbedder) EmbedStream(ctx context.Context, inputs <-chan interface{}) <-chan EmbeddingResult {
+	settings := e.settings()
+	out := make(chan EmbeddingResult, settings.maxPoolSize)
+	go func() {
+		defer close(out)
+		_ = e.pipeline(ctx, func(ctx context.Context) (interface{}, bool) {
+			select {
+			case content, ok := <-inputs:
+				return content, ok
+			case <-ctx.Done():
+				return nil, false
+			}
+		}, func(result EmbeddingResult) {
+			select {
+			case out <- result:
+			case <-ctx.Done():
+			}
+		}, settings.failFast)
+	}()
+	return out
+}
+
+// EmbedSeq 对迭代器中的输入流式嵌入，返回按完成顺序产生结果的迭代器
+// 提前结束遍历会取消其余请求
+func (e *LLMEmbedder) EmbedSeq(ctx context.Context, inputs iter.Seq[interface{}]) iter.Seq[EmbeddingResult] {
+	return func(yield func(EmbeddingResult) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		next, stop := iter.Pull(inputs)
+		defer stop()
 
-	return results, nil
+		stopped := false
+		_ = e.pipeline(ctx, func(ctx context.Context) (interface{}, bool) {
+			return next()
+		}, func(result EmbeddingResult) {
+			if !stopped && !yield(result) {
+				stopped = true
+				cancel()
+			}
+		}, e.settings().failFast)
+	}
+}
+
+// limitedEmbed 在设置了限制器时先获取并发槽位再嵌入
+func (e *LLMEmbedder) limitedEmbed(ctx context.Context, limiter *AdaptiveLimiter, content interface{}) ([]float64, error) {
+	if limiter == nil {
+		return e.Embed(ctx, content)
+	}
+	release, err := limiter.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("embedding canceled: %w", err)
+	}
+	embedding, err := e.Embed(ctx, content)
+	release(err)
+	return embedding, err
+}
+
+// embedJob 是分发给工作goroutine的一个输入
+type embedJob struct {
+	index   int
+	content interface{}
+}
+
+// pipeline 启动固定数量的工作goroutine，依次通过 next 读取输入，并在调用方的goroutine中把结果交给 emit
+// 内存占用与输入总数无关；返回第一个嵌入错误，failFast 为 true 时该错误出现后取消其余请求并停止读取输入
+func (e *LLMEmbedder) pipeline(ctx context.Context, next func(ctx context.Context) (interface{}, bool), emit func(EmbeddingResult), failFast bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	settings := e.settings()
+	workers := settings.maxPoolSize
+	if settings.limiter != nil {
+		workers = settings.limiter.MaxLimit()
+	}
+
+	jobs := make(chan embedJob)
+	results := make(chan EmbeddingResult, workers)
+
+	var firstErr error
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := EmbeddingResult{Index: job.index}
+				if err := ctx.Err(); err != nil {
+					result.Err = fmt.Errorf("embedding canceled: %w", err)
+				} else if result.Embedding, result.Err = e.limitedEmbed(ctx, settings.limiter, job.content); result.Err != nil {
+					once.Do(func() {
+						firstErr = result.Err
+						if failFast {
+							cancel()
+						}
+					})
+				}
+				results <- result
+			}
+		}()
+	}
+
+	// 读取输入并分发给工作goroutine
+	go func() {
+		defer close(jobs)
+		for index := 0; ctx.Err() == nil; index++ {
+			content, ok := next(ctx)
+			if !ok {
+				return
+			}
+			select {
+			case jobs <- embedJob{index: index, content: content}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		emit(result)
+	}
+	return firstErr
 }
@@ -2,8 +2,11 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"reflect"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 )
 
@@ -28,6 +31,20 @@ func (m *mockService) ListModels(ctx context.Context) (map[string][]ModelInfo, e
 	return nil, nil
 }
 
+func (m *mockService) SetRoute(name string, route Route) error {
+	return nil
+}
+
+func (m *mockService) RemoveRoute(name string) {}
+
+func (m *mockService) Routes() map[string]Route {
+	return nil
+}
+
+func (m *mockService) ResolveRoute(name string, request RouteRequest) (string, string, error) {
+	return "", "", ErrRouteNotFound
+}
+
 func (m *mockService) GetModel(ctx context.Context, providerName, modelID string) (ModelInfo, error) {
 	return ModelInfo{}, nil
 }
@@ -40,6 +57,10 @@ func (m *mockService) Chat(ctx context.Context, providerName, modelID string, re
 	return ChatResponse{}, nil
 }
 
+func (m *mockService) GenerateText(ctx context.Context, providerName string, params GenerateTextParams) (GenerateTextResponse, error) {
+	return GenerateTextResponse{}, nil
+}
+
 func (m *mockService) Embed(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
 	if m.embedFunc != nil {
 		return m.embedFunc(ctx, provider, model, request)
@@ -230,3 +251,332 @@ func (s stringerType) String() string {
 // func contains(s, substr string) bool {
 // 	return s != "" && substr != "" && s != substr && len(s) > len(substr) && s[len(s)-len(substr):] == substr
 // }
+
+// metadataProvider 是可以报告嵌入模型元数据的模拟提供者
+type metadataProvider struct {
+	mockProvider
+	info EmbeddingModelInfo
+}
+
+func (p *metadataProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return p.info, nil
+}
+
+func TestEmbedderConcurrentSettings(t *testing.T) {
+	embedder := NewLLMEmbedder(&mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			return EmbeddingResponse{Embedding: []float64{1, 2}}, nil
+		},
+	}, "test-provider", "test-model", 0)
+
+	// 在 -race 下检查设置与批量嵌入之间没有数据竞争
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			embedder.SetFailFast(i%2 == 0)
+			embedder.SetMaxPoolSize(i%4 + 1)
+			if i%2 == 0 {
+				embedder.SetLimiter(NewAdaptiveLimiter(AdaptiveLimiterConfig{}))
+			} else {
+				embedder.SetLimiter(nil)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := embedder.BatchEmbed(context.Background(), []interface{}{"a", "b", "c"}); err != nil {
+			t.Fatalf("BatchEmbed() error = %v", err)
+		}
+	}
+	<-done
+}
+
+func TestLookupEmbeddingModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+		found bool
+	}{
+		{"mxbai-embed-large", 1024, true},
+		{"mxbai-embed-large:latest", 1024, true},
+		{"ollama/nomic-embed-text:v1.5", 768, true},
+		{"Text-Embedding-3-Small", 1536, true},
+		{"unknown-model", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			info, found := LookupEmbeddingModel(tt.model)
+			if found != tt.found || info.Dimensions != tt.want {
+				t.Errorf("LookupEmbeddingModel(%q) = %d, %v; want %d, %v", tt.model, info.Dimensions, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestDetectDimensions(t *testing.T) {
+	var probes int
+	embedFunc := func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+		probes++
+		return EmbeddingResponse{Embedding: make([]float64, 5)}, nil
+	}
+
+	tests := []struct {
+		name       string
+		model      string
+		metadata   int
+		want       int
+		wantProbes int
+	}{
+		{"registry", "mxbai-embed-large", 0, 1024, 0},
+		{"provider metadata", "custom-model", 7, 7, 0},
+		{"probe", "custom-model", 0, 5, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes = 0
+			svc := NewService()
+			_ = svc.RegisterProvider(&metadataProvider{
+				mockProvider: mockProvider{name: "test-provider", embedFunc: embedFunc},
+				info:         EmbeddingModelInfo{Name: tt.model, Dimensions: tt.metadata},
+			})
+
+			embedder := NewLLMEmbedder(svc, "test-provider", tt.model, 0)
+			got, err := embedder.DetectDimensions(context.Background())
+			if err != nil {
+				t.Fatalf("DetectDimensions() error = %v", err)
+			}
+			if got != tt.want || embedder.Dimensions() != tt.want {
+				t.Errorf("DetectDimensions() = %d, Dimensions() = %d, want %d", got, embedder.Dimensions(), tt.want)
+			}
+			if probes != tt.wantProbes {
+				t.Errorf("DetectDimensions() sent %d probes, want %d", probes, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func TestEmbedAutoDetectsDimensions(t *testing.T) {
+	size := 3
+	embedder := NewLLMEmbedder(&mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			return EmbeddingResponse{Embedding: make([]float64, size)}, nil
+		},
+	}, "test-provider", "custom-model", 0)
+
+	ctx := context.Background()
+	if _, err := embedder.Embed(ctx, "first"); err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if embedder.Dimensions() != 3 {
+		t.Errorf("Dimensions() = %d, want 3", embedder.Dimensions())
+	}
+
+	size = 4
+	if _, err := embedder.Embed(ctx, "second"); err == nil {
+		t.Error("Embed() with changed dimensions expected error, got nil")
+	}
+}
+
+func TestSetOutputDimensions(t *testing.T) {
+	var requested int
+	embedder := NewLLMEmbedder(&mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			requested = request.Dimensions
+			// 提供者忽略维度参数，返回完整的向量
+			return EmbeddingResponse{Embedding: []float64{3, 4, 12}}, nil
+		},
+	}, "test-provider", "nomic-embed-text", 0)
+
+	if err := embedder.SetOutputDimensions(2); err != nil {
+		t.Fatalf("SetOutputDimensions() error = %v", err)
+	}
+	got, err := embedder.Embed(context.Background(), "text")
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if requested != 2 {
+		t.Errorf("request dimensions = %d, want 2", requested)
+	}
+	if !reflect.DeepEqual(got, []float64{0.6, 0.8}) {
+		t.Errorf("Embed() = %v, want [0.6 0.8]", got)
+	}
+	if embedder.Spec().Dimensions != 2 {
+		t.Errorf("Spec().Dimensions = %d, want 2", embedder.Spec().Dimensions)
+	}
+
+	if err := embedder.SetOutputDimensions(0); err != nil || embedder.Dimensions() != 768 {
+		t.Errorf("SetOutputDimensions(0) = %v, Dimensions() = %d, want nil, 768", err, embedder.Dimensions())
+	}
+	if err := embedder.SetOutputDimensions(2048); err == nil {
+		t.Error("SetOutputDimensions() above native dimensions expected error, got nil")
+	}
+	if err := NewLLMEmbedder(nil, "", "all-minilm", 0).SetOutputDimensions(128); err == nil {
+		t.Error("SetOutputDimensions() on non-Matryoshka model expected error, got nil")
+	}
+}
+
+func TestBatchEmbedDetailed(t *testing.T) {
+	mockSvc := &mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			if request.Input == "bad" {
+				return EmbeddingResponse{}, errors.New("provider error")
+			}
+			return EmbeddingResponse{Embedding: []float64{float64(len(request.Input))}}, nil
+		},
+	}
+	embedder := NewLLMEmbedder(mockSvc, "test-provider", "test-model", 1)
+
+	results := embedder.BatchEmbedDetailed(context.Background(), []interface{}{"a", "bad", "ccc", 42})
+	if got := FailedIndexes(results); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("FailedIndexes() = %v, want [1 3]", got)
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Index != i || len(results[i].Embedding) != 1 {
+			t.Errorf("result %d = %+v, want successful embedding", i, results[i])
+		}
+	}
+}
+
+func TestBatchEmbedFailFast(t *testing.T) {
+	var calls atomic.Int32
+	mockSvc := &mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			if calls.Add(1) == 1 {
+				return EmbeddingResponse{}, errors.New("provider error")
+			}
+			return EmbeddingResponse{Embedding: []float64{1}}, nil
+		},
+	}
+	embedder := NewLLMEmbedder(mockSvc, "test-provider", "test-model", 1)
+	embedder.SetMaxPoolSize(1)
+	embedder.SetFailFast(true)
+
+	contents := make([]interface{}, 50)
+	for i := range contents {
+		contents[i] = "text"
+	}
+
+	// 只有一个工作槽，第一次调用失败后其余输入都应被取消
+	results := embedder.BatchEmbedDetailed(context.Background(), contents)
+	canceled := 0
+	for _, result := range results {
+		if errors.Is(result.Err, context.Canceled) {
+			canceled++
+		}
+	}
+	if calls.Load() != 1 || canceled != len(contents)-1 {
+		t.Errorf("%d provider calls, %d canceled; want 1 call and %d canceled", calls.Load(), canceled, len(contents)-1)
+	}
+
+	calls.Store(0)
+	_, err := embedder.BatchEmbed(context.Background(), contents)
+	if err == nil || !strings.Contains(err.Error(), "provider error") {
+		t.Errorf("BatchEmbed() error = %v, want the original provider error", err)
+	}
+}
+
+func TestBatchEmbedBoundedWorkers(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	var active, maxActive, maxGoroutines atomic.Int32
+	mockSvc := &mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for {
+				m := maxActive.Load()
+				if n <= m || maxActive.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			if g := int32(runtime.NumGoroutine()); g > maxGoroutines.Load() {
+				maxGoroutines.Store(g)
+			}
+			return EmbeddingResponse{Embedding: []float64{1}}, nil
+		},
+	}
+	embedder := NewLLMEmbedder(mockSvc, "test-provider", "test-model", 1)
+	embedder.SetMaxPoolSize(4)
+
+	contents := make([]interface{}, 5000)
+	for i := range contents {
+		contents[i] = "text"
+	}
+	if _, err := embedder.BatchEmbed(context.Background(), contents); err != nil {
+		t.Fatalf("BatchEmbed() error = %v", err)
+	}
+	if maxActive.Load() > 4 {
+		t.Errorf("%d concurrent requests, want at most 4", maxActive.Load())
+	}
+	if extra := int(maxGoroutines.Load()) - baseline; extra > 16 {
+		t.Errorf("BatchEmbed() used %d extra goroutines, want a fixed pool", extra)
+	}
+}
+
+func TestEmbedStream(t *testing.T) {
+	mockSvc := &mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			return EmbeddingResponse{Embedding: []float64{float64(len(request.Input))}}, nil
+		},
+	}
+	embedder := NewLLMEmbedder(mockSvc, "test-provider", "test-model", 1)
+	embedder.SetMaxPoolSize(3)
+
+	inputs := make(chan interface{})
+	go func() {
+		defer close(inputs)
+		for i := 0; i < 100; i++ {
+			inputs <- strings.Repeat("x", i+1)
+		}
+	}()
+
+	seen := make(map[int]bool)
+	for result := range embedder.EmbedStream(context.Background(), inputs) {
+		if result.Err != nil {
+			t.Fatalf("result %d error = %v", result.Index, result.Err)
+		}
+		if result.Embedding[0] != float64(result.Index+1) {
+			t.Errorf("result %d = %v, want embedding of input %d", result.Index, result.Embedding, result.Index)
+		}
+		seen[result.Index] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("EmbedStream() returned %d results, want 100", len(seen))
+	}
+}
+
+func TestEmbedSeqEarlyStop(t *testing.T) {
+	var calls atomic.Int32
+	mockSvc := &mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			calls.Add(1)
+			return EmbeddingResponse{Embedding: []float64{1}}, nil
+		},
+	}
+	embedder := NewLLMEmbedder(mockSvc, "test-provider", "test-model", 1)
+	embedder.SetMaxPoolSize(2)
+
+	// 无限的输入序列，只取前 10 个结果
+	endless := func(yield func(interface{}) bool) {
+		for yield("text") {
+		}
+	}
+
+	received := 0
+	for result := range embedder.EmbedSeq(context.Background(), endless) {
+		if result.Err != nil {
+			t.Fatalf("result %d error = %v", result.Index, result.Err)
+		}
+		received++
+		if received == 10 {
+			break
+		}
+	}
+	if received != 10 {
+		t.Errorf("received %d results, want 10", received)
+	}
+	if n := calls.Load(); n > 20 {
+		t.Errorf("%d embedding requests after stopping at 10, want the pipeline to stop", n)
+	}
+}
@@ -2,6 +2,8 @@ package llm
 
 import (
 	"context"
+
+	"github.com/hewenyu/llm/vecmath"
 )
 
 // EmbeddingFuncFlot32 返回一个用于生成嵌入向量的函数
@@ -18,11 +20,7 @@ func NewEmbeddingFuncFlot32(provider Provider) EmbeddingFuncFlot32 {
 			return nil, err
 		}
 		// 将[]float64转换为[]float32
-		embedding := make([]float32, len(response.Embedding))
-		for i, v := range response.Embedding {
-			embedding[i] = float32(v)
-		}
-		return embedding, nil
+		return vecmath.ToFloat32(nil, response.Embedding), nil
 	}
 }
 
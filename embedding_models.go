@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// EmbeddingModelInfo 描述一个嵌入模型的输出维度和输入长度
+type EmbeddingModelInfo struct {
+	Name           string // 模型名称
+	Dimensions     int    // 原生输出维度
+	MaxInputTokens int    // 最大输入token数，可作为文本切分的块大小上限
+	Matryoshka     bool   // 是否支持缩减输出维度（Matryoshka 表示学习）
+}
+
+// EmbeddingModelInfoProvider 是可以查询嵌入模型元数据的提供者实现的可选接口
+type EmbeddingModelInfoProvider interface {
+	EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error)
+}
+
+// embeddingModels 是已知嵌入模型的注册表
+var (
+	embeddingModels = map[string]EmbeddingModelInfo{}
+	embeddingMu     sync.RWMutex
+)
+
+func init() {
+	for _, info := range []EmbeddingModelInfo{
+		{Name: "mxbai-embed-large", Dimensions: 1024, MaxInputTokens: 512, Matryoshka: true},
+		{Name: "nomic-embed-text", Dimensions: 768, MaxInputTokens: 8192, Matryoshka: true},
+		{Name: "all-minilm", Dimensions: 384, MaxInputTokens: 256},
+		{Name: "snowflake-arctic-embed", Dimensions: 1024, MaxInputTokens: 512},
+		{Name: "snowflake-arctic-embed2", Dimensions: 1024, MaxInputTokens: 8192, Matryoshka: true},
+		{Name: "bge-m3", Dimensions: 1024, MaxInputTokens: 8192},
+		{Name: "bge-large", Dimensions: 1024, MaxInputTokens: 512},
+		{Name: "granite-embedding", Dimensions: 384, MaxInputTokens: 512},
+		{Name: "text-embedding-ada-002", Dimensions: 1536, MaxInputTokens: 8191},
+		{Name: "text-embedding-3-small", Dimensions: 1536, MaxInputTokens: 8191, Matryoshka: true},
+		{Name: "text-embedding-3-large", Dimensions: 3072, MaxInputTokens: 8191, Matryoshka: true},
+		{Name: "jina-embeddings-v3", Dimensions: 1024, MaxInputTokens: 8192, Matryoshka: true},
+	} {
+		RegisterEmbeddingModel(info)
+	}
+}
+
+// RegisterEmbeddingModel 注册或覆盖一个嵌入模型的信息
+func RegisterEmbeddingModel(info EmbeddingModelInfo) {
+	embeddingMu.Lock()
+	defer embeddingMu.Unlock()
+	embeddingModels[strings.ToLower(info.Name)] = info
+}
+
+// LookupEmbeddingModel 查询嵌入模型的信息
+// 依次尝试完整名称、去掉 "provider/" 前缀和 ":tag" 后缀的名称，如 ollama/mxbai-embed-large:latest
+func LookupEmbeddingModel(model string) (EmbeddingModelInfo, bool) {
+	embeddingMu.RLock()
+	defer embeddingMu.RUnlock()
+
+	name := strings.ToLower(model)
+	if info, ok := embeddingModels[name]; ok {
+		return info, true
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if info, ok := embeddingModels[name]; ok {
+		return info, true
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	info, ok := embeddingModels[name]
+	return info, ok
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey 是一个可以访问网关的 API 密钥及其配额
+type APIKey struct {
+	Key               string `json:"key"`
+	Name              string `json:"name"`                          // 密钥名称，同时作为调度器的租户
+	RequestsPerMinute int    `json:"requests_per_minute,omitempty"` // 每分钟最多请求数，0 表示不限制
+	TokensPerDay      int    `json:"tokens_per_day,omitempty"`      // 每天最多消耗的 token 数，0 表示不限制
+}
+
+// keyUsage 记录一个密钥在当前窗口内的用量
+type keyUsage struct {
+	minute   time.Time
+	requests int
+	day      time.Time
+	tokens   int
+}
+
+// quotas 按固定时间窗口统计每个密钥的用量
+type quotas struct {
+	usage map[string]*keyUsage
+	now   func() time.Time
+	mu    sync.Mutex
+}
+
+// newQuotas 创建配额统计
+func newQuotas() *quotas {
+	return &quotas{usage: make(map[string]*keyUsage), now: time.Now}
+}
+
+// current 返回密钥在当前窗口的用量，窗口过期时重置，调用方需持有锁
+func (q *quotas) current(key string) *keyUsage {
+	now := q.now()
+	u, ok := q.usage[key]
+	if !ok {
+		u = &keyUsage{}
+		q.usage[key] = u
+	}
+	if minute := now.Truncate(time.Minute); !u.minute.Equal(minute) {
+		u.minute, u.requests = minute, 0
+	}
+	if day := now.Truncate(24 * time.Hour); !u.day.Equal(day) {
+		u.day, u.tokens = day, 0
+	}
+	return u
+}
+
+// allow 检查并计入一次请求，超出配额时返回拒绝原因
+func (q *quotas) allow(key APIKey) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.current(key.Key)
+	if key.TokensPerDay > 0 && u.tokens >= key.TokensPerDay {
+		return "daily token quota exceeded", false
+	}
+	if key.RequestsPerMinute > 0 && u.requests >= key.RequestsPerMinute {
+		return "request rate limit exceeded", false
+	}
+	u.requests++
+	return "", true
+}
+
+// reserve 在请求前预留 token：至少需要 minTokens 个，剩余配额足够时最多预留 maxTokens 个，返回实际预留的数量
+// 剩余配额不足 minTokens 时拒绝；并发请求各自占用预留的配额，不会一起超出每日配额
+func (q *quotas) reserve(key APIKey, minTokens, maxTokens int) (int, string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.current(key.Key)
+	reserved := max(minTokens, maxTokens)
+	if key.TokensPerDay > 0 {
+		remaining := key.TokensPerDay - u.tokens
+		if remaining <= 0 || minTokens > remaining {
+			return 0, "daily token quota exceeded", false
+		}
+		reserved = min(reserved, remaining)
+	}
+	u.tokens += reserved
+	return reserved, "", true
+}
+
+// settle 用请求实际消耗的 token 替换预留的 token，请求失败时 actual 为 0 即释放预留
+func (q *quotas) settle(key APIKey, reserved, actual int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.current(key.Key)
+	// 跨天后窗口已重置，扣除预留时不低于 0
+	u.tokens = max(u.tokens-reserved, 0) + actual
+}
+
+// authenticate 从 Authorization 头中读取 Bearer 密钥并查找对应的配置
+func (s *Server) authenticate(r *http.Request) (APIKey, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return APIKey{}, false
+	}
+	token = strings.TrimSpace(token)
+	for _, key := range s.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(token)) == 1 {
+			return key, true
+		}
+	}
+	return APIKey{}, false
+}
@@ -0,0 +1,646 @@
+// Package gateway 提供 OpenAI 兼容的 HTTP 网关，
+// 通过 /v1/chat/completions、/v1/completions、/v1/embeddings 和 /v1/models 暴露 llm.Service
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hewenyu/llm"
+)
+
+// 定义网关错误
+var (
+	ErrModelNotFound = errors.New("model not found")
+)
+
+// Config 是网关的配置
+type Config struct {
+	APIKeys         []APIKey // 允许访问的密钥，为空时不做认证
+	DefaultProvider string   // 模型名不带 "provider/" 前缀时使用的提供者，为空且只注册了一个提供者时使用该提供者
+	MaxBodyBytes    int64    // 请求体的最大字节数，默认 10MB
+	// DefaultMaxTokens 是请求未设置 max_tokens 时为输出预留的 token 数上限，默认 4096，
+	// 剩余配额不足时只预留剩余的部分
+	DefaultMaxTokens int
+	ErrorLog         *log.Logger // 记录 5xx 错误详情的日志，为空时使用 log.Default()
+}
+
+// Server 是 OpenAI 兼容的 HTTP 网关
+type Server struct {
+	service llm.Service
+	config  Config
+	quotas  *quotas
+	mux     *http.ServeMux
+}
+
+// NewServer 创建一个新的网关
+func NewServer(service llm.Service, config Config) *Server {
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 10 << 20
+	}
+	if config.DefaultMaxTokens <= 0 {
+		config.DefaultMaxTokens = 4096
+	}
+	if config.ErrorLog == nil {
+		config.ErrorLog = log.Default()
+	}
+	s := &Server{
+		service: service,
+		config:  config,
+		quotas:  newQuotas(),
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /v1/chat/completions", s.handle(s.chatCompletions))
+	s.mux.HandleFunc("POST /v1/completions", s.handle(s.completions))
+	s.mux.HandleFunc("POST /v1/embeddings", s.handle(s.embeddings))
+	s.mux.HandleFunc("GET /v1/models", s.handle(s.models))
+	return s
+}
+
+// ServeHTTP 实现 http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handlerFunc 是已通过认证和配额检查的请求处理函数
+type handlerFunc func(w http.ResponseWriter, r *http.Request, key APIKey)
+
+// handle 完成认证、配额检查，并把密钥名称作为租户写入 context
+func (s *Server) handle(next handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key APIKey
+		if len(s.config.APIKeys) > 0 {
+			var ok bool
+			if key, ok = s.authenticate(r); !ok {
+				writeError(w, http.StatusUnauthorized, apiError{
+					Message: "invalid or missing API key",
+					Type:    "invalid_request_error",
+					Code:    "invalid_api_key",
+				})
+				return
+			}
+			if reason, ok := s.quotas.allow(key); !ok {
+				writeError(w, http.StatusTooManyRequests, apiError{
+					Message: reason,
+					Type:    "rate_limit_error",
+					Code:    "rate_limit_exceeded",
+				})
+				return
+			}
+			if key.Name != "" {
+				r = r.WithContext(llm.WithTenant(r.Context(), key.Name))
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes)
+		next(w, r, key)
+	}
+}
+
+// reserve 在请求前为密钥预留估算的提示词 token 和 count 个请求的输出 token，返回预留的数量
+// maxTokens 为 0 时每个请求按 DefaultMaxTokens 预留，剩余配额不足时只预留剩余部分；超出每日配额时写入 429 并返回 false
+func (s *Server) reserve(w http.ResponseWriter, key APIKey, promptTokens, maxTokens, count int) (int, bool) {
+	if key.Key == "" {
+		return 0, true
+	}
+	minTokens, maxReserved := promptTokens+maxTokens*count, promptTokens+maxTokens*count
+	if maxTokens <= 0 {
+		minTokens, maxReserved = promptTokens, promptTokens+s.config.DefaultMaxTokens*count
+	}
+	reserved, reason, ok := s.quotas.reserve(key, minTokens, maxReserved)
+	if !ok {
+		writeError(w, http.StatusTooManyRequests, apiError{
+			Message: reason,
+			Type:    "rate_limit_error",
+			Code:    "rate_limit_exceeded",
+		})
+		return 0, false
+	}
+	return reserved, true
+}
+
+// settle 用实际用量结算请求前预留的 token
+func (s *Server) settle(key APIKey, reserved int, u llm.Usage) {
+	if key.Key != "" {
+		s.quotas.settle(key, reserved, u.TotalTokens)
+	}
+}
+
+// estimateUsage 返回提供者报告的用量，提供者没有报告时按提示词和已生成的文本估算，
+// 避免未报告用量或中途失败的请求不计入配额
+func estimateUsage(u llm.Usage, promptTokens int, output string) llm.Usage {
+	if u.TotalTokens > 0 {
+		return u
+	}
+	completion := llm.ApproxTokenCounter(output)
+	return llm.Usage{PromptTokens: promptTokens, CompletionTokens: completion, TotalTokens: promptTokens + completion}
+}
+
+// resolve 将 "provider/model" 形式的模型名映射到已注册的提供者和模型
+// 第一段不是已注册的提供者时，名称是 Service 的路由名则按 attrs 解析路由，
+// 否则整个名称作为默认提供者的模型名，以支持带斜杠的模型名
+func (s *Server) resolve(name string, attrs llm.RouteRequest) (llm.Provider, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: model is required", llm.ErrInvalidRequest)
+	}
+	if providerName, model, ok := strings.Cut(name, "/"); ok && model != "" {
+		if provider, err := s.service.GetProvider(providerName); err == nil {
+			return provider, model, nil
+		}
+	}
+	if providerName, model, err := s.service.ResolveRoute(name, attrs); err == nil {
+		provider, err := s.service.GetProvider(providerName)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %s: %v", ErrModelNotFound, name, err)
+		}
+		return provider, model, nil
+	}
+
+	providerName := s.config.DefaultProvider
+	if providerName == "" {
+		if providers := s.service.ListProviders(); len(providers) == 1 {
+			providerName = providers[0]
+		}
+	}
+	if providerName == "" {
+		return nil, "", fmt.Errorf("%w: %s (use provider/model)", ErrModelNotFound, name)
+	}
+	provider, err := s.service.GetProvider(providerName)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s: %v", ErrModelNotFound, name, err)
+	}
+	return provider, name, nil
+}
+
+// chatCompletions 处理 /v1/chat/completions
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request, key APIKey) {
+	var body chatCompletionRequest
+	if !decode(w, r, &body) {
+		return
+	}
+	messages, err := toMessages(body.Messages)
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	stop, err := decodeStrings(body.Stop, "stop")
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+
+	request := llm.ChatRequest{
+		Messages:         messages,
+		MaxTokens:        max(body.MaxTokens, body.MaxCompletionTokens),
+		Temperature:      body.Temperature,
+		TopP:             body.TopP,
+		FrequencyPenalty: body.FrequencyPenalty,
+		PresencePenalty:  body.PresencePenalty,
+		Stop:             stop,
+	}
+	provider, model, err := s.resolve(body.Model, llm.ChatRouteRequest(r.Context(), request))
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	completion := chatCompletion{
+		ID:      newID("chatcmpl-"),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   body.Model,
+	}
+
+	// 按估算的提示词和 max_tokens 预留 token，结束后按实际用量结算
+	promptTokens := llm.CountMessageTokens(llm.ApproxTokenCounter, request.Messages)
+	reserved, ok := s.reserve(w, key, promptTokens, request.MaxTokens, 1)
+	if !ok {
+		return
+	}
+	var usage llm.Usage
+	defer func() { s.settle(key, reserved, usage) }()
+
+	if body.Stream {
+		includeUsage := body.StreamOptions != nil && body.StreamOptions.IncludeUsage
+		usage = s.streamChat(r.Context(), w, provider, model, request, completion, includeUsage, promptTokens)
+		return
+	}
+
+	response, err := s.service.Chat(r.Context(), provider.Name(), model, request)
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	usage = estimateUsage(response.Usage, promptTokens, response.Message.Content)
+
+	role := response.Message.Role
+	if role == "" {
+		role = "assistant"
+	}
+	u := toUsage(response.Usage)
+	completion.Choices = []chatChoice{{
+		Message:      &choiceDelta{Role: role, Content: response.Message.Content},
+		FinishReason: stopReason(),
+	}}
+	completion.Usage = &u
+	writeJSON(w, http.StatusOK, completion)
+}
+
+// streamChat 以 SSE 格式流式返回聊天补全，提供者不支持流式时把完整回复作为一个增量发送
+// 返回用于结算配额的用量，提供者没有报告用量或流中途失败时按已发送的内容估算
+func (s *Server) streamChat(ctx context.Context, w http.ResponseWriter, provider llm.Provider, model string, request llm.ChatRequest, completion chatCompletion, includeUsage bool, promptTokens int) llm.Usage {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, apiError{Message: "streaming is not supported", Type: "server_error"})
+		return llm.Usage{}
+	}
+
+	completion.Object = "chat.completion.chunk"
+	started := false
+	send := func(chunk chatCompletion) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	first := true
+	var streamed strings.Builder
+	emit := func(content string) error {
+		streamed.WriteString(content)
+		d := choiceDelta{Content: content}
+		if first {
+			d.Role = "assistant"
+			first = false
+		}
+		chunk := completion
+		chunk.Choices = []chatChoice{{Delta: &d}}
+		return send(chunk)
+	}
+
+	var response llm.ChatResponse
+	var err error
+	if streamer, ok := provider.(llm.ChatStreamer); ok {
+		response, err = streamer.ChatStream(ctx, model, request, emit)
+	} else if response, err = s.service.Chat(ctx, provider.Name(), model, request); err == nil {
+		err = emit(response.Message.Content)
+	}
+	if err != nil {
+		if !started {
+			s.writeServiceError(w, err)
+			return response.Usage
+		}
+		_, apiErr := s.classify(err)
+		data, _ := json.Marshal(errorResponse{Error: apiErr})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+		return estimateUsage(response.Usage, promptTokens, streamed.String())
+	}
+	usage := estimateUsage(response.Usage, promptTokens, streamed.String())
+
+	if first {
+		_ = emit("")
+	}
+	final := completion
+	final.Choices = []chatChoice{{Delta: &choiceDelta{}, FinishReason: stopReason()}}
+	if send(final) != nil {
+		return usage
+	}
+	if includeUsage {
+		u := toUsage(usage)
+		usageChunk := completion
+		usageChunk.Choices = []chatChoice{}
+		usageChunk.Usage = &u
+		if send(usageChunk) != nil {
+			return usage
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+	return usage
+}
+
+// completions 处理 /v1/completions
+func (s *Server) completions(w http.ResponseWriter, r *http.Request, key APIKey) {
+	var body completionRequest
+	if !decode(w, r, &body) {
+		return
+	}
+	prompts, err := decodeStrings(body.Prompt, "prompt")
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	if len(prompts) == 0 {
+		s.writeServiceError(w, fmt.Errorf("%w: prompt is required", llm.ErrInvalidRequest))
+		return
+	}
+	stop, err := decodeStrings(body.Stop, "stop")
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	provider, model, err := s.resolve(body.Model, longestRouteRequest(prompts, func(prompt string) llm.RouteRequest {
+		return llm.CompletionRouteRequest(r.Context(), llm.CompletionRequest{Prompt: prompt})
+	}))
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+
+	completion := textCompletion{
+		ID:      newID("cmpl-"),
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   body.Model,
+	}
+	// 按估算的提示词和每个提示的 max_tokens 预留 token，结束后按实际用量结算
+	promptTokens := 0
+	for _, prompt := range prompts {
+		promptTokens += llm.ApproxTokenCounter(prompt)
+	}
+	reserved, ok := s.reserve(w, key, promptTokens, body.MaxTokens, len(prompts))
+	if !ok {
+		return
+	}
+	var total llm.Usage
+	defer func() { s.settle(key, reserved, total) }()
+
+	for i, prompt := range prompts {
+		response, err := s.service.Complete(r.Context(), provider.Name(), model, llm.CompletionRequest{
+			Prompt:           prompt,
+			MaxTokens:        body.MaxTokens,
+			Temperature:      body.Temperature,
+			TopP:             body.TopP,
+			FrequencyPenalty: body.FrequencyPenalty,
+			PresencePenalty:  body.PresencePenalty,
+			Stop:             stop,
+		})
+		if err != nil {
+			s.writeServiceError(w, err)
+			return
+		}
+		total = addUsage(total, estimateUsage(response.Usage, llm.ApproxTokenCounter(prompt), response.Text))
+		completion.Choices = append(completion.Choices, textChoice{
+			Index:        i,
+			Text:         response.Text,
+			FinishReason: stopReason(),
+		})
+	}
+
+	if body.Stream {
+		// 补全接口没有流式提供者，按 SSE 格式一次性返回每个候选
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		for _, choice := range completion.Choices {
+			chunk := completion
+			chunk.Choices = []textChoice{choice}
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+
+	u := toUsage(total)
+	completion.Usage = &u
+	writeJSON(w, http.StatusOK, completion)
+}
+
+// embeddings 处理 /v1/embeddings
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request, key APIKey) {
+	var body embeddingRequest
+	if !decode(w, r, &body) {
+		return
+	}
+	inputs, err := decodeStrings(body.Input, "input")
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	if len(inputs) == 0 {
+		s.writeServiceError(w, fmt.Errorf("%w: input is required", llm.ErrInvalidRequest))
+		return
+	}
+	if body.EncodingFormat != "" && body.EncodingFormat != "float" && body.EncodingFormat != "base64" {
+		s.writeServiceError(w, fmt.Errorf("%w: unsupported encoding_format %q", llm.ErrInvalidRequest, body.EncodingFormat))
+		return
+	}
+	provider, model, err := s.resolve(body.Model, llm.EmbeddingRouteRequest(r.Context(), llm.EmbeddingRequest{}))
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+
+	// 嵌入没有输出 token，按估算的输入 token 预留，完成后按实际用量结算
+	inputTokens := 0
+	for _, input := range inputs {
+		inputTokens += llm.ApproxTokenCounter(input)
+	}
+	reserved, ok := s.reserve(w, key, inputTokens, 0, 0)
+	if !ok {
+		return
+	}
+	counter := &usageService{Service: s.service}
+	defer func() { s.settle(key, reserved, estimateUsage(counter.total(), inputTokens, "")) }()
+
+	embedder := llm.NewLLMEmbedder(counter, provider.Name(), model, 0)
+	if err := embedder.SetOutputDimensions(body.Dimensions); err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+	contents := make([]interface{}, len(inputs))
+	for i, input := range inputs {
+		contents[i] = input
+	}
+	embeddings, err := embedder.BatchEmbed(r.Context(), contents)
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+
+	list := embeddingList{Object: "list", Model: body.Model}
+	for i, embedding := range embeddings {
+		var value interface{} = embedding
+		if body.EncodingFormat == "base64" {
+			value = encodeBase64(embedding)
+		}
+		list.Data = append(list.Data, embeddingData{Object: "embedding", Index: i, Embedding: value})
+	}
+	list.Usage = toUsage(counter.total())
+	writeJSON(w, http.StatusOK, list)
+}
+
+// usageService 累计经过它的嵌入请求的用量，批量嵌入时用于统计总用量
+type usageService struct {
+	llm.Service
+	usage llm.Usage
+	mu    sync.Mutex
+}
+
+// Embed 调用底层服务并累计用量
+func (u *usageService) Embed(ctx context.Context, provider, model string, request llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	response, err := u.Service.Embed(ctx, provider, model, request)
+	if err == nil {
+		u.mu.Lock()
+		u.usage = addUsage(u.usage, response.Usage)
+		u.mu.Unlock()
+	}
+	return response, err
+}
+
+// total 返回已累计的用量
+func (u *usageService) total() llm.Usage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.usage
+}
+
+// models 处理 /v1/models，模型ID为 "provider/model"
+func (s *Server) models(w http.ResponseWriter, r *http.Request, key APIKey) {
+	all, err := s.service.ListModels(r.Context())
+	if err != nil {
+		s.writeServiceError(w, err)
+		return
+	}
+
+	list := modelList{Object: "list", Data: []modelObject{}}
+	for provider, models := range all {
+		for _, model := range models {
+			list.Data = append(list.Data, modelObject{
+				ID:      provider + "/" + model.Name,
+				Object:  "model",
+				OwnedBy: provider,
+			})
+		}
+	}
+	for name, route := range s.service.Routes() {
+		list.Data = append(list.Data, modelObject{ID: name, Object: "model", OwnedBy: route.Provider})
+	}
+	sort.Slice(list.Data, func(i, j int) bool { return list.Data[i].ID < list.Data[j].ID })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// longestRouteRequest 返回多个输入中最长一个的路由属性，同一请求的所有输入发往同一个模型
+func longestRouteRequest(inputs []string, attrs func(input string) llm.RouteRequest) llm.RouteRequest {
+	var longest llm.RouteRequest
+	for i, input := range inputs {
+		if a := attrs(input); i == 0 || a.PromptTokens > longest.PromptTokens {
+			longest = a
+		}
+	}
+	return longest
+}
+
+// addUsage 累加用量
+func addUsage(a, b llm.Usage) llm.Usage {
+	return llm.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// encodeBase64 将向量编码为小端 float32 的 base64 字符串
+func encodeBase64(vector []float64) string {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// newID 生成一个带前缀的随机ID
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// decode 解析请求体，失败时写入错误响应并返回 false
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, apiError{
+			Message: fmt.Sprintf("invalid request body: %v", err),
+			Type:    "invalid_request_error",
+		})
+		return false
+	}
+	return true
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入 OpenAI 格式的错误响应
+func writeError(w http.ResponseWriter, status int, err apiError) {
+	writeJSON(w, status, errorResponse{Error: err})
+}
+
+// writeServiceError 将 llm 的错误映射为 HTTP 状态码并写入错误响应
+func (s *Server) writeServiceError(w http.ResponseWriter, err error) {
+	status, apiErr := s.classify(err)
+	writeError(w, status, apiErr)
+}
+
+// classify 将错误映射为 HTTP 状态码和 OpenAI 错误类型
+// 4xx 错误返回错误详情；5xx 错误只返回通用信息，详情记录在服务端日志中，避免泄露上游地址等内部信息
+func (s *Server) classify(err error) (int, apiError) {
+	status, apiErr := classifyError(err)
+	if status >= http.StatusInternalServerError {
+		s.config.ErrorLog.Printf("gateway: %d: %v", status, err)
+	}
+	return status, apiErr
+}
+
+// classifyError 将错误映射为 HTTP 状态码和 OpenAI 错误类型
+func classifyError(err error) (int, apiError) {
+	apiErr := apiError{Message: err.Error()}
+	switch {
+	case errors.Is(err, ErrModelNotFound):
+		apiErr.Type, apiErr.Code = "invalid_request_error", "model_not_found"
+		return http.StatusNotFound, apiErr
+	case errors.Is(err, llm.ErrContextWindowExceeded):
+		apiErr.Type, apiErr.Code = "invalid_request_error", "context_length_exceeded"
+		return http.StatusBadRequest, apiErr
+	case errors.Is(err, llm.ErrInvalidRequest):
+		apiErr.Type = "invalid_request_error"
+		return http.StatusBadRequest, apiErr
+	case errors.Is(err, llm.ErrRateLimited), errors.Is(err, llm.ErrQueueFull):
+		apiErr.Type, apiErr.Code = "rate_limit_error", "rate_limit_exceeded"
+		return http.StatusTooManyRequests, apiErr
+	case errors.Is(err, llm.ErrLLMNotAvailable), errors.Is(err, llm.ErrQueueTimeout):
+		return http.StatusServiceUnavailable, apiError{Message: "the model provider is unavailable", Type: "server_error"}
+	case errors.Is(err, llm.ErrRequestTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, apiError{Message: "the model provider timed out", Type: "server_error"}
+	default:
+		return http.StatusInternalServerError, apiError{Message: "internal server error", Type: "server_error"}
+	}
+}
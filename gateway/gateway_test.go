@@ -0,0 +1,676 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hewenyu/llm"
+)
+
+// fakeProvider 是用于测试的提供者，聊天回复 "echo: <最后一条消息>"
+type fakeProvider struct {
+	name   string
+	models []string
+	err    error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]llm.ModelInfo, error) {
+	var models []llm.ModelInfo
+	for _, name := range p.models {
+		models = append(models, llm.ModelInfo{Name: name})
+	}
+	return models, nil
+}
+
+func (p *fakeProvider) GetModel(ctx context.Context, modelID string) (llm.ModelInfo, error) {
+	return llm.ModelInfo{Name: modelID}, nil
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, modelID string, request llm.CompletionRequest) (llm.CompletionResponse, error) {
+	if p.err != nil {
+		return llm.CompletionResponse{}, p.err
+	}
+	return llm.CompletionResponse{
+		Text:  modelID + ": " + request.Prompt,
+		Usage: llm.Usage{PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5},
+	}, nil
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, modelID string, request llm.ChatRequest) (llm.ChatResponse, error) {
+	if p.err != nil {
+		return llm.ChatResponse{}, p.err
+	}
+	last := request.Messages[len(request.Messages)-1]
+	return llm.ChatResponse{
+		Message: llm.Message{Role: "assistant", Content: fmt.Sprintf("echo: %s (%d images)", last.Content, len(last.Images))},
+		Usage:   llm.Usage{PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10},
+	}, nil
+}
+
+func (p *fakeProvider) Embed(ctx context.Context, modelID string, request llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	if p.err != nil {
+		return llm.EmbeddingResponse{}, p.err
+	}
+	return llm.EmbeddingResponse{
+		Embedding: []float64{float64(len(request.Input)), 0, 0, 0},
+		Usage:     llm.Usage{PromptTokens: len(request.Input), TotalTokens: len(request.Input)},
+	}, nil
+}
+
+func (p *fakeProvider) GetEmbedModel() string { return "embed" }
+
+// streamingProvider 在 fakeProvider 的基础上支持流式聊天
+type streamingProvider struct {
+	fakeProvider
+}
+
+func (p *streamingProvider) ChatStream(ctx context.Context, modelID string, request llm.ChatRequest, fn func(delta string) error) (llm.ChatResponse, error) {
+	for _, part := range []string{"Hel", "lo", "!"} {
+		if err := fn(part); err != nil {
+			return llm.ChatResponse{}, err
+		}
+	}
+	return llm.ChatResponse{
+		Message: llm.Message{Role: "assistant", Content: "Hello!"},
+		Usage:   llm.Usage{PromptTokens: 1, CompletionTokens: 3, TotalTokens: 4},
+	}, nil
+}
+
+// unmeteredProvider 在 fakeProvider 的基础上流式发送 parts 后返回 err，不报告用量；during 在调用期间执行
+type unmeteredProvider struct {
+	fakeProvider
+	parts  []string
+	err    error
+	during func()
+}
+
+func (p *unmeteredProvider) Chat(ctx context.Context, modelID string, request llm.ChatRequest) (llm.ChatResponse, error) {
+	return p.ChatStream(ctx, modelID, request, func(string) error { return nil })
+}
+
+func (p *unmeteredProvider) ChatStream(ctx context.Context, modelID string, request llm.ChatRequest, fn func(delta string) error) (llm.ChatResponse, error) {
+	if p.during != nil {
+		p.during()
+	}
+	for _, part := range p.parts {
+		if err := fn(part); err != nil {
+			return llm.ChatResponse{}, err
+		}
+	}
+	if p.err != nil {
+		return llm.ChatResponse{}, p.err
+	}
+	return llm.ChatResponse{Message: llm.Message{Role: "assistant", Content: strings.Join(p.parts, "")}}, nil
+}
+
+// newTestServer 返回注册了 ollama（流式）和 fake 两个提供者的网关
+func newTestServer(t *testing.T, config Config) *httptest.Server {
+	t.Helper()
+	svc := llm.NewService()
+	if err := svc.RegisterProvider(&streamingProvider{fakeProvider{name: "ollama", models: []string{"qwen2.5", "llama3"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RegisterProvider(&fakeProvider{name: "fake", models: []string{"m1"}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewServer(svc, config))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// post 发送 JSON 请求并返回响应
+func post(t *testing.T, server *httptest.Server, path, key, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decodeBody 解析 JSON 响应体
+func decodeBody(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+}
+
+func TestChatCompletions(t *testing.T) {
+	server := newTestServer(t, Config{DefaultProvider: "ollama"})
+
+	tests := []struct {
+		name  string
+		body  string
+		want  string
+		model string
+	}{
+		{
+			name: "provider prefix",
+			body: `{"model":"fake/m1","messages":[{"role":"user","content":"hi"}]}`,
+			want: "echo: hi (0 images)",
+		},
+		{
+			name: "default provider",
+			body: `{"model":"qwen2.5","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+			want: "echo: hi (0 images)",
+		},
+		{
+			name: "content parts with image",
+			body: `{"model":"fake/m1","messages":[{"role":"user","content":[{"type":"text","text":"what is this"},{"type":"image_url","image_url":{"url":"data:image/png;base64,aGVsbG8="}}]}]}`,
+			want: "echo: what is this (1 images)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, server, "/v1/chat/completions", "", tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+			var completion chatCompletion
+			decodeBody(t, resp, &completion)
+			if completion.Object != "chat.completion" || len(completion.Choices) != 1 {
+				t.Fatalf("response = %+v, want one chat.completion choice", completion)
+			}
+			choice := completion.Choices[0]
+			if choice.Message.Content != tt.want || choice.Message.Role != "assistant" || *choice.FinishReason != "stop" {
+				t.Errorf("choice = %+v, want %q", choice, tt.want)
+			}
+			if completion.Usage == nil || completion.Usage.TotalTokens != 10 {
+				t.Errorf("usage = %+v, want 10 total tokens", completion.Usage)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	server := newTestServer(t, Config{})
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{"streaming provider", "ollama/qwen2.5", "Hello!"},
+		{"non-streaming provider", "fake/m1", "echo: hi (0 images)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, server, "/v1/chat/completions", "", fmt.Sprintf(
+				`{"model":%q,"stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`, tt.model))
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+			}
+
+			var content strings.Builder
+			var chunks []chatCompletion
+			done := false
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok {
+					continue
+				}
+				if data == "[DONE]" {
+					done = true
+					break
+				}
+				var chunk chatCompletion
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatalf("invalid chunk %q: %v", data, err)
+				}
+				chunks = append(chunks, chunk)
+				for _, choice := range chunk.Choices {
+					content.WriteString(choice.Delta.Content)
+				}
+			}
+
+			if !done {
+				t.Error("stream did not end with [DONE]")
+			}
+			if content.String() != tt.want {
+				t.Errorf("streamed content = %q, want %q", content.String(), tt.want)
+			}
+			if len(chunks) < 3 || chunks[0].Choices[0].Delta.Role != "assistant" || chunks[0].Object != "chat.completion.chunk" {
+				t.Fatalf("chunks = %+v, want a role chunk first", chunks)
+			}
+			finish := chunks[len(chunks)-2]
+			if finish.Choices[0].FinishReason == nil || *finish.Choices[0].FinishReason != "stop" {
+				t.Errorf("second to last chunk = %+v, want finish_reason stop", finish)
+			}
+			if last := chunks[len(chunks)-1]; last.Usage == nil || len(last.Choices) != 0 {
+				t.Errorf("last chunk = %+v, want a usage chunk", last)
+			}
+		})
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	server := newTestServer(t, Config{})
+	resp := post(t, server, "/v1/completions", "", `{"model":"fake/m1","prompt":["a","b"]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var completion textCompletion
+	decodeBody(t, resp, &completion)
+	if len(completion.Choices) != 2 || completion.Choices[1].Text != "m1: b" || completion.Choices[1].Index != 1 {
+		t.Errorf("choices = %+v, want one choice per prompt", completion.Choices)
+	}
+	if completion.Usage.TotalTokens != 10 {
+		t.Errorf("usage = %+v, want 10 total tokens", completion.Usage)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	server := newTestServer(t, Config{})
+
+	t.Run("float", func(t *testing.T) {
+		resp := post(t, server, "/v1/embeddings", "", `{"model":"fake/embed","input":["a","bbb"]}`)
+		var list struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+			Usage usage `json:"usage"`
+		}
+		decodeBody(t, resp, &list)
+		if len(list.Data) != 2 || list.Data[1].Index != 1 || list.Data[1].Embedding[0] != 3 {
+			t.Errorf("data = %+v, want one embedding per input", list.Data)
+		}
+		if list.Usage.TotalTokens != 4 {
+			t.Errorf("usage = %+v, want 4 total tokens", list.Usage)
+		}
+	})
+
+	t.Run("base64 with dimensions", func(t *testing.T) {
+		resp := post(t, server, "/v1/embeddings", "", `{"model":"fake/embed","input":"abcd","encoding_format":"base64","dimensions":2}`)
+		var list struct {
+			Data []struct {
+				Embedding string `json:"embedding"`
+			} `json:"data"`
+		}
+		decodeBody(t, resp, &list)
+		raw, err := base64.StdEncoding.DecodeString(list.Data[0].Embedding)
+		if err != nil || len(raw) != 8 {
+			t.Fatalf("embedding = %q, want 2 base64 float32 values", list.Data[0].Embedding)
+		}
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(raw)); got != 1 {
+			t.Errorf("first value = %v, want the renormalized 1", got)
+		}
+	})
+}
+
+// batchProvider 的每个嵌入请求等到整批请求都已发出后才返回，逐个嵌入时超时失败
+type batchProvider struct {
+	fakeProvider
+	started sync.WaitGroup
+}
+
+func (p *batchProvider) Embed(ctx context.Context, modelID string, request llm.EmbeddingRequest) (llm.EmbeddingResponse, error) {
+	p.started.Done()
+	done := make(chan struct{})
+	go func() {
+		p.started.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return p.fakeProvider.Embed(ctx, modelID, request)
+	case <-time.After(2 * time.Second):
+		return llm.EmbeddingResponse{}, fmt.Errorf("inputs were not embedded concurrently")
+	}
+}
+
+func TestEmbeddingsBatch(t *testing.T) {
+	provider := &batchProvider{fakeProvider: fakeProvider{name: "batch"}}
+	provider.started.Add(3)
+	svc := llm.NewService()
+	if err := svc.RegisterProvider(provider); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewServer(svc, Config{}))
+	defer server.Close()
+
+	resp := post(t, server, "/v1/embeddings", "", `{"model":"batch/embed","input":["a","bb","ccc"]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var list struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Usage usage `json:"usage"`
+	}
+	decodeBody(t, resp, &list)
+	for i, data := range list.Data {
+		if data.Index != i || data.Embedding[0] != float64(i+1) {
+			t.Errorf("data[%d] = %+v, want the embedding of input %d", i, data, i)
+		}
+	}
+	if len(list.Data) != 3 || list.Usage.TotalTokens != 6 {
+		t.Errorf("got %d embeddings with usage %+v, want 3 with 6 total tokens", len(list.Data), list.Usage)
+	}
+}
+
+func TestModels(t *testing.T) {
+	server := newTestServer(t, Config{})
+	resp, err := http.Get(server.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var list modelList
+	decodeBody(t, resp, &list)
+	var ids []string
+	for _, model := range list.Data {
+		ids = append(ids, model.ID)
+	}
+	if got := strings.Join(ids, ","); got != "fake/m1,ollama/llama3,ollama/qwen2.5" {
+		t.Errorf("model ids = %s, want provider/model for every model", got)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	svc := llm.NewService()
+	_ = svc.RegisterProvider(&fakeProvider{name: "vision", err: fmt.Errorf("wrapped: %w", llm.ErrLLMNotAvailable)})
+	_ = svc.RegisterProvider(&fakeProvider{name: "fake"})
+	_ = svc.SetRoute("smart", llm.Route{
+		Provider: "fake",
+		Model:    "small",
+		Rules: []llm.RouteRule{
+			{Images: true, Provider: "vision", Model: "llava"},
+			{Tenants: []string{"team-a"}, Model: "large"},
+			{MinPromptTokens: 5, Model: "long"},
+		},
+	})
+	server := httptest.NewServer(NewServer(svc, Config{APIKeys: []APIKey{
+		{Key: "sk-a", Name: "team-a"},
+		{Key: "sk-b", Name: "team-b"},
+	}}))
+	defer server.Close()
+
+	completionTests := []struct {
+		name   string
+		key    string
+		prompt string
+		want   string
+	}{
+		{"default target", "sk-b", "hi", "small: hi"},
+		{"tenant rule", "sk-a", "hi", "large: hi"},
+		{"prompt length rule", "sk-b", "a rather long prompt", "long: a rather long prompt"},
+	}
+	for _, tt := range completionTests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, server, "/v1/completions", tt.key, fmt.Sprintf(`{"model":"smart","prompt":%q}`, tt.prompt))
+			var completion textCompletion
+			decodeBody(t, resp, &completion)
+			if len(completion.Choices) != 1 || completion.Choices[0].Text != tt.want {
+				t.Errorf("completion = %+v, want %q", completion, tt.want)
+			}
+			if completion.Model != "smart" {
+				t.Errorf("model = %q, want the requested route name", completion.Model)
+			}
+		})
+	}
+
+	// 图像请求路由到不可用的 vision 提供者
+	image := `{"model":"smart","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,aGVsbG8="}}]}]}`
+	if resp := post(t, server, "/v1/chat/completions", "sk-b", image); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("image chat status = %d, want 503 from the vision provider", resp.StatusCode)
+	}
+	text := `{"model":"smart","messages":[{"role":"user","content":"hi"}]}`
+	if resp := post(t, server, "/v1/chat/completions", "sk-b", text); resp.StatusCode != http.StatusOK {
+		t.Errorf("text chat status = %d, want 200 from the default target", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer sk-a")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list modelList
+	decodeBody(t, resp, &list)
+	if len(list.Data) != 1 || list.Data[0].ID != "smart" || list.Data[0].OwnedBy != "fake" {
+		t.Errorf("models = %+v, want the route listed", list.Data)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	svc := llm.NewService()
+	_ = svc.RegisterProvider(&fakeProvider{name: "down", err: fmt.Errorf("wrapped: %w", llm.ErrLLMNotAvailable)})
+	_ = svc.RegisterProvider(&fakeProvider{name: "limited", err: llm.ErrRateLimited})
+	_ = svc.RegisterProvider(&fakeProvider{name: "long", err: llm.ErrContextWindowExceeded})
+	var logs bytes.Buffer
+	server := httptest.NewServer(NewServer(svc, Config{ErrorLog: log.New(&logs, "", 0)}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"unknown model", `{"model":"nope","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound, "model_not_found"},
+		{"bad json", `{"model":`, http.StatusBadRequest, ""},
+		{"no messages", `{"model":"down/m","messages":[]}`, http.StatusBadRequest, ""},
+		{"remote image", `{"model":"down/m","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`, http.StatusBadRequest, ""},
+		{"unavailable", `{"model":"down/m","messages":[{"role":"user","content":"hi"}]}`, http.StatusServiceUnavailable, ""},
+		{"rate limited", `{"model":"limited/m","messages":[{"role":"user","content":"hi"}]}`, http.StatusTooManyRequests, "rate_limit_exceeded"},
+		{"context window", `{"model":"long/m","messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, "context_length_exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, server, "/v1/chat/completions", "", tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			var body errorResponse
+			decodeBody(t, resp, &body)
+			if body.Error.Message == "" || body.Error.Code != tt.wantCode {
+				t.Errorf("error = %+v, want code %q", body.Error, tt.wantCode)
+			}
+			// 5xx 只返回通用信息，详情只写入服务端日志
+			if tt.wantStatus >= http.StatusInternalServerError && strings.Contains(body.Error.Message, "wrapped") {
+				t.Errorf("message = %q, want no upstream detail", body.Error.Message)
+			}
+		})
+	}
+	if !strings.Contains(logs.String(), "wrapped") {
+		t.Errorf("error log = %q, want the upstream detail", logs.String())
+	}
+}
+
+func TestAuthAndQuotas(t *testing.T) {
+	svc := llm.NewService()
+	_ = svc.RegisterProvider(&fakeProvider{name: "fake"})
+	gateway := NewServer(svc, Config{APIKeys: []APIKey{
+		{Key: "sk-limited", Name: "team-a", RequestsPerMinute: 2},
+		{Key: "sk-tokens", Name: "team-b", TokensPerDay: 15},
+	}})
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	gateway.quotas.now = func() time.Time { return now }
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	chat := `{"model":"fake/m","messages":[{"role":"user","content":"hi"}]}`
+	status := func(key string) int {
+		return post(t, server, "/v1/chat/completions", key, chat).StatusCode
+	}
+
+	if got := status(""); got != http.StatusUnauthorized {
+		t.Errorf("missing key status = %d, want 401", got)
+	}
+	if got := status("sk-wrong"); got != http.StatusUnauthorized {
+		t.Errorf("wrong key status = %d, want 401", got)
+	}
+
+	// 每分钟 2 个请求
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := status("sk-limited"); got != want {
+			t.Errorf("request %d status = %d, want %d", i+1, got, want)
+		}
+	}
+	now = now.Add(time.Minute)
+	if got := status("sk-limited"); got != http.StatusOK {
+		t.Errorf("status in the next minute = %d, want 200", got)
+	}
+
+	// 每天 15 个 token，每次聊天消耗 10 个
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := status("sk-tokens"); got != want {
+			t.Errorf("token request %d status = %d, want %d", i+1, got, want)
+		}
+	}
+	now = now.Add(24 * time.Hour)
+	if got := status("sk-tokens"); got != http.StatusOK {
+		t.Errorf("status on the next day = %d, want 200", got)
+	}
+}
+
+func TestTokenReservation(t *testing.T) {
+	svc := llm.NewService()
+	_ = svc.RegisterProvider(&fakeProvider{name: "fake"})
+	_ = svc.RegisterProvider(&fakeProvider{name: "down", err: llm.ErrLLMNotAvailable})
+	key := APIKey{Key: "sk-tokens", Name: "team", TokensPerDay: 100}
+	gateway := NewServer(svc, Config{APIKeys: []APIKey{key}})
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	used := func() int {
+		gateway.quotas.mu.Lock()
+		defer gateway.quotas.mu.Unlock()
+		return gateway.quotas.current(key.Key).tokens
+	}
+	chat := func(model string, maxTokens int) int {
+		body := fmt.Sprintf(`{"model":%q,"max_tokens":%d,"messages":[{"role":"user","content":"hi"}]}`, model, maxTokens)
+		return post(t, server, "/v1/chat/completions", key.Key, body).StatusCode
+	}
+
+	// max_tokens 超出剩余配额时在调用提供者之前拒绝
+	if got := chat("fake/m", 200); got != http.StatusTooManyRequests {
+		t.Errorf("oversized request status = %d, want 429", got)
+	}
+	if got := used(); got != 0 {
+		t.Errorf("tokens after rejection = %d, want 0", got)
+	}
+
+	// 结算后只计入实际用量
+	if got := chat("fake/m", 50); got != http.StatusOK {
+		t.Errorf("status = %d, want 200", got)
+	}
+	if got := used(); got != 10 {
+		t.Errorf("tokens after settlement = %d, want the 10 actually used", got)
+	}
+
+	// 失败的请求释放预留
+	if got := chat("down/m", 50); got != http.StatusServiceUnavailable {
+		t.Errorf("failing request status = %d, want 503", got)
+	}
+	if got := used(); got != 10 {
+		t.Errorf("tokens after failure = %d, want the reservation released", got)
+	}
+
+	// 预留在请求进行中占用配额，并发请求不能一起超出
+	gateway.quotas.mu.Lock()
+	gateway.quotas.current(key.Key).tokens = 0
+	gateway.quotas.mu.Unlock()
+	if _, reason, ok := gateway.quotas.reserve(key, 60, 60); !ok {
+		t.Fatalf("reserve failed: %s", reason)
+	}
+	if got := chat("fake/m", 50); got != http.StatusTooManyRequests {
+		t.Errorf("status while 60 tokens are reserved = %d, want 429", got)
+	}
+}
+
+func TestTokenEstimates(t *testing.T) {
+	key := APIKey{Key: "sk-tokens", Name: "team", TokensPerDay: 100}
+	svc := llm.NewService()
+	gateway := NewServer(svc, Config{APIKeys: []APIKey{key}, DefaultMaxTokens: 20})
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	used := func() int {
+		gateway.quotas.mu.Lock()
+		defer gateway.quotas.mu.Unlock()
+		return gateway.quotas.current(key.Key).tokens
+	}
+	reset := func() {
+		gateway.quotas.mu.Lock()
+		gateway.quotas.current(key.Key).tokens = 0
+		gateway.quotas.mu.Unlock()
+	}
+	var during int
+	_ = svc.RegisterProvider(&unmeteredProvider{fakeProvider: fakeProvider{name: "quiet"}, parts: []string{"abcd", "efgh"}, during: func() { during = used() }})
+	_ = svc.RegisterProvider(&unmeteredProvider{fakeProvider: fakeProvider{name: "broken"}, parts: []string{"abcd", "efgh"}, err: llm.ErrLLMNotAvailable})
+
+	// "hi" 估算为 5 个提示词 token，未设置 max_tokens 时按 DefaultMaxTokens 预留输出
+	chat := `{"model":"quiet/m","messages":[{"role":"user","content":"hi"}]}`
+	if resp := post(t, server, "/v1/chat/completions", key.Key, chat); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if during != 25 {
+		t.Errorf("tokens reserved during the call = %d, want 5 prompt + 20 default", during)
+	}
+	// 提供者没有报告用量时按提示词和回复估算
+	if got := used(); got != 7 {
+		t.Errorf("tokens after settlement = %d, want the estimated 5 prompt + 2 completion", got)
+	}
+
+	// 流中途失败时按已发送的内容结算
+	reset()
+	stream := `{"model":"broken/m","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	resp := post(t, server, "/v1/chat/completions", key.Key, stream)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream status = %d, want 200", resp.StatusCode)
+	}
+	// 读完响应，确保处理函数已经结算
+	data, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(data), "the model provider is unavailable") {
+		t.Errorf("stream = %q, want the error event", data)
+	}
+	if got := used(); got != 7 {
+		t.Errorf("tokens after a failed stream = %d, want the estimated 7", got)
+	}
+
+	// 估算的提示词超出剩余配额时即使未设置 max_tokens 也会拒绝
+	reset()
+	long := fmt.Sprintf(`{"model":"quiet/m","messages":[{"role":"user","content":%q}]}`, strings.Repeat("a", 400))
+	if resp := post(t, server, "/v1/chat/completions", key.Key, long); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("long prompt status = %d, want 429", resp.StatusCode)
+	}
+	if got := used(); got != 0 {
+		t.Errorf("tokens after rejection = %d, want 0", got)
+	}
+}
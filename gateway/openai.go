@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hewenyu/llm"
+)
+
+// chatCompletionRequest 是 /v1/chat/completions 的请求体
+type chatCompletionRequest struct {
+	Model               string          `json:"model"`
+	Messages            []chatMessage   `json:"messages"`
+	MaxTokens           int             `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	Temperature         float64         `json:"temperature,omitempty"`
+	TopP                float64         `json:"top_p,omitempty"`
+	FrequencyPenalty    float64         `json:"frequency_penalty,omitempty"`
+	PresencePenalty     float64         `json:"presence_penalty,omitempty"`
+	Stop                json.RawMessage `json:"stop,omitempty"`
+	Stream              bool            `json:"stream,omitempty"`
+	StreamOptions       *streamOptions  `json:"stream_options,omitempty"`
+	User                string          `json:"user,omitempty"`
+}
+
+// streamOptions 是流式响应的选项
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatMessage 是 OpenAI 格式的消息，content 可以是字符串或内容片段数组
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+	Name    string          `json:"name,omitempty"`
+}
+
+// contentPart 是多模态消息的内容片段
+type contentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// completionRequest 是 /v1/completions 的请求体
+type completionRequest struct {
+	Model            string          `json:"model"`
+	Prompt           json.RawMessage `json:"prompt"`
+	MaxTokens        int             `json:"max_tokens,omitempty"`
+	Temperature      float64         `json:"temperature,omitempty"`
+	TopP             float64         `json:"top_p,omitempty"`
+	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
+	Stop             json.RawMessage `json:"stop,omitempty"`
+	Stream           bool            `json:"stream,omitempty"`
+	User             string          `json:"user,omitempty"`
+}
+
+// embeddingRequest 是 /v1/embeddings 的请求体
+type embeddingRequest struct {
+	Model          string          `json:"model"`
+	Input          json.RawMessage `json:"input"`
+	Dimensions     int             `json:"dimensions,omitempty"`
+	EncodingFormat string          `json:"encoding_format,omitempty"`
+	User           string          `json:"user,omitempty"`
+}
+
+// usage 是 OpenAI 格式的用量
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// chatCompletion 是 /v1/chat/completions 的响应体，流式响应时 object 为 chat.completion.chunk
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+// chatChoice 是聊天响应中的一个候选，非流式响应使用 Message，流式响应使用 Delta
+type chatChoice struct {
+	Index        int           `json:"index"`
+	Message      *choiceDelta  `json:"message,omitempty"`
+	Delta        *choiceDelta  `json:"delta,omitempty"`
+	FinishReason *finishReason `json:"finish_reason"`
+}
+
+// choiceDelta 是候选的消息或增量内容
+type choiceDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+// finishReason 是生成结束的原因
+type finishReason string
+
+// stopReason 返回表示正常结束的 finish_reason
+func stopReason() *finishReason {
+	reason := finishReason("stop")
+	return &reason
+}
+
+// textCompletion 是 /v1/completions 的响应体
+type textCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []textChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+// textChoice 是文本补全响应中的一个候选
+type textChoice struct {
+	Index        int           `json:"index"`
+	Text         string        `json:"text"`
+	FinishReason *finishReason `json:"finish_reason"`
+}
+
+// embeddingList 是 /v1/embeddings 的响应体
+type embeddingList struct {
+	Object string          `json:"object"`
+	Data   []embeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  usage           `json:"usage"`
+}
+
+// embeddingData 是一条嵌入结果，encoding_format 为 base64 时 Embedding 是小端 float32 的 base64 字符串
+type embeddingData struct {
+	Object    string      `json:"object"`
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+// modelList 是 /v1/models 的响应体
+type modelList struct {
+	Object string        `json:"object"`
+	Data   []modelObject `json:"data"`
+}
+
+// modelObject 是一个模型
+type modelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// errorResponse 是 OpenAI 格式的错误响应
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// apiError 是错误的详细信息
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Param   string `json:"param,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// toUsage 转换用量
+func toUsage(u llm.Usage) usage {
+	return usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+// decodeStrings 解析字符串或字符串数组
+func decodeStrings(raw json.RawMessage, param string) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("%w: %s must be a string or an array of strings", llm.ErrInvalidRequest, param)
+	}
+	return list, nil
+}
+
+// toMessages 将 OpenAI 格式的消息转换为 llm.Message，图片只支持 data URL
+func toMessages(messages []chatMessage) ([]llm.Message, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: messages must not be empty", llm.ErrInvalidRequest)
+	}
+
+	result := make([]llm.Message, len(messages))
+	for i, m := range messages {
+		result[i] = llm.Message{Role: m.Role, Name: m.Name}
+
+		var text string
+		if err := json.Unmarshal(m.Content, &text); err == nil || len(m.Content) == 0 || string(m.Content) == "null" {
+			result[i].Content = text
+			continue
+		}
+
+		var parts []contentPart
+		if err := json.Unmarshal(m.Content, &parts); err != nil {
+			return nil, fmt.Errorf("%w: messages[%d].content must be a string or an array of content parts", llm.ErrInvalidRequest, i)
+		}
+		var content strings.Builder
+		for _, part := range parts {
+			switch part.Type {
+			case "text":
+				content.WriteString(part.Text)
+			case "image_url":
+				if part.ImageURL == nil {
+					return nil, fmt.Errorf("%w: messages[%d] image_url part has no url", llm.ErrInvalidRequest, i)
+				}
+				_, data, ok := strings.Cut(part.ImageURL.URL, ";base64,")
+				if !ok || !strings.HasPrefix(part.ImageURL.URL, "data:") {
+					return nil, fmt.Errorf("%w: messages[%d] only base64 data URLs are supported for images", llm.ErrInvalidRequest, i)
+				}
+				result[i].Images = append(result[i].Images, data)
+			default:
+				return nil, fmt.Errorf("%w: messages[%d] unsupported content part type %q", llm.ErrInvalidRequest, i, part.Type)
+			}
+		}
+		result[i].Content = content.String()
+	}
+	return result, nil
+}
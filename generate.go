@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// 处理后附件的类型
+const (
+	AttachmentTypeText  = "text"
+	AttachmentTypeImage = "image"
+)
+
+// GenerateTextResponse 表示生成文本的结果
+type GenerateTextResponse struct {
+	Text     string                 `json:"text"`
+	Usage    Usage                  `json:"usage"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// BuildChatRequest 根据生成文本参数构建聊天请求
+// 消息顺序为：系统提示、历史消息、带附件的当前提示
+func BuildChatRequest(params GenerateTextParams) (ChatRequest, error) {
+	if params.Prompt == "" && len(params.Attachments) == 0 {
+		return ChatRequest{}, fmt.Errorf("%w: prompt cannot be empty", ErrInvalidRequest)
+	}
+
+	messages := make([]Message, 0, len(params.HistoryMessages)+2)
+	if params.SystemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: params.SystemPrompt})
+	}
+	for _, msg := range params.HistoryMessages {
+		messages = append(messages, Message{Role: msg.Role, Content: msg.Content})
+	}
+
+	user, err := buildUserMessage(params.Prompt, params.Attachments)
+	if err != nil {
+		return ChatRequest{}, err
+	}
+	messages = append(messages, user)
+
+	return ChatRequest{
+		Messages:    messages,
+		MaxTokens:   params.MaxTokens,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		Stop:        params.Stop,
+	}, nil
+}
+
+// buildUserMessage 将提示和附件组装为一条用户消息
+// 文本附件内联到消息内容之前，图像附件以base64形式放入Images
+func buildUserMessage(prompt string, attachments []ProcessedAttachment) (Message, error) {
+	msg := Message{Role: "user"}
+
+	var content strings.Builder
+	for _, attachment := range attachments {
+		switch attachment.Type {
+		case AttachmentTypeText:
+			text, ok := attachment.Data.(string)
+			if !ok {
+				return Message{}, fmt.Errorf("%w: text attachment %s must contain a string", ErrInvalidRequest, attachment.SourceName)
+			}
+			fmt.Fprintf(&content, "[Attachment: %s]\n%s\n\n", attachment.SourceName, text)
+		case AttachmentTypeImage:
+			switch data := attachment.Data.(type) {
+			case string:
+				msg.Images = append(msg.Images, data)
+			case []byte:
+				msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(data))
+			default:
+				return Message{}, fmt.Errorf("%w: image attachment %s must contain base64 string or bytes", ErrInvalidRequest, attachment.SourceName)
+			}
+		default:
+			return Message{}, fmt.Errorf("%w: unsupported attachment type %q", ErrInvalidRequest, attachment.Type)
+		}
+	}
+	content.WriteString(prompt)
+
+	msg.Content = content.String()
+	return msg, nil
+}
+
+// GenerateText 根据生成文本参数执行聊天补全并返回生成的文本
+func (s *service) GenerateText(ctx context.Context, providerName string, params GenerateTextParams) (GenerateTextResponse, error) {
+	if params.Model == "" {
+		return GenerateTextResponse{}, fmt.Errorf("%w: model cannot be empty", ErrInvalidRequest)
+	}
+
+	request, err := BuildChatRequest(params)
+	if err != nil {
+		return GenerateTextResponse{}, err
+	}
+
+	response, err := s.Chat(ctx, providerName, params.Model, request)
+	if err != nil {
+		return GenerateTextResponse{}, err
+	}
+
+	return GenerateTextResponse{
+		Text:     response.Message.Content,
+		Usage:    response.Usage,
+		Metadata: response.Metadata,
+	}, nil
+}
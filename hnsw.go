@@ -0,0 +1,656 @@
+package llm
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/hewenyu/llm/vecmath"
+)
+
+// HNSWConfig 是HNSW索引的配置
+type HNSWConfig struct {
+	M              int              // 每个节点在每层的最大连接数，第0层为 2*M
+	EfConstruction int              // 构建索引时的候选列表大小
+	EfSearch       int              // 查询时的候选列表大小，越大召回率越高、速度越慢
+	Metric         SimilarityMetric // 相似度计算方式
+	Seed           int64            // 层级随机数种子，便于复现
+	// MaxTombstoneRatio 是墓碑节点占全部节点的比例上限，超过时自动重建索引，默认 0.5，为负数时不自动重建。
+	// 重建在触发它的 Upsert 或 Delete 调用中进行，期间查询和其他写入照常执行
+	MaxTombstoneRatio float64
+}
+
+// DefaultHNSWConfig 返回默认的HNSW配置
+func DefaultHNSWConfig() HNSWConfig {
+	return HNSWConfig{
+		M:                 16,
+		EfConstruction:    200,
+		EfSearch:          64,
+		Metric:            CosineSimilarity,
+		Seed:              1,
+		MaxTombstoneRatio: 0.5,
+	}
+}
+
+// hnswNode 是图中的一个节点
+type hnswNode struct {
+	doc       Document
+	vector    []float64 // 用于计算相似度的向量，余弦相似度时已归一化
+	level     int
+	neighbors [][]int // 每层的邻居节点
+	deleted   bool    // 墓碑标记，删除的节点仍参与导航但不出现在结果中
+	mu        sync.RWMutex
+}
+
+// HNSWVectorStore 是基于HNSW（分层可导航小世界图）近似最近邻索引的向量存储
+// 支持并发插入和查询，删除通过墓碑标记实现，墓碑过多时重建索引回收节点
+type HNSWVectorStore struct {
+	embed      EmbeddingFuncFlot64
+	config     HNSWConfig
+	levelMult  float64
+	dimensions int
+	nodes      []*hnswNode
+	ids        map[string]int
+	entry      int
+	maxLevel   int
+	deleted    int
+	rng        *rand.Rand
+	rngMu      sync.Mutex
+	mu         sync.RWMutex
+	// rebuildMu 在插入期间持有读锁，替换重建的图时持有写锁，
+	// 避免插入在两次获取 mu 之间时节点编号被重建改变。锁顺序为 compactMu、rebuildMu、mu
+	rebuildMu sync.RWMutex
+	compactMu sync.Mutex   // 同一时间只进行一次重建
+	journal   []hnswChange // 重建期间发生的写入，替换前重放到新图中
+	recording bool         // 是否正在记录 journal
+	onRebuild func()       // 测试使用，复制文档后、构建新图前调用
+}
+
+// hnswChange 是重建索引期间发生的一次写入
+type hnswChange struct {
+	doc     Document // 插入的文档
+	deleted string   // 删除的文档ID，非空时为删除
+}
+
+// NewHNSWVectorStore 创建一个新的HNSW向量存储，配置中未设置的字段使用默认值
+func NewHNSWVectorStore(embed EmbeddingFuncFlot64, config HNSWConfig) *HNSWVectorStore {
+	defaults := DefaultHNSWConfig()
+	if config.M <= 1 {
+		config.M = defaults.M
+	}
+	if config.EfConstruction <= 0 {
+		config.EfConstruction = defaults.EfConstruction
+	}
+	if config.EfSearch <= 0 {
+		config.EfSearch = defaults.EfSearch
+	}
+	if config.MaxTombstoneRatio == 0 {
+		config.MaxTombstoneRatio = defaults.MaxTombstoneRatio
+	}
+
+	return &HNSWVectorStore{
+		embed:     embed,
+		config:    config,
+		levelMult: 1 / math.Log(float64(config.M)),
+		ids:       make(map[string]int),
+		entry:     -1,
+		rng:       rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// SetEfSearch 设置查询时的候选列表大小
+func (s *HNSWVectorStore) SetEfSearch(ef int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ef > 0 {
+		s.config.EfSearch = ef
+	}
+}
+
+// Dimensions 返回存储中向量的维度，尚无文档时为0
+func (s *HNSWVectorStore) Dimensions() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dimensions
+}
+
+// Len 返回未删除的文档数量
+func (s *HNSWVectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ids)
+}
+
+// Upsert 插入或更新文档，已存在的文档会被标记删除后重新插入
+func (s *HNSWVectorStore) Upsert(ctx context.Context, docs ...Document) error {
+	embedded, err := embedDocuments(ctx, s.embed, s.Dimensions(), docs)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range embedded {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.insert(doc); err != nil {
+			return err
+		}
+	}
+	s.compactIfNeeded()
+	return nil
+}
+
+// Delete 将文档标记为删除
+func (s *HNSWVectorStore) Delete(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	for _, id := range ids {
+		if s.recording {
+			s.journal = append(s.journal, hnswChange{deleted: id})
+		}
+		s.tombstone(id)
+	}
+	s.mu.Unlock()
+	s.compactIfNeeded()
+	return nil
+}
+
+// Compact 只用未删除的文档重建索引，回收墓碑节点占用的内存。
+// 新图在当前图的副本之外构建，期间查询和写入照常执行，重建期间的写入在替换前重放到新图中，
+// 只有替换时短暂持有写锁
+func (s *HNSWVectorStore) Compact() {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	s.compact()
+}
+
+// compactIfNeeded 在墓碑节点比例超过 MaxTombstoneRatio 时重建索引，已有重建在进行时直接返回
+func (s *HNSWVectorStore) compactIfNeeded() {
+	if s.config.MaxTombstoneRatio < 0 || !s.needsCompaction() {
+		return
+	}
+	if !s.compactMu.TryLock() {
+		return
+	}
+	defer s.compactMu.Unlock()
+	// 等待锁期间其他调用可能已经重建
+	if s.needsCompaction() {
+		s.compact()
+	}
+}
+
+// needsCompaction 判断墓碑节点比例是否超过上限
+func (s *HNSWVectorStore) needsCompaction() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return float64(s.deleted) > s.config.MaxTombstoneRatio*float64(len(s.nodes))
+}
+
+// compactCatchUp 是替换前在写锁内重放的最大写入数，更多的写入先在锁外重放
+const compactCatchUp = 64
+
+// compact 按原插入顺序把未删除的文档插入新图并替换当前的图，调用方需持有 compactMu
+func (s *HNSWVectorStore) compact() {
+	// 在写锁内复制未删除的文档并开始记录之后的写入，复制只涉及文档本身，不构建图
+	s.mu.Lock()
+	if s.deleted == 0 {
+		s.mu.Unlock()
+		return
+	}
+	live := make([]Document, 0, len(s.ids))
+	for _, node := range s.nodes {
+		node.mu.RLock()
+		deleted := node.deleted
+		node.mu.RUnlock()
+		if !deleted {
+			live = append(live, node.doc)
+		}
+	}
+	rebuilt := NewHNSWVectorStore(s.embed, s.config)
+	rebuilt.dimensions = s.dimensions
+	s.recording, s.journal = true, nil
+	s.mu.Unlock()
+	if s.onRebuild != nil {
+		s.onRebuild()
+	}
+
+	for _, doc := range live {
+		// 维度已经校验过，插入不会失败
+		_ = rebuilt.insert(doc)
+	}
+
+	// 先在锁外重放重建期间的写入，剩余不多时再在写锁内重放并替换
+	for {
+		s.mu.Lock()
+		changes := s.journal
+		s.journal = nil
+		if len(changes) <= compactCatchUp {
+			s.mu.Unlock()
+			rebuilt.replay(changes)
+			break
+		}
+		s.mu.Unlock()
+		rebuilt.replay(changes)
+	}
+
+	// 等待进行中的插入完成连接，此后新的插入在替换完成前等待
+	s.rebuildMu.Lock()
+	defer s.rebuildMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rebuilt.replay(s.journal)
+	s.nodes = rebuilt.nodes
+	s.ids = rebuilt.ids
+	s.entry = rebuilt.entry
+	s.maxLevel = rebuilt.maxLevel
+	s.deleted = rebuilt.deleted
+	s.recording, s.journal = false, nil
+}
+
+// replay 把重建期间记录的写入应用到新图
+func (s *HNSWVectorStore) replay(changes []hnswChange) {
+	for _, change := range changes {
+		if change.deleted != "" {
+			s.mu.Lock()
+			s.tombstone(change.deleted)
+			s.mu.Unlock()
+			continue
+		}
+		_ = s.insert(change.doc)
+	}
+}
+
+// tombstone 标记删除文档，调用方需持有写锁
+func (s *HNSWVectorStore) tombstone(id string) {
+	idx, exists := s.ids[id]
+	if !exists {
+		return
+	}
+	node := s.nodes[idx]
+	node.mu.Lock()
+	node.deleted = true
+	node.mu.Unlock()
+	delete(s.ids, id)
+	s.deleted++
+}
+
+// Tombstones 返回已标记删除但仍保留在图中的节点数
+func (s *HNSWVectorStore) Tombstones() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.deleted
+}
+
+// randomLevel 按指数分布随机生成节点层级
+func (s *HNSWVectorStore) randomLevel() int {
+	s.rngMu.Lock()
+	r := s.rng.Float64()
+	s.rngMu.Unlock()
+	return int(math.Floor(-math.Log(1-r) * s.levelMult))
+}
+
+// score 计算两个索引向量的相似度
+func (s *HNSWVectorStore) score(a, b []float64) float64 {
+	if s.config.Metric == CosineSimilarity {
+		return vecmath.Dot(a, b) // 向量已归一化
+	}
+	return similarity(s.config.Metric, a, b)
+}
+
+// prepare 将向量转换为索引使用的形式
+func (s *HNSWVectorStore) prepare(vector []float64) []float64 {
+	if s.config.Metric != CosineSimilarity {
+		return vector
+	}
+	return vecmath.Normalize(vector)
+}
+
+// maxConnections 返回指定层的最大连接数
+func (s *HNSWVectorStore) maxConnections(level int) int {
+	if level == 0 {
+		return 2 * s.config.M
+	}
+	return s.config.M
+}
+
+// insert 将文档插入图中
+func (s *HNSWVectorStore) insert(doc Document) error {
+	s.rebuildMu.RLock()
+	defer s.rebuildMu.RUnlock()
+
+	level := s.randomLevel()
+	node := &hnswNode{
+		doc:       doc,
+		vector:    s.prepare(doc.Embedding),
+		level:     level,
+		neighbors: make([][]int, level+1),
+	}
+
+	// 分配节点并读取当前入口点
+	s.mu.Lock()
+	if s.dimensions == 0 {
+		s.dimensions = len(doc.Embedding)
+	}
+	if len(doc.Embedding) != s.dimensions {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: document %s has %d dimensions, expected %d",
+			ErrDimensionMismatch, doc.ID, len(doc.Embedding), s.dimensions)
+	}
+	if s.recording {
+		s.journal = append(s.journal, hnswChange{doc: doc})
+	}
+	s.tombstone(doc.ID)
+	id := len(s.nodes)
+	s.nodes = append(s.nodes, node)
+	s.ids[doc.ID] = id
+	entry, maxLevel := s.entry, s.maxLevel
+	if entry < 0 {
+		s.entry, s.maxLevel = id, level
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	// 连接到图中，此阶段只需读锁，不同插入之间通过节点锁同步
+	s.mu.RLock()
+	current := entry
+	currentScore := s.score(node.vector, s.nodes[current].vector)
+	for l := maxLevel; l > level; l-- {
+		current, currentScore = s.greedy(node.vector, current, currentScore, l)
+	}
+
+	entries := []scoredNode{{id: current, score: currentScore}}
+	for l := min(level, maxLevel); l >= 0; l-- {
+		candidates := s.searchLayer(node.vector, entries, s.config.EfConstruction, l)
+		selected := s.selectNeighbors(candidates, s.config.M)
+
+		// 并发插入的节点可能已经连接到新节点，保留这些连接
+		node.mu.Lock()
+		existing := node.neighbors[l]
+		node.neighbors[l] = make([]int, 0, len(selected)+len(existing))
+		for _, c := range selected {
+			node.neighbors[l] = append(node.neighbors[l], c.id)
+		}
+		for _, n := range existing {
+			if !containsNode(selected, n) {
+				node.neighbors[l] = append(node.neighbors[l], n)
+			}
+		}
+		node.mu.Unlock()
+
+		for _, c := range selected {
+			s.link(c.id, id, l)
+		}
+		entries = candidates
+	}
+	s.mu.RUnlock()
+
+	// 新节点层级更高时成为新的入口点
+	if level > maxLevel {
+		s.mu.Lock()
+		if level > s.maxLevel {
+			s.entry, s.maxLevel = id, level
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// link 为节点 from 在第 level 层添加指向 to 的连接，超出上限时重新筛选邻居
+func (s *HNSWVectorStore) link(from, to, level int) {
+	node := s.nodes[from]
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if level >= len(node.neighbors) {
+		return
+	}
+	neighbors := append(node.neighbors[level], to)
+	limit := s.maxConnections(level)
+	if len(neighbors) <= limit {
+		node.neighbors[level] = neighbors
+		return
+	}
+
+	candidates := make([]scoredNode, len(neighbors))
+	for i, n := range neighbors {
+		candidates[i] = scoredNode{id: n, score: s.score(node.vector, s.nodes[n].vector)}
+	}
+	sortScoredDesc(candidates)
+	selected := s.selectNeighbors(candidates, limit)
+
+	node.neighbors[level] = node.neighbors[level][:0]
+	for _, c := range selected {
+		node.neighbors[level] = append(node.neighbors[level], c.id)
+	}
+}
+
+// neighborsOf 将节点在指定层的邻居复制到 buf 中返回
+func (s *HNSWVectorStore) neighborsOf(id, level int, buf []int) []int {
+	node := s.nodes[id]
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	if level >= len(node.neighbors) {
+		return buf[:0]
+	}
+	return append(buf[:0], node.neighbors[level]...)
+}
+
+// greedy 在指定层贪心地移动到最相似的节点
+func (s *HNSWVectorStore) greedy(query []float64, current int, currentScore float64, level int) (int, float64) {
+	var buf []int
+	for changed := true; changed; {
+		changed = false
+		buf = s.neighborsOf(current, level, buf)
+		for _, n := range buf {
+			if score := s.score(query, s.nodes[n].vector); score > currentScore {
+				current, currentScore, changed = n, score, true
+			}
+		}
+	}
+	return current, currentScore
+}
+
+// searchLayer 在指定层进行束搜索，返回按相似度从高到低排序的最多 ef 个节点
+func (s *HNSWVectorStore) searchLayer(query []float64, entries []scoredNode, ef, level int) []scoredNode {
+	// 调用方持有读锁，节点数量在搜索期间不会变化
+	visited := make([]bool, len(s.nodes))
+	var buf []int
+	candidates := &maxScoreHeap{}
+	results := &minScoreHeap{}
+
+	for _, e := range entries {
+		if visited[e.id] {
+			continue
+		}
+		visited[e.id] = true
+		heap.Push(candidates, e)
+		heap.Push(results, e)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(scoredNode)
+		if results.Len() >= ef && c.score < (*results)[0].score {
+			break
+		}
+		buf = s.neighborsOf(c.id, level, buf)
+		for _, n := range buf {
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+
+			score := s.score(query, s.nodes[n].vector)
+			if results.Len() < ef || score > (*results)[0].score {
+				heap.Push(candidates, scoredNode{id: n, score: score})
+				heap.Push(results, scoredNode{id: n, score: score})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := make([]scoredNode, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(scoredNode)
+	}
+	return sorted
+}
+
+// selectNeighbors 使用启发式方法从按相似度降序排列的候选中选择邻居：
+// 优先选择与已选邻居不太相似的候选以保持图的连通性，不足 m 个时用剩余候选补齐
+func (s *HNSWVectorStore) selectNeighbors(candidates []scoredNode, m int) []scoredNode {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]scoredNode, 0, m)
+	var pruned []scoredNode
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		keep := true
+		for _, r := range selected {
+			if s.score(s.nodes[c.id].vector, s.nodes[r.id].vector) > c.score {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// Query 嵌入查询文本并返回最相似的 k 条文档
+func (s *HNSWVectorStore) Query(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if s.embed == nil {
+		return nil, ErrNoEmbedder
+	}
+	vector, err := s.embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return s.QueryVector(ctx, vector, k, filter)
+}
+
+// QueryVector 返回与向量近似最相似的 k 条文档，结果中的向量和元数据是副本
+// 过滤或删除导致结果不足时会扩大搜索范围重试
+func (s *HNSWVectorStore) QueryVector(ctx context.Context, vector []float64, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: k must be positive", ErrInvalidRequest)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.entry < 0 {
+		return nil, nil
+	}
+	if len(vector) != s.dimensions {
+		return nil, fmt.Errorf("%w: query has %d dimensions, expected %d", ErrDimensionMismatch, len(vector), s.dimensions)
+	}
+
+	query := s.prepare(vector)
+	current := s.entry
+	currentScore := s.score(query, s.nodes[current].vector)
+	for l := s.maxLevel; l > 0; l-- {
+		current, currentScore = s.greedy(query, current, currentScore, l)
+	}
+	entries := []scoredNode{{id: current, score: currentScore}}
+
+	for ef := max(s.config.EfSearch, k); ; ef *= 2 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		results := make([]SearchResult, 0, k)
+		for _, c := range s.searchLayer(query, entries, ef, 0) {
+			node := s.nodes[c.id]
+			node.mu.RLock()
+			deleted := node.deleted
+			node.mu.RUnlock()
+			if deleted || (len(filter) > 0 && !filter.Match(node.doc.Metadata)) {
+				continue
+			}
+			results = append(results, SearchResult{Document: cloneDocument(node.doc), Score: c.score})
+			if len(results) == k {
+				break
+			}
+		}
+
+		if len(results) == k || ef >= len(s.nodes) {
+			return results, nil
+		}
+	}
+}
+
+// scoredNode 是带相似度得分的节点
+type scoredNode struct {
+	id    int
+	score float64
+}
+
+// sortScoredDesc 按得分从高到低排序
+func sortScoredDesc(nodes []scoredNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].score > nodes[j].score
+	})
+}
+
+// containsNode 判断节点列表中是否包含指定节点
+func containsNode(nodes []scoredNode, id int) bool {
+	for _, n := range nodes {
+		if n.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// minScoreHeap 是得分最小的元素在堆顶的堆
+type minScoreHeap []scoredNode
+
+func (h minScoreHeap) Len() int            { return len(h) }
+func (h minScoreHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h minScoreHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minScoreHeap) Push(x interface{}) { *h = append(*h, x.(scoredNode)) }
+func (h *minScoreHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// maxScoreHeap 是得分最大的元素在堆顶的堆
+type maxScoreHeap []scoredNode
+
+func (h maxScoreHeap) Len() int            { return len(h) }
+func (h maxScoreHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h maxScoreHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxScoreHeap) Push(x interface{}) { *h = append(*h, x.(scoredNode)) }
+func (h *maxScoreHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
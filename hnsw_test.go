@@ -0,0 +1,297 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// randomDocuments 生成带随机向量的测试文档
+func randomDocuments(n, dimensions int, seed int64) []Document {
+	rng := rand.New(rand.NewSource(seed))
+	docs := make([]Document, n)
+	for i := range docs {
+		embedding := make([]float64, dimensions)
+		for j := range embedding {
+			embedding[j] = rng.NormFloat64()
+		}
+		docs[i] = Document{
+			ID:        fmt.Sprintf("doc-%d", i),
+			Embedding: embedding,
+			Metadata:  map[string]interface{}{"shard": i % 4},
+		}
+	}
+	return docs
+}
+
+// recallAt 计算近似结果相对精确结果的召回率
+func recallAt(approx, exact []SearchResult) float64 {
+	want := make(map[string]bool, len(exact))
+	for _, r := range exact {
+		want[r.ID] = true
+	}
+	hits := 0
+	for _, r := range approx {
+		if want[r.ID] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact))
+}
+
+// measureRecall 用精确搜索作为基准计算平均 recall@k
+func measureRecall(t testing.TB, hnsw *HNSWVectorStore, exact *MemoryVectorStore, queries []Document, k int, filter MetadataFilter) float64 {
+	ctx := context.Background()
+	var total float64
+	for _, q := range queries {
+		approx, err := hnsw.QueryVector(ctx, q.Embedding, k, filter)
+		if err != nil {
+			t.Fatalf("HNSW QueryVector() error = %v", err)
+		}
+		want, err := exact.QueryVector(ctx, q.Embedding, k, filter)
+		if err != nil {
+			t.Fatalf("exact QueryVector() error = %v", err)
+		}
+		total += recallAt(approx, want)
+	}
+	return total / float64(len(queries))
+}
+
+func TestHNSWRecall(t *testing.T) {
+	ctx := context.Background()
+	docs := randomDocuments(1500, 32, 1)
+	queries := randomDocuments(100, 32, 2)
+
+	for _, metric := range []SimilarityMetric{CosineSimilarity, DotProductSimilarity, EuclideanSimilarity} {
+		t.Run(metric.String(), func(t *testing.T) {
+			config := DefaultHNSWConfig()
+			config.Metric = metric
+			hnsw := NewHNSWVectorStore(nil, config)
+			exact := NewMemoryVectorStore(nil, metric)
+			if err := hnsw.Upsert(ctx, docs...); err != nil {
+				t.Fatalf("Upsert() error = %v", err)
+			}
+			if err := exact.Upsert(ctx, docs...); err != nil {
+				t.Fatalf("Upsert() error = %v", err)
+			}
+
+			recall := measureRecall(t, hnsw, exact, queries, 10, nil)
+			t.Logf("recall@10 = %.3f", recall)
+			if recall < 0.9 {
+				t.Errorf("recall@10 = %.3f, want >= 0.9", recall)
+			}
+
+			recall = measureRecall(t, hnsw, exact, queries, 10, MetadataFilter{"shard": 1})
+			t.Logf("filtered recall@10 = %.3f", recall)
+			if recall < 0.9 {
+				t.Errorf("filtered recall@10 = %.3f, want >= 0.9", recall)
+			}
+		})
+	}
+}
+
+func TestHNSWConcurrentInsertAndDelete(t *testing.T) {
+	ctx := context.Background()
+	docs := randomDocuments(1000, 16, 3)
+	hnsw := NewHNSWVectorStore(nil, DefaultHNSWConfig())
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(docs); i += 8 {
+				if err := hnsw.Upsert(ctx, docs[i]); err != nil {
+					t.Errorf("Upsert() error = %v", err)
+					return
+				}
+				if i%50 == 0 {
+					_, _ = hnsw.QueryVector(ctx, docs[i].Embedding, 5, nil)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if hnsw.Len() != len(docs) {
+		t.Fatalf("Len() = %d, want %d", hnsw.Len(), len(docs))
+	}
+
+	exact := NewMemoryVectorStore(nil, CosineSimilarity)
+	_ = exact.Upsert(ctx, docs...)
+	if recall := measureRecall(t, hnsw, exact, randomDocuments(50, 16, 4), 10, nil); recall < 0.9 {
+		t.Errorf("recall@10 after concurrent inserts = %.3f, want >= 0.9", recall)
+	}
+
+	// 删除最相似的文档后，它不应再出现在结果中
+	results, _ := hnsw.QueryVector(ctx, docs[0].Embedding, 1, nil)
+	if results[0].ID != docs[0].ID {
+		t.Fatalf("QueryVector() = %s, want %s", results[0].ID, docs[0].ID)
+	}
+	if err := hnsw.Delete(ctx, docs[0].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	results, _ = hnsw.QueryVector(ctx, docs[0].Embedding, 10, nil)
+	for _, r := range results {
+		if r.ID == docs[0].ID {
+			t.Errorf("deleted document %s returned by QueryVector()", r.ID)
+		}
+	}
+	if len(results) != 10 {
+		t.Errorf("QueryVector() returned %d results after delete, want 10", len(results))
+	}
+	if hnsw.Len() != len(docs)-1 || hnsw.Tombstones() != 1 {
+		t.Errorf("Len() = %d, Tombstones() = %d, want %d and 1", hnsw.Len(), hnsw.Tombstones(), len(docs)-1)
+	}
+
+	// 更新文档会替换旧节点
+	updated := docs[1]
+	updated.Embedding = docs[2].Embedding
+	if err := hnsw.Upsert(ctx, updated); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	results, _ = hnsw.QueryVector(ctx, docs[1].Embedding, 1, nil)
+	if len(results) == 1 && results[0].ID == docs[1].ID {
+		t.Errorf("QueryVector() returned stale vector for updated document %s", docs[1].ID)
+	}
+}
+
+func BenchmarkHNSWQuery(b *testing.B) {
+	ctx := context.Background()
+	docs := randomDocuments(10000, 64, 1)
+	queries := randomDocuments(100, 64, 2)
+
+	hnsw := NewHNSWVectorStore(nil, DefaultHNSWConfig())
+	exact := NewMemoryVectorStore(nil, CosineSimilarity)
+	_ = hnsw.Upsert(ctx, docs...)
+	_ = exact.Upsert(ctx, docs...)
+
+	b.Run("exact", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = exact.QueryVector(ctx, queries[i%len(queries)].Embedding, 10, nil)
+		}
+	})
+
+	for _, ef := range []int{16, 64, 256} {
+		hnsw.SetEfSearch(ef)
+		b.Run(fmt.Sprintf("hnsw-ef%d", ef), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = hnsw.QueryVector(ctx, queries[i%len(queries)].Embedding, 10, nil)
+			}
+			b.StopTimer()
+			b.ReportMetric(measureRecall(b, hnsw, exact, queries, 10, nil), "recall@10")
+		})
+	}
+}
+
+func BenchmarkHNSWInsert(b *testing.B) {
+	ctx := context.Background()
+	docs := randomDocuments(b.N, 64, 1)
+	hnsw := NewHNSWVectorStore(nil, DefaultHNSWConfig())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = hnsw.Upsert(ctx, docs[i])
+	}
+}
+
+func TestHNSWCompaction(t *testing.T) {
+	ctx := context.Background()
+	docs := randomDocuments(100, 16, 5)
+	hnsw := NewHNSWVectorStore(nil, DefaultHNSWConfig())
+
+	// 反复更新同一批文档，墓碑超过一半时自动重建，节点数保持有界
+	for round := 0; round < 20; round++ {
+		if err := hnsw.Upsert(ctx, docs...); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+		hnsw.mu.RLock()
+		nodes := len(hnsw.nodes)
+		hnsw.mu.RUnlock()
+		if nodes > 2*len(docs) {
+			t.Fatalf("round %d: %d nodes for %d documents", round, nodes, len(docs))
+		}
+	}
+	if hnsw.Len() != len(docs) {
+		t.Fatalf("Len() = %d, want %d", hnsw.Len(), len(docs))
+	}
+
+	if err := hnsw.Delete(ctx, docs[0].ID, docs[1].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	hnsw.Compact()
+	if hnsw.Tombstones() != 0 || len(hnsw.nodes) != len(docs)-2 {
+		t.Errorf("after Compact() Tombstones() = %d, nodes = %d, want 0 and %d", hnsw.Tombstones(), len(hnsw.nodes), len(docs)-2)
+	}
+
+	exact := NewMemoryVectorStore(nil, CosineSimilarity)
+	_ = exact.Upsert(ctx, docs[2:]...)
+	if recall := measureRecall(t, hnsw, exact, randomDocuments(20, 16, 6), 10, nil); recall < 0.9 {
+		t.Errorf("recall@10 after compaction = %.3f, want >= 0.9", recall)
+	}
+}
+
+func TestHNSWCompactionConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	docs := randomDocuments(300, 16, 7)
+	config := DefaultHNSWConfig()
+	config.MaxTombstoneRatio = -1
+	hnsw := NewHNSWVectorStore(nil, config)
+	if err := hnsw.Upsert(ctx, docs[:200]...); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	for _, doc := range docs[:100] {
+		_ = hnsw.Delete(ctx, doc.ID)
+	}
+
+	// 构建新图期间查询不等待，写入在替换前重放到新图中
+	hnsw.onRebuild = func() {
+		done := make(chan error, 1)
+		go func() {
+			_, err := hnsw.QueryVector(ctx, docs[150].Embedding, 5, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("QueryVector() during rebuild error = %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("QueryVector() blocked while the graph was rebuilt")
+		}
+		if err := hnsw.Upsert(ctx, docs[200:]...); err != nil {
+			t.Errorf("Upsert() during rebuild error = %v", err)
+		}
+		_ = hnsw.Delete(ctx, docs[100].ID)
+	}
+	hnsw.Compact()
+
+	if got := hnsw.Len(); got != 199 {
+		t.Errorf("Len() = %d, want 199", got)
+	}
+	hnsw.mu.RLock()
+	nodes, recording := len(hnsw.nodes), hnsw.recording
+	hnsw.mu.RUnlock()
+	if nodes != 200 || recording {
+		t.Errorf("nodes = %d, recording = %v, want 100 rebuilt plus 100 replayed nodes and no recording", nodes, recording)
+	}
+	for _, doc := range []Document{docs[100], docs[150], docs[250]} {
+		results, err := hnsw.QueryVector(ctx, doc.Embedding, 1, nil)
+		if err != nil {
+			t.Fatalf("QueryVector() error = %v", err)
+		}
+		found := len(results) == 1 && results[0].ID == doc.ID
+		if want := doc.ID != docs[100].ID; found != want {
+			t.Errorf("%s found = %v, want %v", doc.ID, found, want)
+		}
+	}
+
+	exact := NewMemoryVectorStore(nil, CosineSimilarity)
+	_ = exact.Upsert(ctx, docs[101:]...)
+	if recall := measureRecall(t, hnsw, exact, randomDocuments(20, 16, 8), 10, nil); recall < 0.9 {
+		t.Errorf("recall@10 after compaction = %.3f, want >= 0.9", recall)
+	}
+}
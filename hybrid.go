@@ -0,0 +1,205 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// FusionMethod 表示混合检索时合并结果列表的方式
+type FusionMethod int
+
+const (
+	// FusionRRF 使用倒数排名融合（Reciprocal Rank Fusion），只依赖排名，不受两种得分尺度不同的影响
+	FusionRRF FusionMethod = iota
+	// FusionWeighted 将两种得分分别做 min-max 归一化后加权求和
+	FusionWeighted
+)
+
+// String 返回融合方式的名称
+func (m FusionMethod) String() string {
+	switch m {
+	case FusionRRF:
+		return "rrf"
+	case FusionWeighted:
+		return "weighted"
+	default:
+		return fmt.Sprintf("FusionMethod(%d)", int(m))
+	}
+}
+
+// HybridConfig 是混合检索的配置，零值与 DefaultHybridConfig 相同
+type HybridConfig struct {
+	Fusion      FusionMethod // 融合方式
+	DenseWeight float64      // 向量检索结果的权重，关键词检索的权重为 1-DenseWeight，0 表示默认的 0.5
+	RRFConstant float64      // RRF 的平滑常数
+	Candidates  int          // 每一路检索的候选数，0 表示 4*k
+	KeywordOnly bool         // 只使用关键词检索，不嵌入查询
+}
+
+// DefaultHybridConfig 返回默认的混合检索配置
+func DefaultHybridConfig() HybridConfig {
+	return HybridConfig{
+		Fusion:      FusionRRF,
+		DenseWeight: 0.5,
+		RRFConstant: 60,
+	}
+}
+
+// HybridRetriever 同时使用向量检索和 BM25 关键词检索，并融合两路结果
+type HybridRetriever struct {
+	dense    *VectorRetriever
+	store    VectorStore
+	keywords *BM25Index
+	config   HybridConfig
+}
+
+// NewHybridRetriever 创建一个新的混合检索器，向量检索使用 embedder 嵌入查询
+func NewHybridRetriever(embedder *LLMEmbedder, store VectorStore, keywords *BM25Index, config HybridConfig) *HybridRetriever {
+	if config.DenseWeight <= 0 || config.DenseWeight > 1 {
+		config.DenseWeight = 0.5
+	}
+	if config.RRFConstant <= 0 {
+		config.RRFConstant = 60
+	}
+	return &HybridRetriever{
+		dense:    NewVectorRetriever(embedder, store),
+		store:    store,
+		keywords: keywords,
+		config:   config,
+	}
+}
+
+// Upsert 将文档同时写入向量存储和关键词索引
+func (r *HybridRetriever) Upsert(ctx context.Context, docs ...Document) error {
+	if err := r.store.Upsert(ctx, docs...); err != nil {
+		return err
+	}
+	return r.keywords.Upsert(ctx, docs...)
+}
+
+// Delete 从向量存储和关键词索引中删除文档
+func (r *HybridRetriever) Delete(ctx context.Context, ids ...string) error {
+	if err := r.store.Delete(ctx, ids...); err != nil {
+		return err
+	}
+	return r.keywords.Delete(ctx, ids...)
+}
+
+// Retrieve 实现 Retriever 接口，返回结果的得分为融合后的得分
+func (r *HybridRetriever) Retrieve(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: k must be positive", ErrInvalidRequest)
+	}
+
+	candidates := r.config.Candidates
+	if candidates < k {
+		candidates = 4 * k
+	}
+
+	if r.config.KeywordOnly {
+		return r.keywords.Search(ctx, query, k, filter)
+	}
+
+	dense, err := r.dense.Retrieve(ctx, query, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+	sparse, err := r.keywords.Search(ctx, query, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var fused []SearchResult
+	switch r.config.Fusion {
+	case FusionWeighted:
+		fused = weightedFusion(dense, sparse, r.config.DenseWeight)
+	default:
+		fused = rrfFusion(dense, sparse, r.config.DenseWeight, r.config.RRFConstant)
+	}
+
+	if len(fused) > k {
+		fused = fused[:k]
+	}
+	return fused, nil
+}
+
+// rrfFusion 使用加权倒数排名融合合并两路结果
+func rrfFusion(dense, sparse []SearchResult, denseWeight, constant float64) []SearchResult {
+	merged := newFusionSet()
+	for rank, result := range dense {
+		merged.add(result, denseWeight/(constant+float64(rank+1)))
+	}
+	for rank, result := range sparse {
+		merged.add(result, (1-denseWeight)/(constant+float64(rank+1)))
+	}
+	return merged.sorted()
+}
+
+// weightedFusion 将两路得分做 min-max 归一化后加权求和
+func weightedFusion(dense, sparse []SearchResult, denseWeight float64) []SearchResult {
+	merged := newFusionSet()
+	for i, score := range normalizeScores(dense) {
+		merged.add(dense[i], denseWeight*score)
+	}
+	for i, score := range normalizeScores(sparse) {
+		merged.add(sparse[i], (1-denseWeight)*score)
+	}
+	return merged.sorted()
+}
+
+// normalizeScores 将得分归一化到 [0, 1]，所有得分相同时均为 1
+func normalizeScores(results []SearchResult) []float64 {
+	if len(results) == 0 {
+		return nil
+	}
+	lo, hi := results[0].Score, results[0].Score
+	for _, result := range results {
+		lo = min(lo, result.Score)
+		hi = max(hi, result.Score)
+	}
+
+	scores := make([]float64, len(results))
+	for i, result := range results {
+		if hi == lo {
+			scores[i] = 1
+		} else {
+			scores[i] = (result.Score - lo) / (hi - lo)
+		}
+	}
+	return scores
+}
+
+// fusionSet 按文档ID累加融合得分
+type fusionSet struct {
+	results map[string]*SearchResult
+	order   []string
+}
+
+// newFusionSet 创建一个新的融合集合
+func newFusionSet() *fusionSet {
+	return &fusionSet{results: make(map[string]*SearchResult)}
+}
+
+// add 累加文档的得分，保留第一次出现时的文档内容
+func (f *fusionSet) add(result SearchResult, score float64) {
+	if existing, ok := f.results[result.ID]; ok {
+		existing.Score += score
+		return
+	}
+	result.Score = score
+	f.results[result.ID] = &result
+	f.order = append(f.order, result.ID)
+}
+
+// sorted 返回按融合得分从高到低排序的结果，得分相同时按首次出现的顺序
+func (f *fusionSet) sorted() []SearchResult {
+	results := make([]SearchResult, len(f.order))
+	for i, id := range f.order {
+		results[i] = *f.results[id]
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newHybridTestRetriever 创建一个使用词袋嵌入的混合检索器
+func newHybridTestRetriever(t *testing.T, config HybridConfig) *HybridRetriever {
+	t.Helper()
+
+	svc := NewService()
+	_ = svc.RegisterProvider(&mockProvider{
+		name: "test-provider",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			// 嵌入只认识 cat、dog、car 三个词，无法区分错误码
+			embedding := []float64{0, 0, 0, 0.1}
+			for _, word := range strings.Fields(request.Input) {
+				switch word {
+				case "cat", "kitten":
+					embedding[0]++
+				case "dog":
+					embedding[1]++
+				case "car":
+					embedding[2]++
+				}
+			}
+			return EmbeddingResponse{Embedding: embedding}, nil
+		},
+	})
+
+	embedder := NewLLMEmbedder(svc, "test-provider", "test-model", 4)
+	retriever := NewHybridRetriever(embedder, NewMemoryVectorStore(embedder.EmbeddingFunc(), CosineSimilarity), NewBM25Index(), config)
+	err := retriever.Upsert(context.Background(),
+		Document{ID: "cat", Content: "a cat sleeps"},
+		Document{ID: "kitten", Content: "a small kitten"},
+		Document{ID: "dog", Content: "the dog saw ERR-1042 on screen"},
+		Document{ID: "car", Content: "the car broke"},
+	)
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	return retriever
+}
+
+func TestHybridRetriever(t *testing.T) {
+	tests := []struct {
+		name   string
+		fusion FusionMethod
+		query  string
+		want   []string
+	}{
+		{"rrf semantic", FusionRRF, "cat", []string{"cat", "kitten"}},
+		{"rrf identifier", FusionRRF, "ERR-1042", []string{"dog"}},
+		{"weighted semantic", FusionWeighted, "cat", []string{"cat", "kitten"}},
+		{"weighted identifier", FusionWeighted, "ERR-1042", []string{"dog"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultHybridConfig()
+			config.Fusion = tt.fusion
+			retriever := newHybridTestRetriever(t, config)
+
+			results, err := retriever.Retrieve(context.Background(), tt.query, len(tt.want), nil)
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Retrieve(%q) = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestHybridRetrieverConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HybridConfig
+		want   []string
+	}{
+		// 零值配置的 DenseWeight 按 0.5 处理，而不是只用关键词检索
+		{"zero value", HybridConfig{}, []string{"cat", "kitten"}},
+		{"keyword only", HybridConfig{KeywordOnly: true}, []string{"cat"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := newHybridTestRetriever(t, tt.config).Retrieve(context.Background(), "cat", 2, nil)
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Retrieve() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestHybridRetrieverDelete(t *testing.T) {
+	retriever := newHybridTestRetriever(t, DefaultHybridConfig())
+	ctx := context.Background()
+
+	if err := retriever.Delete(ctx, "dog"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	results, err := retriever.Retrieve(ctx, "ERR-1042", 4, nil)
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	for _, result := range results {
+		if result.ID == "dog" {
+			t.Errorf("Retrieve() returned deleted document %q", result.ID)
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hewenyu/llm/textsplit"
+)
+
+// SourceDocument 是待索引的原始文档
+type SourceDocument struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// IndexedDocument 记录一篇已索引文档的内容哈希和块ID
+type IndexedDocument struct {
+	Hash   string   `json:"hash"`
+	Chunks []string `json:"chunks"`
+}
+
+// IndexCheckpoint 是索引进度的检查点，记录每篇已完成文档的状态和生成向量的嵌入模型
+type IndexCheckpoint struct {
+	Documents  map[string]IndexedDocument `json:"documents"`
+	Model      string                     `json:"model,omitempty"`      // 嵌入模型，如 "ollama/mxbai-embed-large"，为空表示未记录
+	Dimensions int                        `json:"dimensions,omitempty"` // 向量维度，0 表示未记录
+	UpdatedAt  time.Time                  `json:"updated_at"`
+}
+
+// matches 判断检查点记录的向量是否由 spec 描述的嵌入模型生成，未记录的字段不做检查
+func (c IndexCheckpoint) matches(spec EmbeddingSpec) bool {
+	if c.Model != "" && c.Model != spec.Model {
+		return false
+	}
+	return c.Dimensions == 0 || spec.Dimensions == 0 || c.Dimensions == spec.Dimensions
+}
+
+// stamp 记录生成向量的嵌入模型和维度
+func (c *IndexCheckpoint) stamp(spec EmbeddingSpec) {
+	c.Model = spec.Model
+	if spec.Dimensions > 0 {
+		c.Dimensions = spec.Dimensions
+	}
+}
+
+// chunkCount 返回检查点记录的块总数
+func (c IndexCheckpoint) chunkCount() int {
+	n := 0
+	for _, doc := range c.Documents {
+		n += len(doc.Chunks)
+	}
+	return n
+}
+
+// CheckpointStore 表示索引检查点的存储
+type CheckpointStore interface {
+	// 加载检查点，不存在时返回空检查点
+	Load(ctx context.Context) (IndexCheckpoint, error)
+
+	// 保存检查点
+	Save(ctx context.Context, checkpoint IndexCheckpoint) error
+}
+
+// CheckpointUpdate 是检查点中一篇文档的变化
+type CheckpointUpdate struct {
+	ID       string           `json:"id"`
+	Document *IndexedDocument `json:"document,omitempty"` // 为空表示文档已删除
+}
+
+// CheckpointAppender 是支持增量保存的检查点存储。索引器每批只追加本批变化的文档，
+// 全部完成后再调用 Save 合并，避免每批重写整个检查点；未实现该接口的存储每批调用 Save
+type CheckpointAppender interface {
+	Append(ctx context.Context, updates []CheckpointUpdate) error
+}
+
+// IndexStats 是索引的进度统计
+type IndexStats struct {
+	Total     int           // 输入的文档数
+	Processed int           // 已处理的文档数（含跳过的）
+	Indexed   int           // 新增或更新的文档数
+	Skipped   int           // 内容未变而跳过的文档数
+	Deleted   int           // 不再存在而删除的文档数
+	Chunks    int           // 写入的块数
+	Elapsed   time.Duration // 已用时间
+}
+
+// IndexerConfig 是索引器的配置
+type IndexerConfig struct {
+	Splitter  textsplit.Splitter // 文本切分器，为空时使用按模型最大输入长度配置的 RecursiveSplitter
+	BatchSize int                // 每次批量嵌入的块数，默认64，每批完成后保存检查点
+	Progress  func(IndexStats)   // 进度回调，每批完成后调用
+}
+
+// Indexer 将文档切分、嵌入并写入向量存储，通过内容哈希实现增量索引
+type Indexer struct {
+	embedder    *LLMEmbedder
+	store       VectorStore
+	checkpoints CheckpointStore
+	config      IndexerConfig
+	mu          sync.Mutex
+}
+
+// NewIndexer 创建一个新的索引器，checkpoints 为空时使用内存检查点存储
+func NewIndexer(embedder *LLMEmbedder, store VectorStore, checkpoints CheckpointStore, config IndexerConfig) *Indexer {
+	if config.Splitter == nil {
+		size := textsplit.DefaultChunkSize
+		if info, ok := LookupEmbeddingModel(embedder.model); ok && info.MaxInputTokens > 0 {
+			size = min(size, info.MaxInputTokens)
+		}
+		config.Splitter = textsplit.RecursiveSplitter{
+			ChunkSize: size,
+			Overlap:   size / 8,
+			Counter:   textsplit.TokenCounter(ApproxTokenCounter),
+		}
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 64
+	}
+	if checkpoints == nil {
+		checkpoints = NewMemoryCheckpointStore()
+	}
+	return &Indexer{
+		embedder:    embedder,
+		store:       store,
+		checkpoints: checkpoints,
+		config:      config,
+	}
+}
+
+// pendingDocument 是等待嵌入的文档及其块
+type pendingDocument struct {
+	id     string
+	hash   string
+	chunks []Document
+	stale  []string
+}
+
+// Index 将文档集合同步到向量存储：docs 应为完整的语料
+// 内容未变的文档被跳过，新增或修改的文档重新切分和嵌入，不在 docs 中的已索引文档被删除
+// 每批嵌入完成后保存检查点，中断后再次调用会从上次完成的位置继续。
+// 向量存储中的文档少于检查点记录的块数时（例如重启后的内存存储），或者嵌入模型、维度与检查点记录的不同时，
+// 检查点已失效，所有文档都会重新索引
+func (ix *Indexer) Index(ctx context.Context, docs []SourceDocument) (IndexStats, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	start := time.Now()
+	stats := IndexStats{Total: len(docs)}
+
+	checkpoint, err := ix.checkpoints.Load(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if checkpoint.Documents == nil {
+		checkpoint.Documents = make(map[string]IndexedDocument)
+	}
+	spec := ix.embedder.Spec()
+	discard := false
+	if !checkpoint.matches(spec) {
+		// 换了嵌入模型或维度后已有的向量不可比，删除检查点记录的块并丢弃检查点
+		ids := make([]string, 0, len(checkpoint.Documents))
+		for id := range checkpoint.Documents {
+			ids = append(ids, id)
+		}
+		if err := ix.remove(ctx, &checkpoint, ids); err != nil {
+			return stats, err
+		}
+		discard = true
+	}
+	if ix.store.Len() < checkpoint.chunkCount() {
+		// 检查点记录的块不在向量存储中，丢弃检查点，避免跳过实际上没有索引的文档
+		discard = true
+	}
+	if discard {
+		checkpoint = IndexCheckpoint{Documents: make(map[string]IndexedDocument), UpdatedAt: time.Now()}
+		checkpoint.stamp(spec)
+		if err := ix.checkpoints.Save(ctx, checkpoint); err != nil {
+			return stats, fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool, len(docs))
+	var pending []pendingDocument
+	pendingChunks := 0
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := ix.write(ctx, pending); err != nil {
+			return err
+		}
+		updates := make([]CheckpointUpdate, len(pending))
+		for i, p := range pending {
+			ids := make([]string, len(p.chunks))
+			for j, chunk := range p.chunks {
+				ids[j] = chunk.ID
+			}
+			doc := IndexedDocument{Hash: p.hash, Chunks: ids}
+			checkpoint.Documents[p.id] = doc
+			updates[i] = CheckpointUpdate{ID: p.id, Document: &doc}
+			stats.Indexed++
+			stats.Chunks += len(p.chunks)
+		}
+		stats.Processed += len(pending)
+		pending, pendingChunks = nil, 0
+		return ix.save(ctx, &checkpoint, updates, &stats, start)
+	}
+
+	for _, doc := range docs {
+		if doc.ID == "" {
+			return stats, fmt.Errorf("%w: document id cannot be empty", ErrInvalidRequest)
+		}
+		if seen[doc.ID] {
+			return stats, fmt.Errorf("%w: duplicate document id %s", ErrInvalidRequest, doc.ID)
+		}
+		seen[doc.ID] = true
+
+		hash, err := documentHash(doc)
+		if err != nil {
+			return stats, err
+		}
+		previous, exists := checkpoint.Documents[doc.ID]
+		if exists && previous.Hash == hash {
+			stats.Skipped++
+			stats.Processed++
+			continue
+		}
+
+		chunks := ix.chunk(doc)
+		current := make(map[string]bool, len(chunks))
+		for _, chunk := range chunks {
+			current[chunk.ID] = true
+		}
+		var stale []string
+		for _, id := range previous.Chunks {
+			if !current[id] {
+				stale = append(stale, id)
+			}
+		}
+
+		pending = append(pending, pendingDocument{id: doc.ID, hash: hash, chunks: chunks, stale: stale})
+		pendingChunks += len(chunks)
+		if pendingChunks >= ix.config.BatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	// 删除不再存在的文档
+	var removed []string
+	for id := range checkpoint.Documents {
+		if !seen[id] {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		if err := ix.remove(ctx, &checkpoint, removed); err != nil {
+			return stats, err
+		}
+		stats.Deleted = len(removed)
+		updates := make([]CheckpointUpdate, len(removed))
+		for i, id := range removed {
+			updates[i] = CheckpointUpdate{ID: id}
+		}
+		if err := ix.save(ctx, &checkpoint, updates, &stats, start); err != nil {
+			return stats, err
+		}
+	}
+
+	// 增量保存时把追加的变化合并为完整的检查点
+	if _, ok := ix.checkpoints.(CheckpointAppender); ok && stats.Indexed+stats.Deleted > 0 {
+		checkpoint.stamp(ix.embedder.Spec())
+		checkpoint.UpdatedAt = time.Now()
+		if err := ix.checkpoints.Save(ctx, checkpoint); err != nil {
+			return stats, fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+	}
+
+	stats.Elapsed = time.Since(start)
+	return stats, nil
+}
+
+// Remove 从向量存储和检查点中删除指定的文档
+func (ix *Indexer) Remove(ctx context.Context, ids ...string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	checkpoint, err := ix.checkpoints.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if err := ix.remove(ctx, &checkpoint, ids); err != nil {
+		return err
+	}
+	checkpoint.UpdatedAt = time.Now()
+	if err := ix.checkpoints.Save(ctx, checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// remove 删除文档的所有块并从检查点中移除
+func (ix *Indexer) remove(ctx context.Context, checkpoint *IndexCheckpoint, ids []string) error {
+	var chunks []string
+	for _, id := range ids {
+		chunks = append(chunks, checkpoint.Documents[id].Chunks...)
+	}
+	if len(chunks) > 0 {
+		if err := ix.store.Delete(ctx, chunks...); err != nil {
+			return fmt.Errorf("failed to delete chunks: %w", err)
+		}
+	}
+	for _, id := range ids {
+		delete(checkpoint.Documents, id)
+	}
+	return nil
+}
+
+// chunk 将文档切分为带来源信息的块
+func (ix *Indexer) chunk(doc SourceDocument) []Document {
+	pieces := ix.config.Splitter.Split(doc.Text)
+	chunks := make([]Document, len(pieces))
+	for i, piece := range pieces {
+		metadata := make(map[string]interface{}, len(doc.Metadata)+4)
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		metadata["source_id"] = doc.ID
+		metadata["chunk_index"] = i
+		metadata["chunk_start"] = piece.Start
+		metadata["chunk_end"] = piece.End
+		if len(piece.Headings) > 0 {
+			metadata["headings"] = piece.Headings
+		}
+		chunks[i] = Document{
+			ID:       fmt.Sprintf("%s#%d", doc.ID, i),
+			Content:  piece.Text,
+			Metadata: metadata,
+		}
+	}
+	return chunks
+}
+
+// write 批量嵌入待写入文档的所有块，写入向量存储并删除过期的块
+func (ix *Indexer) write(ctx context.Context, pending []pendingDocument) error {
+	var chunks []Document
+	var stale []string
+	for _, p := range pending {
+		chunks = append(chunks, p.chunks...)
+		stale = append(stale, p.stale...)
+	}
+
+	if len(chunks) > 0 {
+		contents := make([]interface{}, len(chunks))
+		for i, chunk := range chunks {
+			contents[i] = chunk.Content
+		}
+		embeddings, err := ix.embedder.BatchEmbed(ctx, contents)
+		if err != nil {
+			return err
+		}
+		for i := range chunks {
+			chunks[i].Embedding = embeddings[i]
+		}
+		if err := ix.store.Upsert(ctx, chunks...); err != nil {
+			return fmt.Errorf("failed to upsert chunks: %w", err)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := ix.store.Delete(ctx, stale...); err != nil {
+			return fmt.Errorf("failed to delete stale chunks: %w", err)
+		}
+	}
+	return nil
+}
+
+// save 保存一批变化并报告进度，存储支持增量保存时只追加 updates，否则保存整个检查点
+func (ix *Indexer) save(ctx context.Context, checkpoint *IndexCheckpoint, updates []CheckpointUpdate, stats *IndexStats, start time.Time) error {
+	checkpoint.stamp(ix.embedder.Spec())
+	checkpoint.UpdatedAt = time.Now()
+	var err error
+	if appender, ok := ix.checkpoints.(CheckpointAppender); ok {
+		err = appender.Append(ctx, updates)
+	} else {
+		err = ix.checkpoints.Save(ctx, *checkpoint)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	stats.Elapsed = time.Since(start)
+	if ix.config.Progress != nil {
+		ix.config.Progress(*stats)
+	}
+	return nil
+}
+
+// documentHash 计算文档内容和元数据的哈希
+func documentHash(doc SourceDocument) (string, error) {
+	metadata, err := json.Marshal(doc.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode metadata of document %s: %w", doc.ID, err)
+	}
+	h := sha256.New()
+	h.Write([]byte(doc.Text))
+	h.Write([]byte{0})
+	h.Write(metadata)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyCheckpoint 返回检查点的深拷贝
+func copyCheckpoint(checkpoint IndexCheckpoint) IndexCheckpoint {
+	documents := make(map[string]IndexedDocument, len(checkpoint.Documents))
+	for id, doc := range checkpoint.Documents {
+		doc.Chunks = append([]string(nil), doc.Chunks...)
+		documents[id] = doc
+	}
+	checkpoint.Documents = documents
+	return checkpoint
+}
+
+// MemoryCheckpointStore 是基于内存的检查点存储
+type MemoryCheckpointStore struct {
+	checkpoint IndexCheckpoint
+	mu         sync.Mutex
+}
+
+// NewMemoryCheckpointStore 创建一个新的内存检查点存储
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{}
+}
+
+// Load 加载检查点
+func (s *MemoryCheckpointStore) Load(ctx context.Context) (IndexCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCheckpoint(s.checkpoint), nil
+}
+
+// Save 保存检查点
+func (s *MemoryCheckpointStore) Save(ctx context.Context, checkpoint IndexCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = copyCheckpoint(checkpoint)
+	return nil
+}
+
+// Append 实现 CheckpointAppender 接口
+func (s *MemoryCheckpointStore) Append(ctx context.Context, updates []CheckpointUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkpoint.Documents == nil {
+		s.checkpoint.Documents = make(map[string]IndexedDocument)
+	}
+	applyCheckpointUpdates(&s.checkpoint, updates)
+	s.checkpoint.UpdatedAt = time.Now()
+	return nil
+}
+
+// applyCheckpointUpdates 把变化应用到检查点
+func applyCheckpointUpdates(checkpoint *IndexCheckpoint, updates []CheckpointUpdate) {
+	for _, update := range updates {
+		if update.Document == nil {
+			delete(checkpoint.Documents, update.ID)
+			continue
+		}
+		doc := *update.Document
+		doc.Chunks = append([]string(nil), doc.Chunks...)
+		checkpoint.Documents[update.ID] = doc
+	}
+}
+
+// FileCheckpointStore 是基于JSON文件的检查点存储。
+// Save 写入完整的检查点，Append 把变化以 JSON Lines 追加到 path+".journal"，Load 时重放日志，Save 后清空日志
+type FileCheckpointStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCheckpointStore 创建一个新的文件检查点存储
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	return &FileCheckpointStore{path: path}, nil
+}
+
+// Load 加载检查点，文件不存在时返回空检查点
+func (s *FileCheckpointStore) Load(ctx context.Context) (IndexCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return IndexCheckpoint{}, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint IndexCheckpoint
+	if err == nil {
+		if err := json.Unmarshal(data, &checkpoint); err != nil {
+			return IndexCheckpoint{}, fmt.Errorf("failed to decode checkpoint: %w", err)
+		}
+	}
+	if err := s.replay(&checkpoint); err != nil {
+		return IndexCheckpoint{}, err
+	}
+	return checkpoint, nil
+}
+
+// journalPath 返回增量日志的路径
+func (s *FileCheckpointStore) journalPath() string {
+	return s.path + ".journal"
+}
+
+// replay 把增量日志应用到检查点，进程在写入时崩溃导致的不完整末行会被忽略
+func (s *FileCheckpointStore) replay(checkpoint *IndexCheckpoint) error {
+	data, err := os.ReadFile(s.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint journal: %w", err)
+	}
+	if checkpoint.Documents == nil {
+		checkpoint.Documents = make(map[string]IndexedDocument)
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var update CheckpointUpdate
+		if err := json.Unmarshal(line, &update); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return fmt.Errorf("failed to decode checkpoint journal line %d: %w", i+1, err)
+		}
+		applyCheckpointUpdates(checkpoint, []CheckpointUpdate{update})
+	}
+	return nil
+}
+
+// Append 实现 CheckpointAppender 接口，变化写入磁盘后才返回
+func (s *FileCheckpointStore) Append(ctx context.Context, updates []CheckpointUpdate) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, update := range updates {
+		if err := enc.Encode(update); err != nil {
+			return fmt.Errorf("failed to encode checkpoint update: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.journalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint journal: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint journal: %w", err)
+	}
+	return f.Close()
+}
+
+// Save 保存检查点，先写入临时文件再重命名以保证原子性
+func (s *FileCheckpointStore) Save(ctx context.Context, checkpoint IndexCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	// 日志中的变化已经包含在新的检查点中
+	if err := os.Remove(s.journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to truncate checkpoint journal: %w", err)
+	}
+	return nil
+}
+
+// writeFileSync 写入文件并在关闭前同步到磁盘
+func writeFileSync(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
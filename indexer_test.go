@@ -0,0 +1,307 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hewenyu/llm/textsplit"
+)
+
+// countingEmbedder 返回一个记录嵌入内容的嵌入器，fail 返回 true 时嵌入失败
+func countingEmbedder(embedded *[]string, fail func(text string) bool) *LLMEmbedder {
+	var mu sync.Mutex
+	return NewLLMEmbedder(&mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			if fail != nil && fail(request.Input) {
+				return EmbeddingResponse{}, errors.New("embedding failed")
+			}
+			mu.Lock()
+			*embedded = append(*embedded, request.Input)
+			mu.Unlock()
+			return EmbeddingResponse{Embedding: []float64{float64(len(request.Input)), 1}}, nil
+		},
+	}, "test-provider", "test-model", 2)
+}
+
+// storeIDs 返回内存向量存储中的全部文档ID
+func storeIDs(store *MemoryVectorStore) []string {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var ids []string
+	for id := range store.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestIndexerIncremental(t *testing.T) {
+	var embedded []string
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	checkpoints, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "index", "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore() error = %v", err)
+	}
+
+	var progress []IndexStats
+	indexer := NewIndexer(countingEmbedder(&embedded, nil), store, checkpoints, IndexerConfig{
+		Splitter:  textsplit.TokenSplitter{ChunkSize: 2, Counter: wordCounter},
+		BatchSize: 2,
+		Progress:  func(stats IndexStats) { progress = append(progress, stats) },
+	})
+	ctx := context.Background()
+
+	docs := []SourceDocument{
+		{ID: "a", Text: "one two three four", Metadata: map[string]interface{}{"lang": "en"}},
+		{ID: "b", Text: "five six"},
+		{ID: "c", Text: "seven"},
+	}
+	stats, err := indexer.Index(ctx, docs)
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if stats.Indexed != 3 || stats.Chunks != 4 || stats.Skipped != 0 {
+		t.Errorf("first Index() stats = %+v, want 3 indexed, 4 chunks", stats)
+	}
+	if want := []string{"a#0", "a#1", "b#0", "c#0"}; !reflect.DeepEqual(storeIDs(store), want) {
+		t.Errorf("store ids = %v, want %v", storeIDs(store), want)
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Processed != 3 {
+		t.Errorf("progress = %+v, want final report with 3 processed", progress)
+	}
+
+	chunk, _ := store.Get("a#1")
+	if chunk.Metadata["source_id"] != "a" || chunk.Metadata["lang"] != "en" || chunk.Content != "three four" {
+		t.Errorf("chunk a#1 = %+v, want source metadata and content %q", chunk, "three four")
+	}
+
+	// 修改 a（变短），删除 b，c 不变
+	embedded = nil
+	stats, err = indexer.Index(ctx, []SourceDocument{
+		{ID: "a", Text: "one two", Metadata: map[string]interface{}{"lang": "en"}},
+		{ID: "c", Text: "seven"},
+	})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if stats.Indexed != 1 || stats.Skipped != 1 || stats.Deleted != 1 {
+		t.Errorf("second Index() stats = %+v, want 1 indexed, 1 skipped, 1 deleted", stats)
+	}
+	if !reflect.DeepEqual(embedded, []string{"one two"}) {
+		t.Errorf("second Index() embedded %q, want only the changed document", embedded)
+	}
+	if want := []string{"a#0", "c#0"}; !reflect.DeepEqual(storeIDs(store), want) {
+		t.Errorf("store ids = %v, want %v", storeIDs(store), want)
+	}
+}
+
+func TestIndexerResume(t *testing.T) {
+	var embedded []string
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	checkpoints := NewMemoryCheckpointStore()
+	config := IndexerConfig{Splitter: textsplit.TokenSplitter{ChunkSize: 10, Counter: wordCounter}, BatchSize: 1}
+
+	docs := []SourceDocument{
+		{ID: "1", Text: "first document"},
+		{ID: "2", Text: "second document"},
+		{ID: "3", Text: "third document"},
+	}
+
+	failing := NewIndexer(countingEmbedder(&embedded, func(text string) bool {
+		return strings.HasPrefix(text, "third")
+	}), store, checkpoints, config)
+	stats, err := failing.Index(context.Background(), docs)
+	if err == nil {
+		t.Fatal("Index() with failing embedder expected error, got nil")
+	}
+	if stats.Indexed != 2 {
+		t.Errorf("interrupted Index() indexed %d documents, want 2", stats.Indexed)
+	}
+
+	embedded = nil
+	stats, err = NewIndexer(countingEmbedder(&embedded, nil), store, checkpoints, config).Index(context.Background(), docs)
+	if err != nil {
+		t.Fatalf("resumed Index() error = %v", err)
+	}
+	if stats.Skipped != 2 || stats.Indexed != 1 {
+		t.Errorf("resumed Index() stats = %+v, want 2 skipped, 1 indexed", stats)
+	}
+	if !reflect.DeepEqual(embedded, []string{"third document"}) {
+		t.Errorf("resumed Index() embedded %q, want only the remaining document", embedded)
+	}
+}
+
+func TestIndexerRemove(t *testing.T) {
+	var embedded []string
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	indexer := NewIndexer(countingEmbedder(&embedded, nil), store, nil, IndexerConfig{})
+	ctx := context.Background()
+
+	if _, err := indexer.Index(ctx, []SourceDocument{{ID: "a", Text: "alpha"}, {ID: "b", Text: "beta"}}); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if err := indexer.Remove(ctx, "a"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if want := []string{"b#0"}; !reflect.DeepEqual(storeIDs(store), want) {
+		t.Errorf("store ids = %v, want %v", storeIDs(store), want)
+	}
+
+	if _, err := indexer.Index(ctx, []SourceDocument{{ID: "a"}, {ID: "a"}}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Index() with duplicate ids error = %v, want ErrInvalidRequest", err)
+	}
+}
+
+// countingCheckpointStore 记录 Save 的调用次数
+type countingCheckpointStore struct {
+	*MemoryCheckpointStore
+	saves int
+}
+
+func (s *countingCheckpointStore) Save(ctx context.Context, checkpoint IndexCheckpoint) error {
+	s.saves++
+	return s.MemoryCheckpointStore.Save(ctx, checkpoint)
+}
+
+func TestIndexerCheckpointJournal(t *testing.T) {
+	ctx := context.Background()
+	config := IndexerConfig{Splitter: textsplit.TokenSplitter{ChunkSize: 10, Counter: wordCounter}, BatchSize: 1}
+	docs := []SourceDocument{
+		{ID: "1", Text: "first document"},
+		{ID: "2", Text: "second document"},
+		{ID: "3", Text: "third document"},
+	}
+
+	// 每批只追加变化，完成后保存一次完整的检查点
+	var embedded []string
+	counting := &countingCheckpointStore{MemoryCheckpointStore: NewMemoryCheckpointStore()}
+	if _, err := NewIndexer(countingEmbedder(&embedded, nil), NewMemoryVectorStore(nil, CosineSimilarity), counting, config).Index(ctx, docs); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if counting.saves != 1 {
+		t.Errorf("Save() called %d times for 3 batches, want 1", counting.saves)
+	}
+
+	// 中断后文件存储从日志恢复进度
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoints, _ := NewFileCheckpointStore(path)
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	_, err := NewIndexer(countingEmbedder(&embedded, func(text string) bool {
+		return strings.HasPrefix(text, "third")
+	}), store, checkpoints, config).Index(ctx, docs)
+	if err == nil {
+		t.Fatal("Index() with failing embedder expected error, got nil")
+	}
+
+	reopened, _ := NewFileCheckpointStore(path)
+	checkpoint, err := reopened.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(checkpoint.Documents) != 2 {
+		t.Fatalf("Load() after interruption = %d documents, want 2", len(checkpoint.Documents))
+	}
+
+	embedded = nil
+	stats, err := NewIndexer(countingEmbedder(&embedded, nil), store, reopened, config).Index(ctx, docs)
+	if err != nil {
+		t.Fatalf("resumed Index() error = %v", err)
+	}
+	if stats.Skipped != 2 || stats.Indexed != 1 {
+		t.Errorf("resumed Index() stats = %+v, want 2 skipped, 1 indexed", stats)
+	}
+	if _, err := os.Stat(path + ".journal"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal not merged after a complete Index(): %v", err)
+	}
+}
+
+func TestIndexerStoreMismatch(t *testing.T) {
+	ctx := context.Background()
+	config := IndexerConfig{Splitter: textsplit.TokenSplitter{ChunkSize: 10, Counter: wordCounter}}
+	docs := []SourceDocument{{ID: "1", Text: "first document"}, {ID: "2", Text: "second document"}}
+	checkpoints := NewMemoryCheckpointStore()
+
+	var embedded []string
+	if _, err := NewIndexer(countingEmbedder(&embedded, nil), NewMemoryVectorStore(nil, CosineSimilarity), checkpoints, config).Index(ctx, docs); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	// 重启后内存存储为空，检查点失效，所有文档重新索引
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	stats, err := NewIndexer(countingEmbedder(&embedded, nil), store, checkpoints, config).Index(ctx, docs)
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if stats.Indexed != 2 || stats.Skipped != 0 || store.Len() != 2 {
+		t.Errorf("Index() with empty store stats = %+v, Len() = %d, want 2 indexed", stats, store.Len())
+	}
+}
+
+func TestIndexerModelMismatch(t *testing.T) {
+	ctx := context.Background()
+	config := IndexerConfig{Splitter: textsplit.TokenSplitter{ChunkSize: 10, Counter: wordCounter}}
+	docs := []SourceDocument{{ID: "1", Text: "first document"}, {ID: "2", Text: "second document"}}
+	checkpoints := NewMemoryCheckpointStore()
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	embedder := func(model string, dimensions int) *LLMEmbedder {
+		return NewLLMEmbedder(&mockService{
+			embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+				return EmbeddingResponse{Embedding: make([]float64, dimensions)}, nil
+			},
+		}, "test-provider", model, dimensions)
+	}
+
+	tests := []struct {
+		name       string
+		model      string
+		dimensions int
+		indexed    int
+	}{
+		{"first run", "test-model", 2, 2},
+		{"same model", "test-model", 2, 0},
+		{"new model", "other-model", 2, 2},
+	}
+	for _, tt := range tests {
+		stats, err := NewIndexer(embedder(tt.model, tt.dimensions), store, checkpoints, config).Index(ctx, docs)
+		if err != nil {
+			t.Fatalf("%s: Index() error = %v", tt.name, err)
+		}
+		if stats.Indexed != tt.indexed || store.Len() != 2 {
+			t.Errorf("%s: stats = %+v, Len() = %d, want %d indexed and 2 chunks", tt.name, stats, store.Len(), tt.indexed)
+		}
+		checkpoint, _ := checkpoints.Load(ctx)
+		if checkpoint.Model != "test-provider/"+tt.model || checkpoint.Dimensions != tt.dimensions {
+			t.Errorf("%s: checkpoint records %q with %d dimensions, want %q with %d", tt.name, checkpoint.Model, checkpoint.Dimensions, "test-provider/"+tt.model, tt.dimensions)
+		}
+	}
+}
+
+func TestIndexCheckpointMatches(t *testing.T) {
+	checkpoint := IndexCheckpoint{Model: "ollama/a", Dimensions: 768}
+	tests := []struct {
+		name string
+		spec EmbeddingSpec
+		want bool
+	}{
+		{"same model", EmbeddingSpec{Model: "ollama/a", Dimensions: 768}, true},
+		{"unknown dimensions", EmbeddingSpec{Model: "ollama/a"}, true},
+		{"other model", EmbeddingSpec{Model: "ollama/b", Dimensions: 768}, false},
+		{"other dimensions", EmbeddingSpec{Model: "ollama/a", Dimensions: 256}, false},
+	}
+	for _, tt := range tests {
+		if got := checkpoint.matches(tt.spec); got != tt.want {
+			t.Errorf("%s: matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// 旧版本的检查点没有记录嵌入模型，不做检查
+	if !(IndexCheckpoint{}).matches(EmbeddingSpec{Model: "ollama/b", Dimensions: 256}) {
+		t.Error("checkpoint without a model should match any embedder")
+	}
+}
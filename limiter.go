@@ -0,0 +1,282 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// AdaptiveLimiterConfig 是自适应并发限制器的配置
+type AdaptiveLimiterConfig struct {
+	InitialLimit int     // 初始并发数
+	MinLimit     int     // 最小并发数
+	MaxLimit     int     // 最大并发数
+	Tolerance    float64 // 平均延迟超过基准延迟的倍数时认为后端已饱和
+	Backoff      float64 // 过载错误或延迟恶化时并发数乘以的系数
+}
+
+// DefaultAdaptiveLimiterConfig 返回默认的自适应并发限制器配置
+func DefaultAdaptiveLimiterConfig() AdaptiveLimiterConfig {
+	return AdaptiveLimiterConfig{
+		InitialLimit: 4,
+		MinLimit:     1,
+		MaxLimit:     64,
+		Tolerance:    2,
+		Backoff:      0.5,
+	}
+}
+
+// AdaptiveLimiter 是基于 AIMD 的自适应并发限制器
+// 并发数被占满且延迟正常时每完成约 limit 个请求加 1；平均延迟超过基准延迟的 Tolerance 倍时按 0.9 缩减，
+// 遇到限流、5xx 或超时错误时按 Backoff 缩减，每个往返时间内最多缩减一次
+type AdaptiveLimiter struct {
+	config       AdaptiveLimiterConfig
+	limit        float64
+	inflight     int
+	waiters      []chan struct{}
+	baseline     time.Duration // 观测到的最小延迟，缓慢向上漂移以适应后端变化
+	smoothed     time.Duration // 延迟的指数移动平均
+	lastDecrease time.Time
+	mu           sync.Mutex
+}
+
+// NewAdaptiveLimiter 创建一个新的自适应并发限制器
+func NewAdaptiveLimiter(config AdaptiveLimiterConfig) *AdaptiveLimiter {
+	defaults := DefaultAdaptiveLimiterConfig()
+	if config.MinLimit <= 0 {
+		config.MinLimit = defaults.MinLimit
+	}
+	if config.MaxLimit < config.MinLimit {
+		config.MaxLimit = max(defaults.MaxLimit, config.MinLimit)
+	}
+	if config.InitialLimit <= 0 {
+		config.InitialLimit = defaults.InitialLimit
+	}
+	config.InitialLimit = min(max(config.InitialLimit, config.MinLimit), config.MaxLimit)
+	if config.Tolerance <= 1 {
+		config.Tolerance = defaults.Tolerance
+	}
+	if config.Backoff <= 0 || config.Backoff >= 1 {
+		config.Backoff = defaults.Backoff
+	}
+	return &AdaptiveLimiter{
+		config: config,
+		limit:  float64(config.InitialLimit),
+	}
+}
+
+// Limit 返回当前的并发上限
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight 返回正在执行的请求数
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// MaxLimit 返回配置的最大并发数
+func (l *AdaptiveLimiter) MaxLimit() int {
+	return l.config.MaxLimit
+}
+
+// Acquire 等待一个并发槽位，返回的 release 函数必须在请求结束后以请求的错误调用
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) (func(err error), error) {
+	l.mu.Lock()
+	for l.inflight >= int(l.limit) {
+		wait := make(chan struct{})
+		l.waiters = append(l.waiters, wait)
+		l.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.removeWaiter(wait)
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		l.mu.Lock()
+	}
+	l.inflight++
+	saturated := l.inflight >= int(l.limit)
+	l.mu.Unlock()
+
+	start := time.Now()
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { l.release(time.Since(start), saturated, err) })
+	}, nil
+}
+
+// removeWaiter 移除一个已取消的等待者，如果它已被唤醒则把机会让给下一个，调用方需持有锁
+func (l *AdaptiveLimiter) removeWaiter(wait chan struct{}) {
+	for i, w := range l.waiters {
+		if w == wait {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return
+		}
+	}
+	l.wake()
+}
+
+// wake 唤醒等待者直到并发数占满，调用方需持有锁
+func (l *AdaptiveLimiter) wake() {
+	for free := int(l.limit) - l.inflight; free > 0 && len(l.waiters) > 0; free-- {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// release 记录请求结果并调整并发上限
+func (l *AdaptiveLimiter) release(latency time.Duration, saturated bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+
+	switch {
+	case IsOverloadError(err):
+		l.decrease(l.config.Backoff)
+	case err != nil:
+		// 其他错误（如请求非法）与后端负载无关
+	default:
+		l.observe(latency)
+		if float64(l.smoothed) > float64(l.baseline)*l.config.Tolerance {
+			l.decrease(0.9)
+		} else if saturated {
+			l.limit = math.Min(l.limit+1/l.limit, float64(l.config.MaxLimit))
+		}
+	}
+	l.wake()
+}
+
+// observe 更新延迟统计，调用方需持有锁
+func (l *AdaptiveLimiter) observe(latency time.Duration) {
+	if l.baseline == 0 || latency < l.baseline {
+		l.baseline = latency
+	} else {
+		l.baseline += (latency - l.baseline) / 1000
+	}
+	if l.smoothed == 0 {
+		l.smoothed = latency
+	} else {
+		l.smoothed += (latency - l.smoothed) / 10
+	}
+}
+
+// decrease 按系数缩减并发上限，每个往返时间内最多缩减一次，调用方需持有锁
+func (l *AdaptiveLimiter) decrease(factor float64) {
+	now := time.Now()
+	if now.Sub(l.lastDecrease) < l.smoothed {
+		return
+	}
+	l.lastDecrease = now
+	l.limit = math.Max(math.Floor(l.limit*factor), float64(l.config.MinLimit))
+}
+
+// IsOverloadError 判断错误是否表示后端过载：限流、服务不可用、超时或 HTTP 429/5xx
+func IsOverloadError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrLLMNotAvailable) ||
+		errors.Is(err, ErrRequestTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var status api.StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	return false
+}
+
+// limitedProvider 是通过自适应限制器控制并发的提供者
+type limitedProvider struct {
+	Provider
+	limiter *AdaptiveLimiter
+}
+
+// NewLimitedProvider 返回一个通过限制器控制 Complete、Chat、ChatStream 和 Embed 并发的提供者，
+// 注册到 Service 后该提供者的所有请求共享同一个并发上限
+func NewLimitedProvider(provider Provider, limiter *AdaptiveLimiter) Provider {
+	return &limitedProvider{Provider: provider, limiter: limiter}
+}
+
+// Complete 生成文本补全
+func (p *limitedProvider) Complete(ctx context.Context, modelID string, request CompletionRequest) (CompletionResponse, error) {
+	release, err := p.limiter.Acquire(ctx)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+	response, err := p.Provider.Complete(ctx, modelID, request)
+	release(err)
+	return response, err
+}
+
+// Chat 执行聊天补全
+func (p *limitedProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	release, err := p.limiter.Acquire(ctx)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	response, err := p.Provider.Chat(ctx, modelID, request)
+	release(err)
+	return response, err
+}
+
+// Embed 生成文本的嵌入向量
+func (p *limitedProvider) Embed(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+	release, err := p.limiter.Acquire(ctx)
+	if err != nil {
+		return EmbeddingResponse{}, err
+	}
+	response, err := p.Provider.Embed(ctx, modelID, request)
+	release(err)
+	return response, err
+}
+
+// ChatStream 流式执行聊天补全，整个流式输出期间占用一个并发槽位
+func (p *limitedProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	release, err := p.limiter.Acquire(ctx)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	response, err := wrappedChatStream(ctx, p.Provider, modelID, request, fn)
+	release(err)
+	return response, err
+}
+
+// EmbeddingModelInfo 转发给被包装的提供者
+func (p *limitedProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return wrappedEmbeddingModelInfo(ctx, p.Provider, modelID)
+}
+
+// wrappedChatStream 在被包装的提供者支持时流式执行聊天补全，否则调用 Chat 并把完整回复作为一个增量交给 fn
+func wrappedChatStream(ctx context.Context, provider Provider, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	if streamer, ok := provider.(ChatStreamer); ok {
+		return streamer.ChatStream(ctx, modelID, request, fn)
+	}
+	response, err := provider.Chat(ctx, modelID, request)
+	if err != nil || fn == nil || response.Message.Content == "" {
+		return response, err
+	}
+	return response, fn(response.Message.Content)
+}
+
+// wrappedEmbeddingModelInfo 在被包装的提供者支持时查询嵌入模型元数据
+func wrappedEmbeddingModelInfo(ctx context.Context, provider Provider, modelID string) (EmbeddingModelInfo, error) {
+	if p, ok := provider.(EmbeddingModelInfoProvider); ok {
+		return p.EmbeddingModelInfo(ctx, modelID)
+	}
+	return EmbeddingModelInfo{}, fmt.Errorf("provider %s does not report embedding model info", provider.Name())
+}
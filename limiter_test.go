@@ -0,0 +1,253 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// runLimited 用 workers 个goroutine通过限制器发送 n 个请求，call 模拟后端
+func runLimited(limiter *AdaptiveLimiter, workers, n int, call func() error) {
+	var remaining atomic.Int32
+	remaining.Store(int32(n))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for remaining.Add(-1) >= 0 {
+				release, err := limiter.Acquire(context.Background())
+				if err != nil {
+					return
+				}
+				release(call())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAdaptiveLimiterRampsUp(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 2, MaxLimit: 16})
+	runLimited(limiter, 32, 600, func() error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if got := limiter.Limit(); got <= 2 {
+		t.Errorf("Limit() = %d after healthy traffic, want it to grow above 2", got)
+	}
+	if got := limiter.InFlight(); got != 0 {
+		t.Errorf("InFlight() = %d, want 0", got)
+	}
+}
+
+func TestAdaptiveLimiterBacksOff(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"rate limited", fmt.Errorf("wrapped: %w", ErrRateLimited)},
+		{"server error", api.StatusError{StatusCode: http.StatusServiceUnavailable}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 16, MaxLimit: 16})
+			release, err := limiter.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			release(tt.err)
+			if got := limiter.Limit(); got != 8 {
+				t.Errorf("Limit() = %d after overload error, want 8", got)
+			}
+		})
+	}
+
+	limiter := NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 4})
+	release, _ := limiter.Acquire(context.Background())
+	release(fmt.Errorf("%w: bad prompt", ErrInvalidRequest))
+	if got := limiter.Limit(); got != 4 {
+		t.Errorf("Limit() = %d after client error, want unchanged 4", got)
+	}
+}
+
+func TestAdaptiveLimiterLatency(t *testing.T) {
+	// 后端只能同时处理 4 个请求，超出部分排队使延迟线性增长
+	var inflight atomic.Int32
+	limiter := NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 1, MaxLimit: 64})
+	runLimited(limiter, 64, 1500, func() error {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		time.Sleep(time.Duration(max(1, n-3)) * 500 * time.Microsecond)
+		return nil
+	})
+	if got := limiter.Limit(); got >= 32 {
+		t.Errorf("Limit() = %d, want it to settle well below the maximum when latency degrades", got)
+	}
+}
+
+func TestAdaptiveLimiterAcquireCanceled(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 1, MaxLimit: 1})
+	release, _ := limiter.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() on full limiter error = %v, want context.DeadlineExceeded", err)
+	}
+
+	release(nil)
+	next, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() after release error = %v", err)
+	}
+	next(nil)
+}
+
+func TestIsOverloadError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"rate limited", ErrRateLimited, true},
+		{"not available", fmt.Errorf("x: %w", ErrLLMNotAvailable), true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"429", fmt.Errorf("x: %w", api.StatusError{StatusCode: http.StatusTooManyRequests}), true},
+		{"500", api.StatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"400", api.StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"invalid request", ErrInvalidRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsOverloadError(tt.err); got != tt.want {
+				t.Errorf("IsOverloadError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitedProviderAndEmbedder(t *testing.T) {
+	var active, maxActive atomic.Int32
+	svc := NewService()
+	limiter := NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 3, MaxLimit: 3})
+	_ = svc.RegisterProvider(NewLimitedProvider(&mockProvider{
+		name: "test-provider",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			return EmbeddingResponse{Embedding: []float64{1}}, nil
+		},
+	}, limiter))
+
+	embedder := NewLLMEmbedder(svc, "test-provider", "test-model", 1)
+	embedder.SetLimiter(NewAdaptiveLimiter(AdaptiveLimiterConfig{InitialLimit: 2, MaxLimit: 8}))
+
+	contents := make([]interface{}, 100)
+	for i := range contents {
+		contents[i] = "text"
+	}
+	if _, err := embedder.BatchEmbed(context.Background(), contents); err != nil {
+		t.Fatalf("BatchEmbed() error = %v", err)
+	}
+	if got := maxActive.Load(); got > 3 {
+		t.Errorf("provider saw %d concurrent requests, want at most 3", got)
+	}
+}
+
+// streamingMockProvider 是支持流式输出的模拟提供者，按 deltas 依次输出
+type streamingMockProvider struct {
+	mockProvider
+	deltas []string
+	models []string // 收到的模型名称
+	mu     sync.Mutex
+}
+
+func (p *streamingMockProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	p.mu.Lock()
+	p.models = append(p.models, modelID)
+	p.mu.Unlock()
+	var content string
+	for _, delta := range p.deltas {
+		content += delta
+		if fn != nil {
+			if err := fn(delta); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+	}
+	return ChatResponse{Message: Message{Role: "assistant", Content: content}}, nil
+}
+
+func TestWrappedProvidersChatStream(t *testing.T) {
+	wrappers := []struct {
+		name  string
+		wrap  func(Provider) Provider
+		model string // 被包装的提供者收到的模型名称
+	}{
+		{"limited", func(p Provider) Provider {
+			return NewLimitedProvider(p, NewAdaptiveLimiter(AdaptiveLimiterConfig{}))
+		}, "fast"},
+		{"retry", func(p Provider) Provider { return NewRetryProvider(p, RetryPolicy{}) }, "fast"},
+		{"rate limited", func(p Provider) Provider { return NewRateLimitedProvider(p, NewRateLimiter(600, 1)) }, "fast"},
+		{"alias", func(p Provider) Provider { return NewAliasProvider(p, map[string]string{"fast": "small-model"}) }, "small-model"},
+		{"scheduled", func(p Provider) Provider {
+			return NewScheduledProvider(p, NewScheduler(SchedulerConfig{Concurrency: 1}))
+		}, "fast"},
+		{"coalescing", func(p Provider) Provider { return NewCoalescingProvider(p) }, "fast"},
+	}
+
+	for _, tt := range wrappers {
+		t.Run(tt.name, func(t *testing.T) {
+			// 被包装的提供者支持流式输出时逐个转发增量
+			inner := &streamingMockProvider{mockProvider: mockProvider{name: "mock"}, deltas: []string{"Hel", "lo"}}
+			streamer, ok := tt.wrap(inner).(ChatStreamer)
+			if !ok {
+				t.Fatal("wrapped provider does not implement ChatStreamer")
+			}
+			var deltas []string
+			response, err := streamer.ChatStream(context.Background(), "fast", ChatRequest{}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ChatStream() error = %v", err)
+			}
+			if fmt.Sprint(deltas) != "[Hel lo]" || response.Message.Content != "Hello" {
+				t.Errorf("ChatStream() deltas = %q, content = %q, want [Hel lo] and Hello", deltas, response.Message.Content)
+			}
+			if fmt.Sprint(inner.models) != "["+tt.model+"]" {
+				t.Errorf("inner provider received models %v, want [%s]", inner.models, tt.model)
+			}
+
+			// 不支持流式输出时调用 Chat 并把完整回复作为一个增量
+			plain := &mockProvider{name: "mock", chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+				return ChatResponse{Message: Message{Role: "assistant", Content: "whole reply"}}, nil
+			}}
+			deltas = nil
+			response, err = tt.wrap(plain).(ChatStreamer).ChatStream(context.Background(), "fast", ChatRequest{}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ChatStream() fallback error = %v", err)
+			}
+			if len(deltas) != 1 || deltas[0] != "whole reply" || response.Message.Content != "whole reply" {
+				t.Errorf("ChatStream() fallback deltas = %q, content = %q", deltas, response.Message.Content)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -16,26 +17,49 @@ const (
 
 // OllamaProvider 实现了Ollama的Provider接口
 type OllamaProvider struct {
+	name       string
 	embedModel string
 	client     *api.Client
 }
 
+// OllamaConfig 是 Ollama 提供者的配置
+type OllamaConfig struct {
+	Name       string       // 注册到 Service 的名称，默认 ollama，同时使用多个 Ollama 服务时需要区分
+	Endpoint   string       // 服务地址
+	EmbedModel string       // 默认嵌入模型，默认 mxbai-embed-large
+	HTTPClient *http.Client // 发送请求的客户端，默认 http.DefaultClient
+}
+
 // NewOllamaProvider 创建一个新的Ollama提供者实例
 func NewOllamaProvider(endpoint string) (Provider, error) {
-	endpointURL, err := url.Parse(endpoint)
+	return NewOllamaProviderWithConfig(OllamaConfig{Endpoint: endpoint})
+}
+
+// NewOllamaProviderWithConfig 根据配置创建Ollama提供者实例
+func NewOllamaProviderWithConfig(config OllamaConfig) (Provider, error) {
+	endpointURL, err := url.Parse(config.Endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("invalid endpoint URL: %w", err)
 	}
-	client := api.NewClient(endpointURL, http.DefaultClient)
+	if config.Name == "" {
+		config.Name = "ollama"
+	}
+	if config.EmbedModel == "" {
+		config.EmbedModel = embedModel
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
 	return &OllamaProvider{
-		embedModel: embedModel,
-		client:     client,
+		name:       config.Name,
+		embedModel: config.EmbedModel,
+		client:     api.NewClient(endpointURL, config.HTTPClient),
 	}, nil
 }
 
 // Name 返回提供者的名称
 func (p *OllamaProvider) Name() string {
-	return "ollama"
+	return p.name
 }
 
 // GetEmbedModel 返回嵌入模型
@@ -116,12 +140,24 @@ func (p *OllamaProvider) Complete(ctx context.Context, modelID string, request C
 
 // Chat 处理聊天补全
 func (p *OllamaProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	return p.ChatStream(ctx, modelID, request, nil)
+}
+
+// ChatStream 流式处理聊天补全，fn 为空时只返回完整的响应
+func (p *OllamaProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
 	messages := make([]api.Message, len(request.Messages))
 	for i, msg := range request.Messages {
 		messages[i] = api.Message{
 			Role:    msg.Role,
 			Content: msg.Content,
 		}
+		for _, image := range msg.Images {
+			data, err := base64.StdEncoding.DecodeString(image)
+			if err != nil {
+				return ChatResponse{}, fmt.Errorf("%w: invalid base64 image: %v", ErrInvalidRequest, err)
+			}
+			messages[i].Images = append(messages[i].Images, api.ImageData(data))
+		}
 	}
 
 	options := map[string]interface{}{
@@ -144,6 +180,9 @@ func (p *OllamaProvider) Chat(ctx context.Context, modelID string, request ChatR
 	err := p.client.Chat(ctx, &chatRequest, func(response api.ChatResponse) error {
 		responseContent.WriteString(response.Message.Content)
 		finalResponse = response
+		if fn != nil && response.Message.Content != "" {
+			return fn(response.Message.Content)
+		}
 		return nil
 	})
 
@@ -194,3 +233,29 @@ func (p *OllamaProvider) Embed(ctx context.Context, modelID string, request Embe
 		},
 	}, nil
 }
+
+// EmbeddingModelInfo 从模型元数据中读取嵌入维度和上下文长度
+func (p *OllamaProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	response, err := p.client.Show(ctx, &api.ShowRequest{Model: modelID})
+	if err != nil {
+		return EmbeddingModelInfo{}, fmt.Errorf("failed to show model: %w", err)
+	}
+
+	info := EmbeddingModelInfo{Name: modelID}
+	for key, value := range response.ModelInfo {
+		n, ok := value.(float64)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(key, ".embedding_length"):
+			info.Dimensions = int(n)
+		case strings.HasSuffix(key, ".context_length"):
+			info.MaxInputTokens = int(n)
+		}
+	}
+	if info.Dimensions == 0 {
+		return EmbeddingModelInfo{}, fmt.Errorf("model %s does not report an embedding length", modelID)
+	}
+	return info, nil
+}
@@ -402,3 +402,78 @@ func TestOllamaProvider_EmbedWithContext(t *testing.T) {
 		t.Errorf("Embed() returned embedding of length %d, want %d", len(response.Embedding), len(expectedEmbedding))
 	}
 }
+
+func TestOllamaProvider_EmbeddingModelInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/show" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model_info": map[string]interface{}{
+				"general.architecture":  "bert",
+				"bert.embedding_length": 1024,
+				"bert.context_length":   512,
+			},
+		})
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	provider := &OllamaProvider{client: api.NewClient(serverURL, server.Client())}
+
+	info, err := provider.EmbeddingModelInfo(context.Background(), "mxbai-embed-large")
+	if err != nil {
+		t.Fatalf("EmbeddingModelInfo() error = %v", err)
+	}
+	if info.Dimensions != 1024 || info.MaxInputTokens != 512 {
+		t.Errorf("EmbeddingModelInfo() = %+v, want 1024 dimensions and 512 max input tokens", info)
+	}
+}
+
+func TestOllamaProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		for _, part := range []string{"你", "好", "！"} {
+			encoder.Encode(map[string]interface{}{
+				"model":   "qwen2.5",
+				"message": map[string]string{"role": "assistant", "content": part},
+				"done":    false,
+			})
+		}
+		encoder.Encode(map[string]interface{}{
+			"model":             "qwen2.5",
+			"message":           map[string]string{"role": "assistant", "content": ""},
+			"done":              true,
+			"prompt_eval_count": 5,
+			"eval_count":        3,
+		})
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	provider := &OllamaProvider{client: api.NewClient(serverURL, server.Client())}
+
+	var deltas []string
+	response, err := provider.ChatStream(context.Background(), "qwen2.5", ChatRequest{
+		Messages: []Message{{Role: "user", Content: "你好"}},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if strings.Join(deltas, "|") != "你|好|！" {
+		t.Errorf("ChatStream() deltas = %q, want 你|好|！", deltas)
+	}
+	if response.Message.Content != "你好！" || response.Usage.TotalTokens != 8 {
+		t.Errorf("ChatStream() = %+v, want the full message and 8 total tokens", response)
+	}
+}
@@ -0,0 +1,299 @@
+package llm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxInflatedPDFSize 是解压后所有内容流的总大小上限，防止很小的压缩流膨胀到数 GB
+const maxInflatedPDFSize = 64 << 20
+
+// pdfStreamPattern 匹配PDF中的流对象及其字典
+var pdfStreamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// ExtractPDFText 从PDF数据中提取文本
+// 支持未压缩和FlateDecode压缩的内容流中的文本操作符（Tj、TJ、'、"），
+// 不支持加密文档和依赖CMap的CID字体编码，提取结果不是有效的 UTF-8 文本时返回错误
+func ExtractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", fmt.Errorf("not a PDF document")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", fmt.Errorf("encrypted PDF documents are not supported")
+	}
+
+	var text strings.Builder
+	budget := maxInflatedPDFSize
+	for _, match := range pdfStreamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := data[match[2]:match[3]]
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			decoded, err := inflate(content, budget)
+			if errors.Is(err, ErrAttachmentTooLarge) {
+				return "", err
+			}
+			if err != nil {
+				continue // 跳过无法解压的流（例如图像数据）
+			}
+			budget -= len(decoded)
+			content = decoded
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue // 其他编码方式的流不是文本内容
+		}
+
+		if !bytes.Contains(content, []byte("BT")) {
+			continue
+		}
+		extractContentText(content, &text)
+	}
+
+	result := strings.TrimSpace(text.String())
+	if result == "" {
+		return "", fmt.Errorf("no extractable text found in PDF")
+	}
+	if !isReadableText(result) {
+		// WinAnsi、PDFDoc 编码的字节或没有 ToUnicode 映射的 CID 编码无法直接作为文本
+		return "", fmt.Errorf("unsupported PDF text encoding")
+	}
+	return result, nil
+}
+
+// isReadableText 判断提取结果是否是有效的 UTF-8 且不含换行和制表符以外的控制字符
+func isReadableText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// inflate 解压FlateDecode数据，解压后超过 limit 字节时返回 ErrAttachmentTooLarge
+func inflate(data []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var out bytes.Buffer
+	// 流数据末尾可能有多余字节，读到的部分仍然可用
+	if _, err := io.Copy(&out, io.LimitReader(r, int64(limit)+1)); err != nil && out.Len() == 0 {
+		return nil, err
+	}
+	if out.Len() > limit {
+		return nil, fmt.Errorf("%w: decompressed PDF content exceeds %d bytes", ErrAttachmentTooLarge, maxInflatedPDFSize)
+	}
+	return out.Bytes(), nil
+}
+
+// extractContentText 解析内容流中的文本操作符
+func extractContentText(content []byte, out *strings.Builder) {
+	var operands []string // 当前操作符前的字符串操作数
+	lineStarted := false
+
+	newline := func() {
+		if lineStarted {
+			out.WriteString("\n")
+			lineStarted = false
+		}
+	}
+	write := func(s string) {
+		out.WriteString(s)
+		lineStarted = true
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := readLiteralString(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			s, next := readHexString(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			// TJ数组：字符串之间较大的负偏移视为空格
+			var b strings.Builder
+			i++
+			for i < len(content) && content[i] != ']' {
+				switch {
+				case content[i] == '(':
+					s, next := readLiteralString(content, i)
+					b.WriteString(s)
+					i = next
+				case content[i] == '<':
+					s, next := readHexString(content, i)
+					b.WriteString(s)
+					i = next
+				case content[i] == '-' || (content[i] >= '0' && content[i] <= '9') || content[i] == '.':
+					j := i
+					for j < len(content) && (content[j] == '-' || content[j] == '.' || (content[j] >= '0' && content[j] <= '9')) {
+						j++
+					}
+					var offset float64
+					fmt.Sscanf(string(content[i:j]), "%g", &offset)
+					if offset < -200 {
+						b.WriteString(" ")
+					}
+					i = j
+				default:
+					i++
+				}
+			}
+			operands = append(operands, b.String())
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			j := i
+			for j < len(content) && isPDFRegular(content[j]) {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "Tj", "TJ":
+				for _, s := range operands {
+					write(s)
+				}
+			case "T*", "Td", "TD", "ET":
+				newline()
+			}
+			if !isPDFNumber(content[i:j]) {
+				operands = operands[:0]
+			}
+			i = j
+		default:
+			// ' 和 " 操作符：换行后显示字符串
+			if c == '\'' || c == '"' {
+				newline()
+				for _, s := range operands {
+					write(s)
+				}
+				operands = operands[:0]
+			}
+			i++
+		}
+	}
+	newline()
+}
+
+// isPDFRegular 判断字符是否为PDF的常规字符（非空白、非分隔符）
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%', '\'', '"':
+		return false
+	}
+	return true
+}
+
+// isPDFNumber 判断记号是否为数字
+func isPDFNumber(token []byte) bool {
+	for _, c := range token {
+		if c != '-' && c != '+' && c != '.' && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return len(token) > 0
+}
+
+// readLiteralString 读取以 '(' 开始的字面字符串，返回字符串和结束后的位置
+func readLiteralString(content []byte, i int) (string, int) {
+	var b strings.Builder
+	depth := 0
+	for i < len(content) {
+		c := content[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1
+			}
+			b.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(content) {
+				break
+			}
+			switch e := content[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '\r', '\n':
+				// 续行
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					n := 0
+					for n < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7' {
+						v = v*8 + int(content[i]-'0')
+						i++
+						n++
+					}
+					i--
+					b.WriteByte(byte(v))
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	return b.String(), i
+}
+
+// readHexString 读取以 '<' 开始的十六进制字符串
+func readHexString(content []byte, i int) (string, int) {
+	end := bytes.IndexByte(content[i:], '>')
+	if end < 0 {
+		return "", len(content)
+	}
+	digits := bytes.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n\f", r) {
+			return -1
+		}
+		return r
+	}, content[i+1:i+end])
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return "", i + end + 1
+	}
+	return string(decoded), i + end + 1
+}
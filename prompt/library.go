@@ -0,0 +1,174 @@
+package prompt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Library 是按名称和版本管理的模板库
+type Library struct {
+	partials  map[string]string
+	templates map[string]map[string]*Template
+	mu        sync.RWMutex
+}
+
+// NewLibrary 创建一个新的模板库
+func NewLibrary() *Library {
+	return &Library{
+		partials:  make(map[string]string),
+		templates: make(map[string]map[string]*Template),
+	}
+}
+
+// AddPartial 添加一个命名片段，之后添加的模板可通过 {{template "name" .}} 引用
+func (l *Library) AddPartial(name, text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partials[name] = text
+}
+
+// Add 解析并添加模板，同名同版本的模板会被替换
+func (l *Library) Add(t *Template) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := t.Parse(l.partials); err != nil {
+		return err
+	}
+
+	versions, exists := l.templates[t.Name]
+	if !exists {
+		versions = make(map[string]*Template)
+		l.templates[t.Name] = versions
+	}
+	versions[t.Version] = t
+	return nil
+}
+
+// Get 获取指定版本的模板，version 为空时返回最新版本
+func (l *Library) Get(name, version string) (*Template, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	versions, exists := l.templates[name]
+	if !exists {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+
+	if version == "" {
+		list := sortedVersions(versions)
+		return versions[list[len(list)-1]], nil
+	}
+
+	t, exists := versions[version]
+	if !exists {
+		return nil, fmt.Errorf("template %s version %s not found", name, version)
+	}
+	return t, nil
+}
+
+// Versions 返回模板的所有版本，按从旧到新排序
+func (l *Library) Versions(name string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return sortedVersions(l.templates[name])
+}
+
+// Names 返回所有模板名称
+func (l *Library) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := make([]string, 0, len(l.templates))
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadDir 从目录加载模板库
+// 目录下 partials 子目录中的 *.tmpl 文件作为命名片段（名称为去掉扩展名的文件名），
+// 其余 *.json 文件每个描述一个 Template
+func (l *Library) LoadDir(dir string) error {
+	partialFiles, err := filepath.Glob(filepath.Join(dir, "partials", "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, file := range partialFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read partial: %w", err)
+		}
+		l.AddPartial(strings.TrimSuffix(filepath.Base(file), ".tmpl"), string(data))
+	}
+
+	templateFiles, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range templateFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+
+		var t Template
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("failed to decode template %s: %w", filepath.Base(file), err)
+		}
+		if err := l.Add(&t); err != nil {
+			return fmt.Errorf("failed to load template %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	return nil
+}
+
+// sortedVersions 按版本号从旧到新排序
+func sortedVersions(versions map[string]*Template) []string {
+	list := make([]string, 0, len(versions))
+	for version := range versions {
+		list = append(list, version)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return compareVersions(list[i], list[j]) < 0
+	})
+	return list
+}
+
+// compareVersions 按点分隔的各段比较版本号，数字段按数值比较
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var sa, sb string
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+		na, errA := strconv.Atoi(sa)
+		nb, errB := strconv.Atoi(sb)
+		if errA == nil && errB == nil {
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hewenyu/llm"
+)
+
+func TestTemplateChatRequest(t *testing.T) {
+	tmpl := &Template{
+		Name:   "translate",
+		System: "You translate text into {{.language}}.",
+		User:   "{{.text}}",
+		Variables: []Variable{
+			{Name: "language", Type: TypeString, Default: "English"},
+			{Name: "text", Type: TypeString, Required: true},
+		},
+		Examples: []Example{
+			{User: "你好", Assistant: "Hello"},
+		},
+	}
+
+	got, err := tmpl.ChatRequest(map[string]interface{}{"text": "谢谢"}, llm.ChatRequest{Temperature: 0.2})
+	if err != nil {
+		t.Fatalf("ChatRequest() error = %v", err)
+	}
+
+	want := []llm.Message{
+		{Role: "system", Content: "You translate text into English."},
+		{Role: "user", Content: "你好"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "谢谢"},
+	}
+	if !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("ChatRequest() messages = %+v, want %+v", got.Messages, want)
+	}
+	if got.Temperature != 0.2 {
+		t.Errorf("ChatRequest() temperature = %v, want 0.2", got.Temperature)
+	}
+}
+
+func TestTemplateCompletionRequest(t *testing.T) {
+	tmpl := &Template{
+		Name:     "classify",
+		System:   "Classify the sentiment.",
+		User:     "{{.text}}",
+		Examples: []Example{{User: "great", Assistant: "positive"}},
+	}
+
+	got, err := tmpl.CompletionRequest(map[string]interface{}{"text": "awful"}, llm.CompletionRequest{MaxTokens: 5})
+	if err != nil {
+		t.Fatalf("CompletionRequest() error = %v", err)
+	}
+
+	want := "Classify the sentiment.\n\nInput: great\nOutput: positive\n\nInput: awful\nOutput:"
+	if got.Prompt != want {
+		t.Errorf("CompletionRequest() prompt = %q, want %q", got.Prompt, want)
+	}
+	if got.MaxTokens != 5 {
+		t.Errorf("CompletionRequest() max tokens = %d, want 5", got.MaxTokens)
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	tmpl := &Template{
+		Name: "summary",
+		User: "Summarize in {{.words}} words: {{range .items}}{{.}} {{end}}",
+		Variables: []Variable{
+			{Name: "words", Type: TypeInt, Required: true},
+			{Name: "items", Type: TypeList, Required: true},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]interface{}
+		wantErr error
+	}{
+		{"valid", map[string]interface{}{"words": 10, "items": []string{"a"}}, nil},
+		{"json number", map[string]interface{}{"words": float64(10), "items": []string{"a"}}, nil},
+		{"missing", map[string]interface{}{"items": []string{"a"}}, ErrMissingVariable},
+		{"wrong type", map[string]interface{}{"words": "ten", "items": []string{"a"}}, ErrInvalidVariable},
+		{"fractional int", map[string]interface{}{"words": 1.5, "items": []string{"a"}}, ErrInvalidVariable},
+		{"unknown", map[string]interface{}{"words": 10, "items": []string{"a"}, "extra": true}, ErrUnknownVariable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tmpl.Render(tt.vars)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Render() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateOptionalVariables(t *testing.T) {
+	tmpl := &Template{
+		Name: "greeting",
+		User: "Hello {{.name}}!{{if .count}} x{{.count}}{{end}}{{range .tags}} #{{.}}{{end}}{{if .loud}} !!!{{end}}",
+		Variables: []Variable{
+			{Name: "name", Type: TypeString},
+			{Name: "count", Type: TypeInt},
+			{Name: "tags", Type: TypeList},
+			{Name: "loud", Type: TypeBool},
+			{Name: "extra"},
+		},
+	}
+
+	rendered, err := tmpl.Render(nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if rendered.User != "Hello !" {
+		t.Errorf("Render() user = %q, want optional variables rendered as zero values", rendered.User)
+	}
+}
+
+func TestTemplateConcurrentRender(t *testing.T) {
+	tmpl := &Template{Name: "echo", User: "{{.text}}"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			text := fmt.Sprint(i)
+			rendered, err := tmpl.Render(map[string]interface{}{"text": text})
+			if err != nil || rendered.User != text {
+				t.Errorf("Render() = %q, %v, want %q", rendered.User, err, text)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLibraryLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"partials/persona.tmpl": "You are a {{.role}}.",
+		"review-v1.json":        `{"name": "review", "version": "1", "system": "{{template \"persona\" .}}", "user": "Review: {{.code}}"}`,
+		"review-v2.json":        `{"name": "review", "version": "2", "system": "{{template \"persona\" .}} Be strict.", "user": "Review: {{.code}}"}`,
+		"review-v10.json":       `{"name": "review", "version": "10", "system": "{{template \"persona\" .}} Be brief.", "user": "Review: {{.code}}"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lib := NewLibrary()
+	if err := lib.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+
+	if got := lib.Versions("review"); !reflect.DeepEqual(got, []string{"1", "2", "10"}) {
+		t.Errorf("Versions() = %v, want [1 2 10]", got)
+	}
+
+	latest, err := lib.Get("review", "")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	rendered, err := latest.Render(map[string]interface{}{"role": "reviewer", "code": "x := 1"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if rendered.System != "You are a reviewer. Be brief." {
+		t.Errorf("Render() system = %q", rendered.System)
+	}
+
+	v1, err := lib.Get("review", "1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if v1.Version != "1" {
+		t.Errorf("Get() version = %q, want 1", v1.Version)
+	}
+
+	if _, err := lib.Get("missing", ""); err == nil {
+		t.Error("Get() for missing template expected error, got nil")
+	}
+}
@@ -0,0 +1,321 @@
+// Package prompt 提供基于 text/template 的提示词模板，
+// 用于渲染 llm.ChatRequest 和 llm.CompletionRequest
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/hewenyu/llm"
+)
+
+// 定义错误
+var (
+	ErrMissingVariable = errors.New("missing template variable")
+	ErrInvalidVariable = errors.New("invalid template variable")
+	ErrUnknownVariable = errors.New("unknown template variable")
+)
+
+// 变量类型
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeList   = "list"
+	TypeMap    = "map"
+	TypeAny    = "any"
+)
+
+// Variable 描述模板变量
+type Variable struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type,omitempty"`     // 变量类型，为空时等同于 any
+	Required bool        `json:"required,omitempty"` // 是否必填
+	Default  interface{} `json:"default,omitempty"`  // 未提供时的默认值
+}
+
+// Example 表示一组少样本示例
+type Example struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// Template 表示一个提示词模板
+type Template struct {
+	Name      string     `json:"name"`
+	Version   string     `json:"version,omitempty"`
+	System    string     `json:"system,omitempty"` // 系统消息模板
+	User      string     `json:"user"`             // 用户消息模板
+	Variables []Variable `json:"variables,omitempty"`
+	Examples  []Example  `json:"examples,omitempty"` // 少样本示例，示例本身也可以是模板
+
+	system    *template.Template
+	user      *template.Template
+	examples  []exampleTemplate
+	parseOnce sync.Once // 保证未调用 Parse 时并发的首次 Render 只解析一次
+	parseErr  error
+}
+
+// exampleTemplate 是解析后的示例模板
+type exampleTemplate struct {
+	user      *template.Template
+	assistant *template.Template
+}
+
+// Rendered 表示渲染后的提示词
+type Rendered struct {
+	System   string
+	User     string
+	Examples []Example
+}
+
+// Parse 解析模板，partials 中的命名模板可在模板内通过 {{template "name" .}} 引用
+func (t *Template) Parse(partials map[string]string) error {
+	if t.Name == "" {
+		return fmt.Errorf("template name cannot be empty")
+	}
+
+	for _, v := range t.Variables {
+		switch v.Type {
+		case "", TypeString, TypeInt, TypeFloat, TypeBool, TypeList, TypeMap, TypeAny:
+		default:
+			return fmt.Errorf("template %s: variable %s has unknown type %q", t.Name, v.Name, v.Type)
+		}
+	}
+
+	var err error
+	if t.system, err = parse(t.Name+".system", t.System, partials); err != nil {
+		return err
+	}
+	if t.user, err = parse(t.Name+".user", t.User, partials); err != nil {
+		return err
+	}
+
+	t.examples = make([]exampleTemplate, len(t.Examples))
+	for i, example := range t.Examples {
+		if t.examples[i].user, err = parse(fmt.Sprintf("%s.example%d.user", t.Name, i), example.User, partials); err != nil {
+			return err
+		}
+		if t.examples[i].assistant, err = parse(fmt.Sprintf("%s.example%d.assistant", t.Name, i), example.Assistant, partials); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parse 解析单个模板并附加命名片段
+func parse(name, text string, partials map[string]string) (*template.Template, error) {
+	tmpl := template.New(name).Option("missingkey=error")
+	for partialName, partial := range partials {
+		if _, err := tmpl.New(partialName).Parse(partial); err != nil {
+			return nil, fmt.Errorf("failed to parse partial %s: %w", partialName, err)
+		}
+	}
+	if _, err := tmpl.Parse(text); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Validate 检查变量是否满足模板声明，并返回填充默认值后的变量
+// 未声明变量的模板不做检查
+func (t *Template) Validate(vars map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(vars))
+	for name, value := range vars {
+		data[name] = value
+	}
+	if len(t.Variables) == 0 {
+		return data, nil
+	}
+
+	declared := make(map[string]bool, len(t.Variables))
+	for _, v := range t.Variables {
+		declared[v.Name] = true
+
+		value, exists := data[v.Name]
+		if !exists || value == nil {
+			if v.Default != nil {
+				data[v.Name] = v.Default
+				continue
+			}
+			if v.Required {
+				return nil, fmt.Errorf("%w: %s", ErrMissingVariable, v.Name)
+			}
+			// 非必填变量填充对应类型的零值，避免 missingkey=error 报错或渲染出 <no value>
+			data[v.Name] = zeroValue(v.Type)
+			continue
+		}
+
+		if !matchesType(v.Type, value) {
+			return nil, fmt.Errorf("%w: %s must be %s, got %T", ErrInvalidVariable, v.Name, v.Type, value)
+		}
+	}
+
+	for name := range vars {
+		if !declared[name] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownVariable, name)
+		}
+	}
+
+	return data, nil
+}
+
+// zeroValue 返回变量类型的零值，any 类型按空字符串处理
+func zeroValue(typ string) interface{} {
+	switch typ {
+	case TypeInt:
+		return 0
+	case TypeFloat:
+		return 0.0
+	case TypeBool:
+		return false
+	case TypeList:
+		return []interface{}{}
+	case TypeMap:
+		return map[string]interface{}{}
+	default:
+		return ""
+	}
+}
+
+// matchesType 检查值是否符合声明的类型
+func matchesType(typ string, value interface{}) bool {
+	kind := reflect.TypeOf(value).Kind()
+	switch typ {
+	case TypeString:
+		return kind == reflect.String
+	case TypeInt:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		case reflect.Float32, reflect.Float64:
+			// JSON 解码后的整数为 float64
+			f := reflect.ValueOf(value).Float()
+			return f == float64(int64(f))
+		}
+		return false
+	case TypeFloat:
+		switch kind {
+		case reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case TypeBool:
+		return kind == reflect.Bool
+	case TypeList:
+		return kind == reflect.Slice || kind == reflect.Array
+	case TypeMap:
+		return kind == reflect.Map || kind == reflect.Struct
+	default:
+		return true
+	}
+}
+
+// Render 使用变量渲染模板
+func (t *Template) Render(vars map[string]interface{}) (Rendered, error) {
+	t.parseOnce.Do(func() {
+		if t.user == nil {
+			t.parseErr = t.Parse(nil)
+		}
+	})
+	if t.parseErr != nil {
+		return Rendered{}, t.parseErr
+	}
+
+	data, err := t.Validate(vars)
+	if err != nil {
+		return Rendered{}, fmt.Errorf("template %s: %w", t.Name, err)
+	}
+
+	var rendered Rendered
+	if rendered.System, err = execute(t.system, data); err != nil {
+		return Rendered{}, err
+	}
+	if rendered.User, err = execute(t.user, data); err != nil {
+		return Rendered{}, err
+	}
+
+	for _, example := range t.examples {
+		var e Example
+		if e.User, err = execute(example.user, data); err != nil {
+			return Rendered{}, err
+		}
+		if e.Assistant, err = execute(example.assistant, data); err != nil {
+			return Rendered{}, err
+		}
+		rendered.Examples = append(rendered.Examples, e)
+	}
+
+	return rendered, nil
+}
+
+// execute 执行模板
+func execute(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Messages 将渲染结果转换为聊天消息：系统消息、示例对、用户消息
+func (r Rendered) Messages() []llm.Message {
+	messages := make([]llm.Message, 0, 2+2*len(r.Examples))
+	if r.System != "" {
+		messages = append(messages, llm.Message{Role: "system", Content: r.System})
+	}
+	for _, e := range r.Examples {
+		messages = append(messages,
+			llm.Message{Role: "user", Content: e.User},
+			llm.Message{Role: "assistant", Content: e.Assistant},
+		)
+	}
+	return append(messages, llm.Message{Role: "user", Content: r.User})
+}
+
+// Prompt 将渲染结果拼接为单个补全提示词
+func (r Rendered) Prompt() string {
+	var b strings.Builder
+	if r.System != "" {
+		b.WriteString(r.System)
+		b.WriteString("\n\n")
+	}
+	for _, e := range r.Examples {
+		fmt.Fprintf(&b, "Input: %s\nOutput: %s\n\n", e.User, e.Assistant)
+	}
+	if len(r.Examples) > 0 {
+		fmt.Fprintf(&b, "Input: %s\nOutput:", r.User)
+	} else {
+		b.WriteString(r.User)
+	}
+	return b.String()
+}
+
+// ChatRequest 渲染模板并填充到 base 的消息中，base 的其他参数保持不变
+func (t *Template) ChatRequest(vars map[string]interface{}, base llm.ChatRequest) (llm.ChatRequest, error) {
+	rendered, err := t.Render(vars)
+	if err != nil {
+		return llm.ChatRequest{}, err
+	}
+	base.Messages = rendered.Messages()
+	return base, nil
+}
+
+// CompletionRequest 渲染模板并填充到 base 的提示词中，base 的其他参数保持不变
+func (t *Template) CompletionRequest(vars map[string]interface{}, base llm.CompletionRequest) (llm.CompletionRequest, error) {
+	rendered, err := t.Render(vars)
+	if err != nil {
+		return llm.CompletionRequest{}, err
+	}
+	base.Prompt = rendered.Prompt()
+	return base, nil
+}
@@ -11,6 +11,8 @@ var (
 	ErrInvalidRequest  = errors.New("invalid llm request")
 	ErrRequestTimeout  = errors.New("llm request timed out")
 	ErrRateLimited     = errors.New("llm rate limit exceeded")
+
+	ErrContextWindowExceeded = errors.New("llm context window exceeded")
 )
 
 // Message 表示一条消息
@@ -18,6 +20,7 @@ type Message struct {
 	Role    string                 `json:"role"`
 	Content string                 `json:"content"`
 	Name    string                 `json:"name,omitempty"`
+	Images  []string               `json:"images,omitempty"` // base64编码的图像
 	Context map[string]interface{} `json:"context,omitempty"`
 }
 
@@ -93,9 +96,10 @@ type ChatRequest struct {
 
 // EmbeddingRequest 表示嵌入请求
 type EmbeddingRequest struct {
-	Input    string                 `json:"input"`
-	Model    string                 `json:"model,omitempty"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Input      string                 `json:"input"`
+	Model      string                 `json:"model,omitempty"`
+	Dimensions int                    `json:"dimensions,omitempty"` // 请求缩减后的输出维度，0 表示原生维度
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // CompletionResponse 表示完成响应
@@ -151,3 +155,9 @@ type Provider interface {
 	// GetEmbedModel 获取嵌入模型
 	GetEmbedModel() string
 }
+
+// ChatStreamer 是支持流式聊天补全的提供者实现的可选接口
+type ChatStreamer interface {
+	// 流式执行聊天补全，每生成一段内容调用一次 fn，fn 返回错误时中止生成；返回完整的响应
+	ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error)
+}
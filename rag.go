@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Retriever 根据查询检索相关文档
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error)
+}
+
+// VectorRetriever 使用 LLMEmbedder 嵌入查询并从向量存储中检索
+type VectorRetriever struct {
+	embedder *LLMEmbedder
+	store    VectorStore
+}
+
+// NewVectorRetriever 创建一个新的向量检索器
+func NewVectorRetriever(embedder *LLMEmbedder, store VectorStore) *VectorRetriever {
+	return &VectorRetriever{
+		embedder: embedder,
+		store:    store,
+	}
+}
+
+// Retrieve 实现 Retriever 接口
+func (r *VectorRetriever) Retrieve(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	vector, err := r.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return r.store.QueryVector(ctx, vector, k, filter)
+}
+
+// DefaultRAGPrompt 是默认的RAG提示词模板
+// 模板数据为 RAGPromptData，生成的文本作为系统消息，问题作为用户消息
+const DefaultRAGPrompt = `Answer the user's question using only the sources below. Cite the sources you use with their number in square brackets, like [1]. If the sources do not contain the answer, say that you don't know.
+
+{{range .Sources}}[{{.Index}}] {{.Content}}
+
+{{end}}`
+
+// RAGConfig 是RAG流程的配置
+type RAGConfig struct {
+	TopK           int            // 检索的文档数，默认4
+	ScoreThreshold float64        // 低于该得分的文档被丢弃，0 表示不过滤
+	Filter         MetadataFilter // 检索时的元数据过滤条件
+	PromptTemplate string         // text/template 格式的系统提示模板，为空时使用 DefaultRAGPrompt
+	Counter        TokenCounter   // 打包上下文时使用的token计数器，为空时使用 ApproxTokenCounter
+	ReservedTokens int            // 请求未指定MaxTokens时为回答预留的token数，默认512
+	Request        ChatRequest    // 聊天请求参数（温度、最大token数等），其中的消息会被忽略
+}
+
+// RAGSource 是打包进提示词的一条来源
+type RAGSource struct {
+	Index   int     // 在提示词中的编号，从1开始
+	ID      string  // 文档ID
+	Content string  // 文档内容
+	Score   float64 // 检索得分
+}
+
+// RAGPromptData 是提示词模板的数据
+type RAGPromptData struct {
+	Question string
+	Sources  []RAGSource
+}
+
+// RAGResponse 是RAG流程的结果
+type RAGResponse struct {
+	Answer    string         // 模型的回答
+	Citations []RAGSource    // 回答中引用的来源
+	Sources   []RAGSource    // 打包进提示词的全部来源
+	Retrieved []SearchResult // 检索到的全部文档，包括因上下文窗口不足未使用的
+	Usage     Usage
+}
+
+// citationPattern 匹配回答中形如 [1] 或 [1, 2] 的引用
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// RAGPipeline 是检索增强生成流程：检索相关文档，在上下文窗口内打包进提示词，调用模型并返回带引用的回答
+type RAGPipeline struct {
+	service   Service
+	provider  string
+	model     string
+	retriever Retriever
+	config    RAGConfig
+	prompt    *template.Template
+}
+
+// NewRAGPipeline 创建一个新的RAG流程
+func NewRAGPipeline(service Service, provider, model string, retriever Retriever, config RAGConfig) (*RAGPipeline, error) {
+	if config.TopK <= 0 {
+		config.TopK = 4
+	}
+	if config.Counter == nil {
+		config.Counter = ApproxTokenCounter
+	}
+	if config.ReservedTokens <= 0 {
+		config.ReservedTokens = 512
+	}
+	if config.PromptTemplate == "" {
+		config.PromptTemplate = DefaultRAGPrompt
+	}
+
+	prompt, err := template.New("rag").Parse(config.PromptTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+
+	return &RAGPipeline{
+		service:   service,
+		provider:  provider,
+		model:     model,
+		retriever: retriever,
+		config:    config,
+		prompt:    prompt,
+	}, nil
+}
+
+// Ask 检索与问题相关的文档并生成回答
+func (p *RAGPipeline) Ask(ctx context.Context, question string) (RAGResponse, error) {
+	if strings.TrimSpace(question) == "" {
+		return RAGResponse{}, fmt.Errorf("%w: question cannot be empty", ErrInvalidRequest)
+	}
+
+	retrieved, err := p.retriever.Retrieve(ctx, question, p.config.TopK, p.config.Filter)
+	if err != nil {
+		return RAGResponse{}, fmt.Errorf("failed to retrieve documents: %w", err)
+	}
+
+	model, err := p.service.GetModel(ctx, p.provider, p.model)
+	if err != nil {
+		return RAGResponse{}, fmt.Errorf("failed to get model info: %w", err)
+	}
+
+	request := p.config.Request
+	sources, system, err := p.pack(question, retrieved, model, request.MaxTokens)
+	if err != nil {
+		return RAGResponse{}, err
+	}
+
+	request.Messages = []Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: question},
+	}
+	response, err := p.service.Chat(ctx, p.provider, p.model, request)
+	if err != nil {
+		return RAGResponse{}, err
+	}
+
+	return RAGResponse{
+		Answer:    response.Message.Content,
+		Citations: citedSources(response.Message.Content, sources),
+		Sources:   sources,
+		Retrieved: retrieved,
+		Usage:     response.Usage,
+	}, nil
+}
+
+// pack 按得分顺序将文档加入提示词，直到达到上下文窗口的预算
+func (p *RAGPipeline) pack(question string, retrieved []SearchResult, model ModelInfo, maxTokens int) ([]RAGSource, string, error) {
+	reserved := p.config.ReservedTokens
+	if maxTokens > 0 {
+		reserved = maxTokens
+	}
+	budget := model.ContextWindowSize - reserved - p.config.Counter(question) - 2*messageTokenOverhead
+
+	var sources []RAGSource
+	system, err := p.render(question, sources)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, doc := range retrieved {
+		if p.config.ScoreThreshold != 0 && doc.Score < p.config.ScoreThreshold {
+			continue
+		}
+
+		candidate := append(sources, RAGSource{
+			Index:   len(sources) + 1,
+			ID:      doc.ID,
+			Content: doc.Content,
+			Score:   doc.Score,
+		})
+		rendered, err := p.render(question, candidate)
+		if err != nil {
+			return nil, "", err
+		}
+		// 未知上下文窗口大小时不限制
+		if model.ContextWindowSize > 0 && p.config.Counter(rendered) > budget {
+			continue
+		}
+		sources, system = candidate, rendered
+	}
+
+	return sources, system, nil
+}
+
+// render 渲染系统提示
+func (p *RAGPipeline) render(question string, sources []RAGSource) (string, error) {
+	var b strings.Builder
+	if err := p.prompt.Execute(&b, RAGPromptData{Question: question, Sources: sources}); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+// citedSources 解析回答中的引用编号，返回被引用的来源
+func citedSources(answer string, sources []RAGSource) []RAGSource {
+	var cited []RAGSource
+	seen := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			index, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || index < 1 || index > len(sources) || seen[index] {
+				continue
+			}
+			seen[index] = true
+			cited = append(cited, sources[index-1])
+		}
+	}
+	return cited
+}
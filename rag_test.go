@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newRAGTestPipeline 创建一个使用模拟提供者和内存向量存储的RAG流程
+func newRAGTestPipeline(t *testing.T, contextWindow int, answer string, requests *[]ChatRequest, config RAGConfig) *RAGPipeline {
+	t.Helper()
+
+	svc := NewService()
+	_ = svc.RegisterProvider(&mockProvider{
+		name:   "test-provider",
+		models: []ModelInfo{{Name: "test-model", ContextWindowSize: contextWindow}},
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			embedding, err := keywordEmbedding(ctx, request.Input)
+			return EmbeddingResponse{Embedding: embedding}, err
+		},
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			*requests = append(*requests, request)
+			return ChatResponse{Message: Message{Role: "assistant", Content: answer}}, nil
+		},
+	})
+
+	embedder := NewLLMEmbedder(svc, "test-provider", "test-model", 3)
+	store := NewMemoryVectorStore(embedder.EmbeddingFunc(), CosineSimilarity)
+	err := store.Upsert(context.Background(),
+		Document{ID: "doc-cat", Content: "cat"},
+		Document{ID: "doc-kitten", Content: "kitten"},
+		Document{ID: "doc-dog", Content: "dog"},
+		Document{ID: "doc-car", Content: "car"},
+	)
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	pipeline, err := NewRAGPipeline(svc, "test-provider", "test-model", NewVectorRetriever(embedder, store), config)
+	if err != nil {
+		t.Fatalf("NewRAGPipeline() error = %v", err)
+	}
+	return pipeline
+}
+
+func TestRAGPipelineAsk(t *testing.T) {
+	// 每个来源在提示词中占2个单词，问题占1个单词，两条消息共8个开销
+	const template = "{{range .Sources}}[{{.Index}}] {{.Content}}\n{{end}}"
+
+	tests := []struct {
+		name          string
+		contextWindow int
+		config        RAGConfig
+		answer        string
+		wantSources   []string
+		wantCitations []string
+		wantPrompt    string
+	}{
+		{
+			name:          "score threshold",
+			contextWindow: 4096,
+			config:        RAGConfig{TopK: 3, ScoreThreshold: 0.5, PromptTemplate: template, Counter: wordCounter},
+			answer:        "A cat [1] is a grown kitten [2, 9].",
+			wantSources:   []string{"doc-cat", "doc-kitten"},
+			wantCitations: []string{"doc-cat", "doc-kitten"},
+			wantPrompt:    "[1] cat\n[2] kitten\n",
+		},
+		{
+			name:          "context window limits sources",
+			contextWindow: 10 + 1 + 8 + 2,
+			config:        RAGConfig{TopK: 3, PromptTemplate: template, Counter: wordCounter, ReservedTokens: 10},
+			answer:        "I don't know.",
+			wantSources:   []string{"doc-cat"},
+			wantPrompt:    "[1] cat\n",
+		},
+		{
+			name:          "request max tokens overrides reserved tokens",
+			contextWindow: 10 + 1 + 8 + 4,
+			config: RAGConfig{TopK: 3, PromptTemplate: template, Counter: wordCounter, ReservedTokens: 100,
+				Request: ChatRequest{MaxTokens: 10}},
+			answer:        "See [2].",
+			wantSources:   []string{"doc-cat", "doc-kitten"},
+			wantCitations: []string{"doc-kitten"},
+			wantPrompt:    "[1] cat\n[2] kitten\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []ChatRequest
+			pipeline := newRAGTestPipeline(t, tt.contextWindow, tt.answer, &requests, tt.config)
+
+			response, err := pipeline.Ask(context.Background(), "cat")
+			if err != nil {
+				t.Fatalf("Ask() error = %v", err)
+			}
+
+			if response.Answer != tt.answer {
+				t.Errorf("Answer = %q, want %q", response.Answer, tt.answer)
+			}
+			if got := sourceIDs(response.Sources); !reflect.DeepEqual(got, tt.wantSources) {
+				t.Errorf("Sources = %v, want %v", got, tt.wantSources)
+			}
+			if got := sourceIDs(response.Citations); !reflect.DeepEqual(got, tt.wantCitations) {
+				t.Errorf("Citations = %v, want %v", got, tt.wantCitations)
+			}
+			if len(response.Retrieved) != 3 {
+				t.Errorf("Retrieved has %d documents, want 3", len(response.Retrieved))
+			}
+
+			want := []Message{
+				{Role: "system", Content: tt.wantPrompt},
+				{Role: "user", Content: "cat"},
+			}
+			if !reflect.DeepEqual(requests[0].Messages, want) {
+				t.Errorf("request messages = %+v, want %+v", requests[0].Messages, want)
+			}
+		})
+	}
+}
+
+func TestRAGPipelineErrors(t *testing.T) {
+	var requests []ChatRequest
+	pipeline := newRAGTestPipeline(t, 4096, "", &requests, RAGConfig{})
+
+	if _, err := pipeline.Ask(context.Background(), " "); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Ask() with empty question error = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := pipeline.Ask(context.Background(), "unknown"); err == nil {
+		t.Error("Ask() with failing embedder expected error, got nil")
+	}
+
+	if _, err := NewRAGPipeline(nil, "", "", nil, RAGConfig{PromptTemplate: "{{.Missing"}); err == nil {
+		t.Error("NewRAGPipeline() with invalid template expected error, got nil")
+	}
+}
+
+// sourceIDs 返回来源的文档ID列表
+func sourceIDs(sources []RAGSource) []string {
+	var ids []string
+	for _, source := range sources {
+		ids = append(ids, source.ID)
+	}
+	return ids
+}
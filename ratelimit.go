@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter 是令牌桶限速器，按固定速率发放请求许可，空闲时最多积累 burst 个许可
+type RateLimiter struct {
+	interval time.Duration // 发放一个许可的间隔
+	burst    int
+	next     time.Time // 下一个许可理论上的发放时间
+	mu       sync.Mutex
+}
+
+// NewRateLimiter 创建一个每分钟发放 requestsPerMinute 个许可的限速器，burst 小于 1 时按 1 处理
+func NewRateLimiter(requestsPerMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		interval: time.Minute / time.Duration(max(requestsPerMinute, 1)),
+		burst:    max(burst, 1),
+	}
+}
+
+// Wait 等待一个许可，上下文结束时返回其错误并归还预留的许可
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	// 允许 next 领先当前时间 burst-1 个间隔，超出部分需要等待
+	delay := l.next.Sub(now) - time.Duration(l.burst-1)*l.interval
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.next = l.next.Add(-l.interval)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// rateLimitedProvider 是通过令牌桶限制请求速率的提供者
+type rateLimitedProvider struct {
+	Provider
+	limiter *RateLimiter
+}
+
+// NewRateLimitedProvider 返回一个在 Complete、Chat、ChatStream 和 Embed 前等待限速器许可的提供者
+func NewRateLimitedProvider(provider Provider, limiter *RateLimiter) Provider {
+	return &rateLimitedProvider{Provider: provider, limiter: limiter}
+}
+
+// Complete 生成文本补全
+func (p *rateLimitedProvider) Complete(ctx context.Context, modelID string, request CompletionRequest) (CompletionResponse, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return CompletionResponse{}, err
+	}
+	return p.Provider.Complete(ctx, modelID, request)
+}
+
+// Chat 执行聊天补全
+func (p *rateLimitedProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return ChatResponse{}, err
+	}
+	return p.Provider.Chat(ctx, modelID, request)
+}
+
+// ChatStream 流式执行聊天补全
+func (p *rateLimitedProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return ChatResponse{}, err
+	}
+	return wrappedChatStream(ctx, p.Provider, modelID, request, fn)
+}
+
+// Embed 生成文本的嵌入向量
+func (p *rateLimitedProvider) Embed(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return EmbeddingResponse{}, err
+	}
+	return p.Provider.Embed(ctx, modelID, request)
+}
+
+// EmbeddingModelInfo 转发给被包装的提供者
+func (p *rateLimitedProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return wrappedEmbeddingModelInfo(ctx, p.Provider, modelID)
+}
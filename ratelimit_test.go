@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	// 每 20ms 一个许可，允许突发 3 个
+	limiter := NewRateLimiter(3000, 3)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("burst of 3 took %v, want no waiting", elapsed)
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("4th request after %v, want it to wait for the next permit", elapsed)
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRateLimitedProvider(t *testing.T) {
+	calls := 0
+	provider := NewRateLimitedProvider(&mockProvider{
+		name: "mock",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			calls++
+			return EmbeddingResponse{Embedding: []float64{1}}, nil
+		},
+	}, NewRateLimiter(1, 1))
+
+	if _, err := provider.Embed(context.Background(), "model", EmbeddingRequest{Input: "a"}); err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Embed(ctx, "model", EmbeddingRequest{Input: "b"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Embed() error = %v, want %v while rate limited", err, context.DeadlineExceeded)
+	}
+	if calls != 1 {
+		t.Errorf("provider calls = %d, want 1", calls)
+	}
+}
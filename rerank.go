@@ -0,0 +1,354 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reranker 根据查询对候选文档重新打分并排序
+type Reranker interface {
+	// Rerank 返回按相关性从高到低排序的文档，得分为重排序模型给出的相关性分数
+	// topN 小于等于 0 时返回全部文档
+	Rerank(ctx context.Context, query string, docs []SearchResult, topN int) ([]SearchResult, error)
+}
+
+// RerankAPIStyle 表示重排序接口的请求格式
+type RerankAPIStyle int
+
+const (
+	// RerankAPICohere 是 Cohere、Jina 等使用的格式：{"model", "query", "documents", "top_n"}
+	RerankAPICohere RerankAPIStyle = iota
+	// RerankAPITEI 是 Hugging Face Text Embeddings Inference 使用的格式：{"query", "texts"}
+	RerankAPITEI
+)
+
+// HTTPReranker 通过 HTTP /rerank 接口调用交叉编码器重排序模型
+type HTTPReranker struct {
+	endpoint string
+	model    string
+	apiKey   string
+	style    RerankAPIStyle
+	client   *http.Client
+}
+
+// NewHTTPReranker 创建一个新的HTTP重排序器，endpoint 为完整的接口地址，如 https://api.cohere.com/v2/rerank
+func NewHTTPReranker(endpoint, model, apiKey string) *HTTPReranker {
+	return &HTTPReranker{
+		endpoint: endpoint,
+		model:    model,
+		apiKey:   apiKey,
+		style:    RerankAPICohere,
+		client:   http.DefaultClient,
+	}
+}
+
+// SetAPIStyle 设置请求格式
+func (r *HTTPReranker) SetAPIStyle(style RerankAPIStyle) {
+	r.style = style
+}
+
+// SetHTTPClient 设置HTTP客户端，为空时使用 http.DefaultClient
+func (r *HTTPReranker) SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r.client = client
+}
+
+// rerankScore 是接口返回的单条结果，兼容 relevance_score 和 score 两种字段
+type rerankScore struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+// Rerank 实现 Reranker 接口
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, docs []SearchResult, topN int) ([]SearchResult, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Content
+	}
+
+	var payload map[string]interface{}
+	switch r.style {
+	case RerankAPITEI:
+		payload = map[string]interface{}{"query": query, "texts": texts}
+	default:
+		payload = map[string]interface{}{"query": query, "documents": texts}
+		if r.model != "" {
+			payload["model"] = r.model
+		}
+		if topN > 0 {
+			payload["top_n"] = topN
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rerank request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLLMNotAvailable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rerank response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: %s", ErrRateLimited, strings.TrimSpace(string(data)))
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: rerank returned %s", ErrLLMNotAvailable, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("rerank returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	scores, err := decodeRerankScores(data)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for _, s := range scores {
+		if s.Index < 0 || s.Index >= len(docs) {
+			return nil, fmt.Errorf("rerank returned invalid index %d", s.Index)
+		}
+		result := docs[s.Index]
+		switch {
+		case s.RelevanceScore != nil:
+			result.Score = *s.RelevanceScore
+		case s.Score != nil:
+			result.Score = *s.Score
+		default:
+			return nil, fmt.Errorf("rerank result %d has no score", s.Index)
+		}
+		results = append(results, result)
+	}
+	return sortReranked(results, topN), nil
+}
+
+// decodeRerankScores 解析 {"results": [...]} 或直接为数组的响应
+func decodeRerankScores(data []byte) ([]rerankScore, error) {
+	var scores []rerankScore
+	if err := json.Unmarshal(data, &scores); err == nil {
+		return scores, nil
+	}
+
+	var wrapped struct {
+		Results []rerankScore `json:"results"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("failed to decode rerank response: %w", err)
+	}
+	return wrapped.Results, nil
+}
+
+// sortReranked 按得分从高到低排序并截取前 topN 条
+func sortReranked(results []SearchResult, topN int) []SearchResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if topN > 0 && len(results) > topN {
+		results = results[:topN]
+	}
+	return results
+}
+
+// 提示词模板中的占位符
+const (
+	RerankQueryPlaceholder    = "{{query}}"
+	RerankDocumentPlaceholder = "{{document}}"
+)
+
+// DefaultRerankPrompt 是LLM重排序器默认的提示词模板，{{query}} 和 {{document}} 分别替换为查询和文档内容
+const DefaultRerankPrompt = `Rate how relevant the document is to the query on a scale from 0 (irrelevant) to 10 (perfectly relevant). Reply with the number only.
+
+Query: {{query}}
+
+Document: {{document}}
+
+Relevance:`
+
+// scorePattern 匹配回答中的第一个数字
+var scorePattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// LLMReranker 使用大语言模型作为评审，逐个为文档的相关性打分
+type LLMReranker struct {
+	service     Service
+	provider    string
+	model       string
+	prompt      string
+	maxPoolSize int
+}
+
+// NewLLMReranker 创建一个新的LLM重排序器
+func NewLLMReranker(service Service, provider, model string) *LLMReranker {
+	return &LLMReranker{
+		service:     service,
+		provider:    provider,
+		model:       model,
+		prompt:      DefaultRerankPrompt,
+		maxPoolSize: 4,
+	}
+}
+
+// SetPrompt 设置提示词模板，模板中的 {{query}} 和 {{document}} 分别替换为查询和文档内容，
+// 其余文本（包括 % 等字符）原样保留，为空时使用默认模板
+func (r *LLMReranker) SetPrompt(prompt string) {
+	if prompt == "" {
+		prompt = DefaultRerankPrompt
+	}
+	r.prompt = prompt
+}
+
+// SetMaxPoolSize 设置并发打分的最大请求数
+func (r *LLMReranker) SetMaxPoolSize(size int) {
+	if size > 0 {
+		r.maxPoolSize = size
+	} else {
+		r.maxPoolSize = 4
+	}
+}
+
+// Rerank 实现 Reranker 接口，得分归一化到 [0, 1]
+// 使用固定数量的工作goroutine打分，任何一篇文档打分失败时取消其余请求并返回该错误
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []SearchResult, topN int) ([]SearchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]SearchResult, len(docs))
+	jobs := make(chan int)
+
+	var firstErr error
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < min(r.maxPoolSize, len(docs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				doc := docs[idx]
+				score, err := r.score(ctx, query, doc.Content)
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("failed to score document %s: %w", doc.ID, err)
+						cancel()
+					})
+					continue
+				}
+				doc.Score = score
+				results[idx] = doc
+			}
+		}()
+	}
+
+	canceled := false
+dispatch:
+	for i := range docs {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			canceled = true
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if canceled {
+		return nil, fmt.Errorf("rerank canceled: %w", ctx.Err())
+	}
+	return sortReranked(results, topN), nil
+}
+
+// formatPrompt 把查询和文档内容填入提示词模板，替换只进行一遍，内容中的占位符不会被再次替换
+func (r *LLMReranker) formatPrompt(query, content string) string {
+	return strings.NewReplacer(RerankQueryPlaceholder, query, RerankDocumentPlaceholder, content).Replace(r.prompt)
+}
+
+// score 请求模型为单篇文档打分
+func (r *LLMReranker) score(ctx context.Context, query, content string) (float64, error) {
+	response, err := r.service.Chat(ctx, r.provider, r.model, ChatRequest{
+		Messages:    []Message{{Role: "user", Content: r.formatPrompt(query, content)}},
+		Temperature: 0,
+		MaxTokens:   8,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	match := scorePattern.FindString(response.Message.Content)
+	if match == "" {
+		return 0, fmt.Errorf("no relevance score in reply %q", response.Message.Content)
+	}
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid relevance score %q: %w", match, err)
+	}
+	return min(score, 10) / 10, nil
+}
+
+// RerankRetriever 先用检索器取出较多候选，再用重排序器精排
+type RerankRetriever struct {
+	retriever  Retriever
+	reranker   Reranker
+	candidates int
+}
+
+// NewRerankRetriever 创建一个新的重排序检索器，candidates 为送入重排序的候选数，0 表示 4*k
+func NewRerankRetriever(retriever Retriever, reranker Reranker, candidates int) *RerankRetriever {
+	return &RerankRetriever{
+		retriever:  retriever,
+		reranker:   reranker,
+		candidates: candidates,
+	}
+}
+
+// Retrieve 实现 Retriever 接口
+func (r *RerankRetriever) Retrieve(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: k must be positive", ErrInvalidRequest)
+	}
+
+	candidates := r.candidates
+	if candidates < k {
+		candidates = 4 * k
+	}
+	results, err := r.retriever.Retrieve(ctx, query, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+	reranked, err := r.reranker.Rerank(ctx, query, results, k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank documents: %w", err)
+	}
+	return reranked, nil
+}
@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rerankCandidates 返回用于重排序测试的候选文档
+func rerankCandidates() []SearchResult {
+	return []SearchResult{
+		{Document: Document{ID: "a", Content: "paris is in france"}, Score: 0.9},
+		{Document: Document{ID: "b", Content: "the capital of france is paris"}, Score: 0.8},
+		{Document: Document{ID: "c", Content: "berlin is in germany"}, Score: 0.7},
+	}
+}
+
+func TestHTTPReranker(t *testing.T) {
+	tests := []struct {
+		name     string
+		style    RerankAPIStyle
+		field    string
+		response string
+	}{
+		{
+			name:     "cohere",
+			style:    RerankAPICohere,
+			field:    "documents",
+			response: `{"results":[{"index":1,"relevance_score":0.95},{"index":0,"relevance_score":0.5}]}`,
+		},
+		{
+			name:     "tei",
+			style:    RerankAPITEI,
+			field:    "texts",
+			response: `[{"index":0,"score":0.5},{"index":1,"score":0.95},{"index":2,"score":0.01}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+				}
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if body["query"] != "capital of france" {
+					t.Errorf("query = %v, want %q", body["query"], "capital of france")
+				}
+				if texts, _ := body[tt.field].([]interface{}); len(texts) != 3 {
+					t.Errorf("%s = %v, want 3 documents", tt.field, body[tt.field])
+				}
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			reranker := NewHTTPReranker(server.URL+"/rerank", "rerank-model", "secret")
+			reranker.SetAPIStyle(tt.style)
+
+			results, err := reranker.Rerank(context.Background(), "capital of france", rerankCandidates(), 2)
+			if err != nil {
+				t.Fatalf("Rerank() error = %v", err)
+			}
+			if got := resultIDs(results); !reflect.DeepEqual(got, []string{"b", "a"}) {
+				t.Errorf("Rerank() = %v, want [b a]", got)
+			}
+			if results[0].Score != 0.95 {
+				t.Errorf("Rerank() top score = %v, want 0.95", results[0].Score)
+			}
+		})
+	}
+}
+
+func TestHTTPRerankerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"rate limited", http.StatusTooManyRequests, "slow down", ErrRateLimited},
+		{"server error", http.StatusBadGateway, "", ErrLLMNotAvailable},
+		{"invalid index", http.StatusOK, `[{"index":7,"score":1}]`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := NewHTTPReranker(server.URL, "", "").Rerank(context.Background(), "q", rerankCandidates(), 0)
+			if err == nil {
+				t.Fatal("Rerank() expected error, got nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Rerank() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLLMReranker(t *testing.T) {
+	svc := NewService()
+	_ = svc.RegisterProvider(&mockProvider{
+		name: "test-provider",
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			prompt := request.Messages[0].Content
+			score := "0"
+			switch {
+			case strings.Contains(prompt, "capital of france is paris"):
+				score = "9"
+			case strings.Contains(prompt, "paris is in france"):
+				score = "Relevance: 6/10"
+			case strings.Contains(prompt, "germany"):
+				score = "no idea"
+			}
+			return ChatResponse{Message: Message{Role: "assistant", Content: score}}, nil
+		},
+	})
+
+	reranker := NewLLMReranker(svc, "test-provider", "judge")
+	results, err := reranker.Rerank(context.Background(), "capital of france", rerankCandidates()[:2], 0)
+	if err != nil {
+		t.Fatalf("Rerank() error = %v", err)
+	}
+	if got := resultIDs(results); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("Rerank() = %v, want [b a]", got)
+	}
+	if results[0].Score != 0.9 || results[1].Score != 0.6 {
+		t.Errorf("Rerank() scores = %v, %v, want 0.9, 0.6", results[0].Score, results[1].Score)
+	}
+
+	if _, err := reranker.Rerank(context.Background(), "capital of france", rerankCandidates(), 0); err == nil {
+		t.Error("Rerank() with unparseable score expected error, got nil")
+	}
+}
+
+func TestLLMRerankerPromptAndCancel(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	active := 0
+	svc := NewService()
+	_ = svc.RegisterProvider(&mockProvider{
+		name: "test-provider",
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Err() == nil {
+				active++
+				prompts = append(prompts, request.Messages[0].Content)
+			}
+			return ChatResponse{}, ErrLLMNotAvailable
+		},
+	})
+
+	reranker := NewLLMReranker(svc, "test-provider", "judge")
+	reranker.SetPrompt("Score 0-100%: {{query}} | {{document}}")
+	reranker.SetMaxPoolSize(1)
+	docs := make([]SearchResult, 20)
+	for i := range docs {
+		docs[i] = SearchResult{Document: Document{ID: fmt.Sprint(i), Content: "doc {{query}}"}}
+	}
+
+	if _, err := reranker.Rerank(context.Background(), "50%", docs, 0); !errors.Is(err, ErrLLMNotAvailable) {
+		t.Fatalf("Rerank() error = %v, want ErrLLMNotAvailable", err)
+	}
+	// 第一个错误之后其余请求被取消
+	if active != 1 {
+		t.Errorf("%d requests sent after the first failure, want 1 in total", active)
+	}
+	// % 原样保留，文档中的占位符不会被再次替换
+	if want := "Score 0-100%: 50% | doc {{query}}"; len(prompts) == 0 || prompts[0] != want {
+		t.Errorf("prompt = %q, want %q", prompts, want)
+	}
+}
+
+func TestRerankRetriever(t *testing.T) {
+	idx := NewBM25Index()
+	ctx := context.Background()
+	for _, doc := range rerankCandidates() {
+		_ = idx.Upsert(ctx, doc.Document)
+	}
+
+	// 按内容长度打分的重排序器，长文档排在前面
+	reranker := rerankFunc(func(ctx context.Context, query string, docs []SearchResult, topN int) ([]SearchResult, error) {
+		for i := range docs {
+			docs[i].Score = float64(len(docs[i].Content))
+		}
+		return sortReranked(docs, topN), nil
+	})
+
+	results, err := NewRerankRetriever(idx, reranker, 0).Retrieve(ctx, "paris france", 1, nil)
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if got := resultIDs(results); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Retrieve() = %v, want [b]", got)
+	}
+}
+
+// rerankFunc 将函数适配为 Reranker
+type rerankFunc func(ctx context.Context, query string, docs []SearchResult, topN int) ([]SearchResult, error)
+
+func (f rerankFunc) Rerank(ctx context.Context, query string, docs []SearchResult, topN int) ([]SearchResult, error) {
+	return f(ctx, query, docs, topN)
+}
+
+// resultIDs 返回检索结果的文档ID列表
+func resultIDs(results []SearchResult) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
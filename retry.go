@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy 是请求失败后的重试策略，只重试 IsOverloadError 判定的限流、服务不可用和超时错误
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"max_attempts"`    // 包括首次请求在内的最大尝试次数，默认 3，为 1 时不重试
+	InitialBackoff time.Duration `json:"initial_backoff"` // 第一次重试前的等待时间，默认 500ms
+	MaxBackoff     time.Duration `json:"max_backoff"`     // 等待时间的上限，默认 10s
+	Multiplier     float64       `json:"multiplier"`      // 每次重试后等待时间乘以的系数，默认 2
+}
+
+// DefaultRetryPolicy 返回默认的重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// withDefaults 用默认值填充未设置的字段
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaults.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = max(defaults.MaxBackoff, p.InitialBackoff)
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaults.Multiplier
+	}
+	return p
+}
+
+// backoff 返回第 attempt 次重试前的等待时间，在指数退避的基础上随机取 [50%, 100%] 以错开并发的重试
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	d = min(d, float64(p.MaxBackoff))
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+// retry 按策略执行 fn，遇到过载错误时退避后重试
+func retry[T any](ctx context.Context, policy RetryPolicy, fn func() (T, error)) (T, error) {
+	return retryIf(ctx, policy, fn, IsOverloadError)
+}
+
+// retryIf 按策略执行 fn，retryable 返回 true 时退避后重试
+func retryIf[T any](ctx context.Context, policy RetryPolicy, fn func() (T, error), retryable func(error) bool) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+			return result, err
+		}
+
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		}
+	}
+}
+
+// retryProvider 是按重试策略重试失败请求的提供者
+type retryProvider struct {
+	Provider
+	policy RetryPolicy
+}
+
+// NewRetryProvider 返回一个在 Complete、Chat、ChatStream 和 Embed 遇到过载错误时按策略重试的提供者，
+// 重试用尽或上下文结束时返回最后一次的错误
+func NewRetryProvider(provider Provider, policy RetryPolicy) Provider {
+	return &retryProvider{Provider: provider, policy: policy.withDefaults()}
+}
+
+// Complete 生成文本补全
+func (p *retryProvider) Complete(ctx context.Context, modelID string, request CompletionRequest) (CompletionResponse, error) {
+	return retry(ctx, p.policy, func() (CompletionResponse, error) {
+		return p.Provider.Complete(ctx, modelID, request)
+	})
+}
+
+// Chat 执行聊天补全
+func (p *retryProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	return retry(ctx, p.policy, func() (ChatResponse, error) {
+		return p.Provider.Chat(ctx, modelID, request)
+	})
+}
+
+// ChatStream 流式执行聊天补全，只在还没有输出任何增量时重试，避免调用方收到重复的内容
+func (p *retryProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	streamed := false
+	emit := func(delta string) error {
+		streamed = true
+		if fn == nil {
+			return nil
+		}
+		return fn(delta)
+	}
+	return retryIf(ctx, p.policy, func() (ChatResponse, error) {
+		return wrappedChatStream(ctx, p.Provider, modelID, request, emit)
+	}, func(err error) bool {
+		return !streamed && IsOverloadError(err)
+	})
+}
+
+// Embed 生成文本的嵌入向量
+func (p *retryProvider) Embed(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+	return retry(ctx, p.policy, func() (EmbeddingResponse, error) {
+		return p.Provider.Embed(ctx, modelID, request)
+	})
+}
+
+// EmbeddingModelInfo 转发给被包装的提供者
+func (p *retryProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return wrappedEmbeddingModelInfo(ctx, p.Provider, modelID)
+}
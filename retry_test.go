@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryProvider(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		maxAttempts  int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"succeeds after overload", 2, ErrRateLimited, 3, false, 3},
+		{"gives up after max attempts", 5, ErrLLMNotAvailable, 3, true, 3},
+		{"does not retry client errors", 1, fmt.Errorf("%w: bad prompt", ErrInvalidRequest), 3, true, 1},
+		{"single attempt", 1, ErrRateLimited, 1, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			provider := NewRetryProvider(&mockProvider{
+				name: "mock",
+				chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+					attempts++
+					if attempts <= tt.failures {
+						return ChatResponse{}, tt.err
+					}
+					return ChatResponse{Message: Message{Content: "ok"}}, nil
+				},
+			}, RetryPolicy{MaxAttempts: tt.maxAttempts, InitialBackoff: time.Millisecond})
+
+			response, err := provider.Chat(context.Background(), "model", ChatRequest{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Chat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Chat() error = %v, want the last provider error", err)
+			}
+			if !tt.wantErr && response.Message.Content != "ok" {
+				t.Errorf("Chat() content = %q, want ok", response.Message.Content)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryProviderCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	provider := NewRetryProvider(&mockProvider{
+		name: "mock",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			attempts++
+			cancel()
+			return EmbeddingResponse{}, ErrRateLimited
+		},
+	}, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour})
+
+	if _, err := provider.Embed(ctx, "model", EmbeddingRequest{Input: "text"}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Embed() error = %v, want %v", err, ErrRateLimited)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 after cancellation", attempts)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}.withDefaults()
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 300 * time.Millisecond, 3: 900 * time.Millisecond, 4: time.Second} {
+		got := policy.backoff(attempt)
+		if got < want/2 || got > want {
+			t.Errorf("backoff(%d) = %v, want within [%v, %v]", attempt, got, want/2, want)
+		}
+	}
+}
+
+func TestRetryProviderChatStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		emitFirst    bool // 失败前是否已经输出增量
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"retries before the first delta", false, false, 2},
+		{"does not retry after a delta", true, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			inner := &streamFunc{fn: func(fn func(string) error) (ChatResponse, error) {
+				attempts++
+				if attempts == 1 {
+					if tt.emitFirst {
+						_ = fn("partial")
+					}
+					return ChatResponse{}, ErrLLMNotAvailable
+				}
+				return ChatResponse{Message: Message{Content: "ok"}}, fn("ok")
+			}}
+			provider := NewRetryProvider(inner, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+			var deltas []string
+			_, err := provider.(ChatStreamer).ChatStream(context.Background(), "model", ChatRequest{}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ChatStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d (deltas %q)", attempts, tt.wantAttempts, deltas)
+			}
+		})
+	}
+}
+
+// streamFunc 是由函数实现 ChatStream 的模拟提供者
+type streamFunc struct {
+	mockProvider
+	fn func(fn func(string) error) (ChatResponse, error)
+}
+
+func (p *streamFunc) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	return p.fn(fn)
+}
@@ -0,0 +1,221 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrRouteNotFound 表示请求的路由不存在
+var ErrRouteNotFound = errors.New("route not found")
+
+// MetadataTools 是请求 Metadata 中声明需要工具调用能力的键，值为 true 或非空的工具列表
+const MetadataTools = "tools"
+
+// Route 把逻辑模型名（如 fast、smart、embed-default）映射到提供者和模型。
+// 调用 Service 的 Complete、Chat、Embed 等方法时提供者名称传空字符串、模型名称传路由名即可使用路由，
+// 更换模型时只需修改路由表而不用修改调用方
+type Route struct {
+	Provider string      `json:"provider"` // 默认的提供者
+	Model    string      `json:"model"`    // 默认的模型
+	Rules    []RouteRule `json:"rules"`    // 按顺序匹配的规则，第一条匹配的规则决定目标，都不匹配时使用默认目标
+}
+
+// RouteRule 是根据请求属性选择目标的路由规则，零值的条件不参与匹配，所有条件都满足时规则匹配
+type RouteRule struct {
+	MinPromptTokens int      `json:"min_prompt_tokens"` // 提示词的估算 token 数不少于该值
+	MaxPromptTokens int      `json:"max_prompt_tokens"` // 提示词的估算 token 数不超过该值
+	Images          bool     `json:"images"`            // 请求包含图像
+	Tools           bool     `json:"tools"`             // 请求需要工具调用，见 MetadataTools
+	Tenants         []string `json:"tenants"`           // 请求的租户是其中之一
+	Provider        string   `json:"provider"`          // 匹配时使用的提供者，为空时使用路由的默认提供者
+	Model           string   `json:"model"`             // 匹配时使用的模型，为空时使用路由的默认模型
+}
+
+// RouteRequest 是路由规则匹配的请求属性
+type RouteRequest struct {
+	PromptTokens int    // 提示词的估算 token 数
+	Images       bool   // 是否包含图像
+	Tools        bool   // 是否需要工具调用
+	Tenant       string // 租户
+	Embedding    bool   // 是否为嵌入请求，嵌入请求不匹配规则，总是使用路由的默认目标
+}
+
+// ChatRouteRequest 返回聊天请求的路由属性，租户从 Metadata 或 WithTenant 设置的 context 中读取
+func ChatRouteRequest(ctx context.Context, request ChatRequest) RouteRequest {
+	_, tenant := RequestClass(ctx, request.Metadata)
+	attrs := RouteRequest{
+		PromptTokens: CountMessageTokens(ApproxTokenCounter, request.Messages),
+		Tools:        requiresTools(request.Metadata),
+		Tenant:       tenant,
+	}
+	for _, msg := range request.Messages {
+		if len(msg.Images) > 0 {
+			attrs.Images = true
+			break
+		}
+	}
+	return attrs
+}
+
+// CompletionRouteRequest 返回文本补全请求的路由属性
+func CompletionRouteRequest(ctx context.Context, request CompletionRequest) RouteRequest {
+	_, tenant := RequestClass(ctx, request.Metadata)
+	return RouteRequest{
+		PromptTokens: ApproxTokenCounter(request.Prompt),
+		Tools:        requiresTools(request.Metadata),
+		Tenant:       tenant,
+	}
+}
+
+// EmbeddingRouteRequest 返回嵌入请求的路由属性
+// 不同模型的向量不在同一个向量空间中，如果按文本长度或租户选择模型，同一语料的向量会来自不同模型，
+// 因此嵌入请求忽略路由规则，总是使用路由的默认目标
+func EmbeddingRouteRequest(ctx context.Context, request EmbeddingRequest) RouteRequest {
+	return RouteRequest{Embedding: true}
+}
+
+// requiresTools 判断 Metadata 是否声明需要工具调用
+func requiresTools(metadata map[string]interface{}) bool {
+	switch v := metadata[MetadataTools].(type) {
+	case bool:
+		return v
+	case []interface{}:
+		return len(v) > 0
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
+
+// validate 校验路由
+func (r Route) validate() error {
+	if r.Provider == "" {
+		return errors.New("route provider cannot be empty")
+	}
+	if r.Model == "" {
+		return errors.New("route model cannot be empty")
+	}
+	for i, rule := range r.Rules {
+		if rule.MaxPromptTokens > 0 && rule.MaxPromptTokens < rule.MinPromptTokens {
+			return fmt.Errorf("rule %d: max_prompt_tokens is less than min_prompt_tokens", i)
+		}
+		if rule.Provider == "" && rule.Model == "" {
+			return fmt.Errorf("rule %d: provider or model is required", i)
+		}
+	}
+	return nil
+}
+
+// matches 判断规则是否匹配请求
+func (r RouteRule) matches(attrs RouteRequest) bool {
+	if r.MinPromptTokens > 0 && attrs.PromptTokens < r.MinPromptTokens {
+		return false
+	}
+	if r.MaxPromptTokens > 0 && attrs.PromptTokens > r.MaxPromptTokens {
+		return false
+	}
+	if r.Images && !attrs.Images {
+		return false
+	}
+	if r.Tools && !attrs.Tools {
+		return false
+	}
+	if len(r.Tenants) > 0 && !slices.Contains(r.Tenants, attrs.Tenant) {
+		return false
+	}
+	return true
+}
+
+// resolve 返回请求对应的提供者和模型
+func (r Route) resolve(attrs RouteRequest) (string, string) {
+	if attrs.Embedding {
+		return r.Provider, r.Model
+	}
+	for _, rule := range r.Rules {
+		if !rule.matches(attrs) {
+			continue
+		}
+		provider, model := rule.Provider, rule.Model
+		if provider == "" {
+			provider = r.Provider
+		}
+		if model == "" {
+			model = r.Model
+		}
+		return provider, model
+	}
+	return r.Provider, r.Model
+}
+
+// cloneRoute 深拷贝路由，避免调用方修改路由表
+func cloneRoute(route Route) Route {
+	route.Rules = slices.Clone(route.Rules)
+	for i := range route.Rules {
+		route.Rules[i].Tenants = slices.Clone(route.Rules[i].Tenants)
+	}
+	return route
+}
+
+// SetRoute 添加或替换一条路由，路由名不能包含 "/"
+func (s *service) SetRoute(name string, route Route) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid route name %q", name)
+	}
+	if err := route.validate(); err != nil {
+		return fmt.Errorf("invalid route %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[name] = cloneRoute(route)
+	return nil
+}
+
+// RemoveRoute 删除一条路由
+func (s *service) RemoveRoute(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.routes, name)
+}
+
+// Routes 返回路由表的副本
+func (s *service) Routes() map[string]Route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	routes := make(map[string]Route, len(s.routes))
+	for name, route := range s.routes {
+		routes[name] = cloneRoute(route)
+	}
+	return routes
+}
+
+// ResolveRoute 根据请求属性返回路由对应的提供者和模型
+func (s *service) ResolveRoute(name string, attrs RouteRequest) (string, string, error) {
+	s.mu.RLock()
+	route, ok := s.routes[name]
+	s.mu.RUnlock()
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrRouteNotFound, name)
+	}
+	provider, model := route.resolve(attrs)
+	return provider, model, nil
+}
+
+// route 在提供者名称为空时把模型名称作为路由名解析，返回实际的提供者和模型
+func (s *service) route(providerName, modelID string, attrs func() RouteRequest) (Provider, string, error) {
+	if providerName == "" {
+		var err error
+		if providerName, modelID, err = s.ResolveRoute(modelID, attrs()); err != nil {
+			return nil, "", err
+		}
+	}
+	provider, err := s.GetProvider(providerName)
+	if err != nil {
+		return nil, "", err
+	}
+	return provider, modelID, nil
+}
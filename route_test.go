@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newRoutedService 返回注册了 small 和 vision 两个提供者的服务，聊天回复 "<提供者>/<模型>"
+func newRoutedService(t *testing.T) Service {
+	t.Helper()
+	svc := NewService()
+	for _, name := range []string{"small", "vision"} {
+		name := name
+		provider := &mockProvider{
+			name: name,
+			chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+				return ChatResponse{Message: Message{Content: name + "/" + modelID}}, nil
+			},
+			embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+				return EmbeddingResponse{Embedding: []float64{1, 0, 0}, Metadata: map[string]interface{}{"model": name + "/" + modelID}}, nil
+			},
+		}
+		if err := svc.RegisterProvider(provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return svc
+}
+
+func TestSetRouteValidation(t *testing.T) {
+	svc := NewService()
+	tests := []struct {
+		name  string
+		route string
+		value Route
+	}{
+		{"empty name", "", Route{Provider: "p", Model: "m"}},
+		{"slash in name", "a/b", Route{Provider: "p", Model: "m"}},
+		{"missing provider", "fast", Route{Model: "m"}},
+		{"missing model", "fast", Route{Provider: "p"}},
+		{"rule without target", "fast", Route{Provider: "p", Model: "m", Rules: []RouteRule{{Images: true}}}},
+		{"inverted token range", "fast", Route{Provider: "p", Model: "m", Rules: []RouteRule{{MinPromptTokens: 10, MaxPromptTokens: 5, Model: "x"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := svc.SetRoute(tt.route, tt.value); err == nil {
+				t.Error("SetRoute() error = nil, want an error")
+			}
+		})
+	}
+	if routes := svc.Routes(); len(routes) != 0 {
+		t.Errorf("Routes() = %v, want no routes after invalid updates", routes)
+	}
+}
+
+func TestServiceRoutes(t *testing.T) {
+	svc := newRoutedService(t)
+	if err := svc.SetRoute("smart", Route{
+		Provider: "small",
+		Model:    "qwen2.5",
+		Rules: []RouteRule{
+			{Images: true, Provider: "vision", Model: "llava"},
+			{Tools: true, Model: "qwen2.5-tools"},
+			{Tenants: []string{"premium"}, Model: "qwen2.5:72b"},
+			{MinPromptTokens: 100, Model: "qwen2.5-long"},
+		},
+	}); err != nil {
+		t.Fatalf("SetRoute() error = %v", err)
+	}
+
+	user := func(content string) []Message { return []Message{{Role: "user", Content: content}} }
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		request ChatRequest
+		want    string
+	}{
+		{"default target", context.Background(), ChatRequest{Messages: user("hi")}, "small/qwen2.5"},
+		{"images", context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "what is this", Images: []string{"aGk="}}}}, "vision/llava"},
+		{"tools", context.Background(), ChatRequest{Messages: user("hi"), Metadata: map[string]interface{}{MetadataTools: []interface{}{"search"}}}, "small/qwen2.5-tools"},
+		{"tenant from context", WithTenant(context.Background(), "premium"), ChatRequest{Messages: user("hi")}, "small/qwen2.5:72b"},
+		{"tenant from metadata", context.Background(), ChatRequest{Messages: user("hi"), Metadata: map[string]interface{}{MetadataTenant: "premium"}}, "small/qwen2.5:72b"},
+		{"long prompt", context.Background(), ChatRequest{Messages: user(strings.Repeat("word ", 100))}, "small/qwen2.5-long"},
+		{"first matching rule wins", WithTenant(context.Background(), "premium"), ChatRequest{Messages: []Message{{Role: "user", Images: []string{"aGk="}}}}, "vision/llava"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := svc.Chat(tt.ctx, "", "smart", tt.request)
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if response.Message.Content != tt.want {
+				t.Errorf("Chat() routed to %s, want %s", response.Message.Content, tt.want)
+			}
+		})
+	}
+
+	// 显式指定提供者时不使用路由
+	response, err := svc.Chat(context.Background(), "vision", "smart", ChatRequest{Messages: user("hi")})
+	if err != nil || response.Message.Content != "vision/smart" {
+		t.Errorf("Chat() with a provider = %q, %v, want the model name used as is", response.Message.Content, err)
+	}
+
+	if _, err := svc.Chat(context.Background(), "", "missing", ChatRequest{Messages: user("hi")}); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("Chat() with an unknown route error = %v, want %v", err, ErrRouteNotFound)
+	}
+}
+
+func TestEmbeddingRoutes(t *testing.T) {
+	svc := newRoutedService(t)
+	if err := svc.SetRoute("embed", Route{
+		Provider: "small",
+		Model:    "nomic",
+		Rules: []RouteRule{
+			{Tenants: []string{"a"}, Model: "bge"},
+			{MinPromptTokens: 5, Provider: "vision", Model: "clip"},
+		},
+	}); err != nil {
+		t.Fatalf("SetRoute() error = %v", err)
+	}
+
+	// 嵌入请求忽略规则，同一路由的向量总是来自默认目标
+	for _, tt := range []struct {
+		name  string
+		ctx   context.Context
+		input string
+	}{
+		{"tenant", WithTenant(context.Background(), "a"), "text"},
+		{"long input", context.Background(), strings.Repeat("word ", 20)},
+	} {
+		response, err := svc.Embed(tt.ctx, "", "embed", EmbeddingRequest{Input: tt.input})
+		if err != nil || response.Metadata["model"] != "small/nomic" {
+			t.Errorf("%s: Embed() = %v, %v, want the route's default target", tt.name, response.Metadata, err)
+		}
+	}
+
+	// 嵌入器第一次使用时固定路由的目标，之后修改路由表不影响已有的嵌入器
+	embedder := NewLLMEmbedder(svc, "", "embed", 0)
+	if _, err := embedder.Embed(context.Background(), "text"); err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if err := svc.SetRoute("embed", Route{Provider: "vision", Model: "clip"}); err != nil {
+		t.Fatalf("SetRoute() error = %v", err)
+	}
+	if got := embedder.Spec().Model; got != "small/nomic" {
+		t.Errorf("Spec().Model = %q, want the pinned small/nomic", got)
+	}
+	if got := NewLLMEmbedder(svc, "", "embed", 0).Spec().Model; got != "vision/clip" {
+		t.Errorf("new embedder Spec().Model = %q, want vision/clip", got)
+	}
+
+	if _, err := NewLLMEmbedder(svc, "", "missing", 0).Embed(context.Background(), "text"); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("Embed() with an unknown route error = %v, want %v", err, ErrRouteNotFound)
+	}
+}
+
+func TestServiceRoutesUpdate(t *testing.T) {
+	svc := newRoutedService(t)
+	route := Route{Provider: "small", Model: "nomic", Rules: []RouteRule{{Tenants: []string{"a"}, Model: "bge"}}}
+	if err := svc.SetRoute("embed-default", route); err != nil {
+		t.Fatalf("SetRoute() error = %v", err)
+	}
+	route.Rules[0].Tenants[0] = "changed"
+
+	if got := svc.Routes()["embed-default"].Rules[0].Tenants[0]; got != "a" {
+		t.Errorf("stored rule tenant = %q, want the route unaffected by caller changes", got)
+	}
+
+	embedder := NewLLMEmbedder(svc, "", "embed-default", 0)
+	if dims, err := embedder.DetectDimensions(context.Background()); err != nil || dims != 3 {
+		t.Errorf("DetectDimensions() = %d, %v, want 3", dims, err)
+	}
+
+	// 替换路由后调用方无需修改即可使用新模型
+	if err := svc.SetRoute("embed-default", Route{Provider: "vision", Model: "clip"}); err != nil {
+		t.Fatalf("SetRoute() error = %v", err)
+	}
+	if provider, model, err := svc.ResolveRoute("embed-default", RouteRequest{Tenant: "a"}); err != nil || provider != "vision" || model != "clip" {
+		t.Errorf("ResolveRoute() = %s, %s, %v, want vision, clip", provider, model, err)
+	}
+
+	routes := svc.Routes()
+	delete(routes, "embed-default")
+	if len(svc.Routes()) != 1 {
+		t.Error("Routes() returned the internal table, want a copy")
+	}
+	svc.RemoveRoute("embed-default")
+	if _, _, err := svc.ResolveRoute("embed-default", RouteRequest{}); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("ResolveRoute() after RemoveRoute error = %v, want %v", err, ErrRouteNotFound)
+	}
+}
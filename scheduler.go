@@ -0,0 +1,450 @@
+package llm
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 定义调度错误
+var (
+	ErrQueueTimeout = errors.New("request queue wait timed out")
+	ErrQueueFull    = errors.New("request queue is full")
+)
+
+// Priority 表示请求的优先级，高优先级的请求总是先于低优先级的请求执行
+type Priority int
+
+const (
+	// PriorityBackground 用于批量嵌入、离线索引等后台任务
+	PriorityBackground Priority = iota
+	// PriorityNormal 是默认优先级
+	PriorityNormal
+	// PriorityInteractive 用于用户正在等待的交互式请求
+	PriorityInteractive
+)
+
+// priorityCount 是优先级的数量
+const priorityCount = 3
+
+// 请求 Metadata 中指定优先级和租户的键
+const (
+	MetadataPriority = "priority"
+	MetadataTenant   = "tenant"
+)
+
+// String 返回优先级的名称
+func (p Priority) String() string {
+	switch p {
+	case PriorityBackground:
+		return "background"
+	case PriorityNormal:
+		return "normal"
+	case PriorityInteractive:
+		return "interactive"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+// ParsePriority 解析优先级名称
+func ParsePriority(name string) (Priority, bool) {
+	switch strings.ToLower(name) {
+	case "background", "low":
+		return PriorityBackground, true
+	case "normal", "":
+		return PriorityNormal, true
+	case "interactive", "high":
+		return PriorityInteractive, true
+	default:
+		return PriorityNormal, false
+	}
+}
+
+// schedulerContextKey 是调度信息在 context 中的键
+type schedulerContextKey int
+
+const (
+	priorityKey schedulerContextKey = iota
+	tenantKey
+)
+
+// WithPriority 返回携带请求优先级的 context
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey, priority)
+}
+
+// WithTenant 返回携带租户的 context
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// RequestClass 从请求 Metadata 和 context 中读取优先级和租户，Metadata 优先
+func RequestClass(ctx context.Context, metadata map[string]interface{}) (Priority, string) {
+	priority := PriorityNormal
+	if p, ok := ctx.Value(priorityKey).(Priority); ok {
+		priority = p
+	}
+	tenant, _ := ctx.Value(tenantKey).(string)
+
+	switch v := metadata[MetadataPriority].(type) {
+	case Priority:
+		priority = v
+	case string:
+		if p, ok := ParsePriority(v); ok {
+			priority = p
+		}
+	default:
+		if n, ok := toFloat(v); ok {
+			priority = Priority(n)
+		}
+	}
+	if t, ok := metadata[MetadataTenant].(string); ok {
+		tenant = t
+	}
+
+	priority = min(max(priority, PriorityBackground), PriorityInteractive)
+	return priority, tenant
+}
+
+// SchedulerConfig 是请求调度器的配置
+type SchedulerConfig struct {
+	Concurrency   int                // 同时执行的请求数，默认4
+	MaxWait       time.Duration      // 请求在队列中的最长等待时间，0 表示不限制
+	MaxQueue      int                // 队列中的最大请求数，0 表示不限制
+	TenantWeights map[string]float64 // 同一优先级内各租户的权重，未配置的租户权重为1
+}
+
+// SchedulerStats 是调度器的统计信息
+type SchedulerStats struct {
+	Running          int                        // 正在执行的请求数
+	Queued           int                        // 排队中的请求总数
+	QueuedByPriority map[Priority]int           // 各优先级排队中的请求数
+	QueuedByTenant   map[string]int             // 各租户排队中的请求数
+	Dispatched       uint64                     // 累计开始执行的请求数
+	TimedOut         uint64                     // 累计因等待超时被拒绝的请求数
+	Rejected         uint64                     // 累计因队列已满被拒绝的请求数
+	AverageWait      time.Duration              // 已开始执行的请求的平均排队时间
+	OldestWait       map[Priority]time.Duration // 各优先级中排队最久的请求已等待的时间
+}
+
+// queuedRequest 是排队中的一个请求
+type queuedRequest struct {
+	priority Priority
+	tenant   string
+	start    float64 // 加权公平队列的虚拟开始时间
+	finish   float64 // 加权公平队列的虚拟结束时间
+	seq      uint64
+	enqueued time.Time
+	granted  chan struct{}
+	index    int
+}
+
+// requestQueue 是按虚拟结束时间排序的最小堆
+type requestQueue []*queuedRequest
+
+func (q requestQueue) Len() int { return len(q) }
+func (q requestQueue) Less(i, j int) bool {
+	if q[i].finish != q[j].finish {
+		return q[i].finish < q[j].finish
+	}
+	return q[i].seq < q[j].seq
+}
+func (q requestQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *requestQueue) Push(x interface{}) {
+	r := x.(*queuedRequest)
+	r.index = len(*q)
+	*q = append(*q, r)
+}
+func (q *requestQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	r := old[n-1]
+	r.index = -1
+	*q = old[:n-1]
+	return r
+}
+
+// priorityClass 是一个优先级的加权公平队列
+type priorityClass struct {
+	queue      requestQueue
+	virtual    float64            // 当前虚拟时间
+	lastFinish map[string]float64 // 各租户最后一个请求的虚拟结束时间
+}
+
+// prune 删除不再影响调度的租户记录：结束时间不晚于当前虚拟时间的租户下次排队时从虚拟时间开始，
+// 队列为空时所有租户都从头开始。租户名称来自请求，不清理会无限增长
+func (c *priorityClass) prune() {
+	if c.queue.Len() == 0 {
+		clear(c.lastFinish)
+		return
+	}
+	for tenant, finish := range c.lastFinish {
+		if finish <= c.virtual {
+			delete(c.lastFinish, tenant)
+		}
+	}
+}
+
+// Scheduler 是位于提供者之前的请求调度器
+// 不同优先级之间严格按优先级调度，同一优先级内按租户权重进行加权公平排队
+type Scheduler struct {
+	config     SchedulerConfig
+	classes    [priorityCount]*priorityClass
+	running    int
+	seq        uint64
+	dispatched uint64
+	timedOut   uint64
+	rejected   uint64
+	totalWait  time.Duration
+	mu         sync.Mutex
+}
+
+// NewScheduler 创建一个新的请求调度器
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	s := &Scheduler{config: config}
+	for i := range s.classes {
+		s.classes[i] = &priorityClass{lastFinish: make(map[string]float64)}
+	}
+	return s
+}
+
+// weight 返回租户的权重
+func (s *Scheduler) weight(tenant string) float64 {
+	if w, ok := s.config.TenantWeights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Acquire 按优先级和租户排队等待执行，返回的 release 函数必须在请求结束后调用
+// 等待超过 MaxWait 时返回 ErrQueueTimeout，队列已满时返回 ErrQueueFull
+func (s *Scheduler) Acquire(ctx context.Context, priority Priority, tenant string) (func(), error) {
+	priority = min(max(priority, PriorityBackground), PriorityInteractive)
+
+	s.mu.Lock()
+	if s.running < s.config.Concurrency && s.queued() == 0 {
+		s.running++
+		s.dispatched++
+		s.mu.Unlock()
+		return s.releaseFunc(), nil
+	}
+	if s.config.MaxQueue > 0 && s.queued() >= s.config.MaxQueue {
+		s.rejected++
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %d requests queued", ErrQueueFull, s.config.MaxQueue)
+	}
+
+	class := s.classes[priority]
+	start := max(class.virtual, class.lastFinish[tenant])
+	s.seq++
+	request := &queuedRequest{
+		priority: priority,
+		tenant:   tenant,
+		start:    start,
+		finish:   start + 1/s.weight(tenant),
+		seq:      s.seq,
+		enqueued: time.Now(),
+		granted:  make(chan struct{}),
+	}
+	class.lastFinish[tenant] = request.finish
+	heap.Push(&class.queue, request)
+	s.dispatch()
+	s.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if s.config.MaxWait > 0 {
+		timer := time.NewTimer(s.config.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-request.granted:
+		return s.releaseFunc(), nil
+	case <-ctx.Done():
+		if s.cancel(request, false) {
+			return s.releaseFunc(), nil
+		}
+		return nil, ctx.Err()
+	case <-timeout:
+		if s.cancel(request, true) {
+			return s.releaseFunc(), nil
+		}
+		return nil, fmt.Errorf("%w after %s (%s priority)", ErrQueueTimeout, s.config.MaxWait, priority)
+	}
+}
+
+// cancel 将请求移出队列，如果请求已被调度则返回 true
+func (s *Scheduler) cancel(request *queuedRequest, timedOut bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-request.granted:
+		return true
+	default:
+	}
+	class := s.classes[request.priority]
+	heap.Remove(&class.queue, request.index)
+	// 被取消的请求不占用租户的份额；之后又有同租户的请求排队时其虚拟时间已基于该请求计算，不再回退
+	if class.lastFinish[request.tenant] == request.finish {
+		if request.start > class.virtual {
+			class.lastFinish[request.tenant] = request.start
+		} else {
+			delete(class.lastFinish, request.tenant)
+		}
+	}
+	if timedOut {
+		s.timedOut++
+	}
+	return false
+}
+
+// releaseFunc 返回释放执行槽位的函数
+func (s *Scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			s.dispatch()
+		})
+	}
+}
+
+// dispatch 在有空闲槽位时按优先级和虚拟结束时间调度排队的请求，调用方需持有锁
+func (s *Scheduler) dispatch() {
+	for s.running < s.config.Concurrency {
+		var next *queuedRequest
+		for p := priorityCount - 1; p >= 0; p-- {
+			class := s.classes[p]
+			if class.queue.Len() > 0 {
+				next = heap.Pop(&class.queue).(*queuedRequest)
+				class.virtual = next.start
+				class.prune()
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		s.running++
+		s.dispatched++
+		s.totalWait += time.Since(next.enqueued)
+		close(next.granted)
+	}
+}
+
+// queued 返回排队中的请求总数，调用方需持有锁
+func (s *Scheduler) queued() int {
+	total := 0
+	for _, class := range s.classes {
+		total += class.queue.Len()
+	}
+	return total
+}
+
+// Stats 返回调度器的统计信息
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SchedulerStats{
+		Running:          s.running,
+		Queued:           s.queued(),
+		QueuedByPriority: make(map[Priority]int),
+		QueuedByTenant:   make(map[string]int),
+		Dispatched:       s.dispatched,
+		TimedOut:         s.timedOut,
+		Rejected:         s.rejected,
+		OldestWait:       make(map[Priority]time.Duration),
+	}
+	if s.dispatched > 0 {
+		stats.AverageWait = s.totalWait / time.Duration(s.dispatched)
+	}
+	now := time.Now()
+	for p, class := range s.classes {
+		for _, request := range class.queue {
+			stats.QueuedByPriority[Priority(p)]++
+			stats.QueuedByTenant[request.tenant]++
+			stats.OldestWait[Priority(p)] = max(stats.OldestWait[Priority(p)], now.Sub(request.enqueued))
+		}
+	}
+	return stats
+}
+
+// scheduledProvider 是通过调度器排队执行请求的提供者
+type scheduledProvider struct {
+	Provider
+	scheduler *Scheduler
+}
+
+// NewScheduledProvider 返回一个通过调度器执行 Complete、Chat、ChatStream 和 Embed 的提供者，
+// 优先级和租户从请求 Metadata 的 "priority"、"tenant" 键或 WithPriority、WithTenant 设置的 context 中读取
+func NewScheduledProvider(provider Provider, scheduler *Scheduler) Provider {
+	return &scheduledProvider{Provider: provider, scheduler: scheduler}
+}
+
+// acquire 按请求的优先级和租户排队
+func (p *scheduledProvider) acquire(ctx context.Context, metadata map[string]interface{}) (func(), error) {
+	priority, tenant := RequestClass(ctx, metadata)
+	return p.scheduler.Acquire(ctx, priority, tenant)
+}
+
+// Complete 生成文本补全
+func (p *scheduledProvider) Complete(ctx context.Context, modelID string, request CompletionRequest) (CompletionResponse, error) {
+	release, err := p.acquire(ctx, request.Metadata)
+	if err != nil {
+		return CompletionResponse{}, err
+	}
+	defer release()
+	return p.Provider.Complete(ctx, modelID, request)
+}
+
+// Chat 执行聊天补全
+func (p *scheduledProvider) Chat(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+	release, err := p.acquire(ctx, request.Metadata)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer release()
+	return p.Provider.Chat(ctx, modelID, request)
+}
+
+// ChatStream 流式执行聊天补全，整个流式输出期间占用调度器的槽位
+func (p *scheduledProvider) ChatStream(ctx context.Context, modelID string, request ChatRequest, fn func(delta string) error) (ChatResponse, error) {
+	release, err := p.acquire(ctx, request.Metadata)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer release()
+	return wrappedChatStream(ctx, p.Provider, modelID, request, fn)
+}
+
+// Embed 生成文本的嵌入向量
+func (p *scheduledProvider) Embed(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+	release, err := p.acquire(ctx, request.Metadata)
+	if err != nil {
+		return EmbeddingResponse{}, err
+	}
+	defer release()
+	return p.Provider.Embed(ctx, modelID, request)
+}
+
+// EmbeddingModelInfo 转发给被包装的提供者
+func (p *scheduledProvider) EmbeddingModelInfo(ctx context.Context, modelID string) (EmbeddingModelInfo, error) {
+	return wrappedEmbeddingModelInfo(ctx, p.Provider, modelID)
+}
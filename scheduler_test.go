@@ -0,0 +1,325 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued 等待调度器中排队的请求数达到 n
+func waitQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Stats().Queued < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d queued requests, have %d", n, s.Stats().Queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// scheduleOrder 在占满唯一槽位后依次排队 requests，释放后返回它们的执行顺序
+func scheduleOrder(t *testing.T, s *Scheduler, requests []struct {
+	name     string
+	priority Priority
+	tenant   string
+}) []string {
+	t.Helper()
+	hold, err := s.Acquire(context.Background(), PriorityNormal, "")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	var (
+		order []string
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for i, r := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), r.priority, r.tenant)
+			if err != nil {
+				t.Errorf("Acquire(%s) error = %v", r.name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, r.name)
+			mu.Unlock()
+			release()
+		}()
+		waitQueued(t, s, i+1)
+	}
+	hold()
+	wg.Wait()
+	return order
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Concurrency: 1})
+	order := scheduleOrder(t, s, []struct {
+		name     string
+		priority Priority
+		tenant   string
+	}{
+		{"bulk-1", PriorityBackground, ""},
+		{"bulk-2", PriorityBackground, ""},
+		{"api", PriorityNormal, ""},
+		{"chat", PriorityInteractive, ""},
+	})
+	want := []string{"chat", "api", "bulk-1", "bulk-2"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("execution order = %v, want %v", order, want)
+	}
+}
+
+func TestSchedulerWeightedFairQueuing(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{
+		Concurrency:   1,
+		TenantWeights: map[string]float64{"gold": 2},
+	})
+	var requests []struct {
+		name     string
+		priority Priority
+		tenant   string
+	}
+	// 先让 basic 排满队，加权公平排队仍应让 gold 获得两倍的份额
+	for _, tenant := range []string{"basic", "gold"} {
+		for i := 0; i < 6; i++ {
+			requests = append(requests, struct {
+				name     string
+				priority Priority
+				tenant   string
+			}{tenant, PriorityNormal, tenant})
+		}
+	}
+	order := scheduleOrder(t, s, requests)
+
+	counts := map[string]int{}
+	for _, tenant := range order[:6] {
+		counts[tenant]++
+	}
+	if counts["gold"] != 4 || counts["basic"] != 2 {
+		t.Errorf("first 6 dispatches = %v (%v), want gold:4 basic:2", counts, order)
+	}
+}
+
+func TestSchedulerMaxWait(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Concurrency: 1, MaxWait: 20 * time.Millisecond})
+	hold, err := s.Acquire(context.Background(), PriorityNormal, "")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer hold()
+
+	if _, err := s.Acquire(context.Background(), PriorityBackground, "batch"); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Acquire() error = %v, want ErrQueueTimeout", err)
+	}
+	stats := s.Stats()
+	if stats.TimedOut != 1 || stats.Queued != 0 {
+		t.Errorf("Stats() = %+v, want 1 timed out and an empty queue", stats)
+	}
+}
+
+func TestSchedulerMaxQueueAndCancel(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Concurrency: 1, MaxQueue: 1})
+	hold, err := s.Acquire(context.Background(), PriorityNormal, "")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(ctx, PriorityNormal, "a")
+		done <- err
+	}()
+	waitQueued(t, s, 1)
+
+	if _, err := s.Acquire(context.Background(), PriorityInteractive, "b"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Acquire() on a full queue error = %v, want ErrQueueFull", err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled Acquire() error = %v, want context.Canceled", err)
+	}
+
+	hold()
+	stats := s.Stats()
+	if stats.Running != 0 || stats.Queued != 0 || stats.Rejected != 1 {
+		t.Errorf("Stats() = %+v, want nothing running or queued and 1 rejected", stats)
+	}
+}
+
+func TestSchedulerStats(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Concurrency: 1})
+	hold, err := s.Acquire(context.Background(), PriorityNormal, "")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i, r := range []struct {
+		priority Priority
+		tenant   string
+	}{
+		{PriorityBackground, "a"},
+		{PriorityBackground, "b"},
+		{PriorityInteractive, "a"},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, err := s.Acquire(ctx, r.priority, r.tenant); err == nil {
+				release()
+			}
+		}()
+		waitQueued(t, s, i+1)
+	}
+
+	stats := s.Stats()
+	if stats.Running != 1 || stats.Queued != 3 {
+		t.Errorf("Stats() running = %d, queued = %d, want 1 and 3", stats.Running, stats.Queued)
+	}
+	if want := map[Priority]int{PriorityBackground: 2, PriorityInteractive: 1}; !reflect.DeepEqual(stats.QueuedByPriority, want) {
+		t.Errorf("QueuedByPriority = %v, want %v", stats.QueuedByPriority, want)
+	}
+	if want := map[string]int{"a": 2, "b": 1}; !reflect.DeepEqual(stats.QueuedByTenant, want) {
+		t.Errorf("QueuedByTenant = %v, want %v", stats.QueuedByTenant, want)
+	}
+
+	cancel()
+	wg.Wait()
+	hold()
+}
+
+func TestRequestClass(t *testing.T) {
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		metadata     map[string]interface{}
+		wantPriority Priority
+		wantTenant   string
+	}{
+		{"default", context.Background(), nil, PriorityNormal, ""},
+		{"context", WithTenant(WithPriority(context.Background(), PriorityInteractive), "acme"), nil, PriorityInteractive, "acme"},
+		{"metadata name", context.Background(), map[string]interface{}{"priority": "background", "tenant": "acme"}, PriorityBackground, "acme"},
+		{"metadata number", context.Background(), map[string]interface{}{"priority": 2}, PriorityInteractive, ""},
+		{"metadata overrides context", WithPriority(context.Background(), PriorityInteractive), map[string]interface{}{"priority": "low"}, PriorityBackground, ""},
+		{"out of range", context.Background(), map[string]interface{}{"priority": 9}, PriorityInteractive, ""},
+		{"unknown name", context.Background(), map[string]interface{}{"priority": "urgent"}, PriorityNormal, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priority, tenant := RequestClass(tt.ctx, tt.metadata)
+			if priority != tt.wantPriority || tenant != tt.wantTenant {
+				t.Errorf("RequestClass() = %s, %q, want %s, %q", priority, tenant, tt.wantPriority, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestScheduledProvider(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Concurrency: 1})
+	started := make(chan string, 3)
+	unblock := make(chan struct{})
+	provider := NewScheduledProvider(&mockProvider{
+		name: "test-provider",
+		embedFunc: func(ctx context.Context, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			started <- request.Input
+			<-unblock
+			return EmbeddingResponse{Embedding: []float64{1}}, nil
+		},
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			started <- "chat"
+			return ChatResponse{}, nil
+		},
+	}, s)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_, _ = provider.Embed(context.Background(), "m", EmbeddingRequest{Input: "first"})
+	}()
+	if got := <-started; got != "first" {
+		t.Fatalf("first request = %q, want first", got)
+	}
+	go func() {
+		defer wg.Done()
+		_, _ = provider.Embed(context.Background(), "m", EmbeddingRequest{
+			Input:    "bulk",
+			Metadata: map[string]interface{}{MetadataPriority: "background"},
+		})
+	}()
+	waitQueued(t, s, 1)
+	go func() {
+		defer wg.Done()
+		_, _ = provider.Chat(WithPriority(context.Background(), PriorityInteractive), "m", ChatRequest{})
+	}()
+	waitQueued(t, s, 2)
+
+	close(unblock)
+	if got := <-started; got != "chat" {
+		t.Errorf("second request = %q, want the interactive chat", got)
+	}
+	wg.Wait()
+}
+
+func TestSchedulerTenantState(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Concurrency: 1})
+	hold, err := s.Acquire(context.Background(), PriorityNormal, "")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	class := s.classes[PriorityNormal]
+	tenants := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(class.lastFinish)
+	}
+
+	// 取消的请求回退租户的虚拟结束时间
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(ctx, PriorityNormal, "canceled")
+		done <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() error = %v, want context.Canceled", err)
+	}
+	if n := tenants(); n != 0 {
+		t.Errorf("%d tenants recorded after cancellation, want 0", n)
+	}
+
+	// 大量不同的租户执行完后不再保留记录
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), PriorityNormal, fmt.Sprintf("tenant-%d", i))
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			release()
+		}(i)
+	}
+	waitQueued(t, s, 100)
+	hold()
+	wg.Wait()
+	if n := tenants(); n != 0 {
+		t.Errorf("%d tenants recorded after the queue drained, want 0", n)
+	}
+}
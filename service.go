@@ -9,6 +9,7 @@ import (
 // service 是Service接口的实现
 type service struct {
 	providers map[string]Provider
+	routes    map[string]Route
 	mu        sync.RWMutex
 }
 
@@ -16,6 +17,7 @@ type service struct {
 func NewService() Service {
 	return &service{
 		providers: make(map[string]Provider),
+		routes:    make(map[string]Route),
 	}
 }
 
@@ -88,9 +90,9 @@ func (s *service) ListModels(ctx context.Context) (map[string][]ModelInfo, error
 	return result, nil
 }
 
-// GetModel 获取模型信息
+// GetModel 获取模型信息，提供者名称为空时返回路由默认目标的模型信息
 func (s *service) GetModel(ctx context.Context, providerName, modelID string) (ModelInfo, error) {
-	provider, err := s.GetProvider(providerName)
+	provider, modelID, err := s.route(providerName, modelID, func() RouteRequest { return RouteRequest{} })
 	if err != nil {
 		return ModelInfo{}, err
 	}
@@ -100,7 +102,7 @@ func (s *service) GetModel(ctx context.Context, providerName, modelID string) (M
 
 // Complete 执行文本补全
 func (s *service) Complete(ctx context.Context, providerName, modelID string, request CompletionRequest) (CompletionResponse, error) {
-	provider, err := s.GetProvider(providerName)
+	provider, modelID, err := s.route(providerName, modelID, func() RouteRequest { return CompletionRouteRequest(ctx, request) })
 	if err != nil {
 		return CompletionResponse{}, err
 	}
@@ -110,7 +112,7 @@ func (s *service) Complete(ctx context.Context, providerName, modelID string, re
 
 // Chat 执行聊天补全
 func (s *service) Chat(ctx context.Context, providerName, modelID string, request ChatRequest) (ChatResponse, error) {
-	provider, err := s.GetProvider(providerName)
+	provider, modelID, err := s.route(providerName, modelID, func() RouteRequest { return ChatRouteRequest(ctx, request) })
 	if err != nil {
 		return ChatResponse{}, err
 	}
@@ -120,7 +122,7 @@ func (s *service) Chat(ctx context.Context, providerName, modelID string, reques
 
 // Embed 执行文本嵌入
 func (s *service) Embed(ctx context.Context, providerName, modelID string, request EmbeddingRequest) (EmbeddingResponse, error) {
-	provider, err := s.GetProvider(providerName)
+	provider, modelID, err := s.route(providerName, modelID, func() RouteRequest { return EmbeddingRouteRequest(ctx, request) })
 	if err != nil {
 		return EmbeddingResponse{}, err
 	}
@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
@@ -277,3 +278,67 @@ func TestServiceEmbed(t *testing.T) {
 		t.Errorf("Embed() = %v, want %v", got, expectedResponse)
 	}
 }
+
+func TestGenerateText(t *testing.T) {
+	svc := NewService()
+	var got ChatRequest
+	provider := &mockProvider{
+		name: "test-provider",
+		chatFunc: func(ctx context.Context, modelID string, request ChatRequest) (ChatResponse, error) {
+			got = request
+			return ChatResponse{
+				Message: Message{Role: "assistant", Content: "done"},
+				Usage:   Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+			}, nil
+		},
+	}
+	_ = svc.RegisterProvider(provider)
+
+	params := GenerateTextParams{
+		Prompt:       "describe",
+		SystemPrompt: "be brief",
+		Model:        "test-model",
+		Temperature:  0.5,
+		Stop:         []string{"END"},
+		HistoryMessages: []ChatMessage{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello"},
+		},
+		Attachments: []ProcessedAttachment{
+			{Type: AttachmentTypeText, Data: "file body", SourceName: "notes.txt"},
+			{Type: AttachmentTypeImage, Data: []byte{1, 2, 3}, SourceName: "a.png"},
+		},
+	}
+
+	response, err := svc.GenerateText(context.Background(), "test-provider", params)
+	if err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+	if response.Text != "done" || response.Usage.TotalTokens != 4 {
+		t.Errorf("GenerateText() = %+v, want text and usage from chat response", response)
+	}
+
+	want := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "[Attachment: notes.txt]\nfile body\n\ndescribe", Images: []string{"AQID"}},
+	}
+	if !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("chat messages = %+v, want %+v", got.Messages, want)
+	}
+	if got.Temperature != 0.5 || !reflect.DeepEqual(got.Stop, []string{"END"}) {
+		t.Errorf("chat request parameters = %+v, want temperature and stop from params", got)
+	}
+
+	errorCases := []GenerateTextParams{
+		{Prompt: "x"},
+		{Model: "test-model"},
+		{Model: "test-model", Attachments: []ProcessedAttachment{{Type: "audio"}}},
+	}
+	for _, params := range errorCases {
+		if _, err := svc.GenerateText(context.Background(), "test-provider", params); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("GenerateText(%+v) error = %v, want ErrInvalidRequest", params, err)
+		}
+	}
+}
@@ -18,6 +18,18 @@ type Service interface {
 	// 获取所有可用模型
 	ListModels(ctx context.Context) (map[string][]ModelInfo, error)
 
+	// 添加或替换路由，提供者名称为空时模型名称作为路由名解析
+	SetRoute(name string, route Route) error
+
+	// 删除路由
+	RemoveRoute(name string)
+
+	// 返回路由表
+	Routes() map[string]Route
+
+	// 根据请求属性解析路由对应的提供者和模型
+	ResolveRoute(name string, request RouteRequest) (provider, model string, err error)
+
 	// 获取模型信息
 	GetModel(ctx context.Context, providerName, modelID string) (ModelInfo, error)
 
@@ -29,4 +41,7 @@ type Service interface {
 
 	// 执行文本嵌入
 	Embed(ctx context.Context, providerName, modelID string, request EmbeddingRequest) (EmbeddingResponse, error)
+
+	// 根据生成文本参数生成文本
+	GenerateText(ctx context.Context, providerName string, params GenerateTextParams) (GenerateTextResponse, error)
 }
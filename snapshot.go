@@ -0,0 +1,609 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 定义快照错误
+var (
+	ErrInvalidSnapshot  = errors.New("invalid snapshot")
+	ErrSnapshotMismatch = errors.New("snapshot embedding model mismatch")
+)
+
+// 快照文件格式（小端序）：
+//
+//	magic "LLMSNAP1" | flags u16 | metric u8 | dims u32 | count u64 | model (u16长度 + 字节)
+//	向量区：count*dims 个 float32
+//	记录区：每条记录为 id、content、metadata(JSON)，各自以 u32 长度为前缀
+//	图区（flags 含 snapshotFlagGraph 时）：HNSW参数和每个节点的层级、删除标记及各层邻居，
+//	flags 含 snapshotFlagGraphConfig 时HNSW参数之后还有 seed i64 和 MaxTombstoneRatio f64，
+//	旧版本写入的快照没有这两个字段，加载时使用默认值
+//	尾部：之前所有字节的 CRC32
+const (
+	snapshotMagic           = "LLMSNAP1"
+	snapshotFlagGraph       = 1 << 0
+	snapshotFlagGraphConfig = 1 << 1
+)
+
+// EmbeddingSpec 描述生成向量的嵌入模型，用于确保快照与当前嵌入器兼容
+type EmbeddingSpec struct {
+	Model      string // 嵌入模型名称，如 "ollama/mxbai-embed-large"
+	Dimensions int    // 向量维度，0 表示不检查
+}
+
+// Spec 返回嵌入器的模型描述，使用路由的嵌入器返回路由解析后的提供者和模型
+func (e *LLMEmbedder) Spec() EmbeddingSpec {
+	// 路由无法解析时保留路由名，之后的嵌入同样会失败
+	_, _, _ = e.target()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return EmbeddingSpec{
+		Model:      e.provider + "/" + e.model,
+		Dimensions: e.dimensions,
+	}
+}
+
+// check 检查快照是否由指定的嵌入模型生成
+func (spec EmbeddingSpec) check(info SnapshotInfo) error {
+	if spec.Model != "" && spec.Model != info.Model {
+		return fmt.Errorf("%w: snapshot built with %q, embedder uses %q", ErrSnapshotMismatch, info.Model, spec.Model)
+	}
+	if spec.Dimensions > 0 && info.Count > 0 && spec.Dimensions != info.Dimensions {
+		return fmt.Errorf("%w: snapshot has %d dimensions, embedder produces %d", ErrSnapshotMismatch, info.Dimensions, spec.Dimensions)
+	}
+	return nil
+}
+
+// SnapshotInfo 是快照的头部信息
+type SnapshotInfo struct {
+	Model      string
+	Dimensions int
+	Count      int
+	Metric     SimilarityMetric
+	HasGraph   bool
+}
+
+// hnswGraph 是HNSW图的可持久化形式
+type hnswGraph struct {
+	config   HNSWConfig
+	entry    int
+	maxLevel int
+	levels   []int
+	deleted  []bool
+	links    [][][]int
+}
+
+// snapshotWriter 写入快照并计算校验和
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc uint32
+	err error
+	buf [8]byte
+}
+
+func (w *snapshotWriter) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, p)
+	_, w.err = w.w.Write(p)
+}
+
+func (w *snapshotWriter) u8(v uint8) { w.write([]byte{v}) }
+
+func (w *snapshotWriter) u16(v uint16) {
+	binary.LittleEndian.PutUint16(w.buf[:2], v)
+	w.write(w.buf[:2])
+}
+
+func (w *snapshotWriter) u32(v uint32) {
+	binary.LittleEndian.PutUint32(w.buf[:4], v)
+	w.write(w.buf[:4])
+}
+
+func (w *snapshotWriter) u64(v uint64) {
+	binary.LittleEndian.PutUint64(w.buf[:8], v)
+	w.write(w.buf[:8])
+}
+
+func (w *snapshotWriter) bytes(p []byte) {
+	w.u32(uint32(len(p)))
+	w.write(p)
+}
+
+// writeSnapshot 原子地写入快照：先写入同目录下的临时文件，同步后再重命名
+func writeSnapshot(path string, info SnapshotInfo, docs []Document, graph *hnswGraph) (err error) {
+	if len(info.Model) > math.MaxUint16 {
+		return fmt.Errorf("model name too long")
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w := &snapshotWriter{w: bufio.NewWriterSize(tmp, 1<<20)}
+
+	var flags uint16
+	if graph != nil {
+		flags |= snapshotFlagGraph | snapshotFlagGraphConfig
+	}
+	w.write([]byte(snapshotMagic))
+	w.u16(flags)
+	w.u8(uint8(info.Metric))
+	w.u32(uint32(info.Dimensions))
+	w.u64(uint64(len(docs)))
+	w.u16(uint16(len(info.Model)))
+	w.write([]byte(info.Model))
+
+	for _, doc := range docs {
+		for _, v := range doc.Embedding {
+			w.u32(math.Float32bits(float32(v)))
+		}
+	}
+
+	for _, doc := range docs {
+		metadata, err := json.Marshal(doc.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata of document %s: %w", doc.ID, err)
+		}
+		w.bytes([]byte(doc.ID))
+		w.bytes([]byte(doc.Content))
+		w.bytes(metadata)
+	}
+
+	if graph != nil {
+		w.u64(uint64(int64(graph.entry)))
+		w.u32(uint32(graph.maxLevel))
+		w.u32(uint32(graph.config.M))
+		w.u32(uint32(graph.config.EfConstruction))
+		w.u32(uint32(graph.config.EfSearch))
+		w.u64(uint64(graph.config.Seed))
+		w.u64(math.Float64bits(graph.config.MaxTombstoneRatio))
+		for i := range docs {
+			w.u32(uint32(graph.levels[i]))
+			if graph.deleted[i] {
+				w.u8(1)
+			} else {
+				w.u8(0)
+			}
+			for _, neighbors := range graph.links[i] {
+				w.u32(uint32(len(neighbors)))
+				for _, n := range neighbors {
+					w.u32(uint32(n))
+				}
+			}
+		}
+	}
+
+	// 尾部校验和本身不参与计算
+	crc := w.crc
+	binary.LittleEndian.PutUint32(w.buf[:4], crc)
+	if w.err == nil {
+		_, w.err = w.w.Write(w.buf[:4])
+	}
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if w.err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", w.err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+
+	// 同步目录以持久化重命名，部分平台不支持，忽略错误
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Snapshot 是以内存映射方式打开的只读快照
+type Snapshot struct {
+	info        SnapshotInfo
+	data        []byte
+	close       func() error
+	vectors     []byte
+	records     []int // 每条记录在 data 中的偏移
+	graphOffset int
+	graphConfig bool // 图区是否包含 seed 和 MaxTombstoneRatio
+}
+
+// snapshotReader 从字节切片中顺序读取
+type snapshotReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *snapshotReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("%w: unexpected end of data", ErrInvalidSnapshot)
+		return nil
+	}
+	p := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return p
+}
+
+func (r *snapshotReader) u8() uint8 {
+	if p := r.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *snapshotReader) u16() uint16 {
+	if p := r.next(2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (r *snapshotReader) u32() uint32 {
+	if p := r.next(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (r *snapshotReader) u64() uint64 {
+	if p := r.next(8); p != nil {
+		return binary.LittleEndian.Uint64(p)
+	}
+	return 0
+}
+
+func (r *snapshotReader) bytes() []byte {
+	return r.next(int(r.u32()))
+}
+
+// OpenSnapshot 以内存映射方式打开快照并校验其完整性
+// 使用完毕后需要调用 Close
+func OpenSnapshot(path string) (*Snapshot, error) {
+	data, closeFn, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+
+	s, err := parseSnapshot(data)
+	if err != nil {
+		closeFn()
+		return nil, err
+	}
+	s.close = closeFn
+	return s, nil
+}
+
+// parseSnapshot 解析快照头部并定位各个区域
+func parseSnapshot(data []byte) (*Snapshot, error) {
+	if len(data) < len(snapshotMagic)+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	r := &snapshotReader{data: body, pos: len(snapshotMagic)}
+	flags := r.u16()
+	s := &Snapshot{data: data}
+	s.info.Metric = SimilarityMetric(r.u8())
+	s.info.Dimensions = int(r.u32())
+	count := r.u64()
+	s.info.Model = string(r.next(int(r.u16())))
+	s.info.HasGraph = flags&snapshotFlagGraph != 0
+	s.graphConfig = flags&snapshotFlagGraphConfig != 0
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count > uint64(len(body)) || uint64(s.info.Dimensions)*count*4 > uint64(len(body)) {
+		return nil, fmt.Errorf("%w: bad document count", ErrInvalidSnapshot)
+	}
+	s.info.Count = int(count)
+
+	s.vectors = r.next(s.info.Count * s.info.Dimensions * 4)
+	s.records = make([]int, s.info.Count)
+	for i := range s.records {
+		s.records[i] = r.pos
+		r.bytes()
+		r.bytes()
+		r.bytes()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	s.graphOffset = r.pos
+
+	if !s.info.HasGraph && r.pos != len(body) {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidSnapshot)
+	}
+	return s, nil
+}
+
+// Info 返回快照的头部信息
+func (s *Snapshot) Info() SnapshotInfo {
+	return s.info
+}
+
+// Len 返回快照中的文档数量
+func (s *Snapshot) Len() int {
+	return s.info.Count
+}
+
+// Vector 将第 i 个向量解码到 dst 中并返回，dst 容量不足时重新分配
+func (s *Snapshot) Vector(i int, dst []float64) []float64 {
+	dims := s.info.Dimensions
+	if cap(dst) < dims {
+		dst = make([]float64, dims)
+	}
+	dst = dst[:dims]
+	raw := s.vectors[i*dims*4 : (i+1)*dims*4]
+	for j := range dst {
+		dst[j] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[j*4:])))
+	}
+	return dst
+}
+
+// Document 返回第 i 个文档，包含其嵌入向量
+func (s *Snapshot) Document(i int) (Document, error) {
+	r := &snapshotReader{data: s.data, pos: s.records[i]}
+	doc := Document{
+		ID:      string(r.bytes()),
+		Content: string(r.bytes()),
+	}
+	metadata := r.bytes()
+	if r.err != nil {
+		return Document{}, r.err
+	}
+	if err := json.Unmarshal(metadata, &doc.Metadata); err != nil {
+		return Document{}, fmt.Errorf("%w: bad metadata of document %s: %v", ErrInvalidSnapshot, doc.ID, err)
+	}
+	doc.Embedding = s.Vector(i, nil)
+	return doc, nil
+}
+
+// graph 读取HNSW图区
+func (s *Snapshot) graph() (*hnswGraph, error) {
+	if !s.info.HasGraph {
+		return nil, fmt.Errorf("%w: snapshot has no index graph", ErrInvalidSnapshot)
+	}
+
+	r := &snapshotReader{data: s.data[:len(s.data)-4], pos: s.graphOffset}
+	g := &hnswGraph{
+		entry:    int(int64(r.u64())),
+		maxLevel: int(r.u32()),
+		levels:   make([]int, s.info.Count),
+		deleted:  make([]bool, s.info.Count),
+		links:    make([][][]int, s.info.Count),
+	}
+	g.config = HNSWConfig{
+		M:              int(r.u32()),
+		EfConstruction: int(r.u32()),
+		EfSearch:       int(r.u32()),
+		Metric:         s.info.Metric,
+	}
+	if s.graphConfig {
+		g.config.Seed = int64(r.u64())
+		g.config.MaxTombstoneRatio = math.Float64frombits(r.u64())
+	} else {
+		defaults := DefaultHNSWConfig()
+		g.config.Seed = defaults.Seed
+		g.config.MaxTombstoneRatio = defaults.MaxTombstoneRatio
+	}
+
+	for i := 0; i < s.info.Count && r.err == nil; i++ {
+		g.levels[i] = int(r.u32())
+		g.deleted[i] = r.u8() == 1
+		if g.levels[i] > 64 {
+			return nil, fmt.Errorf("%w: bad node level", ErrInvalidSnapshot)
+		}
+		g.links[i] = make([][]int, g.levels[i]+1)
+		for l := range g.links[i] {
+			n := int(r.u32())
+			if n > s.info.Count {
+				return nil, fmt.Errorf("%w: bad neighbor count", ErrInvalidSnapshot)
+			}
+			g.links[i][l] = make([]int, n)
+			for j := range g.links[i][l] {
+				g.links[i][l][j] = int(r.u32())
+				if g.links[i][l][j] >= s.info.Count {
+					return nil, fmt.Errorf("%w: bad neighbor id", ErrInvalidSnapshot)
+				}
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(s.data)-4 {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidSnapshot)
+	}
+	if s.info.Count > 0 && (g.entry < 0 || g.entry >= s.info.Count) {
+		return nil, fmt.Errorf("%w: bad entry point", ErrInvalidSnapshot)
+	}
+	return g, nil
+}
+
+// Close 解除内存映射
+func (s *Snapshot) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	err := s.close()
+	s.close = nil
+	return err
+}
+
+// openCheckedSnapshot 打开快照并检查嵌入模型是否一致
+func openCheckedSnapshot(path string, spec EmbeddingSpec) (*Snapshot, error) {
+	s, err := OpenSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.check(s.info); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveSnapshot 将存储中的文档原子地保存到快照文件
+// 向量以float32存储，spec 描述生成这些向量的嵌入模型
+func (s *MemoryVectorStore) SaveSnapshot(path string, spec EmbeddingSpec) error {
+	s.mu.RLock()
+	docs := make([]Document, 0, len(s.docs))
+	for _, doc := range s.docs {
+		docs = append(docs, doc)
+	}
+	dimensions, metric := s.dimensions, s.metric
+	s.mu.RUnlock()
+
+	if spec.Dimensions > 0 && len(docs) > 0 && spec.Dimensions != dimensions {
+		return fmt.Errorf("%w: store has %d dimensions, spec declares %d", ErrDimensionMismatch, dimensions, spec.Dimensions)
+	}
+
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return writeSnapshot(path, SnapshotInfo{
+		Model:      spec.Model,
+		Dimensions: dimensions,
+		Count:      len(docs),
+		Metric:     metric,
+	}, docs, nil)
+}
+
+// LoadMemoryVectorStore 从快照加载内存向量存储
+// 快照的嵌入模型或维度与 spec 不一致时返回 ErrSnapshotMismatch
+func LoadMemoryVectorStore(path string, spec EmbeddingSpec, embed EmbeddingFuncFlot64) (*MemoryVectorStore, error) {
+	snapshot, err := openCheckedSnapshot(path, spec)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Close()
+
+	store := NewMemoryVectorStore(embed, snapshot.info.Metric)
+	if snapshot.Len() > 0 {
+		store.dimensions = snapshot.info.Dimensions
+	}
+	for i := 0; i < snapshot.Len(); i++ {
+		doc, err := snapshot.Document(i)
+		if err != nil {
+			return nil, err
+		}
+		store.docs[doc.ID] = doc
+	}
+	return store, nil
+}
+
+// SaveSnapshot 将索引中的文档和图结构原子地保存到快照文件，加载时无需重建索引
+// 已删除的节点作为墓碑一并保存，以保持图的连通性
+func (s *HNSWVectorStore) SaveSnapshot(path string, spec EmbeddingSpec) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if spec.Dimensions > 0 && len(s.nodes) > 0 && spec.Dimensions != s.dimensions {
+		return fmt.Errorf("%w: store has %d dimensions, spec declares %d", ErrDimensionMismatch, s.dimensions, spec.Dimensions)
+	}
+
+	docs := make([]Document, len(s.nodes))
+	graph := &hnswGraph{
+		config:   s.config,
+		entry:    s.entry,
+		maxLevel: s.maxLevel,
+		levels:   make([]int, len(s.nodes)),
+		deleted:  make([]bool, len(s.nodes)),
+		links:    make([][][]int, len(s.nodes)),
+	}
+	for i, node := range s.nodes {
+		node.mu.RLock()
+		docs[i] = node.doc
+		graph.levels[i] = node.level
+		graph.deleted[i] = node.deleted
+		graph.links[i] = make([][]int, len(node.neighbors))
+		for l, neighbors := range node.neighbors {
+			graph.links[i][l] = append([]int(nil), neighbors...)
+		}
+		node.mu.RUnlock()
+	}
+
+	return writeSnapshot(path, SnapshotInfo{
+		Model:      spec.Model,
+		Dimensions: s.dimensions,
+		Count:      len(docs),
+		Metric:     s.config.Metric,
+		HasGraph:   true,
+	}, docs, graph)
+}
+
+// LoadHNSWVectorStore 从快照加载HNSW向量存储，直接恢复图结构
+// 快照的嵌入模型或维度与 spec 不一致时返回 ErrSnapshotMismatch
+func LoadHNSWVectorStore(path string, spec EmbeddingSpec, embed EmbeddingFuncFlot64) (*HNSWVectorStore, error) {
+	snapshot, err := openCheckedSnapshot(path, spec)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Close()
+
+	graph, err := snapshot.graph()
+	if err != nil {
+		return nil, err
+	}
+
+	store := NewHNSWVectorStore(embed, graph.config)
+	if snapshot.Len() == 0 {
+		return store, nil
+	}
+
+	store.dimensions = snapshot.info.Dimensions
+	store.entry = graph.entry
+	store.maxLevel = graph.maxLevel
+	store.nodes = make([]*hnswNode, snapshot.Len())
+	for i := range store.nodes {
+		doc, err := snapshot.Document(i)
+		if err != nil {
+			return nil, err
+		}
+		store.nodes[i] = &hnswNode{
+			doc:       doc,
+			vector:    store.prepare(doc.Embedding),
+			level:     graph.levels[i],
+			neighbors: graph.links[i],
+			deleted:   graph.deleted[i],
+		}
+		if graph.deleted[i] {
+			store.deleted++
+		} else {
+			store.ids[doc.ID] = i
+		}
+	}
+	return store, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package llm
+
+import "os"
+
+// mapFile 在不支持mmap的平台上直接读取整个文件
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package llm
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile 以只读方式将文件映射到内存
+func mapFile(path string) ([]byte, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	if size != int64(int(size)) {
+		return nil, nil, fmt.Errorf("file %s is too large to map", path)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map file: %w", err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryVectorStoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.snap")
+	spec := EmbeddingSpec{Model: "ollama/mxbai-embed-large", Dimensions: 3}
+
+	store := NewMemoryVectorStore(keywordEmbedding, DotProductSimilarity)
+	_ = store.Upsert(ctx,
+		Document{ID: "1", Content: "cat", Metadata: map[string]interface{}{"kind": "animal"}},
+		Document{ID: "2", Content: "car", Metadata: map[string]interface{}{"kind": "vehicle", "wheels": 4}},
+	)
+	if err := store.SaveSnapshot(path, spec); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	loaded, err := LoadMemoryVectorStore(path, spec, keywordEmbedding)
+	if err != nil {
+		t.Fatalf("LoadMemoryVectorStore() error = %v", err)
+	}
+	if loaded.Len() != 2 || loaded.Dimensions() != 3 || loaded.metric != DotProductSimilarity {
+		t.Fatalf("loaded store has %d docs, %d dimensions, metric %v", loaded.Len(), loaded.Dimensions(), loaded.metric)
+	}
+
+	doc, _ := loaded.Get("2")
+	want, _ := store.Get("2")
+	want.Metadata["wheels"] = float64(4) // 元数据经过JSON编码
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("loaded document = %+v, want %+v", doc, want)
+	}
+
+	results, err := loaded.Query(ctx, "kitten", 1, nil)
+	if err != nil || results[0].ID != "1" {
+		t.Errorf("Query() on loaded store = %+v, %v", results, err)
+	}
+}
+
+func TestSnapshotMismatch(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.snap")
+
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	_ = store.Upsert(ctx, Document{ID: "1", Embedding: []float64{1, 2, 3}})
+	if err := store.SaveSnapshot(path, EmbeddingSpec{Model: "ollama/model-a", Dimensions: 4}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("SaveSnapshot() with wrong dimensions error = %v, want ErrDimensionMismatch", err)
+	}
+	if err := store.SaveSnapshot(path, EmbeddingSpec{Model: "ollama/model-a", Dimensions: 3}); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	embedder := NewLLMEmbedder(&mockService{}, "ollama", "model-a", 3)
+	if _, err := LoadMemoryVectorStore(path, embedder.Spec(), nil); err != nil {
+		t.Errorf("LoadMemoryVectorStore() with matching spec error = %v", err)
+	}
+
+	for _, spec := range []EmbeddingSpec{
+		{Model: "ollama/model-b", Dimensions: 3},
+		{Model: "ollama/model-a", Dimensions: 1024},
+	} {
+		if _, err := LoadMemoryVectorStore(path, spec, nil); !errors.Is(err, ErrSnapshotMismatch) {
+			t.Errorf("LoadMemoryVectorStore(%+v) error = %v, want ErrSnapshotMismatch", spec, err)
+		}
+	}
+
+	// 损坏的文件会被校验和拒绝
+	data, _ := os.ReadFile(path)
+	data[len(data)/2] ^= 0xff
+	_ = os.WriteFile(path, data, 0o644)
+	if _, err := OpenSnapshot(path); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("OpenSnapshot() on corrupted file error = %v, want ErrInvalidSnapshot", err)
+	}
+}
+
+func TestHNSWVectorStoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.snap")
+	spec := EmbeddingSpec{Model: "ollama/test", Dimensions: 16}
+
+	docs := randomDocuments(500, 16, 5)
+	store := NewHNSWVectorStore(nil, DefaultHNSWConfig())
+	_ = store.Upsert(ctx, docs...)
+	_ = store.Delete(ctx, docs[3].ID)
+	if err := store.SaveSnapshot(path, spec); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	// 原子写入不应留下临时文件
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("snapshot directory has %d entries, want 1", len(entries))
+	}
+
+	loaded, err := LoadHNSWVectorStore(path, spec, nil)
+	if err != nil {
+		t.Fatalf("LoadHNSWVectorStore() error = %v", err)
+	}
+	if loaded.Len() != store.Len() || loaded.Tombstones() != 1 {
+		t.Fatalf("loaded Len() = %d, Tombstones() = %d, want %d and 1", loaded.Len(), loaded.Tombstones(), store.Len())
+	}
+
+	// 向量以float32保存，得分允许微小误差
+	for _, q := range randomDocuments(20, 16, 6) {
+		want, _ := store.QueryVector(ctx, q.Embedding, 5, nil)
+		got, err := loaded.QueryVector(ctx, q.Embedding, 5, nil)
+		if err != nil {
+			t.Fatalf("QueryVector() error = %v", err)
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID || math.Abs(got[i].Score-want[i].Score) > 1e-5 {
+				t.Fatalf("loaded QueryVector()[%d] = %s (%v), want %s (%v)", i, got[i].ID, got[i].Score, want[i].ID, want[i].Score)
+			}
+		}
+	}
+
+	// 加载后的索引可以继续插入
+	if err := loaded.Upsert(ctx, randomDocuments(1, 16, 7)[0]); err != nil {
+		t.Errorf("Upsert() on loaded store error = %v", err)
+	}
+
+	if _, err := LoadHNSWVectorStore(path, EmbeddingSpec{Model: "ollama/other"}, nil); !errors.Is(err, ErrSnapshotMismatch) {
+		t.Errorf("LoadHNSWVectorStore() with other model error = %v, want ErrSnapshotMismatch", err)
+	}
+
+	memPath := filepath.Join(dir, "memory.snap")
+	_ = NewMemoryVectorStore(nil, CosineSimilarity).SaveSnapshot(memPath, spec)
+	if _, err := LoadHNSWVectorStore(memPath, spec, nil); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("LoadHNSWVectorStore() without graph error = %v, want ErrInvalidSnapshot", err)
+	}
+}
+
+func TestHNSWSnapshotConfig(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.snap")
+	spec := EmbeddingSpec{Model: "ollama/test", Dimensions: 8}
+
+	config := DefaultHNSWConfig()
+	config.M = 8
+	config.EfSearch = 32
+	config.Seed = 42
+	config.MaxTombstoneRatio = -1
+	store := NewHNSWVectorStore(nil, config)
+	_ = store.Upsert(ctx, randomDocuments(50, 8, 1)...)
+	if err := store.SaveSnapshot(path, spec); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	loaded, err := LoadHNSWVectorStore(path, spec, nil)
+	if err != nil {
+		t.Fatalf("LoadHNSWVectorStore() error = %v", err)
+	}
+	if loaded.config != store.config {
+		t.Errorf("loaded config = %+v, want %+v", loaded.config, store.config)
+	}
+
+	// 关闭自动重建的配置在加载后仍然生效
+	docs := randomDocuments(50, 8, 1)
+	for _, doc := range docs[:40] {
+		_ = loaded.Delete(ctx, doc.ID)
+	}
+	if got := loaded.Tombstones(); got != 40 {
+		t.Errorf("Tombstones() = %d, want 40 with auto-compaction disabled", got)
+	}
+}
@@ -0,0 +1,62 @@
+package textsplit
+
+// 支持的代码语言
+const (
+	LanguageGo         = "go"
+	LanguagePython     = "python"
+	LanguageJavaScript = "javascript"
+	LanguageTypeScript = "typescript"
+	LanguageJava       = "java"
+	LanguageRust       = "rust"
+)
+
+// codeSeparators 是各语言在顶层声明处的分隔符，按优先级排列
+var codeSeparators = map[string][]string{
+	LanguageGo: {
+		"\nfunc ", "\ntype ", "\nvar ", "\nconst ",
+		"\n\n", "\n\t", "\n", " ",
+	},
+	LanguagePython: {
+		"\nclass ", "\ndef ", "\nasync def ", "\n    def ", "\n    async def ",
+		"\n\n", "\n", " ",
+	},
+	LanguageJavaScript: {
+		"\nexport ", "\nfunction ", "\nclass ", "\nconst ", "\nlet ",
+		"\n\n", "\n", " ",
+	},
+	LanguageTypeScript: {
+		"\nexport ", "\ninterface ", "\ntype ", "\nfunction ", "\nclass ", "\nconst ", "\nlet ",
+		"\n\n", "\n", " ",
+	},
+	LanguageJava: {
+		"\npublic ", "\nprotected ", "\nprivate ", "\nclass ", "\ninterface ",
+		"\n    public ", "\n    protected ", "\n    private ",
+		"\n\n", "\n", " ",
+	},
+	LanguageRust: {
+		"\npub fn ", "\nfn ", "\nimpl ", "\npub struct ", "\nstruct ", "\npub enum ", "\nenum ", "\nmod ", "\ntrait ",
+		"\n\n", "\n", " ",
+	},
+}
+
+// CodeSplitter 按函数、类型等声明边界切分源代码，声明关键字保留在块的开头
+type CodeSplitter struct {
+	Language  string       // 代码语言，未知语言按行和空白切分
+	ChunkSize int          // 每块最多的token数，<=0 时使用 DefaultChunkSize
+	Overlap   int          // 相邻块重叠的token数
+	Counter   TokenCounter // token计数器，为空时按字符计数
+}
+
+// Split 实现 Splitter 接口
+func (s CodeSplitter) Split(text string) []Chunk {
+	separators, ok := codeSeparators[s.Language]
+	if !ok {
+		separators = []string{"\n\n", "\n", " "}
+	}
+	return RecursiveSplitter{
+		ChunkSize:  s.ChunkSize,
+		Overlap:    s.Overlap,
+		Separators: separators,
+		Counter:    s.Counter,
+	}.Split(text)
+}
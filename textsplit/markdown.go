@@ -0,0 +1,93 @@
+package textsplit
+
+import (
+	"regexp"
+	"strings"
+)
+
+// headingPattern 匹配ATX风格的Markdown标题行
+var headingPattern = regexp.MustCompile(`^(#{1,6})[ \t]+(.+?)[ \t#]*$`)
+
+// markdownSeparators 是Markdown章节内部的分隔符
+var markdownSeparators = append([]string{"\n```", "\n\n", "\n"}, DefaultSeparators[2:]...)
+
+// MarkdownSplitter 按标题切分Markdown，块不会跨越章节，每个块记录其所在的标题路径
+type MarkdownSplitter struct {
+	ChunkSize int          // 每块最多的token数，<=0 时使用 DefaultChunkSize
+	Overlap   int          // 同一章节内相邻块重叠的token数
+	Counter   TokenCounter // token计数器，为空时按字符计数
+}
+
+// section 表示一个Markdown章节
+type section struct {
+	start, end int
+	headings   []string
+}
+
+// Split 实现 Splitter 接口
+func (s MarkdownSplitter) Split(text string) []Chunk {
+	size := chunkSize(s.ChunkSize)
+	var chunks []Chunk
+	for _, sec := range markdownSections(text) {
+		for _, chunk := range recursiveChunks(text, sec.start, sec.end, markdownSeparators, size, s.Overlap, s.Counter) {
+			chunk.Headings = sec.headings
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// markdownSections 按标题将文本划分为章节，忽略代码块中的 # 行
+func markdownSections(text string) []section {
+	var sections []section
+	var path []string
+	current := section{start: 0}
+	inFence := false
+
+	for pos := 0; pos < len(text); {
+		lineEnd := strings.IndexByte(text[pos:], '\n')
+		next := len(text)
+		if lineEnd >= 0 {
+			next = pos + lineEnd + 1
+		}
+		line := strings.TrimRight(text[pos:next], "\r\n")
+
+		if strings.HasPrefix(strings.TrimSpace(line), "```") || strings.HasPrefix(strings.TrimSpace(line), "~~~") {
+			inFence = !inFence
+		} else if m := headingPattern.FindStringSubmatch(line); m != nil && !inFence {
+			if pos > current.start {
+				current.end = pos
+				sections = append(sections, current)
+			}
+
+			level := len(m[1])
+			if len(path) >= level {
+				path = path[:level-1]
+			}
+			for len(path) < level-1 {
+				path = append(path, "")
+			}
+			path = append(path, m[2])
+
+			current = section{start: pos, headings: compactHeadings(path)}
+		}
+		pos = next
+	}
+
+	if current.start < len(text) {
+		current.end = len(text)
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// compactHeadings 复制标题路径并去掉跳级产生的空标题
+func compactHeadings(path []string) []string {
+	headings := make([]string, 0, len(path))
+	for _, h := range path {
+		if h != "" {
+			headings = append(headings, h)
+		}
+	}
+	return headings
+}
@@ -0,0 +1,161 @@
+package textsplit
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wordPattern 匹配一个词及其后的空白；CJK字符单独成词
+var wordPattern = regexp.MustCompile(`[\p{Han}\p{Hiragana}\p{Katakana}\p{Hangul}]\s*|[^\s\p{Han}\p{Hiragana}\p{Katakana}\p{Hangul}]+\s*|\s+`)
+
+// sentencePattern 匹配以句末标点结尾的句子及其后的空白
+var sentencePattern = regexp.MustCompile(`[^.!?。！？]*(?:[.!?]+["'”’)\]]*(?:\s+|$)|[。！？]+["'”’)\]]*\s*)`)
+
+// TokenSplitter 按固定token数切分，相邻块之间有重叠
+type TokenSplitter struct {
+	ChunkSize int          // 每块最多的token数，<=0 时使用 DefaultChunkSize
+	Overlap   int          // 相邻块重叠的token数
+	Counter   TokenCounter // token计数器，为空时按字符计数
+}
+
+// Split 实现 Splitter 接口
+func (s TokenSplitter) Split(text string) []Chunk {
+	size := chunkSize(s.ChunkSize)
+	return merge(text, wordSpans(text, 0, len(text), size, s.Counter), size, s.Overlap, s.Counter)
+}
+
+// wordSpans 将区间切分为词，超过 size 的单个词再按字符切分
+func wordSpans(text string, start, end, size int, counter TokenCounter) []span {
+	var spans []span
+	for _, loc := range wordPattern.FindAllStringIndex(text[start:end], -1) {
+		sp := newSpan(text, start+loc[0], start+loc[1], counter)
+		if sp.tokens > size {
+			spans = append(spans, runeSpans(text, sp.start, sp.end, counter)...)
+		} else {
+			spans = append(spans, sp)
+		}
+	}
+	return spans
+}
+
+// RecursiveSplitter 依次尝试分隔符递归切分：
+// 先按段落切分，块仍然过大时再按行、句子、词切分，最后按字符切分
+type RecursiveSplitter struct {
+	ChunkSize  int          // 每块最多的token数，<=0 时使用 DefaultChunkSize
+	Overlap    int          // 相邻块重叠的token数
+	Separators []string     // 按优先级排列的分隔符，为空时使用 DefaultSeparators
+	Counter    TokenCounter // token计数器，为空时按字符计数
+}
+
+// DefaultSeparators 是 RecursiveSplitter 的默认分隔符
+var DefaultSeparators = []string{"\n\n", "\n", "。", "！", "？", ". ", "! ", "? ", "；", "; ", "，", ", ", " "}
+
+// Split 实现 Splitter 接口
+func (s RecursiveSplitter) Split(text string) []Chunk {
+	separators := s.Separators
+	if len(separators) == 0 {
+		separators = DefaultSeparators
+	}
+	return recursiveChunks(text, 0, len(text), separators, chunkSize(s.ChunkSize), s.Overlap, s.Counter)
+}
+
+// recursiveChunks 使用第一个出现的分隔符切分区间：相邻的小片段合并为块，
+// 过大的片段用后续分隔符继续切分，因此块尽量在较高层级的分隔符处断开
+func recursiveChunks(text string, start, end int, separators []string, size, overlap int, counter TokenCounter) []Chunk {
+	whole := newSpan(text, start, end, counter)
+	if whole.tokens <= size {
+		return merge(text, []span{whole}, size, overlap, counter)
+	}
+
+	for i, sep := range separators {
+		if sep == "" || !strings.Contains(text[start:end], sep) {
+			continue
+		}
+
+		var chunks []Chunk
+		var small []span
+		for _, piece := range splitKeep(text, start, end, sep) {
+			sp := newSpan(text, piece[0], piece[1], counter)
+			if sp.tokens <= size {
+				small = append(small, sp)
+				continue
+			}
+			chunks = append(chunks, merge(text, small, size, overlap, counter)...)
+			small = nil
+			chunks = append(chunks, recursiveChunks(text, sp.start, sp.end, separators[i+1:], size, overlap, counter)...)
+		}
+		return append(chunks, merge(text, small, size, overlap, counter)...)
+	}
+
+	return merge(text, runeSpans(text, start, end, counter), size, overlap, counter)
+}
+
+// splitKeep 按分隔符切分区间而不丢弃任何字符
+// 以换行开头的关键字分隔符（如 "\nfunc "）归入下一段，其他分隔符归入上一段
+func splitKeep(text string, start, end int, sep string) [][2]int {
+	cut := len(sep)
+	if rest := strings.TrimLeft(sep, "\n"); rest != sep && strings.TrimSpace(rest) != "" {
+		cut = len(sep) - len(rest)
+	}
+
+	var pieces [][2]int
+	pieceStart := start
+	for pos := start; pos < end; {
+		idx := strings.Index(text[pos:end], sep)
+		if idx < 0 {
+			break
+		}
+		boundary := pos + idx + cut
+		if boundary > pieceStart {
+			pieces = append(pieces, [2]int{pieceStart, boundary})
+			pieceStart = boundary
+		}
+		pos += idx + len(sep)
+	}
+	if pieceStart < end {
+		pieces = append(pieces, [2]int{pieceStart, end})
+	}
+	return pieces
+}
+
+// SentenceSplitter 按句子边界切分，不会在句子中间断开，除非单个句子超过块大小
+type SentenceSplitter struct {
+	ChunkSize int          // 每块最多的token数，<=0 时使用 DefaultChunkSize
+	Overlap   int          // 相邻块重叠的token数
+	Counter   TokenCounter // token计数器，为空时按字符计数
+}
+
+// Split 实现 Splitter 接口
+func (s SentenceSplitter) Split(text string) []Chunk {
+	size := chunkSize(s.ChunkSize)
+	return merge(text, sentenceSpans(text, 0, len(text), size, s.Counter), size, s.Overlap, s.Counter)
+}
+
+// sentenceSpans 将区间切分为句子，超过 size 的句子再按词切分
+func sentenceSpans(text string, start, end, size int, counter TokenCounter) []span {
+	var spans []span
+	add := func(from, to int) {
+		sp := newSpan(text, from, to, counter)
+		if sp.tokens > size {
+			spans = append(spans, wordSpans(text, from, to, size, counter)...)
+		} else {
+			spans = append(spans, sp)
+		}
+	}
+
+	last := start
+	for _, loc := range sentencePattern.FindAllStringIndex(text[start:end], -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		if start+loc[0] > last {
+			add(last, start+loc[0])
+		}
+		add(start+loc[0], start+loc[1])
+		last = start + loc[1]
+	}
+	if last < end {
+		add(last, end)
+	}
+	return spans
+}
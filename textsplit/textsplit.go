@@ -0,0 +1,109 @@
+// Package textsplit 将长文本切分为适合嵌入模型的块，每个块记录其在原文中的偏移
+package textsplit
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenCounter 计算一段文本的token数，可以直接使用 llm.ApproxTokenCounter
+type TokenCounter func(text string) int
+
+// Chunk 表示切分后的一个文本块
+type Chunk struct {
+	Text     string   `json:"text"`
+	Start    int      `json:"start"` // 在原文中的起始字节偏移
+	End      int      `json:"end"`   // 在原文中的结束字节偏移（不含）
+	Tokens   int      `json:"tokens"`
+	Headings []string `json:"headings,omitempty"` // Markdown切分时块所在的标题路径
+}
+
+// Splitter 表示文本切分器
+type Splitter interface {
+	Split(text string) []Chunk
+}
+
+// Contents 返回块的文本，可直接传给 LLMEmbedder.BatchEmbed
+func Contents(chunks []Chunk) []interface{} {
+	contents := make([]interface{}, len(chunks))
+	for i, c := range chunks {
+		contents[i] = c.Text
+	}
+	return contents
+}
+
+// DefaultChunkSize 是未设置块大小时使用的默认值
+const DefaultChunkSize = 512
+
+// chunkSize 返回有效的块大小
+func chunkSize(size int) int {
+	if size <= 0 {
+		return DefaultChunkSize
+	}
+	return size
+}
+
+// countTokens 计数，counter 为空时按字符计数
+func countTokens(counter TokenCounter, text string) int {
+	if counter == nil {
+		return utf8.RuneCountInString(text)
+	}
+	return counter(text)
+}
+
+// span 表示原文中的一段区间及其token数
+type span struct {
+	start, end int
+	tokens     int
+}
+
+// merge 将相邻的区间合并为不超过 size 个token的块，相邻块之间重叠不超过 overlap 个token
+// 区间的token数按相加估算，最终块的token数使用计数器重新计算
+func merge(text string, spans []span, size, overlap int, counter TokenCounter) []Chunk {
+	var chunks []Chunk
+	for i := 0; i < len(spans); {
+		j, total := i, 0
+		for j < len(spans) && (j == i || total+spans[j].tokens <= size) {
+			total += spans[j].tokens
+			j++
+		}
+
+		chunk := text[spans[i].start:spans[j-1].end]
+		if strings.TrimSpace(chunk) != "" {
+			chunks = append(chunks, Chunk{
+				Text:   chunk,
+				Start:  spans[i].start,
+				End:    spans[j-1].end,
+				Tokens: countTokens(counter, chunk),
+			})
+		}
+		if j == len(spans) {
+			break
+		}
+
+		// 从当前块末尾回退以形成重叠，同时保证至少前进一个区间
+		next, carried := j, 0
+		for next-1 > i && carried+spans[next-1].tokens <= overlap {
+			next--
+			carried += spans[next].tokens
+		}
+		i = next
+	}
+	return chunks
+}
+
+// newSpan 创建区间并计算token数
+func newSpan(text string, start, end int, counter TokenCounter) span {
+	return span{start: start, end: end, tokens: countTokens(counter, text[start:end])}
+}
+
+// runeSpans 将区间按字符切分
+func runeSpans(text string, start, end int, counter TokenCounter) []span {
+	var spans []span
+	for i := start; i < end; {
+		_, size := utf8.DecodeRuneInString(text[i:end])
+		spans = append(spans, newSpan(text, i, i+size, counter))
+		i += size
+	}
+	return spans
+}
@@ -0,0 +1,142 @@
+package textsplit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wordCounter 按空格分词计数
+func wordCounter(text string) int {
+	return len(strings.Fields(text))
+}
+
+// checkOffsets 检查每个块的文本与其在原文中的偏移一致
+func checkOffsets(t *testing.T, text string, chunks []Chunk) {
+	t.Helper()
+	for i, c := range chunks {
+		if text[c.Start:c.End] != c.Text {
+			t.Errorf("chunk %d text %q does not match offsets [%d:%d] %q", i, c.Text, c.Start, c.End, text[c.Start:c.End])
+		}
+	}
+}
+
+func TestTokenSplitter(t *testing.T) {
+	text := "one two three four five six seven eight nine ten"
+	chunks := TokenSplitter{ChunkSize: 4, Overlap: 1, Counter: wordCounter}.Split(text)
+	checkOffsets(t, text, chunks)
+
+	var got []string
+	for _, c := range chunks {
+		got = append(got, strings.TrimSpace(c.Text))
+		if c.Tokens > 4 {
+			t.Errorf("chunk %q has %d tokens, want <= 4", c.Text, c.Tokens)
+		}
+	}
+	want := []string{"one two three four", "four five six seven", "seven eight nine ten"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Split() = %q, want %q", got, want)
+	}
+
+	// CJK文本按字符计数，超过块大小的长词按字符切分
+	cjk := "向量数据库支持相似度搜索"
+	chunks = TokenSplitter{ChunkSize: 5}.Split(cjk)
+	checkOffsets(t, cjk, chunks)
+	if len(chunks) != 3 || chunks[0].Text != "向量数据库" {
+		t.Errorf("Split() CJK = %+v", chunks)
+	}
+}
+
+func TestRecursiveSplitter(t *testing.T) {
+	text := "First paragraph has five words.\n\nSecond paragraph is a bit longer than the first one.\n\nThird."
+	chunks := RecursiveSplitter{ChunkSize: 6, Counter: wordCounter}.Split(text)
+	checkOffsets(t, text, chunks)
+
+	if len(chunks) < 3 {
+		t.Fatalf("Split() returned %d chunks, want at least 3", len(chunks))
+	}
+	if strings.TrimSpace(chunks[0].Text) != "First paragraph has five words." {
+		t.Errorf("first chunk = %q, want first paragraph", chunks[0].Text)
+	}
+	for _, c := range chunks {
+		if c.Tokens > 6 {
+			t.Errorf("chunk %q has %d tokens, want <= 6", c.Text, c.Tokens)
+		}
+	}
+
+	// 没有重叠时所有块拼接起来覆盖原文（只含空白的块会被丢弃）
+	var covered strings.Builder
+	for _, c := range chunks {
+		covered.WriteString(c.Text)
+	}
+	if strings.Join(strings.Fields(covered.String()), " ") != strings.Join(strings.Fields(text), " ") {
+		t.Errorf("chunks without overlap do not cover the text: %q", covered.String())
+	}
+}
+
+func TestSentenceSplitter(t *testing.T) {
+	text := "The cat sat. The dog ran away! Did it come back? 它回来了。然后睡觉了。"
+	chunks := SentenceSplitter{ChunkSize: 6, Counter: wordCounter}.Split(text)
+	checkOffsets(t, text, chunks)
+
+	for _, c := range chunks {
+		trimmed := strings.TrimSpace(c.Text)
+		last, _ := lastRune(trimmed)
+		if !strings.ContainsRune(".!?。", last) {
+			t.Errorf("chunk %q does not end at a sentence boundary", c.Text)
+		}
+	}
+
+	chunks = SentenceSplitter{ChunkSize: 8, Overlap: 4, Counter: wordCounter}.Split(text)
+	if len(chunks) < 2 || !strings.HasPrefix(chunks[1].Text, "The dog") {
+		t.Errorf("Split() with sentence overlap = %+v", chunks)
+	}
+}
+
+func lastRune(s string) (rune, int) {
+	r := []rune(s)
+	if len(r) == 0 {
+		return 0, 0
+	}
+	return r[len(r)-1], 1
+}
+
+func TestMarkdownSplitter(t *testing.T) {
+	text := "Intro text.\n\n# Guide\n\nWelcome.\n\n## Install\n\nRun go get.\n\n```sh\n# not a heading\n```\n\n## Usage\n\nCall the API.\n\n# FAQ\n\nNone yet.\n"
+	chunks := MarkdownSplitter{ChunkSize: 100, Counter: wordCounter}.Split(text)
+	checkOffsets(t, text, chunks)
+
+	var headings [][]string
+	for _, c := range chunks {
+		headings = append(headings, c.Headings)
+	}
+	want := [][]string{
+		nil,
+		{"Guide"},
+		{"Guide", "Install"},
+		{"Guide", "Usage"},
+		{"FAQ"},
+	}
+	if !reflect.DeepEqual(headings, want) {
+		t.Errorf("Split() headings = %q, want %q", headings, want)
+	}
+	if !strings.Contains(chunks[2].Text, "# not a heading") {
+		t.Errorf("fenced code block split as heading: %q", chunks[2].Text)
+	}
+}
+
+func TestCodeSplitter(t *testing.T) {
+	text := "package main\n\nimport \"fmt\"\n\nfunc a() {\n\tfmt.Println(1)\n}\n\nfunc b() {\n\tfmt.Println(2)\n}\n"
+	chunks := CodeSplitter{Language: LanguageGo, ChunkSize: 6, Counter: wordCounter}.Split(text)
+	checkOffsets(t, text, chunks)
+
+	var funcs int
+	for _, c := range chunks {
+		if strings.HasPrefix(c.Text, "func ") {
+			funcs++
+		}
+	}
+	if funcs != 2 {
+		t.Errorf("Split() = %q, want each function to start a chunk", Contents(chunks))
+	}
+}
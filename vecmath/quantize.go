@@ -0,0 +1,191 @@
+package vecmath
+
+import (
+	"container/heap"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Int8Vector 是对称量化到 int8 的向量，原始值约等于 Values[i] * Scale
+type Int8Vector struct {
+	Values []int8
+	Scale  float64
+}
+
+// QuantizeInt8 将向量量化为 int8，按绝对值最大的元素确定缩放系数
+func QuantizeInt8[T Float](v []T) Int8Vector {
+	var maxAbs float64
+	for _, x := range v {
+		maxAbs = max(maxAbs, math.Abs(float64(x)))
+	}
+
+	q := Int8Vector{Values: make([]int8, len(v))}
+	if maxAbs == 0 {
+		return q
+	}
+	q.Scale = maxAbs / 127
+	for i, x := range v {
+		q.Values[i] = int8(math.Round(float64(x) / q.Scale))
+	}
+	return q
+}
+
+// Dequantize 还原为 float64 向量
+func (q Int8Vector) Dequantize() []float64 {
+	v := make([]float64, len(q.Values))
+	for i, x := range q.Values {
+		v[i] = float64(x) * q.Scale
+	}
+	return v
+}
+
+// DotInt8 使用整数运算计算两个量化向量的近似点积，长度不同时 panic
+func DotInt8(a, b Int8Vector) float64 {
+	checkLength(len(a.Values), len(b.Values))
+	n := len(a.Values)
+	var sum int64
+	for i := 0; i < n; i++ {
+		sum += int64(a.Values[i]) * int64(b.Values[i])
+	}
+	return float64(sum) * a.Scale * b.Scale
+}
+
+// ScoreInt8 计算全精度查询向量与量化向量的点积，用于重新打分，长度不同时 panic
+func ScoreInt8[T Float](query []T, v Int8Vector) float64 {
+	checkLength(len(query), len(v.Values))
+	n := len(query)
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += float64(query[i]) * float64(v.Values[i])
+	}
+	return sum * v.Scale
+}
+
+// BinaryVector 是按符号量化的二值向量，每一维占一位，正数为 1
+type BinaryVector struct {
+	Bits []uint64
+	Dims int
+}
+
+// QuantizeBinary 将向量按符号量化为二值向量
+func QuantizeBinary[T Float](v []T) BinaryVector {
+	q := BinaryVector{Bits: make([]uint64, (len(v)+63)/64), Dims: len(v)}
+	for i, x := range v {
+		if x > 0 {
+			q.Bits[i/64] |= 1 << (i % 64)
+		}
+	}
+	return q
+}
+
+// Hamming 计算两个二值向量的汉明距离，维度不同时 panic
+func Hamming(a, b BinaryVector) int {
+	checkLength(a.Dims, b.Dims)
+	n := min(len(a.Bits), len(b.Bits))
+	distance := 0
+	for i := 0; i < n; i++ {
+		distance += bits.OnesCount64(a.Bits[i] ^ b.Bits[i])
+	}
+	return distance
+}
+
+// ScoreBinary 计算全精度查询向量与二值向量（按 ±1 展开）的点积，用于重新打分，维度不同时 panic
+func ScoreBinary[T Float](query []T, v BinaryVector) float64 {
+	checkLength(len(query), v.Dims)
+	n := len(query)
+	var sum float64
+	for i := 0; i < n; i++ {
+		if v.Bits[i/64]&(1<<(i%64)) != 0 {
+			sum += float64(query[i])
+		} else {
+			sum -= float64(query[i])
+		}
+	}
+	return sum
+}
+
+// Candidate 是量化检索的一条候选结果
+type Candidate struct {
+	Index int     // 在向量列表中的下标
+	Score float64 // 得分，越大越相似
+}
+
+// SearchInt8 在量化向量中检索与查询点积最大的 k 个向量
+func SearchInt8(query Int8Vector, vectors []Int8Vector, k int) []Candidate {
+	top := newTopCandidates(k)
+	for i, v := range vectors {
+		top.push(Candidate{Index: i, Score: DotInt8(query, v)})
+	}
+	return top.sorted()
+}
+
+// SearchBinary 在二值向量中检索汉明距离最小的 k 个向量，得分为 Dims-2*Hamming
+func SearchBinary(query BinaryVector, vectors []BinaryVector, k int) []Candidate {
+	top := newTopCandidates(k)
+	for i, v := range vectors {
+		top.push(Candidate{Index: i, Score: float64(query.Dims - 2*Hamming(query, v))})
+	}
+	return top.sorted()
+}
+
+// Rescore 使用更精确的打分函数对量化检索的候选重新打分，返回得分最高的 k 个
+// 通常先用量化向量检索 k 的数倍候选，再用全精度向量或 ScoreInt8/ScoreBinary 重新打分
+func Rescore(candidates []Candidate, k int, score func(index int) float64) []Candidate {
+	top := newTopCandidates(k)
+	for _, c := range candidates {
+		top.push(Candidate{Index: c.Index, Score: score(c.Index)})
+	}
+	return top.sorted()
+}
+
+// candidateHeap 是按得分排序的最小堆
+type candidateHeap []Candidate
+
+func (h candidateHeap) Len() int            { return len(h) }
+func (h candidateHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h candidateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidateHeap) Push(x interface{}) { *h = append(*h, x.(Candidate)) }
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// topCandidates 维护得分最高的 k 个候选
+type topCandidates struct {
+	k int
+	h candidateHeap
+}
+
+// newTopCandidates 创建一个新的 top-k 集合
+func newTopCandidates(k int) *topCandidates {
+	return &topCandidates{k: k}
+}
+
+// push 加入一个候选
+func (t *topCandidates) push(c Candidate) {
+	if t.k <= 0 {
+		return
+	}
+	if len(t.h) < t.k {
+		heap.Push(&t.h, c)
+	} else if c.Score > t.h[0].Score {
+		t.h[0] = c
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// sorted 返回按得分从高到低排序的候选，得分相同时按下标升序
+func (t *topCandidates) sorted() []Candidate {
+	result := append([]Candidate(nil), t.h...)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Index < result[j].Index
+	})
+	return result
+}
@@ -0,0 +1,150 @@
+// Package vecmath 提供嵌入向量的常用运算：归一化、相似度、精度转换、量化和维度截断
+// 函数同时支持 float32 和 float64 向量，内部统一使用 float64 累加
+package vecmath
+
+import (
+	"fmt"
+	"math"
+)
+
+// Float 是支持的向量元素类型
+type Float interface {
+	~float32 | ~float64
+}
+
+// checkLength 在两个向量长度不同时 panic，维度不一致通常说明混用了不同模型的嵌入，静默截断会得到错误的结果
+func checkLength(a, b int) {
+	if a != b {
+		panic(fmt.Sprintf("vecmath: vector length mismatch: %d != %d", a, b))
+	}
+}
+
+// Dot 计算两个向量的点积，长度不同时 panic
+func Dot[T Float](a, b []T) float64 {
+	checkLength(len(a), len(b))
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// Norm 计算向量的 L2 范数
+func Norm[T Float](v []T) float64 {
+	return math.Sqrt(Dot(v, v))
+}
+
+// Normalize 返回 L2 归一化后的新向量，零向量返回全零向量
+func Normalize[T Float](v []T) []T {
+	out := make([]T, len(v))
+	copy(out, v)
+	NormalizeInPlace(out)
+	return out
+}
+
+// NormalizeInPlace 原地将向量 L2 归一化，零向量保持不变
+func NormalizeInPlace[T Float](v []T) {
+	norm := Norm(v)
+	if norm == 0 {
+		return
+	}
+	for i := range v {
+		v[i] = T(float64(v[i]) / norm)
+	}
+}
+
+// Cosine 计算余弦相似度，任一向量为零向量时返回 0，长度不同时 panic
+func Cosine[T Float](a, b []T) float64 {
+	checkLength(len(a), len(b))
+	na, nb := Norm(a), Norm(b)
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return Dot(a, b) / (na * nb)
+}
+
+// Euclidean 计算欧氏距离，长度不同时 panic
+func Euclidean[T Float](a, b []T) float64 {
+	checkLength(len(a), len(b))
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// SimilarityMatrix 计算 a 中每个向量与 b 中每个向量的相似度，结果为 len(a) 行 len(b) 列
+func SimilarityMatrix[T Float](a, b [][]T, similarity func(x, y []T) float64) [][]float64 {
+	data := make([]float64, len(a)*len(b))
+	matrix := make([][]float64, len(a))
+	for i, x := range a {
+		row := data[i*len(b) : (i+1)*len(b) : (i+1)*len(b)]
+		for j, y := range b {
+			row[j] = similarity(x, y)
+		}
+		matrix[i] = row
+	}
+	return matrix
+}
+
+// CosineMatrix 计算余弦相似度矩阵，每个向量只计算一次范数
+func CosineMatrix[T Float](a, b [][]T) [][]float64 {
+	normsA := norms(a)
+	normsB := norms(b)
+	matrix := SimilarityMatrix(a, b, Dot[T])
+	for i, row := range matrix {
+		for j := range row {
+			if normsA[i] == 0 || normsB[j] == 0 {
+				row[j] = 0
+			} else {
+				row[j] /= normsA[i] * normsB[j]
+			}
+		}
+	}
+	return matrix
+}
+
+// norms 计算每个向量的范数
+func norms[T Float](vectors [][]T) []float64 {
+	result := make([]float64, len(vectors))
+	for i, v := range vectors {
+		result[i] = Norm(v)
+	}
+	return result
+}
+
+// ToFloat32 将 src 转换为 float32 写入 dst 并返回，dst 容量足够时不分配内存
+func ToFloat32(dst []float32, src []float64) []float32 {
+	dst = grow(dst, len(src))
+	for i, v := range src {
+		dst[i] = float32(v)
+	}
+	return dst
+}
+
+// ToFloat64 将 src 转换为 float64 写入 dst 并返回，dst 容量足够时不分配内存
+func ToFloat64(dst []float64, src []float32) []float64 {
+	dst = grow(dst, len(src))
+	for i, v := range src {
+		dst[i] = float64(v)
+	}
+	return dst
+}
+
+// grow 返回长度为 n 的切片，容量不足时重新分配
+func grow[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
+
+// Truncate 按 Matryoshka 表示学习的方式截取前 dims 维并重新归一化，返回新向量
+// dims 大于向量长度或小于等于 0 时保留全部维度
+func Truncate[T Float](v []T, dims int) []T {
+	if dims <= 0 || dims > len(v) {
+		dims = len(v)
+	}
+	return Normalize(v[:dims])
+}
@@ -0,0 +1,210 @@
+package vecmath
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// almostEqual 判断两个浮点数是否在误差范围内相等
+func almostEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// randomVectors 生成确定性的随机向量
+func randomVectors(n, dims int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		vectors[i] = make([]float64, dims)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.NormFloat64()
+		}
+	}
+	return vectors
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(a, b []float64) float64
+		a, b []float64
+		want float64
+	}{
+		{"dot", Dot[float64], []float64{1, 2, 3}, []float64{4, 5, 6}, 32},
+		{"cosine parallel", Cosine[float64], []float64{1, 2}, []float64{2, 4}, 1},
+		{"cosine orthogonal", Cosine[float64], []float64{1, 0}, []float64{0, 3}, 0},
+		{"cosine zero vector", Cosine[float64], []float64{0, 0}, []float64{1, 1}, 0},
+		{"euclidean", Euclidean[float64], []float64{0, 0}, []float64{3, 4}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.a, tt.b); !almostEqual(got, tt.want, 1e-12) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := Cosine([]float32{1, 2}, []float32{2, 4}); !almostEqual(got, 1, 1e-6) {
+		t.Errorf("Cosine(float32) = %v, want 1", got)
+	}
+}
+
+func TestLengthMismatchPanics(t *testing.T) {
+	a, b := []float64{1, 2, 3}, []float64{1, 2}
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"dot", func() { Dot(a, b) }},
+		{"cosine", func() { Cosine(a, b) }},
+		{"cosine zero vector", func() { Cosine([]float64{0, 0, 0}, b) }},
+		{"euclidean", func() { Euclidean(a, b) }},
+		{"int8", func() { DotInt8(QuantizeInt8(a), QuantizeInt8(b)) }},
+		{"score int8", func() { ScoreInt8(a, QuantizeInt8(b)) }},
+		{"hamming", func() { Hamming(QuantizeBinary(a), QuantizeBinary(b)) }},
+		{"score binary", func() { ScoreBinary(a, QuantizeBinary(b)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic on length mismatch")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
+
+func TestNormalizeAndTruncate(t *testing.T) {
+	v := []float64{3, 4}
+	normalized := Normalize(v)
+	if !reflect.DeepEqual(normalized, []float64{0.6, 0.8}) {
+		t.Errorf("Normalize() = %v, want [0.6 0.8]", normalized)
+	}
+	if !reflect.DeepEqual(v, []float64{3, 4}) {
+		t.Errorf("Normalize() modified its input: %v", v)
+	}
+	if got := Normalize([]float64{0, 0}); !reflect.DeepEqual(got, []float64{0, 0}) {
+		t.Errorf("Normalize(zero) = %v, want [0 0]", got)
+	}
+
+	truncated := Truncate([]float32{3, 4, 100}, 2)
+	if len(truncated) != 2 || !almostEqual(Norm(truncated), 1, 1e-6) {
+		t.Errorf("Truncate() = %v, want 2 unit-length dimensions", truncated)
+	}
+	if got := Truncate([]float64{2}, 5); !reflect.DeepEqual(got, []float64{1}) {
+		t.Errorf("Truncate() beyond length = %v, want [1]", got)
+	}
+}
+
+func TestCosineMatrix(t *testing.T) {
+	a := randomVectors(3, 8, 1)
+	b := randomVectors(4, 8, 2)
+
+	matrix := CosineMatrix(a, b)
+	if len(matrix) != 3 || len(matrix[0]) != 4 {
+		t.Fatalf("CosineMatrix() has shape %dx%d, want 3x4", len(matrix), len(matrix[0]))
+	}
+	for i := range a {
+		for j := range b {
+			if want := Cosine(a[i], b[j]); !almostEqual(matrix[i][j], want, 1e-12) {
+				t.Errorf("CosineMatrix()[%d][%d] = %v, want %v", i, j, matrix[i][j], want)
+			}
+		}
+	}
+}
+
+func TestConversionWithoutAllocation(t *testing.T) {
+	src := []float64{1.5, -2.25, 3}
+	buf32 := make([]float32, 0, len(src))
+	buf64 := make([]float64, 0, len(src))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf32 = ToFloat32(buf32, src)
+		buf64 = ToFloat64(buf64, buf32)
+	})
+	if allocs != 0 {
+		t.Errorf("conversion allocated %v times per run, want 0", allocs)
+	}
+	if !reflect.DeepEqual(buf64, src) {
+		t.Errorf("round trip = %v, want %v", buf64, src)
+	}
+}
+
+func TestQuantizeInt8(t *testing.T) {
+	v := []float64{0.5, -1, 0.25, 0}
+	q := QuantizeInt8(v)
+	if q.Values[1] != -127 {
+		t.Errorf("QuantizeInt8() max value = %d, want -127", q.Values[1])
+	}
+	for i, x := range q.Dequantize() {
+		if !almostEqual(x, v[i], q.Scale/2) {
+			t.Errorf("Dequantize()[%d] = %v, want %v", i, x, v[i])
+		}
+	}
+	if got := DotInt8(q, q); !almostEqual(got, Dot(v, v), 0.01) {
+		t.Errorf("DotInt8() = %v, want about %v", got, Dot(v, v))
+	}
+	if got := ScoreInt8(v, q); !almostEqual(got, Dot(v, v), 0.01) {
+		t.Errorf("ScoreInt8() = %v, want about %v", got, Dot(v, v))
+	}
+}
+
+func TestQuantizeBinary(t *testing.T) {
+	a := QuantizeBinary([]float64{1, -1, 2, -3})
+	b := QuantizeBinary([]float64{1, 1, -2, -3})
+	if got := Hamming(a, b); got != 2 {
+		t.Errorf("Hamming() = %d, want 2", got)
+	}
+	if got := ScoreBinary([]float64{0.5, 0.25, 1, 2}, a); got != 0.5-0.25+1-2 {
+		t.Errorf("ScoreBinary() = %v, want %v", got, 0.5-0.25+1-2)
+	}
+}
+
+func TestQuantizedSearchWithRescoring(t *testing.T) {
+	const k = 10
+	vectors := randomVectors(2000, 128, 3)
+	queries := randomVectors(20, 128, 4)
+
+	int8s := make([]Int8Vector, len(vectors))
+	binaries := make([]BinaryVector, len(vectors))
+	for i, v := range vectors {
+		int8s[i] = QuantizeInt8(v)
+		binaries[i] = QuantizeBinary(v)
+	}
+
+	recall := func(name string, search func(query []float64) []Candidate, want float64) {
+		var hits int
+		for _, query := range queries {
+			exact := make(map[int]bool)
+			all := make([]Candidate, len(vectors))
+			for i, v := range vectors {
+				all[i] = Candidate{Index: i, Score: Dot(query, v)}
+			}
+			for _, c := range Rescore(all, k, func(i int) float64 { return Dot(query, vectors[i]) }) {
+				exact[c.Index] = true
+			}
+			for _, c := range search(query) {
+				if exact[c.Index] {
+					hits++
+				}
+			}
+		}
+		if got := float64(hits) / float64(k*len(queries)); got < want {
+			t.Errorf("%s recall@%d = %.2f, want at least %.2f", name, k, got, want)
+		}
+	}
+
+	recall("int8", func(query []float64) []Candidate {
+		return SearchInt8(QuantizeInt8(query), int8s, k)
+	}, 0.9)
+	recall("binary with rescoring", func(query []float64) []Candidate {
+		candidates := SearchBinary(QuantizeBinary(query), binaries, 50*k)
+		return Rescore(candidates, k, func(i int) float64 { return Dot(query, vectors[i]) })
+	}, 0.9)
+}
@@ -0,0 +1,368 @@
+package llm
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/hewenyu/llm/vecmath"
+)
+
+// 定义向量存储错误
+var (
+	ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+	ErrNoEmbedder        = errors.New("vector store has no embedding function")
+)
+
+// SimilarityMetric 表示向量相似度的计算方式
+type SimilarityMetric int
+
+const (
+	// CosineSimilarity 余弦相似度
+	CosineSimilarity SimilarityMetric = iota
+	// DotProductSimilarity 点积
+	DotProductSimilarity
+	// EuclideanSimilarity 欧氏距离，得分为距离的相反数，越大越相似
+	EuclideanSimilarity
+)
+
+// String 返回相似度名称
+func (m SimilarityMetric) String() string {
+	switch m {
+	case CosineSimilarity:
+		return "cosine"
+	case DotProductSimilarity:
+		return "dot"
+	case EuclideanSimilarity:
+		return "l2"
+	default:
+		return fmt.Sprintf("SimilarityMetric(%d)", int(m))
+	}
+}
+
+// Document 表示向量存储中的一条文档
+type Document struct {
+	ID        string                 `json:"id"`
+	Content   string                 `json:"content"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Embedding []float64              `json:"embedding,omitempty"` // 为空时由存储的嵌入函数生成
+}
+
+// cloneDocument 复制文档的向量和元数据，存储与调用方之间传递文档时使用，
+// 避免调用方原地修改向量或元数据时破坏索引或与过滤读取产生数据竞争
+func cloneDocument(doc Document) Document {
+	doc.Embedding = slices.Clone(doc.Embedding)
+	doc.Metadata = maps.Clone(doc.Metadata)
+	return doc
+}
+
+// cloneResults 复制检索结果中的文档
+func cloneResults(results []SearchResult) []SearchResult {
+	for i := range results {
+		results[i].Document = cloneDocument(results[i].Document)
+	}
+	return results
+}
+
+// SearchResult 表示一条检索结果
+type SearchResult struct {
+	Document
+	Score float64 `json:"score"` // 相似度得分，越大越相似
+}
+
+// MetadataFilter 按元数据过滤文档，每个键的值必须相等
+// 值为切片时表示匹配其中任意一个
+type MetadataFilter map[string]interface{}
+
+// Match 判断元数据是否满足过滤条件
+func (f MetadataFilter) Match(metadata map[string]interface{}) bool {
+	for key, want := range f {
+		got, exists := metadata[key]
+		if !exists {
+			return false
+		}
+
+		rv := reflect.ValueOf(want)
+		if rv.Kind() == reflect.Slice {
+			matched := false
+			for i := 0; i < rv.Len(); i++ {
+				if metadataEqual(got, rv.Index(i).Interface()) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+
+		if !metadataEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataEqual 比较元数据值，数字按数值比较以兼容JSON解码后的float64
+func metadataEqual(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toFloat 将数值类型转换为float64
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// VectorStore 表示向量存储接口
+type VectorStore interface {
+	// 插入或更新文档，未提供嵌入向量的文档会自动嵌入
+	Upsert(ctx context.Context, docs ...Document) error
+
+	// 删除文档
+	Delete(ctx context.Context, ids ...string) error
+
+	// 嵌入查询文本并返回最相似的 k 条文档
+	Query(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error)
+
+	// 返回与向量最相似的 k 条文档
+	QueryVector(ctx context.Context, vector []float64, k int, filter MetadataFilter) ([]SearchResult, error)
+
+	// 返回文档数量
+	Len() int
+}
+
+// EmbeddingFunc 返回使用该嵌入器的嵌入函数
+func (e *LLMEmbedder) EmbeddingFunc() EmbeddingFuncFlot64 {
+	return func(ctx context.Context, text string) ([]float64, error) {
+		return e.Embed(ctx, text)
+	}
+}
+
+// Float64 将float32嵌入函数转换为float64嵌入函数
+func (f EmbeddingFuncFlot32) Float64() EmbeddingFuncFlot64 {
+	return func(ctx context.Context, text string) ([]float64, error) {
+		embedding, err := f(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		return vecmath.ToFloat64(nil, embedding), nil
+	}
+}
+
+// similarity 按指定方式计算两个向量的相似度
+func similarity(metric SimilarityMetric, a, b []float64) float64 {
+	switch metric {
+	case DotProductSimilarity:
+		return vecmath.Dot(a, b)
+	case EuclideanSimilarity:
+		return -vecmath.Euclidean(a, b)
+	default:
+		return vecmath.Cosine(a, b)
+	}
+}
+
+// resultHeap 是按得分排序的最小堆，用于保留 top-k 结果
+type resultHeap []SearchResult
+
+func (h resultHeap) Len() int            { return len(h) }
+func (h resultHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h resultHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x interface{}) { *h = append(*h, x.(SearchResult)) }
+func (h *resultHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// topK 维护得分最高的 k 条结果
+type topK struct {
+	k int
+	h resultHeap
+}
+
+// push 加入一条候选结果
+func (t *topK) push(result SearchResult) {
+	if len(t.h) < t.k {
+		heap.Push(&t.h, result)
+	} else if result.Score > t.h[0].Score {
+		t.h[0] = result
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// sorted 返回按得分从高到低排序的结果
+func (t *topK) sorted() []SearchResult {
+	results := make([]SearchResult, len(t.h))
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(&t.h).(SearchResult)
+	}
+	return results
+}
+
+// embedDocuments 为未提供嵌入向量的文档生成向量，并校验维度
+func embedDocuments(ctx context.Context, embed EmbeddingFuncFlot64, dimensions int, docs []Document) ([]Document, error) {
+	embedded := make([]Document, len(docs))
+	for i, doc := range docs {
+		if doc.ID == "" {
+			return nil, fmt.Errorf("%w: document id cannot be empty", ErrInvalidRequest)
+		}
+		// 复制调用方的向量和元数据，避免之后修改影响存储中的文档
+		doc = cloneDocument(doc)
+		if len(doc.Embedding) == 0 {
+			if embed == nil {
+				return nil, ErrNoEmbedder
+			}
+			embedding, err := embed(ctx, doc.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to embed document %s: %w", doc.ID, err)
+			}
+			doc.Embedding = embedding
+		}
+		if dimensions == 0 {
+			dimensions = len(doc.Embedding)
+		}
+		if len(doc.Embedding) != dimensions {
+			return nil, fmt.Errorf("%w: document %s has %d dimensions, expected %d",
+				ErrDimensionMismatch, doc.ID, len(doc.Embedding), dimensions)
+		}
+		embedded[i] = doc
+	}
+	return embedded, nil
+}
+
+// MemoryVectorStore 是基于内存暴力搜索的向量存储
+type MemoryVectorStore struct {
+	embed      EmbeddingFuncFlot64
+	metric     SimilarityMetric
+	dimensions int
+	docs       map[string]Document
+	mu         sync.RWMutex
+}
+
+// NewMemoryVectorStore 创建一个新的内存向量存储
+// embed 用于嵌入文档和查询，可以是 LLMEmbedder.EmbeddingFunc() 或 EmbeddingFuncFlot32.Float64()，
+// 为空时只能使用带嵌入向量的文档和 QueryVector
+func NewMemoryVectorStore(embed EmbeddingFuncFlot64, metric SimilarityMetric) *MemoryVectorStore {
+	return &MemoryVectorStore{
+		embed:  embed,
+		metric: metric,
+		docs:   make(map[string]Document),
+	}
+}
+
+// Dimensions 返回存储中向量的维度，尚无文档时为0
+func (s *MemoryVectorStore) Dimensions() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dimensions
+}
+
+// Upsert 插入或更新文档
+func (s *MemoryVectorStore) Upsert(ctx context.Context, docs ...Document) error {
+	embedded, err := embedDocuments(ctx, s.embed, s.Dimensions(), docs)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 先校验整批文档再写入，任何一个文档不合法时存储保持不变
+	dimensions := s.dimensions
+	if dimensions == 0 && len(embedded) > 0 {
+		dimensions = len(embedded[0].Embedding)
+	}
+	for _, doc := range embedded {
+		if len(doc.Embedding) != dimensions {
+			return fmt.Errorf("%w: document %s has %d dimensions, expected %d",
+				ErrDimensionMismatch, doc.ID, len(doc.Embedding), dimensions)
+		}
+	}
+	s.dimensions = dimensions
+	for _, doc := range embedded {
+		s.docs[doc.ID] = doc
+	}
+	return nil
+}
+
+// Delete 删除文档
+func (s *MemoryVectorStore) Delete(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.docs, id)
+	}
+	return nil
+}
+
+// Get 获取指定ID的文档，返回的向量和元数据是副本
+func (s *MemoryVectorStore) Get(id string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, exists := s.docs[id]
+	return cloneDocument(doc), exists
+}
+
+// Len 返回文档数量
+func (s *MemoryVectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.docs)
+}
+
+// Query 嵌入查询文本并返回最相似的 k 条文档
+func (s *MemoryVectorStore) Query(ctx context.Context, query string, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if s.embed == nil {
+		return nil, ErrNoEmbedder
+	}
+	vector, err := s.embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return s.QueryVector(ctx, vector, k, filter)
+}
+
+// QueryVector 返回与向量最相似的 k 条文档，结果中的向量和元数据是副本
+func (s *MemoryVectorStore) QueryVector(ctx context.Context, vector []float64, k int, filter MetadataFilter) ([]SearchResult, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: k must be positive", ErrInvalidRequest)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.dimensions != 0 && len(vector) != s.dimensions {
+		return nil, fmt.Errorf("%w: query has %d dimensions, expected %d", ErrDimensionMismatch, len(vector), s.dimensions)
+	}
+
+	top := &topK{k: k}
+	for _, doc := range s.docs {
+		if len(filter) > 0 && !filter.Match(doc.Metadata) {
+			continue
+		}
+		top.push(SearchResult{Document: doc, Score: similarity(s.metric, vector, doc.Embedding)})
+	}
+
+	return cloneResults(top.sorted()), nil
+}
@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+// keywordEmbedding 根据关键词生成确定性的测试向量
+func keywordEmbedding(ctx context.Context, text string) ([]float64, error) {
+	vectors := map[string][]float64{
+		"cat":    {1, 0, 0},
+		"kitten": {0.9, 0.1, 0},
+		"dog":    {0, 1, 0},
+		"car":    {0, 0, 1},
+	}
+	if v, ok := vectors[text]; ok {
+		return v, nil
+	}
+	return nil, errors.New("unknown text")
+}
+
+func TestMemoryVectorStoreQuery(t *testing.T) {
+	store := NewMemoryVectorStore(keywordEmbedding, CosineSimilarity)
+	ctx := context.Background()
+
+	err := store.Upsert(ctx,
+		Document{ID: "1", Content: "cat", Metadata: map[string]interface{}{"kind": "animal", "legs": 4}},
+		Document{ID: "2", Content: "kitten", Metadata: map[string]interface{}{"kind": "animal", "legs": 4}},
+		Document{ID: "3", Content: "dog", Metadata: map[string]interface{}{"kind": "animal", "legs": 4}},
+		Document{ID: "4", Content: "car", Metadata: map[string]interface{}{"kind": "vehicle"}},
+	)
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	results, err := store.Query(ctx, "cat", 2, nil)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "1" || results[1].ID != "2" {
+		t.Fatalf("Query() = %+v, want documents 1 and 2", results)
+	}
+	if math.Abs(results[0].Score-1) > 1e-9 {
+		t.Errorf("Query() top score = %v, want 1", results[0].Score)
+	}
+
+	results, err = store.Query(ctx, "cat", 10, MetadataFilter{"kind": "vehicle"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "4" {
+		t.Errorf("Query() with filter = %+v, want document 4", results)
+	}
+
+	results, _ = store.Query(ctx, "cat", 10, MetadataFilter{"legs": float64(4), "kind": []string{"animal", "plant"}})
+	if len(results) != 3 {
+		t.Errorf("Query() with numeric and list filter returned %d results, want 3", len(results))
+	}
+
+	if err := store.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	results, _ = store.Query(ctx, "cat", 1, nil)
+	if len(results) != 1 || results[0].ID != "2" {
+		t.Errorf("Query() after delete = %+v, want document 2", results)
+	}
+	if store.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", store.Len())
+	}
+}
+
+func TestMemoryVectorStoreMetrics(t *testing.T) {
+	ctx := context.Background()
+	docs := []Document{
+		{ID: "short", Embedding: []float64{1, 0}},
+		{ID: "long", Embedding: []float64{3, 3}},
+	}
+
+	tests := []struct {
+		metric SimilarityMetric
+		want   string
+	}{
+		{CosineSimilarity, "short"},
+		{DotProductSimilarity, "long"},
+		{EuclideanSimilarity, "short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric.String(), func(t *testing.T) {
+			store := NewMemoryVectorStore(nil, tt.metric)
+			if err := store.Upsert(ctx, docs...); err != nil {
+				t.Fatalf("Upsert() error = %v", err)
+			}
+			results, err := store.QueryVector(ctx, []float64{1, 0.1}, 1, nil)
+			if err != nil {
+				t.Fatalf("QueryVector() error = %v", err)
+			}
+			if results[0].ID != tt.want {
+				t.Errorf("QueryVector() = %s, want %s", results[0].ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryVectorStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+
+	if err := store.Upsert(ctx, Document{ID: "1", Content: "text"}); !errors.Is(err, ErrNoEmbedder) {
+		t.Errorf("Upsert() without embedder error = %v, want ErrNoEmbedder", err)
+	}
+	if _, err := store.Query(ctx, "text", 1, nil); !errors.Is(err, ErrNoEmbedder) {
+		t.Errorf("Query() without embedder error = %v, want ErrNoEmbedder", err)
+	}
+	if err := store.Upsert(ctx, Document{ID: "1", Embedding: []float64{1, 2}}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := store.Upsert(ctx, Document{ID: "2", Embedding: []float64{1, 2, 3}}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Upsert() with wrong dimension error = %v, want ErrDimensionMismatch", err)
+	}
+	if _, err := store.QueryVector(ctx, []float64{1}, 1, nil); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("QueryVector() with wrong dimension error = %v, want ErrDimensionMismatch", err)
+	}
+
+	// 一批中有不合法的文档时整批都不写入
+	err := store.Upsert(ctx, Document{ID: "3", Embedding: []float64{3, 4}}, Document{ID: "4", Embedding: []float64{1}})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Upsert() with mixed dimensions error = %v, want ErrDimensionMismatch", err)
+	}
+	if _, ok := store.Get("3"); ok || store.Len() != 1 {
+		t.Errorf("Upsert() with invalid batch stored documents, Len() = %d", store.Len())
+	}
+
+	// 存储保存向量的副本，调用方修改切片不影响已存储的文档
+	embedding := []float64{5, 6}
+	if err := store.Upsert(ctx, Document{ID: "5", Embedding: embedding}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	embedding[0] = 0
+	if doc, _ := store.Get("5"); doc.Embedding[0] != 5 {
+		t.Errorf("stored embedding = %v, want [5 6]", doc.Embedding)
+	}
+}
+
+func TestVectorStoreCopies(t *testing.T) {
+	ctx := context.Background()
+	stores := []struct {
+		name  string
+		store VectorStore
+	}{
+		{"memory", NewMemoryVectorStore(nil, CosineSimilarity)},
+		{"hnsw", NewHNSWVectorStore(nil, DefaultHNSWConfig())},
+	}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			// 调用方修改写入的向量和元数据不影响已存储的文档
+			embedding := []float64{1, 0}
+			metadata := map[string]interface{}{"lang": "go"}
+			if err := tt.store.Upsert(ctx, Document{ID: "a", Embedding: embedding, Metadata: metadata}); err != nil {
+				t.Fatalf("Upsert() error = %v", err)
+			}
+			embedding[0] = -1
+			metadata["lang"] = "rust"
+
+			// 修改检索结果同样不影响存储
+			results, err := tt.store.QueryVector(ctx, []float64{1, 0}, 1, MetadataFilter{"lang": "go"})
+			if err != nil || len(results) != 1 {
+				t.Fatalf("QueryVector() = %v, %v, want the stored document", results, err)
+			}
+			results[0].Embedding[0] = 42
+			results[0].Metadata["lang"] = "python"
+
+			results, err = tt.store.QueryVector(ctx, []float64{1, 0}, 1, MetadataFilter{"lang": "go"})
+			if err != nil || len(results) != 1 {
+				t.Fatalf("QueryVector() after edits = %v, %v, want the stored document", results, err)
+			}
+			if results[0].Embedding[0] != 1 || results[0].Metadata["lang"] != "go" {
+				t.Errorf("stored document = %+v, want the original embedding and metadata", results[0].Document)
+			}
+		})
+	}
+
+	store := NewMemoryVectorStore(nil, CosineSimilarity)
+	_ = store.Upsert(ctx, Document{ID: "a", Embedding: []float64{1, 0}, Metadata: map[string]interface{}{"lang": "go"}})
+	doc, _ := store.Get("a")
+	doc.Metadata["lang"] = "rust"
+	if doc, _ := store.Get("a"); doc.Metadata["lang"] != "go" {
+		t.Errorf("Get() metadata after edit = %v, want a copy", doc.Metadata)
+	}
+
+	index := NewBM25Index()
+	_ = index.Upsert(ctx, Document{ID: "a", Content: "go code", Metadata: map[string]interface{}{"lang": "go"}})
+	results, _ := index.Search(ctx, "go", 1, nil)
+	results[0].Metadata["lang"] = "rust"
+	if results, _ := index.Search(ctx, "go", 1, MetadataFilter{"lang": "go"}); len(results) != 1 {
+		t.Error("editing a BM25 result changed the indexed metadata")
+	}
+}
+
+func TestVectorStoreWithEmbedders(t *testing.T) {
+	ctx := context.Background()
+
+	mockSvc := &mockService{
+		embedFunc: func(ctx context.Context, provider, model string, request EmbeddingRequest) (EmbeddingResponse, error) {
+			embedding, err := keywordEmbedding(ctx, request.Input)
+			return EmbeddingResponse{Embedding: embedding}, err
+		},
+	}
+	embedder := NewLLMEmbedder(mockSvc, "test-provider", "test-model", 3)
+
+	var float32Func EmbeddingFuncFlot32 = func(ctx context.Context, text string) ([]float32, error) {
+		embedding, err := keywordEmbedding(ctx, text)
+		result := make([]float32, len(embedding))
+		for i, v := range embedding {
+			result[i] = float32(v)
+		}
+		return result, err
+	}
+
+	for name, embed := range map[string]EmbeddingFuncFlot64{
+		"llm embedder": embedder.EmbeddingFunc(),
+		"float32 func": float32Func.Float64(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := NewMemoryVectorStore(embed, CosineSimilarity)
+			if err := store.Upsert(ctx, Document{ID: "a", Content: "dog"}, Document{ID: "b", Content: "car"}); err != nil {
+				t.Fatalf("Upsert() error = %v", err)
+			}
+			results, err := store.Query(ctx, "car", 1, nil)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if results[0].ID != "b" {
+				t.Errorf("Query() = %s, want b", results[0].ID)
+			}
+		})
+	}
+}
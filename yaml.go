@@ -0,0 +1,314 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine 是去掉注释和缩进后的一行 YAML
+type yamlLine struct {
+	num    int // 行号，从 1 开始
+	indent int
+	text   string
+}
+
+// yamlParser 是配置文件使用的 YAML 子集解析器，支持块映射、块序列、注释、引号字符串以及
+// 单行的 [a, b] 和 {} 写法，不支持多文档、锚点、标签和多行字符串。
+// 解析结果与 encoding/json 使用 UseNumber 解码的结果类型一致：map[string]any、[]any、string、bool、json.Number 和 nil
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML 解析 YAML 文档
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed in indentation", i+1)
+		}
+		if len(lines) == 0 && text == "---" {
+			continue
+		}
+		if text == "---" || text == "..." {
+			return nil, fmt.Errorf("yaml: line %d: multiple documents are not supported", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	value, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected content", p.lines[p.pos].num)
+	}
+	return value, nil
+}
+
+// stripYAMLComment 去掉引号外以 # 开头的注释
+// 引号只有出现在标量开头（行首或 :、-、[、{、, 之后）时才开始一个引号字符串，o'brien 这样的普通标量中的引号不算
+func stripYAMLComment(line string) string {
+	var quote byte
+	var prev byte // 引号外上一个非空白字符
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == '\'' && quote == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+				i++ // 单引号字符串中的 '' 表示一个单引号
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && strings.IndexByte("\x00:-[{,", prev) >= 0:
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+		if quote == 0 && c != ' ' && c != '\t' {
+			prev = c
+		}
+	}
+	return line
+}
+
+// parseBlock 解析从当前行开始、缩进为 indent 的映射或序列
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// parseMapping 解析缩进为 indent 的块映射
+func (p *yamlParser) parseMapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+		}
+		if isYAMLSequenceItem(line.text) {
+			return nil, fmt.Errorf("yaml: line %d: expected a mapping key, found a sequence item", line.num)
+		}
+		key, rest, ok, err := splitYAMLKey(line.text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: %w", line.num, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected \"key: value\"", line.num)
+		}
+		if _, exists := m[key]; exists {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+
+		value, err := p.parseValue(indent, rest, line.num, true)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// parseSequence 解析缩进为 indent 的块序列
+func (p *yamlParser) parseSequence(indent int) ([]any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && !isYAMLSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if _, _, ok, _ := splitYAMLKey(rest); ok {
+			// "- key: value" 开始一个映射，后续的键与第一个键对齐
+			itemIndent := indent + len(line.text) - len(rest)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: itemIndent, text: rest}
+			item, err := p.parseMapping(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		p.pos++
+		item, err := p.parseValue(indent, rest, line.num, false)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseValue 解析 "key:" 或 "- " 之后的值，值为空时解析下一行开始的嵌套块。
+// YAML 允许映射的值是与键缩进相同的序列，inMapping 表示当前是否在解析映射的值
+func (p *yamlParser) parseValue(indent int, rest string, num int, inMapping bool) (any, error) {
+	if rest != "" {
+		return parseYAMLScalar(rest, num)
+	}
+	if p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		if next.indent > indent {
+			return p.parseBlock(next.indent)
+		}
+		if inMapping && next.indent == indent && isYAMLSequenceItem(next.text) {
+			return p.parseSequence(indent)
+		}
+	}
+	return nil, nil
+}
+
+// isYAMLSequenceItem 判断一行是否是序列项
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey 把 "key: value" 拆分为键和值，不是映射项时 ok 为 false
+func splitYAMLKey(text string) (key, rest string, ok bool, err error) {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false, fmt.Errorf("unterminated quoted string")
+		}
+		after := text[end+1:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		value, err := parseYAMLScalar(text[:end+1], 0)
+		if err != nil {
+			return "", "", false, err
+		}
+		return value.(string), strings.TrimSpace(after[1:]), true, nil
+	}
+
+	if text != "" && (text[0] == '[' || text[0] == '{') {
+		return "", "", false, nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false, nil
+		}
+		i = len(text) - 1
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true, nil
+}
+
+// closingQuote 返回以引号开头的字符串中对应的结束引号位置，没有时返回 -1
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLScalar 解析单行的值
+func parseYAMLScalar(text string, num int) (any, error) {
+	switch text[0] {
+	case '"', '\'':
+		end := closingQuote(text)
+		if end != len(text)-1 {
+			return nil, fmt.Errorf("yaml: line %d: invalid quoted string %s", num, text)
+		}
+		if text[0] == '\'' {
+			return strings.ReplaceAll(text[1:end], "''", "'"), nil
+		}
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid quoted string %s", num, text)
+		}
+		return s, nil
+	case '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated flow sequence", num)
+		}
+		items := []any{}
+		for _, part := range splitFlowItems(text[1 : len(text)-1]) {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			item, err := parseYAMLScalar(part, num)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case '{':
+		if text != "{}" && (len(text) < 2 || !strings.HasSuffix(text, "}") || strings.TrimSpace(text[1:len(text)-1]) != "") {
+			return nil, fmt.Errorf("yaml: line %d: only empty flow mappings {} are supported", num)
+		}
+		return map[string]any{}, nil
+	case '&', '*', '!', '|', '>':
+		return nil, fmt.Errorf("yaml: line %d: anchors, tags and block scalars are not supported", num)
+	}
+
+	switch text {
+	case "null", "~":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	var number float64
+	if json.Unmarshal([]byte(text), &number) == nil {
+		return json.Number(text), nil
+	}
+	return text, nil
+}
+
+// splitFlowItems 按引号外的逗号拆分 [a, b] 的内容
+func splitFlowItems(text string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+	}{
+		{
+			name: "nested mappings and scalars",
+			input: `
+# comment
+providers:
+  local:
+    type: ollama   # trailing comment
+    endpoint: "http://localhost:11434"
+    timeout: 30s
+    enabled: true
+    weight: 1.5
+    missing: ~
+    label: 'it''s #1'
+`,
+			want: map[string]any{"providers": map[string]any{"local": map[string]any{
+				"type":     "ollama",
+				"endpoint": "http://localhost:11434",
+				"timeout":  "30s",
+				"enabled":  true,
+				"weight":   json.Number("1.5"),
+				"missing":  nil,
+				"label":    "it's #1",
+			}}},
+		},
+		{
+			name: "sequences",
+			input: `---
+tags: [a, "b, c", 3]
+rules:
+- name: first
+  max: 10
+-   name: second
+    when:
+      - images
+      - tools
+empty: []
+none: {}
+`,
+			want: map[string]any{
+				"tags": []any{"a", "b, c", json.Number("3")},
+				"rules": []any{
+					map[string]any{"name": "first", "max": json.Number("10")},
+					map[string]any{"name": "second", "when": []any{"images", "tools"}},
+				},
+				"empty": []any{},
+				"none":  map[string]any{},
+			},
+		},
+		{
+			name: "quotes inside plain scalars",
+			input: `
+headers:
+  X-Team: o'brien # team header
+  X-Note: say "hi" # greeting
+  X-Quoted: 'a # b' # quoted
+`,
+			want: map[string]any{"headers": map[string]any{
+				"X-Team":   "o'brien",
+				"X-Note":   `say "hi"`,
+				"X-Quoted": "a # b",
+			}},
+		},
+		{
+			name:  "top-level sequence",
+			input: "- one\n- two: 2\n",
+			want:  []any{"one", map[string]any{"two": json.Number("2")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parseYAML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"bad indentation", "a:\n  b: 1\n    c: 2\n", "line 3: unexpected indentation"},
+		{"duplicate key", "a: 1\na: 2\n", "line 2: duplicate key"},
+		{"not a mapping", "a: 1\njust text\n", "line 2: expected \"key: value\""},
+		{"tabs", "a:\n\tb: 1\n", "line 2: tabs"},
+		{"unterminated string", "a: \"open\n", "line 1: invalid quoted string"},
+		{"block scalar", "a: |\n  text\n", "line 1: anchors, tags and block scalars"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseYAML() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}